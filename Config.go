@@ -1,5 +1,10 @@
 package datastoreadapter
 
+import (
+	"context"
+	"time"
+)
+
 type Config struct {
 	// Datastore kind name.
 	// Optional. (Default: "casbin")
@@ -7,5 +12,233 @@ type Config struct {
 	// Datastore namespace.
 	// Optional. (Default: "")
 	Namespace string
+	// ReadOnly makes every mutating operation fail with ErrReadOnly.
+	// Optional. (Default: false)
+	ReadOnly bool
+	// Number of entities fetched per page by paginated operations.
+	// Optional. (Default and maximum: 500)
+	PageSize int
+	// Number of concurrent queries LoadPolicy runs, one per ptype.
+	// Optional. (Default: 1)
+	LoadWorkers int
+	// Lease duration of the policy lock SavePolicy holds while it replaces the
+	// stored rules; see Adapter.AcquireLock. Zero disables the lock.
+	// Optional. (Default: 0)
+	LockTTL time.Duration
+	// Deduplicate makes AddPolicy skip rules which are already stored.
+	// The lookup needs a composite index on p_type and v0 to v5 with the
+	// ancestor; see RequiredIndexes.
+	// Optional. (Default: false)
+	Deduplicate bool
+	// Tracer which starts a span for each operation.
+	// Optional. (Default: nil)
+	Tracer Tracer
+	// Collector of per-operation metrics.
+	// Optional. (Default: nil)
+	Metrics MetricsCollector
+	// Logger of operations and recovered failures.
+	// Optional. (Default: nil)
+	Logger Logger
+	// Interceptors wrapping every operation, the first of which is the
+	// outermost.
+	// Optional. (Default: nil)
+	Interceptors []Interceptor
+	// Audit makes every mutation of the policy write an AuditEntry to the
+	// kind suffixed with "_audit"; see Adapter.ListAuditEntries.
+	// Optional. (Default: false)
+	Audit bool
+	// SoftDelete makes RemovePolicy and RemoveFilteredPolicy mark rules as
+	// deleted instead of deleting them; see Adapter.PurgeDeletedPolicies.
+	// Optional. (Default: false)
+	SoftDelete bool
+	// Name of the model definition SaveModel and LoadModel store and load,
+	// so that several of them can coexist under the same kind and namespace.
+	// CleanupPolicies also uses it to find the defined ptypes.
+	// Optional. (Default: "", the unnamed model)
+	ModelName string
+	// IndexFallback makes LoadPolicy, LoadFilteredPolicy and
+	// RemoveFilteredPolicy fall back to a query the built-in indexes serve,
+	// filtering the rules in memory, when their composite index is missing.
+	// The Logger is warned of the index to create; see RequiredIndexes.
+	// Optional. (Default: false)
+	IndexFallback bool
+	// KeyEncrypter encrypting the data key which encrypts the rule values
+	// v0 to v5, e.g. with Cloud KMS. Values stored before it was set are
+	// loaded as they are until the policy is saved again. The values of the
+	// audit entries, of the events of the Notifiers and of the snapshots of
+	// CacheConfig.Shared are encrypted as well.
+	// Optional. (Default: nil, values are stored in plaintext)
+	KeyEncrypter KeyEncrypter
+	// ValueTransformer applied to the rule values before they are stored or
+	// matched, e.g. HMACTransformer to keep PII out of datastore.
+	// Optional. (Default: nil)
+	ValueTransformer ValueTransformer
+	// Codec encoding the rule values to the stored strings, applied after
+	// ValueTransformer and before the encryption with KeyEncrypter.
+	// Optional. (Default: nil)
+	Codec Codec
+	// Kinds maps ptypes, or the sections "p" and "g", to the kinds their rules
+	// are stored in, e.g. {"g": "casbin_groups"}. A ptype is looked up before
+	// its section. The other rules, the policy version and the other entities
+	// of the adapter are stored in Kind.
+	// Optional. (Default: nil)
+	Kinds map[string]string
+	// EntityMapper mapping the rules to the entities of an existing schema.
+	// Optional. (Default: nil, rules are stored as CasbinRule)
+	EntityMapper EntityMapper
+	// DefaultTimeout bounds every operation whose context has no deadline,
+	// such as the ones casbin calls without a context, so that a hung
+	// datastore call doesn't block e.g. the startup of an enforcer forever.
+	// Long-running operations, such as ScanPolicy, need a context with a
+	// deadline of their own to outlast it.
+	// Optional. (Default: 0, no timeout)
+	DefaultTimeout time.Duration
+	// SerializeWrites makes the writes of the same rule by the adapter wait
+	// for each other, so that e.g. an AddPolicy and a RemovePolicy of a rule
+	// called from different goroutines can't interleave. The writes of many
+	// rules, such as SavePolicy, RemoveFilteredPolicy and the imports, wait
+	// for all the others. Writes by other processes are not serialized.
+	// Optional. (Default: false)
+	SerializeWrites bool
+	// RateLimit is the number of datastore calls per second the paginated
+	// reads and the transactions of the adapter are throttled to, so that
+	// bulk operations such as SavePolicy and the migrations don't exhaust the
+	// quota shared with the rest of the application.
+	// Optional. (Default: 0, unlimited)
+	RateLimit float64
+	// RateBurst is the number of calls allowed at once above RateLimit.
+	// Optional. (Default: RateLimit, at least 1)
+	RateBurst int
+	// MaxConcurrentRPCs is the number of the throttled calls which can run
+	// at once, e.g. by the workers of Config.LoadWorkers.
+	// Optional. (Default: 0, unlimited)
+	MaxConcurrentRPCs int
+	// IdempotencyTTL is how long the idempotency keys set with
+	// WithIdempotencyKey are recorded, which should outlast the retries of
+	// the jobs using them.
+	// Optional. (Default: 24 hours)
+	IdempotencyTTL time.Duration
+	// ConsistentLoad makes LoadPolicy and LoadFilteredPolicy, including those
+	// of CachedAdapter, read all the pages of rules in a read-only
+	// transaction, so that a load running along with a SavePolicy in pages or
+	// another batch of mutations never feeds the model a torn policy. The
+	// load has to complete within the transaction lifetime of datastore.
+	// Optional. (Default: false)
+	ConsistentLoad bool
+	// BlueGreen makes SavePolicy write the rules to an inactive slot and then
+	// switch the active slot to it in a single transaction, instead of
+	// replacing the rules in place, so that even the policies too large for
+	// a transaction are never seen partially saved. The rules of the previous
+	// slot are kept until the next SavePolicy, so that RollbackPolicy can
+	// switch back to them at once. The adapter reads the active slot along
+	// with the policy version, and its writes fail with ErrConflict once
+	// another writer has switched slots, until the policy is loaded again.
+	// Optional. (Default: false)
+	BlueGreen bool
+	// IncrementalSave makes SavePolicy compare the model with the stored
+	// rules and only delete and write the rules which differ, instead of
+	// replacing all of them, so that saving a large policy after a few
+	// changes takes a few mutations. The rules kept are not rewritten, so
+	// they keep their metadata. It is ignored along with BlueGreen.
+	// Optional. (Default: false)
+	IncrementalSave bool
+	// CaseFolding stores the lowercased values v0 to v5 of the rules along
+	// with them, so that the filters of Filter.IgnoreCase and WithIgnoreCase
+	// are served by an index instead of a scan. Only the rules written while
+	// it is set are stored so; rewrite the others, e.g. with
+	// ImportPolicyCSV, before relying on it. It is ignored along with codecs
+	// such as ValueTransformer, whose stored values don't fold as the values
+	// do, so that the filters ignoring case scan the rules then.
+	// Optional. (Default: false)
+	CaseFolding bool
+	// Shards spreads the rules of each kind over as many kinds, named after
+	// it with "_shard1", "_shard2" and so on, by the hash of their values, so
+	// that the rules of very large policies are split into smaller entity
+	// groups. The loads and the filtered queries fan out over the shards,
+	// while the writes and removals of a rule go to its shard only. It
+	// doesn't relieve the contention of concurrent writes: each of them
+	// still increments the single policy version in its transaction.
+	// Changing it requires moving the stored rules to their new shards,
+	// e.g. with ExportPolicyCSV and ImportPolicyCSV.
+	// Optional. (Default: 1, no sharding)
+	Shards int
+	// CircuitBreakerErrorRate is the rate of operations failed by datastore,
+	// e.g. as unavailable or timed out, from 0 to 1, at which the adapter
+	// stops calling it for CircuitBreakerCooldown, so that a degraded
+	// backend doesn't make every autosave hang. The operations fail with
+	// ErrCircuitOpen meanwhile, after which a single operation probes the
+	// backend, closing the breaker if it succeeds. Conflicts, locks and
+	// canceled contexts are not counted as failures.
+	// Optional. (Default: 0, no circuit breaker)
+	CircuitBreakerErrorRate float64
+	// CircuitBreakerMinCalls is the number of operations of a window below
+	// which the breaker doesn't trip.
+	// Optional. (Default: 10)
+	CircuitBreakerMinCalls int
+	// CircuitBreakerWindow is the period the error rate is measured over.
+	// Optional. (Default: 1 minute)
+	CircuitBreakerWindow time.Duration
+	// CircuitBreakerCooldown is how long the breaker stays open before
+	// letting a probe through.
+	// Optional. (Default: 30 seconds)
+	CircuitBreakerCooldown time.Duration
+	// HedgeDelay hedges the page reads of LoadPolicy, including that of
+	// CachedAdapter: a page not returned within it is read again, and the
+	// first of the two reads to return is used, which trims the tail
+	// latency of the loads at startup at the cost of extra reads. Set it
+	// around the 95th percentile latency of a page read.
+	// Optional. (Default: 0, no hedging)
+	HedgeDelay time.Duration
+	// ContextExtractor derives the namespace, the actor and the request ID
+	// of each operation from its context, in place of WithNamespace,
+	// WithActor and WithRequestID.
+	// Optional. (Default: nil)
+	ContextExtractor ContextExtractor
+	// Clock tells the time the entities are stamped and expired with.
+	// Optional. (Default: nil, the system clock)
+	Clock Clock
+	// KeyGenerator returns the keys of the new rules, audit entries and
+	// snapshot rules.
+	// Optional. (Default: nil, keys completed by datastore)
+	KeyGenerator KeyGenerator
+	// Notifiers are notified of the operations which have modified the
+	// policy, once they succeed; see WebhookNotifier.
+	// Optional. (Default: nil)
+	Notifiers []Notifier
+	// SensitiveRules are the predicates of the rules OnSensitiveRule is
+	// called with once an operation adding them succeeds, e.g. to alert on
+	// wildcard grants.
+	// Optional. (Default: nil)
+	SensitiveRules []SensitiveRule
+	// OnSensitiveRule is called synchronously with each added rule matching
+	// SensitiveRules, and must not block.
+	// Optional. (Default: nil)
+	OnSensitiveRule func(context.Context, SensitiveRuleAlert)
+	// UnknownPType selects how the loads treat the stored rules whose ptype
+	// the model doesn't define; see also WithSkippedRules.
+	// Optional. (Default: UnknownPTypeSkip)
+	UnknownPType UnknownPTypeMode
+	// StrictArity makes the operations writing rules fail with ErrRuleArity
+	// before writing anything if a rule doesn't have as many values as the
+	// definition of its ptype in the model the adapter has last loaded or
+	// saved the policy of, or with ErrUnknownPType if the model doesn't
+	// define its ptype. Nothing is checked until a model has been loaded.
+	// Optional. (Default: false)
+	StrictArity bool
+	// QuarantineMalformed makes LoadPolicy and LoadFilteredPolicy skip the
+	// stored rules they can't load, instead of failing, and move them to the
+	// quarantine kind once loaded; see QuarantinedRule. These are the
+	// entities which don't fit CasbinRule, those whose values Config.Codec
+	// fail to decode, and those whose ptype the model doesn't define, unless
+	// UnknownPType is UnknownPTypeFail. Read-only adapters only skip them.
+	// Optional. (Default: false)
+	QuarantineMalformed bool
+	// ReverseIndex makes the adapter write, along with each rule, entities
+	// keyed by its subject and its object, its first and second values, so
+	// that LoadFilteredPolicy loads the rules of a single subject or object
+	// with a scan of their keys, which needs no composite index. It takes a
+	// third of the rules a transaction can write. Run RebuildReverseIndex
+	// once after setting it on a stored policy.
+	// Optional. (Default: false)
+	ReverseIndex bool
 }
-
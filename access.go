@@ -0,0 +1,86 @@
+package datastoreadapter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// accessProbeName is the key name of the entity ValidateAccess writes.
+const accessProbeName = "access_probe"
+
+// accessProbe is the entity ValidateAccess writes and deletes. It is a root
+// entity, so it isn't scanned along with the rules.
+type accessProbe struct {
+	CheckedAt time.Time `datastore:"checked_at,noindex"`
+}
+
+// AccessReport is the result of ValidateAccess. Each of Read, Write and
+// Delete is the error the access failed with, or nil if it is allowed.
+type AccessReport struct {
+	Kind      string
+	Namespace string
+	Read      error
+	Write     error
+	Delete    error
+	// Skipped is set if Write and Delete were not checked since the adapter
+	// is read-only.
+	Skipped bool
+}
+
+// Err returns an error listing the failed accesses, or nil if there is none.
+func (r *AccessReport) Err() error {
+	var failed []string
+	for _, check := range []struct {
+		name string
+		err  error
+	}{{"read", r.Read}, {"write", r.Write}, {"delete", r.Delete}} {
+		if check.err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v (%s)", check.name, check.err, ErrorCode(check.err)))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("no access to kind %q in namespace %q: %s", r.Kind, r.Namespace, strings.Join(failed, "; "))
+}
+
+func (a *Adapter) accessProbeKey() *datastore.Key {
+	key := datastore.NameKey(a.kind, accessProbeName, nil)
+	key.Namespace = a.namespace
+	return key
+}
+
+// ValidateAccess checks that the adapter can read, write and delete entities
+// of its kind and namespace, by reading, writing and deleting a probe entity,
+// so that IAM misconfigurations fail at startup rather than at the first
+// SavePolicy. A read-only adapter only checks reading.
+//
+// It returns the report of every check along with its Err, so that the
+// failed accesses can be logged at once.
+func (a *Adapter) ValidateAccess(ctx context.Context) (*AccessReport, error) {
+	report := &AccessReport{Kind: a.kind, Namespace: a.namespace}
+	err := a.do(ctx, "ValidateAccess", func(ctx context.Context) error {
+		var probe accessProbe
+		if err := a.db.Get(ctx, a.accessProbeKey(), &probe); err != nil && err != datastore.ErrNoSuchEntity {
+			report.Read = err
+		}
+		if a.readOnly {
+			report.Skipped = true
+			return report.Err()
+		}
+
+		probe.CheckedAt = a.now()
+		if _, err := a.db.Put(ctx, a.accessProbeKey(), &probe); err != nil {
+			report.Write = err
+		}
+		if err := a.db.Delete(ctx, a.accessProbeKey()); err != nil {
+			report.Delete = err
+		}
+		return report.Err()
+	})
+	return report, err
+}
@@ -0,0 +1,40 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+)
+
+func TestValidateAccess(t *testing.T) {
+	config := Config{Kind: "casbin_test_access", Namespace: "unittest"}
+	ctx := context.Background()
+	db := getDatastore()
+
+	report, err := NewAdapterWithConfig(db, config).ValidateAccess(ctx)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if report.Read != nil || report.Write != nil || report.Delete != nil || report.Skipped {
+		t.Errorf("got %+v, wants every access allowed", report)
+	}
+	a := NewAdapterWithConfig(db, config)
+	if err := db.Get(ctx, a.accessProbeKey(), &accessProbe{}); err != datastore.ErrNoSuchEntity {
+		t.Errorf("got %v, wants the probe deleted", err)
+	}
+
+	config.ReadOnly = true
+	report, err = NewAdapterWithConfig(db, config).ValidateAccess(ctx)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if !report.Skipped {
+		t.Errorf("got %+v, wants write and delete skipped", report)
+	}
+
+	report = &AccessReport{Kind: "casbin", Write: ErrReadOnly}
+	if report.Err() == nil {
+		t.Error("got no error, wants the failed write")
+	}
+}
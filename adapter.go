@@ -2,8 +2,10 @@ package datastoreadapter
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"runtime"
+	"sync"
+	"time"
 
 	"cloud.google.com/go/datastore"
 	"github.com/casbin/casbin/v2/model"
@@ -12,217 +14,715 @@ import (
 
 const casbinKind = "casbin"
 
-// CasbinRule represents a rule in Casbin.
+// CasbinRule represents a rule in Casbin. The firestore package stores it
+// under the same property names.
 type CasbinRule struct {
-	PType string `datastore:"p_type"`
-	V0    string `datastore:"v0"`
-	V1    string `datastore:"v1"`
-	V2    string `datastore:"v2"`
-	V3    string `datastore:"v3"`
-	V4    string `datastore:"v4"`
-	V5    string `datastore:"v5"`
+	PType string `datastore:"p_type" firestore:"p_type"`
+	V0    string `datastore:"v0" firestore:"v0"`
+	V1    string `datastore:"v1" firestore:"v1"`
+	V2    string `datastore:"v2" firestore:"v2"`
+	V3    string `datastore:"v3" firestore:"v3"`
+	V4    string `datastore:"v4" firestore:"v4"`
+	V5    string `datastore:"v5" firestore:"v5"`
+	// Extra holds the values of rules with more than six of them, after V5.
+	// They are not indexed, so the adapter matches them in memory.
+	Extra []string `datastore:"extra,noindex" firestore:"extra"`
+	// Tokens is the number of values of the rule, so that empty ones are
+	// loaded as well. Rules stored without it end at their first empty value.
+	Tokens int `datastore:"tokens,noindex" firestore:"tokens"`
+
+	// CreatedAt is the time the rule was first stored. SavePolicy preserves
+	// it for the rules which were already stored.
+	CreatedAt time.Time `datastore:"created_at" firestore:"created_at"`
+	// UpdatedAt is the time the rule was last modified.
+	UpdatedAt time.Time `datastore:"updated_at" firestore:"updated_at"`
+	// CreatedBy is the actor, set with WithActor, which first stored the rule.
+	CreatedBy string `datastore:"created_by" firestore:"created_by"`
+	// ExpiresAt is the time after which the rule is no longer loaded, or
+	// zero if it never expires; see Adapter.AddPolicyWithExpiry.
+	ExpiresAt time.Time `datastore:"expires_at" firestore:"expires_at"`
+	// DeletedAt is the time the rule was soft deleted, or zero if it is live;
+	// see Config.SoftDelete.
+	DeletedAt time.Time `datastore:"deleted_at" firestore:"deleted_at"`
+	// DeletedBy is the actor, set with WithActor, which soft deleted the rule.
+	DeletedBy string `datastore:"deleted_by" firestore:"deleted_by"`
+	// Folded holds the lowercased values V0 to V5, each prefixed with its
+	// position, e.g. "0:alice", so that the filters of Filter.IgnoreCase
+	// can match them; see Config.CaseFolding.
+	Folded []string `datastore:"folded" firestore:"-"`
 }
 
-// adapter represents the GCP datastore adapter for policy storage.
-type adapter struct {
+// Adapter represents the GCP datastore adapter for policy storage.
+type Adapter struct {
 	db        *datastore.Client
 	kind      string
 	namespace string
+	readOnly  bool
+	pageSize  int
+
+	loadWorkers int
+	lockTTL     time.Duration
+	deduplicate bool
+	tracer      Tracer
+	metrics     MetricsCollector
+	logger      Logger
+
+	interceptors  []Interceptor
+	auditing      bool
+	softDelete    bool
+	modelName     string
+	indexFallback bool
+	keyEncrypter  KeyEncrypter
+	codecs        []Codec
+	kinds         map[string]string
+	mapper        EntityMapper
+	extractor     ContextExtractor
+	clock         Clock
+	keyGenerator  KeyGenerator
+	notifiers     []Notifier
+
+	sensitiveRules  []SensitiveRule
+	onSensitiveRule func(context.Context, SensitiveRuleAlert)
+	unknownPType    UnknownPTypeMode
+	strictArity     bool
+
+	quarantineMalformed bool
+	reverseIndex        bool
+
+	defaultTimeout time.Duration
+	// ruleLocks serializes the writes of the same rule, or is nil if
+	// Config.SerializeWrites is not set.
+	ruleLocks *ruleLocks
+	// limiter throttles the datastore calls of the bulk operations, and is
+	// shared by the adapters ForNamespace returns.
+	limiter *rateLimiter
+	// breaker fails the operations fast while datastore is degraded, and is
+	// shared by the adapters ForNamespace returns.
+	breaker *circuitBreaker
+
+	idempotencyTTL time.Duration
+	consistentLoad bool
+	hedgeDelay     time.Duration
+	blueGreen      bool
+	incremental    bool
+	caseFolding    bool
+	shards         int
+	// slot is the slot of Config.BlueGreen the rules are read from and
+	// written to, as last read from datastore.
+	slot int64
+
+	// namespaces holds the adapters ForNamespace returns, and is shared by
+	// all of them. owner closes db once none of them is reachable, if the
+	// adapter has been constructed by NewAdapterWithConfig.
+	namespaces *namespaceAdapters
+	owner      *clientOwner
+
+	// mu guards the policy version the loaded model reflects, whether the
+	// last load was a filtered one and the definitions of that model.
+	mu           sync.Mutex
+	version      int64
+	versionKnown bool
+	filtered     bool
+	// arity is the number of values of the rules of each ptype of the model
+	// last loaded or saved, if Config.StrictArity is set.
+	arity map[string]int
+
+	// keyMu guards the cipher of the rule values, which is set up on first
+	// use.
+	keyMu  sync.Mutex
+	cipher *valueCipher
 }
 
-// finalizer is the destructor for adapter.
-func finalizer(a *adapter) {
-	a.close()
+// clientOwner owns the datastore client of the adapters which close it when
+// released. The finalizer is set on it rather than on those adapters, which
+// reach each other through their shared namespaceAdapters: a finalizer isn't
+// guaranteed to run on an object in a reference cycle.
+type clientOwner struct {
+	db *datastore.Client
 }
 
-func (a *adapter) close() {
-	a.db.Close()
+// finalizer is the destructor for clientOwner.
+func finalizer(o *clientOwner) {
+	o.close()
+}
+
+func (o *clientOwner) close() {
+	o.db.Close()
 }
 
 // NewAdapter is the constructor for Adapter. A valid datastore client must be provided.
-func NewAdapter(db *datastore.Client) persist.Adapter {
-	return NewAdapterWithConfig(db, Config{casbinKind, ""})
+func NewAdapter(db *datastore.Client) *Adapter {
+	return NewAdapterWithConfig(db, Config{Kind: casbinKind, Namespace: ""})
 }
 
 // NewAdapter is the constructor for Adapter. A valid datastore client must be provided.
-func NewAdapterWithConfig(db *datastore.Client, config Config) persist.Adapter {
+func NewAdapterWithConfig(db *datastore.Client, config Config) *Adapter {
+	a := newAdapter(db, config)
+	a.owner = &clientOwner{db: db}
+
+	// Call the destructor when the object is released.
+	runtime.SetFinalizer(a.owner, finalizer)
+
+	return a
+}
+
+// NewAdapterWithSharedClient is the same as NewAdapterWithConfig but the
+// adapter doesn't close db when released; the caller owns db and closes it
+// once done, e.g. when db is shared with the rest of the application.
+func NewAdapterWithSharedClient(db *datastore.Client, config Config) *Adapter {
+	return newAdapter(db, config)
+}
+
+// newAdapter returns an Adapter which doesn't close db when released.
+func newAdapter(db *datastore.Client, config Config) *Adapter {
 	kind := casbinKind
 	if config.Kind != "" {
 		kind = config.Kind
 	}
-	a := &adapter{db, kind, config.Namespace}
-
-	// Call the destructor when the object is released.
-	runtime.SetFinalizer(a, finalizer)
-
+	pageSize := defaultPageSize
+	if 0 < config.PageSize && config.PageSize < defaultPageSize {
+		pageSize = config.PageSize
+	}
+	a := &Adapter{
+		db:        db,
+		kind:      kind,
+		namespace: config.Namespace,
+		readOnly:  config.ReadOnly,
+		pageSize:  pageSize,
+
+		loadWorkers: config.LoadWorkers,
+		lockTTL:     config.LockTTL,
+		deduplicate: config.Deduplicate,
+		tracer:      config.Tracer,
+		metrics:     config.Metrics,
+		logger:      config.Logger,
+
+		interceptors:  config.Interceptors,
+		auditing:      config.Audit,
+		softDelete:    config.SoftDelete,
+		modelName:     config.ModelName,
+		indexFallback: config.IndexFallback,
+		keyEncrypter:  config.KeyEncrypter,
+		kinds:         config.Kinds,
+		mapper:        config.EntityMapper,
+		extractor:     config.ContextExtractor,
+		clock:         config.Clock,
+		keyGenerator:  config.KeyGenerator,
+		notifiers:     config.Notifiers,
+
+		sensitiveRules:  config.SensitiveRules,
+		onSensitiveRule: config.OnSensitiveRule,
+		unknownPType:    config.UnknownPType,
+		strictArity:     config.StrictArity,
+
+		quarantineMalformed: config.QuarantineMalformed,
+		reverseIndex:        config.ReverseIndex,
+
+		defaultTimeout: config.DefaultTimeout,
+	}
+	a.codecs = newCodecs(a, config)
+	a.limiter = newRateLimiter(config)
+	a.breaker = newCircuitBreaker(config)
+	a.consistentLoad = config.ConsistentLoad
+	a.hedgeDelay = config.HedgeDelay
+	a.blueGreen = config.BlueGreen
+	a.incremental = config.IncrementalSave
+	a.caseFolding = foldsCase(config, a.codecs)
+	a.shards = config.Shards
+	a.slot = defaultSlot
+	a.idempotencyTTL = config.IdempotencyTTL
+	if a.idempotencyTTL <= 0 {
+		a.idempotencyTTL = defaultIdempotencyTTL
+	}
+	if config.SerializeWrites {
+		a.ruleLocks = &ruleLocks{rules: make(map[ruleID]*ruleLock)}
+	}
+	a.namespaces = &namespaceAdapters{config: config, adapters: map[string]*Adapter{config.Namespace: a}}
 	return a
 }
 
-func (a *adapter) pseudoRootKey() *datastore.Key {
-	key := datastore.IDKey(a.kind, 1, nil)
-	key.Namespace = a.namespace
-	return key
+var _ persist.Adapter = (*Adapter)(nil)
+
+// pseudoRootKey returns the key of the pseudo root entity of the configured
+// kind, which the policy version and the other entities of the adapter
+// descend from. It doesn't depend on the slot of Config.BlueGreen.
+func (a *Adapter) pseudoRootKey() *datastore.Key {
+	return a.slotRootKey(a.kind, defaultSlot)
 }
 
-func (a *adapter) newQuery() *datastore.Query {
-	return datastore.NewQuery(a.kind).Namespace(a.namespace).Filter("p_type >", "").Ancestor(a.pseudoRootKey())
+// newRuleKey returns the key of a new entity storing line, which is encoded.
+func (a *Adapter) newRuleKey(line *CasbinRule) *datastore.Key {
+	kind := a.ruleShard(*line)
+	return a.newKey(kind, a.rootKeyOf(kind))
 }
 
-func (a *adapter) LoadPolicy(model model.Model) error {
-	var rules []*CasbinRule
+func (a *Adapter) LoadPolicy(model model.Model) error {
+	return a.LoadPolicyCtx(context.Background(), model)
+}
 
-	ctx := context.Background()
-	query := a.newQuery()
-	_, err := a.db.GetAll(ctx, query, &rules)
+// LoadPolicyCtx loads all policy rules from the storage into the model.
+// Rules are fetched page by page and fed into the model as they arrive, so the
+// whole result set is never buffered in memory. Loading stops as soon as ctx
+// is canceled.
+//
+// If Config.LoadWorkers is greater than 1, the rules of each ptype defined in
+// the model are loaded concurrently.
+func (a *Adapter) LoadPolicyCtx(ctx context.Context, model model.Model) error {
+	return a.do(withHedging(ctx), "LoadPolicy", func(ctx context.Context) error {
+		a.setFiltered(false)
+		a.observeModel(model)
+
+		ctx, malformed := a.collectMalformed(ctx)
+		err := a.readConsistently(ctx, func(ctx context.Context) error {
+			// Read the version first, so the loaded rules are at least as new.
+			version, err := a.readVersion(ctx)
+			if err != nil {
+				return wrapError("LoadPolicy", err)
+			}
 
-	if err != nil {
-		return err
-	}
+			if a.loadWorkers > 1 {
+				err = a.loadPolicyInParallel(ctx, model)
+			} else {
+				err = a.paginatePlans(ctx, a.scanPlans(modelPTypes(model)), false, func(keys []*datastore.Key, rules []CasbinRule) error {
+					for i, line := range rules {
+						if err := a.loadRule(ctx, model, keys[i], line); err != nil {
+							return err
+						}
+					}
+					return nil
+				})
+			}
+			if err != nil {
+				return wrapError("LoadPolicy", err)
+			}
 
-	for _, l := range rules {
-		loadPolicyLine(*l, model)
-	}
+			a.observeVersion(version)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return wrapError("LoadPolicy", a.flushMalformed(ctx, malformed))
+	})
+}
 
-	return nil
+// SavePolicy replaces the stored rules with the ones in the model.
+//
+// If the policy has been modified by another writer since the adapter loaded
+// it, SavePolicy fails with ErrConflict instead of overwriting that change;
+// load the policy again and retry.
+//
+// If Config.LockTTL is set, SavePolicy holds the policy lock meanwhile and
+// fails with ErrLocked if another writer holds it. Large policies, which are
+// replaced page by page, extend the lease before every page and stop with
+// ErrLocked once it is lost.
+func (a *Adapter) SavePolicy(model model.Model) error {
+	return a.SavePolicyCtx(context.Background(), model)
 }
 
-func (a *adapter) SavePolicy(model model.Model) error {
-	ctx := context.Background()
+// SavePolicyCtx is the same as SavePolicy but honors ctx.
+func (a *Adapter) SavePolicyCtx(ctx context.Context, model model.Model) error {
+	return a.do(ctx, "SavePolicy", func(ctx context.Context) (err error) {
+		if a.readOnly {
+			return wrapError("SavePolicy", ErrReadOnly)
+		}
+		defer a.lockRules()()
 
-	// Drop all casbin entities
-	keys, err := a.db.GetAll(ctx, a.newQuery().KeysOnly(), nil)
-	if err != nil {
-		return err
-	}
+		a.audit(ctx, AuditEntry{})
+		a.observeModel(model)
+
+		var lock *Lock
+		if a.lockTTL > 0 && dryRun(ctx) == nil {
+			lock, err = a.AcquireLock(ctx, a.lockTTL)
+			if err != nil {
+				return wrapError("SavePolicy", err)
+			}
+			defer func() {
+				if rerr := lock.Release(ctx); err == nil {
+					err = wrapError("SavePolicy", rerr)
+				}
+			}()
+		}
 
-	var lines []interface{}
+		var lines []interface{}
 
-	for ptype, ast := range model["p"] {
-		for _, rule := range ast.Policy {
-			line := savePolicyLine(ptype, rule)
-			lines = append(lines, &line)
+		for ptype, ast := range model["p"] {
+			for _, rule := range ast.Policy {
+				line := savePolicyLine(ptype, rule)
+				lines = append(lines, &line)
+			}
 		}
-	}
 
-	for ptype, ast := range model["g"] {
-		for _, rule := range ast.Policy {
-			line := savePolicyLine(ptype, rule)
-			lines = append(lines, &line)
+		for ptype, ast := range model["g"] {
+			for _, rule := range ast.Policy {
+				line := savePolicyLine(ptype, rule)
+				lines = append(lines, &line)
+			}
 		}
-	}
 
-	ancestor := a.pseudoRootKey()
-	_, err = a.db.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
-		if err = tx.DeleteMulti(keys); err != nil {
-			return err
+		// Check the rules before anything is dropped.
+		if err := a.checkArity(lines); err != nil {
+			return wrapError("SavePolicy", err)
 		}
 
-		for _, line := range lines {
-			key := datastore.IncompleteKey(a.kind, ancestor)
-			key.Namespace = a.namespace
-			_, err := tx.Put(key, line)
-			if err != nil {
+		if a.blueGreen && dryRun(ctx) == nil {
+			return wrapError("SavePolicy", a.savePolicyToSlot(ctx, lines, lock))
+		}
+		if a.incremental {
+			return wrapError("SavePolicy", a.savePolicyIncrementally(ctx, lines, lock))
+		}
+
+		// Collect the keys of all casbin entities to drop them, as long as they
+		// fit in a single transaction along with the new rules, and the
+		// metadata of the rules to preserve it.
+		var keys []*datastore.Key
+		stored := make(ruleMetadata)
+		err = ErrTxnTooLarge
+		if len(lines)*a.ruleWrites() <= maxRuleMutations {
+			_, err = a.paginateRules(ctx, false, "", func(page []*datastore.Key, rules []CasbinRule) error {
+				keys = append(keys, liveKeys(page, rules)...)
+				stored.collect(rules)
+				if len(keys)+len(lines)*a.ruleWrites() > maxRuleMutations {
+					return ErrTxnTooLarge
+				}
+				return nil
+			})
+		}
+		if err == ErrTxnTooLarge {
+			return wrapError("SavePolicy", a.savePolicyInPages(ctx, lines, stored, lock))
+		}
+		if err != nil {
+			return wrapError("SavePolicy", err)
+		}
+		stored.stamp(ctx, lines, a.now())
+
+		if record := dryRun(ctx); record != nil {
+			recordDeletes(record, MutationDelete, keys)
+			recordPuts(record, lines)
+			return nil
+		}
+
+		lines, err = a.encodeRules(ctx, lines)
+		if err != nil {
+			return wrapError("SavePolicy", err)
+		}
+		ruleKeys := make([]*datastore.Key, len(lines))
+		for i, line := range lines {
+			ruleKeys[i] = a.newRuleKey(line.(*CasbinRule))
+		}
+		ruleKeys, entities, err := a.indexedEntities(ctx, ruleKeys, lines)
+		if err != nil {
+			return wrapError("SavePolicy", err)
+		}
+		if err := a.markHardDelete(ctx); err != nil {
+			return wrapError("SavePolicy", err)
+		}
+		err = a.mutate(ctx, true, len(keys)+len(lines), func(tx *datastore.Transaction) error {
+			if err := tx.DeleteMulti(keys); err != nil {
 				return err
 			}
+			_, err := tx.PutMulti(ruleKeys, entities)
+			return err
+		})
+		if err == nil {
+			op := operationFromContext(ctx)
+			op.expect(PhaseDeleting, len(keys))
+			op.advance(PhaseDeleting, len(keys))
+			op.expect(PhaseWriting, len(lines))
+			op.advance(PhaseWriting, len(lines))
 		}
 
+		return wrapError("SavePolicy", err)
+	})
+}
+
+// savePolicyInPages replaces the stored rules with lines when they are too
+// many to be replaced in a single transaction. The stored rules are dropped
+// page by page and then the new ones are written in batches, so other
+// instances may observe a partially saved policy meanwhile. A conflicting
+// write stops it with ErrConflict, leaving the policy partially saved.
+//
+// If lock is not nil, its lease is extended before every page, so it is held
+// for as long as the rebuild runs.
+func (a *Adapter) savePolicyInPages(ctx context.Context, lines []interface{}, stored ruleMetadata, lock *Lock) error {
+	var commits batchCommits
+	_, err := a.paginateRules(ctx, false, "", func(keys []*datastore.Key, rules []CasbinRule) error {
+		if err := lock.extend(ctx); err != nil {
+			return err
+		}
+		stored.collect(rules)
+		live := liveKeys(keys, rules)
+		err := a.deleteRules(ctx, true, live)
+		var failed *MultiError
+		if errors.As(err, &failed) && !abortsBatches(ctx, err) {
+			// Go on purging the other pages, so that the errors of all
+			// of them are reported at once.
+			commits.skip(failed)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		commits.delete(live)
 		return nil
 	})
+	if err != nil || len(commits.errs) > 0 {
+		// Writing the rules over a partially purged policy would leave
+		// the rules which failed to be purged, so the save stops there.
+		return commits.fail(err, lines)
+	}
+	stored.stamp(ctx, lines, a.now())
+	return commits.fail(a.putRules(ctx, true, lines, lock), nil)
+}
 
-	return err
+// AddPolicy adds a rule to the storage. If Config.Deduplicate is set, a rule
+// which is already stored is skipped.
+func (a *Adapter) AddPolicy(sec string, ptype string, rule []string) error {
+	return a.AddPolicyCtx(context.Background(), sec, ptype, rule)
 }
 
-func (a *adapter) AddPolicy(sec string, ptype string, rule []string) error {
-	ctx := context.Background()
-	line := savePolicyLine(ptype, rule)
+// AddPolicyCtx is the same as AddPolicy but honors ctx.
+func (a *Adapter) AddPolicyCtx(ctx context.Context, sec string, ptype string, rule []string) error {
+	return a.do(ctx, "AddPolicy", func(ctx context.Context) error {
+		_, err := a.addPolicy(ctx, ptype, rule, time.Time{})
+		return err
+	})
+}
 
-	key := datastore.IncompleteKey(a.kind, a.pseudoRootKey())
-	key.Namespace = a.namespace
-	_, err := a.db.Put(ctx, key, &line)
-	return err
+// AddPolicyWithExpiry is the same as AddPolicyCtx but the rule is no longer
+// loaded after expiresAt, and is deleted by PurgeExpiredPolicies.
+func (a *Adapter) AddPolicyWithExpiry(ctx context.Context, sec string, ptype string, rule []string, expiresAt time.Time) error {
+	return a.do(ctx, "AddPolicy", func(ctx context.Context) error {
+		_, err := a.addPolicy(ctx, ptype, rule, expiresAt)
+		return err
+	})
 }
 
-func (a *adapter) RemovePolicy(sec string, ptype string, rule []string) error {
-	var rules []*CasbinRule
+// addPolicy is the body of AddPolicyWithExpiry. It reports whether it stored
+// the rule, which it doesn't if the rule is already stored and
+// Config.Deduplicate is set, or if the idempotency key of ctx has been used.
+func (a *Adapter) addPolicy(ctx context.Context, ptype string, rule []string, expiresAt time.Time) (bool, error) {
+	if a.readOnly {
+		return false, wrapError("AddPolicy", ErrReadOnly)
+	}
+	defer a.lockRule(ptype, rule)()
 
 	line := savePolicyLine(ptype, rule)
+	if err := a.checkArity([]interface{}{&line}); err != nil {
+		return false, wrapError("AddPolicy", err)
+	}
+	stampRule(ctx, &line, a.now())
+	line.ExpiresAt = expiresAt
+	a.audit(ctx, AuditEntry{PType: ptype, Rule: rule})
 
-	ctx := context.Background()
-	query := a.newQuery().
-		Filter("p_type =", line.PType).
-		Filter("v0 =", line.V0).
-		Filter("v1 =", line.V1).
-		Filter("v2 =", line.V2).
-		Filter("v3 =", line.V3).
-		Filter("v4 =", line.V4)
+	if record := dryRun(ctx); record != nil {
+		recordPuts(record, []interface{}{&line})
+		return true, nil
+	}
 
-	keys, err := a.db.GetAll(ctx, query, &rules)
+	plain := line
+	line, err := a.encodeRule(ctx, line)
 	if err != nil {
-		switch err {
-		case datastore.ErrNoSuchEntity:
-			return nil
-		default:
+		return false, wrapError("AddPolicy", err)
+	}
+	keys, entities, err := a.indexedEntities(ctx, []*datastore.Key{a.newRuleKey(&line)}, []interface{}{&line})
+	if err != nil {
+		return false, wrapError("AddPolicy", err)
+	}
+	added := false
+	err = a.mutate(ctx, false, 1, func(tx *datastore.Transaction) error {
+		added = false
+		if err := a.claimIdempotencyKey(ctx, tx); err != nil {
 			return err
 		}
+		if a.deduplicate {
+			query := a.ruleQuery(line).Filter(a.property("v5")+" =", line.V5).Transaction(tx)
+			if !a.softDelete {
+				query = query.Limit(1)
+			}
+			keys, err := a.db.GetAll(ctx, query, nil)
+			if err != nil {
+				return err
+			}
+			if line.V5 != "" {
+				rules, err := a.getRules(tx.GetMulti, keys)
+				if err != nil {
+					return err
+				}
+				keys = sameExtra(keys, rules, line.Extra)
+			}
+			if live, err := a.liveRules(tx, keys); err != nil || live {
+				if err == nil {
+					err = errUnchanged
+				}
+				return err
+			}
+		}
+
+		added = true
+		_, err := tx.PutMulti(keys, entities)
+		return err
+	})
+	if added && err == nil {
+		a.recordAdded(ctx, &plain)
 	}
-	return a.db.DeleteMulti(ctx, keys)
+	return added && err == nil, wrapError("AddPolicy", err)
 }
 
-func (a *adapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
-
-	ctx := context.Background()
+func (a *Adapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	return a.RemovePolicyCtx(context.Background(), sec, ptype, rule)
+}
 
-	var rules []*CasbinRule
+// RemovePolicyCtx is the same as RemovePolicy but honors ctx.
+func (a *Adapter) RemovePolicyCtx(ctx context.Context, sec string, ptype string, rule []string) error {
+	_, err := a.RemovePolicyExisted(ctx, sec, ptype, rule)
+	return err
+}
 
-	selector := make(map[string]interface{})
-	selector["p_type"] = ptype
+// RemovePolicyExisted is the same as RemovePolicyCtx but also reports whether
+// the rule was stored. Removing a rule which is not stored, as casbin does
+// with auto-save when the model lacks it, costs a keys-only query, plus a
+// lookup of its tombstones with Config.SoftDelete, and no transaction.
+func (a *Adapter) RemovePolicyExisted(ctx context.Context, sec string, ptype string, rule []string) (bool, error) {
+	existed := false
+	err := a.do(ctx, "RemovePolicy", func(ctx context.Context) error {
+		if a.readOnly {
+			return wrapError("RemovePolicy", ErrReadOnly)
+		}
+		defer a.lockRule(ptype, rule)()
 
-	if fieldIndex <= 0 && 0 < fieldIndex+len(fieldValues) {
-		if fieldValues[0-fieldIndex] != "" {
-			selector["v0"] = fieldValues[0-fieldIndex]
+		line, err := a.encodeRule(ctx, savePolicyLine(ptype, rule))
+		if err != nil {
+			return wrapError("RemovePolicy", err)
 		}
-	}
-	if fieldIndex <= 1 && 1 < fieldIndex+len(fieldValues) {
-		if fieldValues[1-fieldIndex] != "" {
-			selector["v1"] = fieldValues[1-fieldIndex]
+		a.audit(ctx, AuditEntry{PType: ptype, Rule: rule})
+
+		keys, err := a.ruleKeys(ctx, line)
+		if err != nil {
+			return wrapError("RemovePolicy", err)
 		}
-	}
-	if fieldIndex <= 2 && 2 < fieldIndex+len(fieldValues) {
-		if fieldValues[2-fieldIndex] != "" {
-			selector["v2"] = fieldValues[2-fieldIndex]
+		if a.softDelete && len(keys) > 0 {
+			rules, err := a.getRules(func(keys []*datastore.Key, dst interface{}) error {
+				return a.db.GetMulti(ctx, keys, dst)
+			}, keys)
+			if err != nil {
+				return wrapError("RemovePolicy", err)
+			}
+			keys = liveKeys(keys, rules)
 		}
-	}
-	if fieldIndex <= 3 && 3 < fieldIndex+len(fieldValues) {
-		if fieldValues[3-fieldIndex] != "" {
-			selector["v3"] = fieldValues[3-fieldIndex]
+		if len(keys) == 0 {
+			return nil
 		}
-	}
-	if fieldIndex <= 4 && 4 < fieldIndex+len(fieldValues) {
-		if fieldValues[4-fieldIndex] != "" {
-			selector["v4"] = fieldValues[4-fieldIndex]
+		n, err := a.removeRules(ctx, keys)
+		existed = n > 0
+		return wrapError("RemovePolicy", err)
+	})
+	return existed, err
+}
+
+func (a *Adapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	return a.RemoveFilteredPolicyCtx(context.Background(), sec, ptype, fieldIndex, fieldValues...)
+}
+
+// RemoveFilteredPolicyCtx is the same as RemoveFilteredPolicy but honors ctx.
+func (a *Adapter) RemoveFilteredPolicyCtx(ctx context.Context, sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	_, err := a.removeFilteredPolicy(ctx, ptype, fieldIndex, fieldValues...)
+	return err
+}
+
+// removeFilteredPolicy runs RemoveFilteredPolicyCtx and returns the number of
+// rules it removed.
+func (a *Adapter) removeFilteredPolicy(ctx context.Context, ptype string, fieldIndex int, fieldValues ...string) (int, error) {
+	removed := 0
+	err := a.do(ctx, "RemoveFilteredPolicy", func(ctx context.Context) error {
+		if a.readOnly {
+			return wrapError("RemoveFilteredPolicy", ErrReadOnly)
 		}
-	}
-	if fieldIndex <= 5 && 5 < fieldIndex+len(fieldValues) {
-		if fieldValues[5-fieldIndex] != "" {
-			selector["v5"] = fieldValues[5-fieldIndex]
+		defer a.lockRules()()
+
+		plans, err := a.filteredPlans(ctx, Filter{PType: ptype, FieldIndex: fieldIndex, FieldValues: fieldValues, IgnoreCase: ignoresCase(ctx)})
+		if err != nil {
+			return wrapError("RemoveFilteredPolicy", err)
 		}
-	}
+		a.audit(ctx, AuditEntry{PType: ptype, Rule: fieldValues, FieldIndex: fieldIndex})
 
-	query := a.newQuery()
-	for k, v := range selector {
-		query = query.Filter(fmt.Sprintf("%s =", k), v)
-	}
+		var commits batchCommits
+		err = a.paginatePlans(ctx, plans, true, func(keys []*datastore.Key, _ []CasbinRule) error {
+			n, err := a.removeRules(ctx, keys)
+			if err != nil {
+				return err
+			}
+			removed += n
+			commits.delete(keys)
+			return nil
+		})
+		return wrapError("RemoveFilteredPolicy", commits.fail(err, nil))
+	})
+	return removed, err
+}
+
+// ruleQuery returns a keys-only query for the stored copies of line.
+// It doesn't match v5, so as to be served by the same index as ever.
+func (a *Adapter) ruleQuery(line CasbinRule) *datastore.Query {
+	return a.kindQuery(a.ruleShard(line)).
+		Filter(a.property("p_type")+" =", line.PType).
+		Filter(a.property("v0")+" =", line.V0).
+		Filter(a.property("v1")+" =", line.V1).
+		Filter(a.property("v2")+" =", line.V2).
+		Filter(a.property("v3")+" =", line.V3).
+		Filter(a.property("v4")+" =", line.V4).
+		KeysOnly()
+}
 
-	keys, err := a.db.GetAll(ctx, query, &rules)
+// ruleKeys returns the keys of the stored copies of line, which is encoded.
+func (a *Adapter) ruleKeys(ctx context.Context, line CasbinRule) ([]*datastore.Key, error) {
+	keys, err := a.db.GetAll(ctx, a.ruleQuery(line), nil)
 	if err != nil {
 		switch err {
 		case datastore.ErrNoSuchEntity:
-			return nil
+			return nil, nil
 		default:
-			return err
+			return nil, err
+		}
+	}
+	operationFromContext(ctx).read(len(keys))
+	if line.V5 == "" {
+		return keys, nil
+	}
+	rules, err := a.getRules(func(keys []*datastore.Key, dst interface{}) error {
+		return a.db.GetMulti(ctx, keys, dst)
+	}, keys)
+	if err != nil {
+		return nil, err
+	}
+	return sameExtra(keys, rules, line.Extra), nil
+}
+
+// sameExtra returns the keys of rules whose extra values are extra, since the
+// queries can't match them.
+func sameExtra(keys []*datastore.Key, rules []CasbinRule, extra []string) []*datastore.Key {
+	var same []*datastore.Key
+	for i, rule := range rules {
+		if ruleFields(CasbinRule{Extra: rule.Extra}) == ruleFields(CasbinRule{Extra: extra}) {
+			same = append(same, keys[i])
 		}
 	}
-	return a.db.DeleteMulti(ctx, keys)
+	return same
+}
+
+// NewCasbinRule returns the CasbinRule storing rule of ptype.
+func NewCasbinRule(ptype string, rule []string) CasbinRule {
+	return savePolicyLine(ptype, rule)
+}
+
+// Rule returns the values of line, as LoadPolicy loads them.
+func (line CasbinRule) Rule() []string {
+	return ruleValues(line)
+}
+
+// LoadPolicyLine adds line to the model, as LoadPolicy does.
+func LoadPolicyLine(line CasbinRule, model model.Model) {
+	loadPolicyLine(line, model, time.Now())
 }
 
 func savePolicyLine(ptype string, rule []string) CasbinRule {
@@ -248,51 +748,36 @@ func savePolicyLine(ptype string, rule []string) CasbinRule {
 	if len(rule) > 5 {
 		line.V5 = rule[5]
 	}
+	if len(rule) > maxRuleFields {
+		line.Extra = append([]string(nil), rule[maxRuleFields:]...)
+	}
+	line.Tokens = len(rule)
 
 	return line
 }
 
-func loadPolicyLine(line CasbinRule, model model.Model) {
-	key := line.PType
-	sec := key[:1]
-
-	tokens := []string{}
-	if line.V0 != "" {
-		tokens = append(tokens, line.V0)
-	} else {
-		goto LineEnd
-	}
-
-	if line.V1 != "" {
-		tokens = append(tokens, line.V1)
-	} else {
-		goto LineEnd
-	}
-
-	if line.V2 != "" {
-		tokens = append(tokens, line.V2)
-	} else {
-		goto LineEnd
-	}
-
-	if line.V3 != "" {
-		tokens = append(tokens, line.V3)
-	} else {
-		goto LineEnd
+// loadPolicyLine adds line to the model. Rules expired at now and soft
+// deleted ones are skipped. It reports false if the ptype of line is not
+// defined in the model.
+func loadPolicyLine(line CasbinRule, model model.Model, now time.Time) bool {
+	if line.deleted() || line.expired(now) {
+		return true
 	}
+	return addPolicyLine(line, model)
+}
 
-	if line.V4 != "" {
-		tokens = append(tokens, line.V4)
-	} else {
-		goto LineEnd
+// addPolicyLine adds line to the model. It reports false, without adding it,
+// if its ptype is not defined in the model.
+func addPolicyLine(line CasbinRule, model model.Model) bool {
+	key := line.PType
+	if key == "" {
+		return false
 	}
-
-	if line.V5 != "" {
-		tokens = append(tokens, line.V5)
-	} else {
-		goto LineEnd
+	ast, ok := model[key[:1]][key]
+	if !ok {
+		return false
 	}
 
-LineEnd:
-	model[sec][key].Policy = append(model[sec][key].Policy, tokens)
+	ast.Policy = append(ast.Policy, ruleValues(line))
+	return true
 }
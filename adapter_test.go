@@ -2,6 +2,7 @@ package datastoreadapter
 
 import (
 	"context"
+	"errors"
 	"os"
 	"sort"
 	"strings"
@@ -238,3 +239,50 @@ func TestConfig(t *testing.T) {
 		t.Error("got: ", actual, ", wants ", wants)
 	})
 }
+
+func TestLoadPolicyCtxCanceled(t *testing.T) {
+	config := Config{Kind: "casbin_test", Namespace: "unittest"}
+	initPolicy(t, config)
+
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf")
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := a.LoadPolicyCtx(ctx, e.GetModel()); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, wants context.Canceled", err)
+	}
+}
+
+func TestAddPolicyDeduplicate(t *testing.T) {
+	config := Config{Kind: "casbin_test", Namespace: "unittest", Deduplicate: true}
+	initPolicy(t, config)
+
+	a := NewAdapterWithConfig(getDatastore(), config)
+	// The adapter is called directly, since the enforcer skips known rules.
+	for i := 0; i < 2; i++ {
+		if err := a.AddPolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+	}
+
+	// testGetPolicy ignores duplicates, so count the stored copies.
+	line := savePolicyLine("p", []string{"alice", "data1", "read"})
+	keys, err := getDatastore().GetAll(context.Background(), a.ruleQuery(line), nil)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(keys) != 1 {
+		t.Errorf("got %d copies of the rule, wants 1", len(keys))
+	}
+
+	// Without the option, the rule is written again.
+	config.Deduplicate = false
+	if err := NewAdapterWithConfig(getDatastore(), config).AddPolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	keys, _ = getDatastore().GetAll(context.Background(), a.ruleQuery(line), nil)
+	if len(keys) != 2 {
+		t.Errorf("got %d copies of the rule, wants 2", len(keys))
+	}
+}
@@ -0,0 +1,85 @@
+package datastoreadapter
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/datastore"
+)
+
+// CountPolicies returns the number of stored rules, including soft deleted
+// ones. It counts them with a keys-only scan.
+func (a *Adapter) CountPolicies(ctx context.Context) (int, error) {
+	n := 0
+	err := a.do(ctx, "CountPolicies", func(ctx context.Context) error {
+		_, err := a.paginateRules(ctx, true, "", func(keys []*datastore.Key, _ []CasbinRule) error {
+			n += len(keys)
+			return nil
+		})
+		return err
+	})
+	return n, err
+}
+
+// Namespaces returns the namespaces which hold rules of the configured kind.
+func (m *MultiTenantAdapter) Namespaces(ctx context.Context) ([]string, error) {
+	var namespaces []string
+	a := m.ForNamespace(m.config.Namespace)
+	err := a.do(ctx, "ListNamespaces", func(ctx context.Context) error {
+		keys, err := a.db.GetAll(ctx, datastore.NewQuery("__namespace__").KeysOnly(), nil)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			// The default namespace is keyed by ID 1 rather than by name.
+			namespace := key.Name
+			b := m.ForNamespace(namespace)
+			for _, kind := range b.ruleKinds() {
+				rules, err := a.db.GetAll(ctx, b.kindQuery(kind).KeysOnly().Limit(1), nil)
+				if err != nil {
+					return err
+				}
+				if len(rules) > 0 {
+					namespaces = append(namespaces, namespace)
+					break
+				}
+			}
+		}
+		return nil
+	})
+	return namespaces, err
+}
+
+// CountPolicies returns the number of stored rules in each of namespaces, or
+// in each namespace Namespaces returns if none is given.
+func (m *MultiTenantAdapter) CountPolicies(ctx context.Context, namespaces ...string) (map[string]int, error) {
+	counts := make(map[string]int)
+	err := m.ForEachNamespace(ctx, namespaces, func(ctx context.Context, a *Adapter) error {
+		n, err := a.CountPolicies(ctx)
+		counts[a.namespace] = n
+		return err
+	})
+	return counts, err
+}
+
+// ForEachNamespace calls fn with the adapter of each of namespaces, or of
+// each namespace Namespaces returns if none is given, e.g. to add a global
+// rule or purge a ptype across tenants. It stops at the first error, which it
+// returns along with the namespace it occurred in.
+func (m *MultiTenantAdapter) ForEachNamespace(ctx context.Context, namespaces []string, fn func(ctx context.Context, a *Adapter) error) error {
+	if len(namespaces) == 0 {
+		var err error
+		namespaces, err = m.Namespaces(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, namespace := range namespaces {
+		if err := fn(ctx, m.ForNamespace(namespace)); err != nil {
+			return fmt.Errorf("namespace %q: %w", namespace, err)
+		}
+	}
+	return nil
+}
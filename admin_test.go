@@ -0,0 +1,45 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNamespaceAdministration(t *testing.T) {
+	ctx := context.Background()
+	config := Config{Kind: "casbin_test_admin", Namespace: "unittest"}
+	initPolicy(t, config)
+	initPolicy(t, Config{Kind: config.Kind, Namespace: "unittest_admin"})
+	m := NewMultiTenantAdapter(getDatastore(), config)
+
+	namespaces, err := m.Namespaces(ctx)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	found := make(map[string]bool)
+	for _, namespace := range namespaces {
+		found[namespace] = true
+	}
+	if !found["unittest"] || !found["unittest_admin"] {
+		t.Errorf("got %v, wants both namespaces", namespaces)
+	}
+
+	// Purge a ptype across the selected namespaces.
+	selected := []string{"unittest", "unittest_admin"}
+	err = m.ForEachNamespace(ctx, selected, func(ctx context.Context, a *Adapter) error {
+		return a.RemoveFilteredPolicyCtx(ctx, "g", "g", 0)
+	})
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	counts, err := m.CountPolicies(ctx, selected...)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	for _, namespace := range selected {
+		if counts[namespace] != 4 {
+			t.Errorf("got %d rules in %s, wants 4", counts[namespace], namespace)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package datastoreadapter
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RulePredicate reports whether a rule of ptype matches.
+type RulePredicate func(ptype string, rule []string) bool
+
+// SensitiveRule is a predicate of Config.SensitiveRules.
+type SensitiveRule struct {
+	// Name identifies the predicate in the alerts, e.g. "wildcard-object".
+	Name string
+	// Match reports whether a rule is sensitive; see ParseRulePredicate.
+	Match RulePredicate
+}
+
+// SensitiveRuleAlert is what Config.OnSensitiveRule is called with for each
+// sensitive rule an operation has added.
+type SensitiveRuleAlert struct {
+	// Name is the name of the SensitiveRule the rule matches.
+	Name string
+	// Event describes the operation, with PType and Rule set to the rule, so
+	// that it can be passed on to a Notifier.
+	Event PolicyEvent
+}
+
+// ParseRulePredicate parses a RulePredicate from expressions like
+//
+//	v1 == '*'
+//	ptype == 'g' && v1 == 'root'
+//	v0 == 'root' || v2 != 'read'
+//
+// Each comparison tests "ptype" or a value, v0 to v5, against a literal
+// quoted with ' or " with == or !=; && binds tighter than ||, and literals
+// may not contain either. A value the rule lacks is empty.
+func ParseRulePredicate(expr string) (RulePredicate, error) {
+	var anyOf []RulePredicate
+	for _, disjunct := range strings.Split(expr, "||") {
+		var allOf []RulePredicate
+		for _, comparison := range strings.Split(disjunct, "&&") {
+			p, err := parseRuleComparison(strings.TrimSpace(comparison))
+			if err != nil {
+				return nil, fmt.Errorf("rule predicate %q: %w", expr, err)
+			}
+			allOf = append(allOf, p)
+		}
+		anyOf = append(anyOf, func(ptype string, rule []string) bool {
+			for _, p := range allOf {
+				if !p(ptype, rule) {
+					return false
+				}
+			}
+			return true
+		})
+	}
+	return func(ptype string, rule []string) bool {
+		for _, p := range anyOf {
+			if p(ptype, rule) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// MustParseRulePredicate is the same as ParseRulePredicate but panics if expr
+// is invalid, for predicates known at compile time.
+func MustParseRulePredicate(expr string) RulePredicate {
+	p, err := ParseRulePredicate(expr)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// parseRuleComparison parses a comparison of ParseRulePredicate.
+func parseRuleComparison(s string) (RulePredicate, error) {
+	negate := false
+	i := strings.Index(s, "==")
+	if j := strings.Index(s, "!="); j >= 0 && (i < 0 || j < i) {
+		i, negate = j, true
+	}
+	if i < 0 {
+		return nil, fmt.Errorf("%q is not a comparison", s)
+	}
+	field := strings.TrimSpace(s[:i])
+	literal, err := strconv.Unquote(strings.Replace(strings.TrimSpace(s[i+2:]), "'", "\"", -1))
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a quoted literal", strings.TrimSpace(s[i+2:]))
+	}
+
+	var value func(ptype string, rule []string) string
+	switch field {
+	case "ptype":
+		value = func(ptype string, rule []string) string { return ptype }
+	case "v0", "v1", "v2", "v3", "v4", "v5":
+		n := int(field[1] - '0')
+		value = func(ptype string, rule []string) string {
+			if n < len(rule) {
+				return rule[n]
+			}
+			return ""
+		}
+	default:
+		return nil, fmt.Errorf("unknown field %q", field)
+	}
+	return func(ptype string, rule []string) bool {
+		return (value(ptype, rule) == literal) != negate
+	}, nil
+}
+
+// recordAdded records the rules the operation running with ctx has
+// committed, to check them against Config.SensitiveRules once it succeeds.
+func (a *Adapter) recordAdded(ctx context.Context, lines ...*CasbinRule) {
+	o := operationFromContext(ctx)
+	if o == nil || len(a.sensitiveRules) == 0 {
+		return
+	}
+	for _, line := range lines {
+		o.added = append(o.added, *line)
+	}
+}
+
+// alert calls Config.OnSensitiveRule with the sensitive rules the operation
+// has added.
+func (o *operation) alert() {
+	if o == nil || len(o.added) == 0 || o.adapter.onSensitiveRule == nil {
+		return
+	}
+	a := o.adapter
+	for _, line := range o.added {
+		rule := line.Rule()
+		for _, s := range a.sensitiveRules {
+			if !s.Match(line.PType, rule) {
+				continue
+			}
+			a.onSensitiveRule(o.ctx, SensitiveRuleAlert{
+				Name: s.Name,
+				Event: PolicyEvent{
+					Op:        o.stats.Op,
+					Kind:      a.kind,
+					Namespace: a.namespace,
+					PType:     line.PType,
+					Rule:      rule,
+					Actor:     ActorFromContext(o.ctx),
+					RequestID: RequestIDFromContext(o.ctx),
+					Timestamp: o.startedAt,
+				},
+			})
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseRulePredicate(t *testing.T) {
+	tests := []struct {
+		expr  string
+		ptype string
+		rule  []string
+		want  bool
+	}{
+		{`v1 == '*'`, "p", []string{"alice", "*", "read"}, true},
+		{`v1 == '*'`, "p", []string{"alice", "data1", "read"}, false},
+		{`ptype == 'g' && v1 == "root"`, "g", []string{"alice", "root"}, true},
+		{`ptype == 'g' && v1 == "root"`, "p", []string{"alice", "root"}, false},
+		{`v0 == 'root' || v2 != 'read'`, "p", []string{"alice", "data1", "write"}, true},
+		{`v0 == 'root' || v2 != 'read'`, "p", []string{"alice", "data1", "read"}, false},
+		{`v4 == ''`, "p", []string{"alice"}, true},
+	}
+	for _, tt := range tests {
+		p, err := ParseRulePredicate(tt.expr)
+		if err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+		if got := p(tt.ptype, tt.rule); got != tt.want {
+			t.Errorf("%s on %s %v: got %v, wants %v", tt.expr, tt.ptype, tt.rule, got, tt.want)
+		}
+	}
+
+	for _, expr := range []string{`v1`, `v6 == 'x'`, `v1 == x`, `v1 == '*' &&`} {
+		if _, err := ParseRulePredicate(expr); err == nil {
+			t.Errorf("%s: got no error, wants an error", expr)
+		}
+	}
+}
+
+func TestSensitiveRules(t *testing.T) {
+	var alerts []SensitiveRuleAlert
+	config := Config{
+		Kind:      "casbin_test_sensitive",
+		Namespace: "unittest",
+		SensitiveRules: []SensitiveRule{
+			{Name: "wildcard-object", Match: MustParseRulePredicate(`ptype == 'p' && v1 == '*'`)},
+			{Name: "root", Match: MustParseRulePredicate(`v0 == 'root'`)},
+		},
+		OnSensitiveRule: func(ctx context.Context, alert SensitiveRuleAlert) {
+			alerts = append(alerts, alert)
+		},
+	}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+	ctx := WithActor(context.Background(), "alice")
+
+	if len(alerts) != 0 {
+		t.Fatalf("got %+v, wants no alert for the seed policy", alerts)
+	}
+	if err := a.AddPolicyCtx(ctx, "p", "p", []string{"carol", "*", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	_, err := a.ApplyChangeSet(ctx, []Change{
+		{Op: ChangeAdd, PolicyRule: PolicyRule{PType: "p", Rule: []string{"root", "data3", "read"}}},
+		{Op: ChangeAdd, PolicyRule: PolicyRule{PType: "p", Rule: []string{"dave", "data3", "read"}}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	// A dry run adds nothing, so doesn't alert.
+	if err := a.AddPolicyCtx(WithDryRun(ctx, func(Mutation) {}), "p", "p", []string{"root", "*", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	wants := []struct {
+		name, op string
+		rule     []string
+	}{
+		{"wildcard-object", "AddPolicy", []string{"carol", "*", "read"}},
+		{"root", "ApplyChangeSet", []string{"root", "data3", "read"}},
+	}
+	if len(alerts) != len(wants) {
+		t.Fatalf("got %+v, wants %d alerts", alerts, len(wants))
+	}
+	for i, alert := range alerts {
+		want := wants[i]
+		e := alert.Event
+		if alert.Name != want.name || e.Op != want.op || e.PType != "p" || e.Actor != "alice" || len(e.Rule) != 3 || e.Rule[0] != want.rule[0] || e.Rule[1] != want.rule[1] {
+			t.Errorf("got %+v, wants %s by %s of %v", alert, want.name, want.op, want.rule)
+		}
+	}
+}
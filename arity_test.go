@@ -0,0 +1,78 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/casbin/casbin/v2/model"
+)
+
+func TestStrictArity(t *testing.T) {
+	config := Config{Kind: "casbin_test_strict_arity", Namespace: "unittest", StrictArity: true}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+	ctx := context.Background()
+
+	m, err := model.NewModelFromFile("examples/rbac_model.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.LoadPolicyCtx(ctx, m); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	tests := []struct {
+		ptype string
+		rule  []string
+		err   error
+	}{
+		{"p", []string{"carol", "data3"}, ErrRuleArity},
+		{"p", []string{"carol", "data3", "read", "allow"}, ErrRuleArity},
+		{"g", []string{"carol", "admin", "domain1"}, ErrRuleArity},
+		{"p2", []string{"carol", "data3", "read"}, ErrUnknownPType},
+	}
+	for _, tt := range tests {
+		if err := a.AddPolicyCtx(ctx, tt.ptype[:1], tt.ptype, tt.rule); !errors.Is(err, tt.err) {
+			t.Errorf("%s %v: got %v, wants %v", tt.ptype, tt.rule, err, tt.err)
+		}
+	}
+	_, err = a.ApplyChangeSet(ctx, []Change{
+		{Op: ChangeAdd, PolicyRule: PolicyRule{PType: "p", Rule: []string{"dave", "data3", "read"}}},
+		{Op: ChangeAdd, PolicyRule: PolicyRule{PType: "p", Rule: []string{"dave", "data3"}}},
+	}, nil)
+	if !errors.Is(err, ErrRuleArity) {
+		t.Errorf("got %v, wants %v", err, ErrRuleArity)
+	}
+	if err := a.AddPolicyCtx(ctx, "p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Errorf("got %v, wants no error", err)
+	}
+
+	// SavePolicy checks the rules against the model it saves.
+	m.AddPolicy("p", "p", []string{"erin", "data4"})
+	if err := a.SavePolicyCtx(ctx, m); !errors.Is(err, ErrRuleArity) {
+		t.Errorf("got %v, wants %v", err, ErrRuleArity)
+	}
+
+	// Nothing invalid has been written.
+	if err := SaveModelWithConfig(getDatastore(), "examples/rbac_model.conf", config); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	violations, err := a.ValidatePolicies(ctx)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(violations) != 0 {
+		t.Errorf("got %+v, wants no violation", violations)
+	}
+
+	// Without StrictArity, nothing is checked.
+	config.StrictArity = false
+	b := NewAdapterWithConfig(getDatastore(), config)
+	if err := b.LoadPolicyCtx(ctx, m); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := b.AddPolicyCtx(ctx, "p", "p", []string{"carol", "data3"}); err != nil {
+		t.Errorf("got %v, wants no error", err)
+	}
+}
@@ -0,0 +1,139 @@
+package datastoreadapter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/api/iterator"
+)
+
+// auditKindSuffix is appended to the configured kind to name the kind of
+// the audit entries.
+const auditKindSuffix = "_audit"
+
+// AuditEntry records a mutation of the policy.
+//
+// Audit entries are root entities, so writing them doesn't contend with the
+// writes to the entity group of the rules. Each of them is written in the
+// same transaction as the mutation it records.
+type AuditEntry struct {
+	// Op is the name of the operation, such as "AddPolicy".
+	Op string `datastore:"op" json:"op"`
+	// PType is the ptype of the rule, or empty for SavePolicy.
+	PType string `datastore:"p_type,noindex" json:"ptype,omitempty"`
+	// Rule is the rule added or removed, or the field values for
+	// RemoveFilteredPolicy. With Config.KeyEncrypter, its values are stored
+	// encrypted as those of the rules are; ListAuditEntries decrypts them.
+	Rule []string `datastore:"rule,noindex" json:"rule,omitempty"`
+	// FieldIndex is the field index for RemoveFilteredPolicy.
+	FieldIndex int `datastore:"field_index,noindex" json:"field_index,omitempty"`
+	// Actor is the actor set on the context with WithActor, or derived by
+	// Config.ContextExtractor.
+	Actor string `datastore:"actor" json:"actor,omitempty"`
+	// RequestID is the request ID set on the context with WithRequestID, or
+	// derived by Config.ContextExtractor.
+	RequestID string `datastore:"request_id,noindex" json:"request_id,omitempty"`
+	// Timestamp is the time the operation started.
+	Timestamp time.Time `datastore:"timestamp" json:"timestamp"`
+
+	// stored is set if the values of Rule are already stored ones, as those
+	// of a quarantined rule.
+	stored bool
+}
+
+type actorKey struct{}
+
+// WithActor returns a context which makes the audit entries of the operations
+// run with it record actor.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set with WithActor, or an empty string.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+func (a *Adapter) auditKind() string {
+	return a.kind + auditKindSuffix
+}
+
+func (a *Adapter) newAuditKey() *datastore.Key {
+	return a.newKey(a.auditKind(), nil)
+}
+
+// audit makes the next mutation of the operation running with ctx write an
+// audit entry of it, if Config.Audit is set, and records the event the
+// Notifiers are notified of once it succeeds. With Config.KeyEncrypter, the
+// values of the rule are encrypted in both, or redacted if they can't be.
+func (a *Adapter) audit(ctx context.Context, entry AuditEntry) {
+	o := operationFromContext(ctx)
+	if o == nil {
+		return
+	}
+	if !entry.stored && (a.auditing || len(a.notifiers) > 0) {
+		rule, err := a.encryptValues(ctx, entry.Rule)
+		if err != nil {
+			o.warn(fmt.Errorf("audit: %w", err))
+			rule = make([]string, len(entry.Rule))
+			for i := range rule {
+				rule[i] = redactedValue
+			}
+		}
+		entry.Rule = rule
+	}
+	entry.Op = o.stats.Op
+	entry.Actor = ActorFromContext(ctx)
+	entry.RequestID = RequestIDFromContext(ctx)
+	entry.Timestamp = o.startedAt
+	if len(a.notifiers) > 0 {
+		o.event = &PolicyEvent{
+			Op:         entry.Op,
+			Kind:       a.kind,
+			Namespace:  a.namespace,
+			PType:      entry.PType,
+			Rule:       entry.Rule,
+			FieldIndex: entry.FieldIndex,
+			Actor:      entry.Actor,
+			RequestID:  entry.RequestID,
+			Timestamp:  entry.Timestamp,
+		}
+	}
+	if a.auditing {
+		o.pendingAudit = &entry
+	}
+}
+
+// ListAuditEntries calls fn with the audit entries recorded in [from, to), in
+// order of their timestamps. It stops at the first error fn returns.
+func (a *Adapter) ListAuditEntries(ctx context.Context, from, to time.Time, fn func(AuditEntry) error) error {
+	return a.do(ctx, "ListAuditEntries", func(ctx context.Context) error {
+		query := datastore.NewQuery(a.auditKind()).
+			Namespace(a.namespace).
+			Filter("timestamp >=", from).
+			Filter("timestamp <", to).
+			Order("timestamp")
+
+		it := a.db.Run(ctx, query)
+		for {
+			var entry AuditEntry
+			_, err := it.Next(&entry)
+			if err == iterator.Done {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			operationFromContext(ctx).read(1)
+			if entry.Rule, err = a.decryptValues(ctx, entry.Rule); err != nil {
+				return err
+			}
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+	})
+}
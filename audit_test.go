@@ -0,0 +1,74 @@
+package datastoreadapter
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAudit(t *testing.T) {
+	ctx := WithActor(context.Background(), "alice")
+	config := Config{Kind: "casbin_test_audit", Namespace: "unittest", Audit: true}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	from := time.Now()
+	if err := a.AddPolicyCtx(ctx, "p", "p", []string{"bob", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.RemovePolicyCtx(ctx, "p", "p", []string{"bob", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	// Removing a rule which isn't stored mutates nothing.
+	if err := a.RemovePolicyCtx(ctx, "p", "p", []string{"bob", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.RemoveFilteredPolicyCtx(ctx, "p", "p", 0, "alice"); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	to := time.Now().Add(time.Millisecond)
+
+	var entries []AuditEntry
+	err := a.ListAuditEntries(ctx, from, to, func(entry AuditEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	wants := []AuditEntry{
+		{Op: "AddPolicy", PType: "p", Rule: []string{"bob", "data3", "read"}, Actor: "alice"},
+		{Op: "RemovePolicy", PType: "p", Rule: []string{"bob", "data3", "read"}, Actor: "alice"},
+		{Op: "RemoveFilteredPolicy", PType: "p", Rule: []string{"alice"}, Actor: "alice"},
+	}
+	if len(entries) != len(wants) {
+		t.Fatalf("got %d entries, wants %d", len(entries), len(wants))
+	}
+	for i, entry := range entries {
+		if entry.Timestamp.Before(from) || !entry.Timestamp.Before(to) {
+			t.Errorf("got timestamp %v, wants in [%v, %v)", entry.Timestamp, from, to)
+		}
+		entry.Timestamp = time.Time{}
+		if !reflect.DeepEqual(entry, wants[i]) {
+			t.Errorf("got %+v, wants %+v", entry, wants[i])
+		}
+	}
+
+	// No entries are recorded unless Config.Audit is set.
+	config.Audit = false
+	b := NewAdapterWithConfig(getDatastore(), config)
+	from = time.Now()
+	if err := b.AddPolicyCtx(ctx, "p", "p", []string{"bob", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	n := 0
+	err = b.ListAuditEntries(ctx, from, time.Now().Add(time.Millisecond), func(AuditEntry) error {
+		n++
+		return nil
+	})
+	if err != nil || n != 0 {
+		t.Errorf("got %d entries and %v, wants none", n, err)
+	}
+}
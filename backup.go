@@ -0,0 +1,107 @@
+package datastoreadapter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"strings"
+
+	"cloud.google.com/go/storage"
+)
+
+// backupChecksumKey is the object metadata key of the SHA-256 checksum of a
+// backup, computed over its uncompressed JSON.
+const backupChecksumKey = "sha256"
+
+// ErrChecksumMismatch is reported when a backup doesn't match its checksum.
+var ErrChecksumMismatch = errors.New("backup checksum mismatch")
+
+// BackupToGCS writes a PolicySnapshot of the stored model and rules to bucket
+// as a gzip-compressed JSON object named after prefix and the current time,
+// e.g. "prefix/20200720T150405Z.json.gz", and returns its name.
+//
+// The SHA-256 checksum of the snapshot is stored in the object metadata and
+// verified by RestoreFromGCS, and the upload is verified with CRC32C.
+func (a *Adapter) BackupToGCS(ctx context.Context, bucket *storage.BucketHandle, prefix string) (string, error) {
+	var name string
+	err := a.do(ctx, "BackupToGCS", func(ctx context.Context) error {
+		snapshot, err := a.snapshotPolicy(ctx)
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(snapshot)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(b)
+
+		var gz bytes.Buffer
+		zw := gzip.NewWriter(&gz)
+		if _, err := zw.Write(b); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+
+		name = strings.TrimSuffix(prefix, "/") + "/" + snapshot.ExportedAt.Format("20060102T150405Z") + ".json.gz"
+		w := bucket.Object(name).NewWriter(ctx)
+		w.ContentType = "application/gzip"
+		w.Metadata = map[string]string{backupChecksumKey: hex.EncodeToString(sum[:])}
+		w.CRC32C = crc32.Checksum(gz.Bytes(), crc32.MakeTable(crc32.Castagnoli))
+		w.SendCRC32C = true
+		if _, err := w.Write(gz.Bytes()); err != nil {
+			w.Close()
+			return err
+		}
+		return w.Close()
+	})
+	if err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// RestoreFromGCS restores the backup stored in bucket as object by
+// BackupToGCS, storing its rules according to mode, as ImportJSON does. It
+// fails with ErrChecksumMismatch, before modifying anything, if the backup is
+// corrupted.
+func (a *Adapter) RestoreFromGCS(ctx context.Context, bucket *storage.BucketHandle, object string, mode ImportMode) error {
+	return a.do(ctx, "RestoreFromGCS", func(ctx context.Context) error {
+		attrs, err := bucket.Object(object).Attrs(ctx)
+		if err != nil {
+			return err
+		}
+		r, err := bucket.Object(object).NewReader(ctx)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadAll(zr)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(b)
+		if hex.EncodeToString(sum[:]) != attrs.Metadata[backupChecksumKey] {
+			return fmt.Errorf("%s: %w", object, ErrChecksumMismatch)
+		}
+
+		var snapshot PolicySnapshot
+		if err := json.Unmarshal(b, &snapshot); err != nil {
+			return err
+		}
+		return a.restorePolicy(ctx, &snapshot, mode)
+	})
+}
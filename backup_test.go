@@ -0,0 +1,60 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"cloud.google.com/go/storage"
+)
+
+func TestBackupToGCS(t *testing.T) {
+	bucketName := os.Getenv("TEST_CASBIN_GCS_BUCKET")
+	if bucketName == "" {
+		t.Skip("TEST_CASBIN_GCS_BUCKET is not set")
+	}
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	bucket := client.Bucket(bucketName)
+
+	config := Config{Kind: "casbin_test_backup", Namespace: "unittest"}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	name, err := a.BackupToGCS(ctx, bucket, "unittest")
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	defer bucket.Object(name).Delete(ctx)
+
+	b := a.ForNamespace("unittest_backup")
+	if err := b.RestoreFromGCS(ctx, bucket, name, ImportReplace); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if n, _ := b.CountPolicies(ctx); n != 5 {
+		t.Errorf("got %d rules, wants 5", n)
+	}
+
+	// A backup which doesn't match its checksum is rejected.
+	r, err := bucket.Object(name).NewReader(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup, _ := ioutil.ReadAll(r)
+	r.Close()
+	w := bucket.Object(name).NewWriter(ctx)
+	w.Metadata = map[string]string{backupChecksumKey: "corrupted"}
+	w.Write(backup)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.RestoreFromGCS(ctx, bucket, name, ImportReplace); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("got %v, wants ErrChecksumMismatch", err)
+	}
+}
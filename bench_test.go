@@ -0,0 +1,145 @@
+package datastoreadapter
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+)
+
+// benchSizes are the numbers of rules the benchmarks run against, e.g.
+//
+//	go test -run=NONE -bench=. -benchtime=10x
+//
+// The largest one is skipped with -short.
+var benchSizes = []int{1000, 10000, 100000}
+
+// benchModel returns a model holding n rules.
+func benchModel(b *testing.B, n int) model.Model {
+	e, err := casbin.NewEnforcer("examples/rbac_model.conf")
+	if err != nil {
+		b.Fatal(err)
+	}
+	m := e.GetModel()
+	for i := 0; i < n; i++ {
+		m.AddPolicy("p", "p", []string{fmt.Sprintf("user%d", i), fmt.Sprintf("data%d", i%100), "read"})
+	}
+	return m
+}
+
+// benchAdapters runs fn for each size of benchSizes with an adapter storing as
+// many rules.
+func benchAdapters(b *testing.B, config Config, fn func(b *testing.B, a *Adapter, m model.Model)) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			if testing.Short() && n > 10000 {
+				b.Skip("skipped with -short")
+			}
+			config := config
+			config.Kind = fmt.Sprintf("casbin_bench_%d", n)
+			config.Namespace = "benchmark"
+			a := NewAdapterWithConfig(getDatastore(), config)
+			m := benchModel(b, n)
+			if err := a.SavePolicy(m); err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			fn(b, a, m)
+		})
+	}
+}
+
+func BenchmarkLoadPolicy(b *testing.B) {
+	benchAdapters(b, Config{}, func(b *testing.B, a *Adapter, m model.Model) {
+		for i := 0; i < b.N; i++ {
+			m.ClearPolicy()
+			if err := a.LoadPolicy(m); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkLoadPolicyParallel(b *testing.B) {
+	benchAdapters(b, Config{LoadWorkers: 4}, func(b *testing.B, a *Adapter, m model.Model) {
+		for i := 0; i < b.N; i++ {
+			m.ClearPolicy()
+			if err := a.LoadPolicy(m); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkCachedLoadPolicy(b *testing.B) {
+	benchAdapters(b, Config{}, func(b *testing.B, a *Adapter, m model.Model) {
+		c := NewCachedAdapter(a, time.Minute)
+		for i := 0; i < b.N; i++ {
+			m.ClearPolicy()
+			if err := c.LoadPolicy(m); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkSavePolicy(b *testing.B) {
+	benchAdapters(b, Config{}, func(b *testing.B, a *Adapter, m model.Model) {
+		for i := 0; i < b.N; i++ {
+			if err := a.SavePolicy(m); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkSavePolicyIncremental(b *testing.B) {
+	benchAdapters(b, Config{IncrementalSave: true}, func(b *testing.B, a *Adapter, m model.Model) {
+		for i := 0; i < b.N; i++ {
+			// Each save adds or removes a single rule.
+			rule := []string{"user0", "data0", "write"}
+			if i%2 == 0 {
+				m.AddPolicy("p", "p", rule)
+			} else {
+				m.RemovePolicy("p", "p", rule)
+			}
+			if err := a.SavePolicy(m); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkAddRemovePolicy(b *testing.B) {
+	benchAdapters(b, Config{}, func(b *testing.B, a *Adapter, _ model.Model) {
+		for i := 0; i < b.N; i++ {
+			rule := []string{fmt.Sprintf("bench%d", i), "data0", "read"}
+			if err := a.AddPolicy("p", "p", rule); err != nil {
+				b.Fatal(err)
+			}
+			if err := a.RemovePolicy("p", "p", rule); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkBufferedAddPolicy(b *testing.B) {
+	benchAdapters(b, Config{}, func(b *testing.B, a *Adapter, _ model.Model) {
+		buf := NewBufferedAdapter(context.Background(), a, time.Hour)
+		defer buf.Close()
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < 100; j++ {
+				if err := buf.AddPolicy("p", "p", []string{fmt.Sprintf("bench%d_%d", i, j), "data0", "read"}); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if err := buf.Flush(context.Background()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultBreakerMinCalls = 10
+	defaultBreakerWindow   = time.Minute
+	defaultBreakerCooldown = 30 * time.Second
+)
+
+// circuitBreaker fails the operations of the adapters sharing it fast while
+// datastore is degraded; see Config.CircuitBreakerErrorRate.
+//
+// It is closed until the failed operations of a window reach the error
+// rate, then open, rejecting every operation, for the cooldown, and then
+// half-open, letting a single probe through: the breaker closes if the
+// probe succeeds and opens again if it fails.
+type circuitBreaker struct {
+	errorRate float64
+	minCalls  int
+	window    time.Duration
+	cooldown  time.Duration
+
+	mu sync.Mutex
+	// open is set from the time the breaker trips until a probe succeeds.
+	open     bool
+	openedAt time.Time
+	probing  bool
+	// calls and failures count the operations since windowStart.
+	calls       int
+	failures    int
+	windowStart time.Time
+}
+
+// newCircuitBreaker returns the breaker configured by config, or nil if
+// config doesn't enable it.
+func newCircuitBreaker(config Config) *circuitBreaker {
+	if config.CircuitBreakerErrorRate <= 0 {
+		return nil
+	}
+
+	b := &circuitBreaker{
+		errorRate:   config.CircuitBreakerErrorRate,
+		minCalls:    config.CircuitBreakerMinCalls,
+		window:      config.CircuitBreakerWindow,
+		cooldown:    config.CircuitBreakerCooldown,
+		windowStart: time.Now(),
+	}
+	if b.minCalls <= 0 {
+		b.minCalls = defaultBreakerMinCalls
+	}
+	if b.window <= 0 {
+		b.window = defaultBreakerWindow
+	}
+	if b.cooldown <= 0 {
+		b.cooldown = defaultBreakerCooldown
+	}
+	return b
+}
+
+// allow returns the function to call with the outcome of an operation, or
+// ErrCircuitOpen if the operation is rejected.
+func (b *circuitBreaker) allow() (func(err error), error) {
+	if b == nil {
+		return func(error) {}, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return b.record, nil
+	}
+	if b.probing || time.Since(b.openedAt) < b.cooldown {
+		return nil, ErrCircuitOpen
+	}
+	b.probing = true
+	return b.probe, nil
+}
+
+// record counts the outcome of an operation run while the breaker is closed,
+// tripping it once the error rate is reached.
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.open {
+		// Tripped by a concurrent operation meanwhile.
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(b.windowStart) >= b.window {
+		b.calls, b.failures, b.windowStart = 0, 0, now
+	}
+	b.calls++
+	if backendFailure(err) {
+		b.failures++
+	}
+	if b.calls >= b.minCalls && float64(b.failures) >= b.errorRate*float64(b.calls) {
+		b.open, b.openedAt = true, now
+	}
+}
+
+// probe closes the breaker if the probe succeeded, and opens it again for
+// another cooldown otherwise.
+func (b *circuitBreaker) probe(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if backendFailure(err) {
+		b.openedAt = time.Now()
+		return
+	}
+	b.open = false
+	b.calls, b.failures, b.windowStart = 0, 0, time.Now()
+}
+
+// backendFailure reports whether err is a failure of datastore itself, as
+// opposed to one caused by the caller or by the state of the policy, such as
+// ErrConflict, which says nothing about the health of the backend.
+func backendFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var s interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &s) {
+		return false
+	}
+	switch s.GRPCStatus().Code() {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.ResourceExhausted, codes.Unknown:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	const (
+		healthy = iota
+		conflicting
+		degraded
+	)
+	var mode int32
+	calls := 0
+	backend := func(ctx context.Context, op string, next func(context.Context) error) error {
+		calls++
+		switch atomic.LoadInt32(&mode) {
+		case conflicting:
+			return ErrConflict
+		case degraded:
+			return status.Error(codes.Unavailable, "unavailable")
+		}
+		return next(ctx)
+	}
+	config := Config{Kind: "casbin_test_breaker", Namespace: "unittest",
+		CircuitBreakerErrorRate: 0.5, CircuitBreakerMinCalls: 4, CircuitBreakerCooldown: 50 * time.Millisecond,
+		Interceptors: []Interceptor{backend}}
+	initPolicy(t, config)
+
+	a := NewAdapterWithConfig(getDatastore(), config)
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	ctx := context.Background()
+
+	// Conflicts don't trip the breaker: along with the load of NewEnforcer,
+	// the window counts 5 operations before the backend degrades, so it
+	// trips after 5 failures.
+	atomic.StoreInt32(&mode, conflicting)
+	for i := 0; i < 4; i++ {
+		if err := a.AddPolicyCtx(ctx, "p", "p", []string{"carol", "data3", "read"}); !errors.Is(err, ErrConflict) {
+			t.Fatalf("got %v, wants ErrConflict", err)
+		}
+	}
+
+	atomic.StoreInt32(&mode, degraded)
+	for i := 0; i < 5; i++ {
+		if err := a.AddPolicy("p", "p", []string{"carol", "data3", "read"}); errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("got %v after %d failures, wants the breaker closed", err, i)
+		}
+	}
+	calls = 0
+	if err := a.AddPolicy("p", "p", []string{"carol", "data3", "read"}); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got %v, wants ErrCircuitOpen", err)
+	}
+	if err := a.ForNamespace("unittest_other").LoadPolicy(e.GetModel()); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got %v, wants ErrCircuitOpen for the other namespaces", err)
+	}
+	if calls != 0 {
+		t.Errorf("got %d calls, wants the operations rejected before running", calls)
+	}
+
+	// A failed probe opens the breaker for another cooldown.
+	time.Sleep(60 * time.Millisecond)
+	if err := a.LoadPolicy(e.GetModel()); errors.Is(err, ErrCircuitOpen) || err == nil {
+		t.Errorf("got %v, wants the probe to fail", err)
+	}
+	if err := a.LoadPolicy(e.GetModel()); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got %v, wants ErrCircuitOpen after the failed probe", err)
+	}
+
+	// A successful probe closes it.
+	atomic.StoreInt32(&mode, healthy)
+	time.Sleep(60 * time.Millisecond)
+	if err := e.LoadPolicy(); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if _, err := e.AddPolicy("carol", "data3", "read"); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"carol", "data3", "read"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+
+	if b := newCircuitBreaker(Config{}); b != nil {
+		t.Errorf("got a breaker, wants none by default")
+	}
+}
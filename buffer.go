@@ -0,0 +1,373 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+)
+
+// BufferedAdapter wraps an Adapter and buffers AddPolicy and RemovePolicy,
+// for workloads which mutate hundreds of rules per second, such as user
+// syncs. The buffered mutations are coalesced, the last one of each rule
+// winning, except that an addition following a removal still removes the
+// stored copies of the rule first. They are flushed in batches with PutMulti
+// and DeleteMulti on an interval, once the buffer is full, or when Flush is
+// called:
+//
+//	b := datastoreadapter.NewBufferedAdapter(ctx, a, time.Second)
+//	defer b.Close()
+//	e.SetAdapter(b)
+//
+// LoadPolicy and RemoveFilteredPolicy flush the buffer first, and SavePolicy
+// discards it, so that they see the buffered mutations. A failed flush keeps
+// the mutations it couldn't commit in the buffer for the next one; the
+// background flushes report the errors to BufferConfig.OnError, besides
+// Config.Logger and Config.Metrics as the FlushPolicy operation.
+//
+// Since the writes are deferred, the rules added without
+// Config.Deduplicate set may be stored more than once if a flush is retried.
+type BufferedAdapter struct {
+	adapter    *Adapter
+	interval   time.Duration
+	maxPending int
+	onError    func(error)
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	full   chan struct{}
+
+	// flushMu serializes the flushes, so that the mutations are written in
+	// the order they were buffered.
+	flushMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[ruleID]bufferedWrite
+}
+
+// bufferedWrite is a buffered mutation of a rule.
+type bufferedWrite struct {
+	line   CasbinRule
+	remove bool
+	// replace is set on an addition which follows a removal of the rule, so
+	// that the stored copies are removed before it is added.
+	replace bool
+}
+
+// coalesce returns the mutation of a rule which w, buffered after prev, is
+// coalesced into.
+func coalesce(prev, w bufferedWrite) bufferedWrite {
+	if !w.remove && (prev.remove || prev.replace) {
+		w.replace = true
+	}
+	return w
+}
+
+var _ persist.Adapter = (*BufferedAdapter)(nil)
+
+// BufferConfig is the configuration of BufferedAdapter.
+type BufferConfig struct {
+	// How often the buffer is flushed.
+	// Optional. (Default: 1 second)
+	Interval time.Duration
+	// Number of buffered rules which triggers a flush before the interval.
+	// Optional. (Default: 500)
+	MaxPending int
+	// Function called with the errors of the background flushes.
+	// Optional. (Default: nil)
+	OnError func(error)
+}
+
+// defaultFlushInterval is the default BufferConfig.Interval.
+const defaultFlushInterval = time.Second
+
+// NewBufferedAdapter is the constructor for BufferedAdapter. It flushes the
+// buffer every interval until ctx is done or Close is called.
+func NewBufferedAdapter(ctx context.Context, a *Adapter, interval time.Duration) *BufferedAdapter {
+	return NewBufferedAdapterWithConfig(ctx, a, BufferConfig{Interval: interval})
+}
+
+// NewBufferedAdapterWithConfig is the constructor for BufferedAdapter.
+func NewBufferedAdapterWithConfig(ctx context.Context, a *Adapter, config BufferConfig) *BufferedAdapter {
+	interval := config.Interval
+	if interval <= 0 {
+		interval = defaultFlushInterval
+	}
+	maxPending := config.MaxPending
+	if maxPending <= 0 {
+		maxPending = defaultPageSize
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	b := &BufferedAdapter{
+		adapter:    a,
+		interval:   interval,
+		maxPending: maxPending,
+		onError:    config.OnError,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+		full:       make(chan struct{}, 1),
+		pending:    make(map[ruleID]bufferedWrite),
+	}
+	go b.run(ctx)
+	return b
+}
+
+func (b *BufferedAdapter) run(ctx context.Context) {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-b.full:
+		}
+		if err := b.Flush(ctx); err != nil && b.onError != nil && ctx.Err() == nil {
+			b.onError(err)
+		}
+	}
+}
+
+// Pending returns the number of buffered mutations.
+func (b *BufferedAdapter) Pending() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.pending)
+}
+
+// buffer buffers w, replacing the buffered mutation of the same rule.
+func (b *BufferedAdapter) buffer(w bufferedWrite) {
+	b.mu.Lock()
+	id := ruleFields(w.line)
+	if prev, ok := b.pending[id]; ok {
+		w = coalesce(prev, w)
+	}
+	b.pending[id] = w
+	full := len(b.pending) >= b.maxPending
+	b.mu.Unlock()
+
+	if full {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Flush writes the buffered mutations. The ones it fails to commit are kept
+// in the buffer, coalesced with those of the same rules buffered since.
+func (b *BufferedAdapter) Flush(ctx context.Context) error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	writes := b.pending
+	b.pending = make(map[ruleID]bufferedWrite)
+	b.mu.Unlock()
+	if len(writes) == 0 {
+		return nil
+	}
+
+	var failed map[ruleID]bufferedWrite
+	err := b.adapter.do(ctx, "FlushPolicy", func(ctx context.Context) error {
+		var err error
+		failed, err = b.adapter.flush(ctx, writes)
+		return err
+	})
+	if err != nil {
+		b.mu.Lock()
+		for id, w := range failed {
+			if newer, ok := b.pending[id]; ok {
+				w = coalesce(w, newer)
+			}
+			b.pending[id] = w
+		}
+		b.mu.Unlock()
+	}
+	return err
+}
+
+// flush removes and then adds the rules of writes. If it fails, it also
+// returns the writes it hasn't committed, according to the MultiError of the
+// failed batches.
+func (a *Adapter) flush(ctx context.Context, writes map[ruleID]bufferedWrite) (map[ruleID]bufferedWrite, error) {
+	defer a.lockRules()()
+	a.audit(ctx, AuditEntry{})
+
+	var removed []*datastore.Key
+	var added []interface{}
+	removedBy := make(map[ruleID][]*datastore.Key)
+	adding := make(map[ruleID]bool)
+	for id, w := range writes {
+		w := w
+		if !w.remove && !w.replace && !a.deduplicate {
+			added = append(added, &w.line)
+			adding[id] = true
+			continue
+		}
+
+		line, err := a.encodeRule(ctx, w.line)
+		if err != nil {
+			return writes, err
+		}
+		keys, err := a.ruleKeys(ctx, line)
+		if err != nil {
+			return writes, err
+		}
+		if w.remove || w.replace {
+			removed = append(removed, keys...)
+			removedBy[id] = keys
+			if w.replace {
+				added = append(added, &w.line)
+				adding[id] = true
+			}
+			continue
+		}
+		if a.softDelete && len(keys) > 0 {
+			rules, err := a.getRules(func(keys []*datastore.Key, dst interface{}) error {
+				return a.db.GetMulti(ctx, keys, dst)
+			}, keys)
+			if err != nil {
+				return writes, err
+			}
+			keys = liveKeys(keys, rules)
+		}
+		if len(keys) == 0 {
+			added = append(added, &w.line)
+			adding[id] = true
+		}
+	}
+
+	if _, err := a.removeRules(ctx, removed); err != nil {
+		deleted := make(map[string]bool)
+		var multi *MultiError
+		if errors.As(err, &multi) {
+			for _, key := range multi.Deleted {
+				deleted[key.String()] = true
+			}
+		}
+		return uncommitted(writes, removedBy, deleted, adding, nil), err
+	}
+	if err := a.putRules(ctx, false, added, nil); err != nil {
+		written := make(map[ruleID]bool)
+		var multi *MultiError
+		if errors.As(err, &multi) {
+			for _, line := range multi.Written {
+				written[ruleFields(line)] = true
+			}
+		}
+		return uncommitted(writes, nil, nil, adding, written), err
+	}
+	return nil, nil
+}
+
+// uncommitted returns the writes of which a key listed in removedBy is not
+// deleted, or the rule being added is not written.
+func uncommitted(writes map[ruleID]bufferedWrite, removedBy map[ruleID][]*datastore.Key, deleted map[string]bool, adding, written map[ruleID]bool) map[ruleID]bufferedWrite {
+	failed := make(map[ruleID]bufferedWrite)
+	for id, w := range writes {
+		if adding[id] && !written[id] {
+			failed[id] = w
+			continue
+		}
+		for _, key := range removedBy[id] {
+			if !deleted[key.String()] {
+				failed[id] = w
+				break
+			}
+		}
+	}
+	return failed
+}
+
+// Close stops the background flushes, waits for the running one to return,
+// and flushes the buffer a last time.
+func (b *BufferedAdapter) Close() error {
+	b.cancel()
+	<-b.done
+	return b.Flush(context.Background())
+}
+
+func (b *BufferedAdapter) LoadPolicy(model model.Model) error {
+	return b.LoadPolicyCtx(context.Background(), model)
+}
+
+// LoadPolicyCtx is the same as Adapter.LoadPolicyCtx but flushes the buffer
+// first.
+func (b *BufferedAdapter) LoadPolicyCtx(ctx context.Context, model model.Model) error {
+	if err := b.Flush(ctx); err != nil {
+		return err
+	}
+	return b.adapter.LoadPolicyCtx(ctx, model)
+}
+
+func (b *BufferedAdapter) SavePolicy(model model.Model) error {
+	return b.SavePolicyCtx(context.Background(), model)
+}
+
+// SavePolicyCtx is the same as Adapter.SavePolicyCtx but discards the
+// buffer, since model supersedes it.
+func (b *BufferedAdapter) SavePolicyCtx(ctx context.Context, model model.Model) error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	b.pending = make(map[ruleID]bufferedWrite)
+	b.mu.Unlock()
+	return b.adapter.SavePolicyCtx(ctx, model)
+}
+
+func (b *BufferedAdapter) AddPolicy(sec string, ptype string, rule []string) error {
+	return b.AddPolicyCtx(context.Background(), sec, ptype, rule)
+}
+
+// AddPolicyCtx buffers the addition of the rule.
+func (b *BufferedAdapter) AddPolicyCtx(ctx context.Context, sec string, ptype string, rule []string) error {
+	return b.AddPolicyWithExpiry(ctx, sec, ptype, rule, time.Time{})
+}
+
+// AddPolicyWithExpiry is the same as AddPolicyCtx but the rule is no longer
+// loaded after expiresAt; see Adapter.AddPolicyWithExpiry.
+func (b *BufferedAdapter) AddPolicyWithExpiry(ctx context.Context, sec string, ptype string, rule []string, expiresAt time.Time) error {
+	if b.adapter.readOnly {
+		return wrapError("AddPolicy", ErrReadOnly)
+	}
+	line := savePolicyLine(ptype, rule)
+	stampRule(ctx, &line, b.adapter.now())
+	line.ExpiresAt = expiresAt
+	b.buffer(bufferedWrite{line: line})
+	return nil
+}
+
+func (b *BufferedAdapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	return b.RemovePolicyCtx(context.Background(), sec, ptype, rule)
+}
+
+// RemovePolicyCtx buffers the removal of the rule.
+func (b *BufferedAdapter) RemovePolicyCtx(ctx context.Context, sec string, ptype string, rule []string) error {
+	if b.adapter.readOnly {
+		return wrapError("RemovePolicy", ErrReadOnly)
+	}
+	b.buffer(bufferedWrite{line: savePolicyLine(ptype, rule), remove: true})
+	return nil
+}
+
+func (b *BufferedAdapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	return b.RemoveFilteredPolicyCtx(context.Background(), sec, ptype, fieldIndex, fieldValues...)
+}
+
+// RemoveFilteredPolicyCtx is the same as Adapter.RemoveFilteredPolicyCtx but
+// flushes the buffer first.
+func (b *BufferedAdapter) RemoveFilteredPolicyCtx(ctx context.Context, sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	if err := b.Flush(ctx); err != nil {
+		return err
+	}
+	return b.adapter.RemoveFilteredPolicyCtx(ctx, sec, ptype, fieldIndex, fieldValues...)
+}
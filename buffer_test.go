@@ -0,0 +1,116 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+)
+
+func TestBufferedAdapter(t *testing.T) {
+	config := Config{Kind: "casbin_test_buffer", Namespace: "unittest", Deduplicate: true}
+	initPolicy(t, config)
+	ctx := context.Background()
+
+	a := NewAdapterWithConfig(getDatastore(), config)
+	b := NewBufferedAdapter(ctx, NewAdapterWithConfig(getDatastore(), config), time.Hour)
+	defer b.Close()
+
+	// The mutations of the same rule are coalesced.
+	for _, rule := range [][]string{{"carol", "data3", "read"}, {"dave", "data4", "read"}, {"alice", "data1", "read"}} {
+		if err := b.AddPolicy("p", "p", rule); err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+	}
+	if err := b.RemovePolicy("p", "p", []string{"dave", "data4", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := b.RemovePolicy("p", "p", []string{"bob", "data2", "write"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if n := b.Pending(); n != 4 {
+		t.Errorf("got %d pending mutations, wants 4", n)
+	}
+
+	// Nothing is written until flushed.
+	if n, err := a.CountPolicies(ctx); err != nil || n != 5 {
+		t.Errorf("got %d, %v, wants 5 rules", n, err)
+	}
+	if err := b.Flush(ctx); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if n := b.Pending(); n != 0 {
+		t.Errorf("got %d pending mutations, wants none", n)
+	}
+
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"carol", "data3", "read"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+
+	// LoadPolicy flushes the buffer first.
+	if err := b.AddPolicy("p", "p", []string{"erin", "data5", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	e, _ = casbin.NewEnforcer("examples/rbac_model.conf", b)
+	if !e.HasPolicy("erin", "data5", "read") {
+		t.Errorf("got no buffered rule, wants it loaded")
+	}
+}
+
+func TestBufferedAdapterMaxPending(t *testing.T) {
+	config := Config{Kind: "casbin_test_buffer", Namespace: "unittest"}
+	initPolicy(t, config)
+	ctx := context.Background()
+
+	a := NewAdapterWithConfig(getDatastore(), config)
+	b := NewBufferedAdapterWithConfig(ctx, NewAdapterWithConfig(getDatastore(), config), BufferConfig{Interval: time.Hour, MaxPending: 2})
+	defer b.Close()
+
+	for _, rule := range [][]string{{"carol", "data3", "read"}, {"dave", "data4", "read"}} {
+		if err := b.AddPolicy("p", "p", rule); err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+	}
+
+	// A full buffer is flushed in the background.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		n, err := a.CountPolicies(ctx)
+		if err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+		if n == 7 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d rules, wants 7 once flushed", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBufferedAdapterRemoveThenAdd(t *testing.T) {
+	config := Config{Kind: "casbin_test_buffer", Namespace: "unittest"}
+	initPolicy(t, config)
+	ctx := context.Background()
+
+	a := NewAdapterWithConfig(getDatastore(), config)
+	b := NewBufferedAdapter(ctx, NewAdapterWithConfig(getDatastore(), config), time.Hour)
+	defer b.Close()
+
+	// Removing and adding back a stored rule doesn't store a second copy.
+	if err := b.RemovePolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := b.AddPolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := b.Flush(ctx); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if n, err := a.CountPolicies(ctx); err != nil || n != 5 {
+		t.Errorf("got %d, %v, wants 5 rules", n, err)
+	}
+}
@@ -0,0 +1,342 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+)
+
+// CachedAdapter wraps an Adapter and serves LoadPolicy and LoadFilteredPolicy
+// from in-memory snapshots of the stored rules.
+//
+// Snapshots are dropped on every write made through the CachedAdapter, when
+// Invalidate is called, and once they are older than the TTL. Writes made by
+// other instances are only noticed through the latter two, so it is up to the
+// TTL to bound the staleness; see UpdateCallback to invalidate the snapshots
+// on watcher notifications.
+//
+// If a SharedCache is configured, the snapshot of the whole policy is also
+// stored there, keyed by the policy version, so it never goes stale.
+type CachedAdapter struct {
+	adapter *Adapter
+	ttl     time.Duration
+
+	shared    SharedCache
+	sharedTTL time.Duration
+
+	mu        sync.Mutex
+	gen       uint64
+	snapshots map[string]*snapshot
+	filtered  bool
+}
+
+// snapshot holds the rules returned by a query. Snapshots of the whole
+// policy also hold the policy version they were taken at.
+type snapshot struct {
+	rules   []CasbinRule
+	version int64
+	expires time.Time
+}
+
+var _ persist.FilteredAdapter = (*CachedAdapter)(nil)
+
+// CacheConfig is the configuration of CachedAdapter.
+type CacheConfig struct {
+	// How long snapshots are served.
+	// Optional. (Default: 0, meaning until invalidated)
+	TTL time.Duration
+	// Second-level cache shared with other instances.
+	// Optional. (Default: nil)
+	Shared SharedCache
+	// How long the snapshot is kept in the shared cache. Since a snapshot is
+	// stored under a new key for every policy version, it must be finite.
+	// Optional. (Default: TTL, or 1 hour if TTL is 0)
+	SharedTTL time.Duration
+}
+
+// NewCachedAdapter is the constructor for CachedAdapter.
+// A ttl of zero keeps the snapshots until they are invalidated.
+func NewCachedAdapter(a *Adapter, ttl time.Duration) *CachedAdapter {
+	return NewCachedAdapterWithConfig(a, CacheConfig{TTL: ttl})
+}
+
+// NewCachedAdapterWithConfig is the constructor for CachedAdapter.
+func NewCachedAdapterWithConfig(a *Adapter, config CacheConfig) *CachedAdapter {
+	sharedTTL := config.SharedTTL
+	if sharedTTL == 0 {
+		sharedTTL = config.TTL
+	}
+	if sharedTTL == 0 {
+		sharedTTL = defaultSharedTTL
+	}
+	return &CachedAdapter{
+		adapter:   a,
+		ttl:       config.TTL,
+		shared:    config.Shared,
+		sharedTTL: sharedTTL,
+		snapshots: make(map[string]*snapshot),
+	}
+}
+
+// Invalidate drops all the local snapshots, so the next load reads from the
+// shared cache, if any, or from datastore.
+func (c *CachedAdapter) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.snapshots = make(map[string]*snapshot)
+}
+
+// UpdateCallback returns a watcher update callback which invalidates the
+// snapshots before calling next. Since Enforcer.SetWatcher installs its own
+// callback, set it afterwards:
+//
+//	e.SetWatcher(w)
+//	w.SetUpdateCallback(cached.UpdateCallback(func(string) { e.LoadPolicy() }))
+func (c *CachedAdapter) UpdateCallback(next func(string)) func(string) {
+	return func(msg string) {
+		c.Invalidate()
+		if next != nil {
+			next(msg)
+		}
+	}
+}
+
+func (c *CachedAdapter) LoadPolicy(model model.Model) error {
+	return c.LoadPolicyCtx(context.Background(), model)
+}
+
+// LoadPolicyCtx is the same as Adapter.LoadPolicyCtx but may be served from
+// a snapshot.
+func (c *CachedAdapter) LoadPolicyCtx(ctx context.Context, model model.Model) error {
+	s, err := c.snapshot(ctx, "", c.adapter.scanPlans(modelPTypes(model))...)
+	if err != nil {
+		return wrapError("LoadPolicy", err)
+	}
+	for _, line := range s.rules {
+		if err := c.adapter.loadRule(ctx, model, nil, line); err != nil {
+			return wrapError("LoadPolicy", err)
+		}
+	}
+	c.setFiltered(false)
+	c.adapter.observeModel(model)
+	// Let SavePolicy detect writes made since the snapshot was taken.
+	c.adapter.observeVersion(s.version)
+	return nil
+}
+
+func (c *CachedAdapter) LoadFilteredPolicy(model model.Model, filter interface{}) error {
+	return c.LoadFilteredPolicyCtx(context.Background(), model, filter)
+}
+
+// LoadFilteredPolicyCtx is the same as Adapter.LoadFilteredPolicyCtx but may be
+// served from a snapshot.
+func (c *CachedAdapter) LoadFilteredPolicyCtx(ctx context.Context, model model.Model, filter interface{}) error {
+	f, err := toFilter(filter)
+	if err != nil {
+		return wrapError("LoadFilteredPolicy", err)
+	}
+
+	key := fmt.Sprintf("%#v", f)
+	plans, err := c.adapter.filteredPlans(ctx, f)
+	if err != nil {
+		return wrapError("LoadFilteredPolicy", err)
+	}
+	s, err := c.snapshot(ctx, key, plans...)
+	if err != nil {
+		return wrapError("LoadFilteredPolicy", err)
+	}
+	for _, line := range s.rules {
+		if err := c.adapter.loadRule(ctx, model, nil, line); err != nil {
+			return wrapError("LoadFilteredPolicy", err)
+		}
+	}
+	c.setFiltered(true)
+	c.adapter.observeModel(model)
+	return nil
+}
+
+func (c *CachedAdapter) IsFiltered() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.filtered
+}
+
+func (c *CachedAdapter) setFiltered(filtered bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.filtered = filtered
+}
+
+// snapshot returns the snapshot identified by key, running plans to take a
+// new one if there is no fresh one.
+func (c *CachedAdapter) snapshot(ctx context.Context, key string, plans ...queryPlan) (*snapshot, error) {
+	c.mu.Lock()
+	s, ok := c.snapshots[key]
+	gen := c.gen
+	c.mu.Unlock()
+	if ok && (s.expires.IsZero() || c.adapter.now().Before(s.expires)) {
+		return s, nil
+	}
+
+	s, err := c.load(ctx, key, plans)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.ttl > 0 {
+		s.expires = c.adapter.now().Add(c.ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Don't keep the snapshot if it has been invalidated meanwhile.
+	if c.gen == gen {
+		c.snapshots[key] = s
+	}
+	return s, nil
+}
+
+// load takes a new snapshot with fill, as a LoadPolicy or LoadFilteredPolicy
+// operation of the adapter.
+func (c *CachedAdapter) load(ctx context.Context, key string, plans []queryPlan) (*snapshot, error) {
+	name := "LoadFilteredPolicy"
+	if key == "" {
+		name = "LoadPolicy"
+		ctx = withHedging(ctx)
+	}
+
+	s := &snapshot{}
+	err := c.adapter.do(ctx, name, func(ctx context.Context) error {
+		return c.adapter.readConsistently(ctx, func(ctx context.Context) error {
+			return c.fill(ctx, s, key, plans)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// fill fills s with the results of plans, or with the snapshot in the shared
+// cache if the whole policy is requested. Shared cache failures fall back to
+// datastore.
+func (c *CachedAdapter) fill(ctx context.Context, s *snapshot, key string, plans []queryPlan) error {
+	op := operationFromContext(ctx)
+	var sharedKey string
+	if key == "" {
+		// The version is read before the rules, so the snapshot is at least
+		// as new as the version it is stored for.
+		version, err := c.adapter.readVersion(ctx)
+		if err != nil {
+			return err
+		}
+		s.version = version
+		if c.shared != nil {
+			sharedKey = sharedCacheKey(c.adapter, version)
+		}
+	}
+	if sharedKey != "" {
+		b, err := c.shared.Get(ctx, sharedKey)
+		if err != nil {
+			op.warn(fmt.Errorf("shared cache get: %w", err))
+		} else if b != nil {
+			if rules, ok := decodeSharedSnapshot(b); ok {
+				if rules, err = c.adapter.decryptRules(ctx, rules); err == nil {
+					s.rules = rules
+					return nil
+				}
+				op.warn(fmt.Errorf("shared cache: %w", err))
+			} else {
+				op.warn(errors.New("shared cache: undecodable snapshot"))
+			}
+		}
+	}
+
+	err := c.adapter.paginatePlans(ctx, plans, false, func(_ []*datastore.Key, page []CasbinRule) error {
+		s.rules = append(s.rules, page...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if sharedKey != "" {
+		rules, err := c.adapter.encryptRules(ctx, s.rules)
+		var b []byte
+		if err == nil {
+			b, err = encodeSharedSnapshot(rules)
+		}
+		if err == nil {
+			err = c.shared.Set(ctx, sharedKey, b, c.sharedTTL)
+		}
+		if err != nil {
+			op.warn(fmt.Errorf("shared cache set: %w", err))
+		}
+	}
+	return nil
+}
+
+func (c *CachedAdapter) SavePolicy(model model.Model) error {
+	return c.SavePolicyCtx(context.Background(), model)
+}
+
+// SavePolicyCtx is the same as Adapter.SavePolicyCtx but also drops the
+// snapshots.
+func (c *CachedAdapter) SavePolicyCtx(ctx context.Context, model model.Model) error {
+	defer c.Invalidate()
+	return c.adapter.SavePolicyCtx(ctx, model)
+}
+
+func (c *CachedAdapter) AddPolicy(sec string, ptype string, rule []string) error {
+	return c.AddPolicyCtx(context.Background(), sec, ptype, rule)
+}
+
+// AddPolicyCtx is the same as Adapter.AddPolicyCtx but also drops the
+// snapshots.
+func (c *CachedAdapter) AddPolicyCtx(ctx context.Context, sec string, ptype string, rule []string) error {
+	defer c.Invalidate()
+	return c.adapter.AddPolicyCtx(ctx, sec, ptype, rule)
+}
+
+// AddPolicyWithExpiry is the same as Adapter.AddPolicyWithExpiry but also
+// drops the snapshots.
+func (c *CachedAdapter) AddPolicyWithExpiry(ctx context.Context, sec string, ptype string, rule []string, expiresAt time.Time) error {
+	defer c.Invalidate()
+	return c.adapter.AddPolicyWithExpiry(ctx, sec, ptype, rule, expiresAt)
+}
+
+// PurgeExpiredPolicies is the same as Adapter.PurgeExpiredPolicies but also
+// drops the snapshots.
+func (c *CachedAdapter) PurgeExpiredPolicies(ctx context.Context) (int, error) {
+	defer c.Invalidate()
+	return c.adapter.PurgeExpiredPolicies(ctx)
+}
+
+func (c *CachedAdapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	return c.RemovePolicyCtx(context.Background(), sec, ptype, rule)
+}
+
+// RemovePolicyCtx is the same as Adapter.RemovePolicyCtx but also drops the
+// snapshots.
+func (c *CachedAdapter) RemovePolicyCtx(ctx context.Context, sec string, ptype string, rule []string) error {
+	defer c.Invalidate()
+	return c.adapter.RemovePolicyCtx(ctx, sec, ptype, rule)
+}
+
+func (c *CachedAdapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	return c.RemoveFilteredPolicyCtx(context.Background(), sec, ptype, fieldIndex, fieldValues...)
+}
+
+// RemoveFilteredPolicyCtx is the same as Adapter.RemoveFilteredPolicyCtx but
+// also drops the snapshots.
+func (c *CachedAdapter) RemoveFilteredPolicyCtx(ctx context.Context, sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	defer c.Invalidate()
+	return c.adapter.RemoveFilteredPolicyCtx(ctx, sec, ptype, fieldIndex, fieldValues...)
+}
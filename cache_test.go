@@ -0,0 +1,80 @@
+package datastoreadapter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+)
+
+func TestCachedAdapter(t *testing.T) {
+	config := Config{Kind: "casbin_test", Namespace: "unittest"}
+	initPolicy(t, config)
+
+	a := NewAdapterWithConfig(getDatastore(), config)
+	cached := NewCachedAdapter(NewAdapterWithConfig(getDatastore(), config), 0)
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", cached)
+
+	// A write made by another instance isn't visible until invalidated.
+	if err := a.AddPolicy("p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := e.LoadPolicy(); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+
+	cached.UpdateCallback(nil)("")
+	if err := e.LoadPolicy(); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"carol", "data3", "read"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+
+	// A write made through the cache invalidates it.
+	if _, err := e.RemovePolicy("carol", "data3", "read"); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := e.LoadPolicy(); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+
+	// Filtered loads are cached separately.
+	e.ClearPolicy()
+	if err := cached.LoadFilteredPolicy(e.GetModel(), Filter{PType: "p", FieldValues: []string{"alice"}}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if !cached.IsFiltered() {
+		t.Error("got IsFiltered() == false, wants true")
+	}
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+}
+
+func TestCachedAdapterTTL(t *testing.T) {
+	config := Config{Kind: "casbin_test", Namespace: "unittest"}
+	initPolicy(t, config)
+
+	a := NewAdapterWithConfig(getDatastore(), config)
+	cached := NewCachedAdapter(NewAdapterWithConfig(getDatastore(), config), 10*time.Millisecond)
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", cached)
+
+	if err := a.RemoveFilteredPolicy("p", "p", 0, "data2_admin"); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if err := e.LoadPolicy(); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+}
@@ -0,0 +1,46 @@
+package datastoreadapter
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+type ignoreCaseKey struct{}
+
+// WithIgnoreCase returns a context under which RemoveFilteredPolicyCtx matches
+// the field values ignoring case, as Filter.IgnoreCase does for the filtered
+// loads.
+func WithIgnoreCase(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ignoreCaseKey{}, true)
+}
+
+// ignoresCase reports whether ctx has been returned by WithIgnoreCase.
+func ignoresCase(ctx context.Context) bool {
+	ignore, _ := ctx.Value(ignoreCaseKey{}).(bool)
+	return ignore
+}
+
+// foldedValue returns the element of CasbinRule.Folded for value, the field-th
+// value of a rule as stored.
+func foldedValue(field int, value string) string {
+	return strconv.Itoa(field) + ":" + strings.ToLower(value)
+}
+
+// foldsCase reports whether an adapter with config and codecs stores the
+// folded values. Config.CaseFolding is ignored along with codecs, since the
+// values they store don't fold as the values do, e.g. once encrypted.
+func foldsCase(config Config, codecs []Codec) bool {
+	return config.CaseFolding && len(codecs) == 0
+}
+
+// foldRule sets the folded values of rule, if Config.CaseFolding is set.
+func (a *Adapter) foldRule(rule *CasbinRule) {
+	if !a.caseFolding {
+		return
+	}
+	rule.Folded = rule.Folded[:0]
+	for field, v := range rule.values()[:maxRuleFields] {
+		rule.Folded = append(rule.Folded, foldedValue(field, *v))
+	}
+}
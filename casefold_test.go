@@ -0,0 +1,59 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+)
+
+func TestIgnoreCase(t *testing.T) {
+	for _, folding := range []bool{true, false} {
+		config := Config{Kind: "casbin_test_ignore_case", Namespace: "unittest", CaseFolding: folding}
+		initPolicy(t, config)
+		ctx := context.Background()
+		a := NewAdapterWithConfig(getDatastore(), config)
+
+		if err := a.AddPolicyCtx(ctx, "p", "p", []string{"Carol", "Data3", "read"}); err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+
+		e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+		if err := e.LoadFilteredPolicy(&Filter{PType: "p", FieldValues: []string{"CAROL", "data3"}, IgnoreCase: true}); err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+		testGetPolicy(e, [][]string{{"Carol", "Data3", "read"}}, func(actual, wants [][]string) {
+			t.Error("folding: ", folding, ", got: ", actual, ", wants ", wants)
+		})
+
+		// Without WithIgnoreCase, the values must match exactly.
+		if err := a.RemoveFilteredPolicyCtx(ctx, "p", "p", 0, "carol"); err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+		if exists, err := a.ExistsPolicy(ctx, "p", []string{"Carol", "Data3", "read"}); err != nil || !exists {
+			t.Errorf("folding: %v, got %v, %v, wants true", folding, exists, err)
+		}
+		if err := a.RemoveFilteredPolicyCtx(WithIgnoreCase(ctx), "p", "p", 0, "carol"); err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+		if exists, err := a.ExistsPolicy(ctx, "p", []string{"Carol", "Data3", "read"}); err != nil || exists {
+			t.Errorf("folding: %v, got %v, %v, wants false", folding, exists, err)
+		}
+	}
+}
+
+func TestCaseFoldingWithCodecs(t *testing.T) {
+	// The transformed values don't fold as the values do, so the filters
+	// ignoring case scan the rules instead.
+	config := Config{Kind: "casbin_test_ignore_case", Namespace: "unittest", CaseFolding: true, ValueTransformer: HMACTransformer([]byte("secret"), func(string, int) bool { return false })}
+	a := NewAdapterWithConfig(getDatastore(), config)
+	plans, err := a.filteredPlans(context.Background(), Filter{PType: "p", FieldValues: []string{"CAROL"}, IgnoreCase: true})
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	for _, plan := range plans {
+		if !plan.partial || !plan.match(CasbinRule{PType: "p", V0: "Carol"}) {
+			t.Errorf("got a plan partial: %v, wants it matching in memory ignoring case", plan.partial)
+		}
+	}
+}
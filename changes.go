@@ -0,0 +1,170 @@
+package datastoreadapter
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/datastore"
+)
+
+// ChangeOp is the operation of a Change.
+type ChangeOp string
+
+const (
+	// ChangeAdd adds a rule.
+	ChangeAdd ChangeOp = "add"
+	// ChangeRemove removes a rule.
+	ChangeRemove ChangeOp = "remove"
+)
+
+// Change is a rule added or removed by ApplyChangeSet.
+type Change struct {
+	Op ChangeOp `json:"op"`
+	PolicyRule
+}
+
+// ChangeReport describes the rules ApplyChangeSet writes, or would have
+// written if the validation had accepted them.
+type ChangeReport struct {
+	// Added are the rules added. With Config.Deduplicate, the rules already
+	// stored are left out.
+	Added []PolicyRule
+	// Removed are the stored rules removed, one per stored copy.
+	Removed []PolicyRule
+	// Applied reports whether the rules have been written.
+	Applied bool
+
+	adapter  *Adapter
+	resolved *resolvedChanges
+}
+
+// ChangeValidator validates the changes of ApplyChangeSet before they are
+// written, and rejects them by returning an error.
+type ChangeValidator func(ctx context.Context, report *ChangeReport) error
+
+// ChangeRejectedError is reported by ApplyChangeSet when the validation
+// rejects the changes. It matches ErrChangeRejected with errors.Is, and
+// unwraps to the error of the validation.
+type ChangeRejectedError struct {
+	// Report describes the rejected changes.
+	Report *ChangeReport
+	// Err is the error the validation returned.
+	Err error
+}
+
+func (e *ChangeRejectedError) Error() string {
+	return "changes rejected: " + e.Err.Error()
+}
+
+// Unwrap returns the error of the validation.
+func (e *ChangeRejectedError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrChangeRejected.
+func (e *ChangeRejectedError) Is(target error) bool {
+	return target == ErrChangeRejected
+}
+
+// ApplyChangeSet stages changes, in order, lets validate, if not nil, check
+// them and the policy they would result in, e.g. that no admin is left
+// without a role, and writes all of them in a single transaction once it
+// accepts them:
+//
+//	report, err := a.ApplyChangeSet(ctx, changes, func(ctx context.Context, r *datastoreadapter.ChangeReport) error {
+//		roles, err := r.Policy(ctx, "g")
+//		if err != nil {
+//			return err
+//		}
+//		if !hasAdmin(roles) {
+//			return errors.New("no admin left")
+//		}
+//		return nil
+//	})
+//
+// If validate rejects them, nothing is written and ApplyChangeSet fails with
+// a *ChangeRejectedError holding the report. The changes are subject to the
+// same limits and retries as those of WithTransaction, which may run
+// validate more than once.
+func (a *Adapter) ApplyChangeSet(ctx context.Context, changes []Change, validate ChangeValidator) (*ChangeReport, error) {
+	report := &ChangeReport{adapter: a}
+	err := a.do(ctx, "ApplyChangeSet", func(ctx context.Context) error {
+		if a.readOnly {
+			return wrapError("ApplyChangeSet", ErrReadOnly)
+		}
+		staged := make([]stagedChange, len(changes))
+		for i, c := range changes {
+			line := savePolicyLine(c.PType, c.Rule)
+			switch c.Op {
+			case ChangeAdd:
+				stampRule(ctx, &line, a.now())
+			case ChangeRemove:
+			default:
+				return wrapError("ApplyChangeSet", fmt.Errorf("invalid change op %q", c.Op))
+			}
+			staged[i] = stagedChange{line: line, remove: c.Op == ChangeRemove}
+		}
+
+		err := a.applyChanges(ctx, staged, func(r *resolvedChanges) error {
+			report.resolve(r)
+			if validate == nil {
+				return nil
+			}
+			if err := validate(ctx, report); err != nil {
+				return &ChangeRejectedError{Report: report, Err: err}
+			}
+			return nil
+		})
+		report.Applied = err == nil && dryRun(ctx) == nil
+		return wrapError("ApplyChangeSet", err)
+	})
+	return report, err
+}
+
+// resolve sets the rules of the report to those of r.
+func (r *ChangeReport) resolve(resolved *resolvedChanges) {
+	r.resolved = resolved
+	r.Added = make([]PolicyRule, len(resolved.added))
+	for i, line := range resolved.added {
+		r.Added[i] = newPolicyRule(*line)
+	}
+	r.Removed = make([]PolicyRule, len(resolved.removed))
+	for i, line := range resolved.removed {
+		r.Removed[i] = newPolicyRule(line)
+	}
+}
+
+// Policy returns the rules of ptype the policy holds once the changes are
+// applied: the live stored ones, but those removed, followed by those added.
+// It reads all the stored rules of ptype.
+func (r *ChangeReport) Policy(ctx context.Context, ptype string) ([][]string, error) {
+	a := r.adapter
+	removed := make(map[string]bool, len(r.resolved.deleted))
+	for _, key := range r.resolved.deleted {
+		removed[key.String()] = true
+	}
+
+	plans, err := a.filteredPlans(ctx, Filter{PType: ptype})
+	if err != nil {
+		return nil, err
+	}
+	var rules [][]string
+	now := a.now()
+	err = a.paginatePlans(ctx, plans, false, func(keys []*datastore.Key, page []CasbinRule) error {
+		for i, line := range page {
+			if !removed[keys[i].String()] && !line.deleted() && !line.expired(now) {
+				rules = append(rules, ruleValues(line))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range r.resolved.added {
+		if line.PType == ptype {
+			rules = append(rules, ruleValues(*line))
+		}
+	}
+	return rules, nil
+}
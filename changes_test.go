@@ -0,0 +1,66 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+)
+
+func TestApplyChangeSet(t *testing.T) {
+	config := Config{Kind: "casbin_test_changes", Namespace: "unittest"}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+	ctx := context.Background()
+
+	// Rejects the changes which leave data2_admin without a member.
+	errNoAdmin := errors.New("no member of data2_admin left")
+	validate := func(ctx context.Context, r *ChangeReport) error {
+		roles, err := r.Policy(ctx, "g")
+		if err != nil {
+			return err
+		}
+		for _, role := range roles {
+			if role[1] == "data2_admin" {
+				return nil
+			}
+		}
+		return errNoAdmin
+	}
+
+	report, err := a.ApplyChangeSet(ctx, []Change{
+		{Op: ChangeRemove, PolicyRule: PolicyRule{PType: "g", Rule: []string{"alice", "data2_admin"}}},
+		{Op: ChangeAdd, PolicyRule: PolicyRule{PType: "p", Rule: []string{"carol", "data3", "read"}}},
+	}, validate)
+	var rejected *ChangeRejectedError
+	if !errors.Is(err, ErrChangeRejected) || !errors.Is(err, errNoAdmin) || !errors.As(err, &rejected) {
+		t.Fatalf("got %v, wants the changes rejected", err)
+	}
+	if report.Applied || rejected.Report != report || len(report.Removed) != 1 || len(report.Added) != 1 {
+		t.Errorf("got %+v, wants a report of the rejected changes", report)
+	}
+
+	report, err = a.ApplyChangeSet(ctx, []Change{
+		{Op: ChangeAdd, PolicyRule: PolicyRule{PType: "g", Rule: []string{"bob", "data2_admin"}}},
+		{Op: ChangeRemove, PolicyRule: PolicyRule{PType: "g", Rule: []string{"alice", "data2_admin"}}},
+	}, validate)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if !report.Applied || len(report.Removed) != 1 || !SamePolicy([][]string{report.Removed[0].Rule}, [][]string{{"alice", "data2_admin"}}) {
+		t.Errorf("got %+v, wants alice's role removed", report)
+	}
+
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	if roles := e.GetGroupingPolicy(); !SamePolicy(roles, [][]string{{"bob", "data2_admin"}}) {
+		t.Errorf("got %v, wants bob granted data2_admin only", roles)
+	}
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+
+	if _, err := a.ApplyChangeSet(ctx, []Change{{Op: "rename"}}, nil); err == nil {
+		t.Error("got no error, wants an invalid op rejected")
+	}
+}
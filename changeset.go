@@ -0,0 +1,101 @@
+package datastoreadapter
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// ChangeSet is a set of changes to the policy which can be built, serialized
+// to JSON for review, e.g. in a pull request of a GitOps pipeline, and later
+// applied with ApplyChangeSet:
+//
+//	cs := new(datastoreadapter.ChangeSet).
+//		Update("g", []string{"alice", "admin"}, []string{"alice", "operator"}).
+//		Add("p", "operator", "data1", "read")
+//	err := cs.WriteJSON(w)
+//
+//	cs, err := datastoreadapter.ReadChangeSet(r)
+//	report, err := a.ApplyChangeSet(ctx, cs.Changes(), validate)
+type ChangeSet struct {
+	// Description says what the changes are for, for the reviewers.
+	Description string `json:"description,omitempty"`
+	// Adds are the rules added.
+	Adds []PolicyRule `json:"adds,omitempty"`
+	// Removes are the rules removed.
+	Removes []PolicyRule `json:"removes,omitempty"`
+	// Updates are the rules replaced by others.
+	Updates []RuleUpdate `json:"updates,omitempty"`
+}
+
+// RuleUpdate replaces the rule Old of a ChangeSet with New.
+type RuleUpdate struct {
+	PType string   `json:"ptype"`
+	Old   []string `json:"old"`
+	New   []string `json:"new"`
+}
+
+// Add adds the addition of rule to s, and returns s.
+func (s *ChangeSet) Add(ptype string, rule ...string) *ChangeSet {
+	s.Adds = append(s.Adds, PolicyRule{PType: ptype, Rule: rule})
+	return s
+}
+
+// Remove adds the removal of rule to s, and returns s.
+func (s *ChangeSet) Remove(ptype string, rule ...string) *ChangeSet {
+	s.Removes = append(s.Removes, PolicyRule{PType: ptype, Rule: rule})
+	return s
+}
+
+// Update adds the replacement of the rule old with new to s, and returns s.
+func (s *ChangeSet) Update(ptype string, old, new []string) *ChangeSet {
+	s.Updates = append(s.Updates, RuleUpdate{PType: ptype, Old: old, New: new})
+	return s
+}
+
+// Empty reports whether s has no change.
+func (s *ChangeSet) Empty() bool {
+	return len(s.Adds) == 0 && len(s.Removes) == 0 && len(s.Updates) == 0
+}
+
+// Changes returns the changes of s in the order ApplyChangeSet applies them:
+// the removals first, then the updates, as the removal of the old rule and
+// the addition of the new one, and the additions last, so that a rule both
+// removed and added ends up stored.
+func (s *ChangeSet) Changes() []Change {
+	var changes []Change
+	for _, rule := range s.Removes {
+		changes = append(changes, Change{Op: ChangeRemove, PolicyRule: rule})
+	}
+	for _, u := range s.Updates {
+		changes = append(changes,
+			Change{Op: ChangeRemove, PolicyRule: PolicyRule{PType: u.PType, Rule: u.Old}},
+			Change{Op: ChangeAdd, PolicyRule: PolicyRule{PType: u.PType, Rule: u.New}})
+	}
+	for _, rule := range s.Adds {
+		changes = append(changes, Change{Op: ChangeAdd, PolicyRule: rule})
+	}
+	return changes
+}
+
+// WriteJSON writes s to w as indented JSON.
+func (s *ChangeSet) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// ReadChangeSet reads a ChangeSet written by WriteJSON from r.
+func ReadChangeSet(r io.Reader) (*ChangeSet, error) {
+	var s ChangeSet
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ChangeSet returns the changes which make the stored rules match the other
+// policy d compares them with. The rules whose expiry differs are left out,
+// since a ChangeSet doesn't record expiries.
+func (d *PolicyDiff) ChangeSet() *ChangeSet {
+	return &ChangeSet{Adds: d.Added, Removes: d.Removed}
+}
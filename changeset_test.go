@@ -0,0 +1,69 @@
+package datastoreadapter
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+)
+
+func TestChangeSet(t *testing.T) {
+	config := Config{Kind: "casbin_test_changeset", Namespace: "unittest"}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+	ctx := context.Background()
+
+	cs := (&ChangeSet{Description: "replace alice's role"}).
+		Update("g", []string{"alice", "data2_admin"}, []string{"alice", "data1_admin"}).
+		Add("p", "data1_admin", "data1", "write").
+		Remove("p", "bob", "data2", "write")
+
+	var buf bytes.Buffer
+	if err := cs.WriteJSON(&buf); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	read, err := ReadChangeSet(&buf)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if !reflect.DeepEqual(read, cs) {
+		t.Errorf("got %+v, wants %+v", read, cs)
+	}
+
+	changes := read.Changes()
+	wants := []ChangeOp{ChangeRemove, ChangeRemove, ChangeAdd, ChangeAdd}
+	for i, c := range changes {
+		if i < len(wants) && c.Op != wants[i] {
+			t.Errorf("got %s for change %d, wants %s", c.Op, i, wants[i])
+		}
+	}
+	if _, err := a.ApplyChangeSet(ctx, changes, nil); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"data1_admin", "data1", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+
+	// The change set of a diff reverts the changes.
+	initPolicy(t, Config{Kind: "casbin_test_changeset_seed", Namespace: "unittest"})
+	diff, err := a.DiffPolicies(ctx, NewAdapterWithConfig(getDatastore(), Config{Kind: "casbin_test_changeset_seed", Namespace: "unittest"}))
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if _, err := a.ApplyChangeSet(ctx, diff.ChangeSet().Changes(), nil); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := e.LoadPolicy(); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+	if empty := (&ChangeSet{}).Empty(); !empty || cs.Empty() {
+		t.Errorf("got %v and %v, wants only the change set without changes empty", empty, cs.Empty())
+	}
+}
@@ -0,0 +1,88 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+
+	"cloud.google.com/go/datastore"
+)
+
+// CleanupReport describes the rules deleted by CleanupPolicies.
+type CleanupReport struct {
+	// Duplicates is the number of extra copies deleted of rules which were
+	// stored more than once.
+	Duplicates int
+	// Orphans is the number of rules deleted because their ptype is not
+	// defined in the stored model.
+	Orphans int
+}
+
+// CleanupPolicies scans the stored rules and deletes the exact duplicates,
+// keeping one copy of each rule, and the rules whose ptype is not defined in
+// the model stored with SaveModelWithConfig. Orphans are kept if no model is
+// stored.
+//
+// The rules are scanned in order, so that duplicates are adjacent, and are
+// deleted page by page. The scan needs the same composite index as
+// Config.Deduplicate. On failure, the report counts the rules deleted so far.
+func (a *Adapter) CleanupPolicies(ctx context.Context) (*CleanupReport, error) {
+	report := &CleanupReport{}
+	err := a.do(ctx, "CleanupPolicies", func(ctx context.Context) error {
+		return a.cleanupPolicies(ctx, report)
+	})
+	return report, err
+}
+
+func (a *Adapter) cleanupPolicies(ctx context.Context, report *CleanupReport) error {
+	if a.readOnly {
+		return ErrReadOnly
+	}
+
+	var ptypes map[string]bool
+	m, err := a.loadModel(ctx)
+	switch {
+	case err == nil:
+		ptypes = make(map[string]bool)
+		for _, ptype := range modelPTypes(m) {
+			ptypes[ptype] = true
+		}
+	case !errors.Is(err, ErrModelNotFound):
+		return err
+	}
+
+	for _, kind := range a.ruleKinds() {
+		if err := a.cleanupKind(ctx, kind, ptypes, report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanupKind cleans up the rules stored in kind.
+func (a *Adapter) cleanupKind(ctx context.Context, kind string, ptypes map[string]bool, report *CleanupReport) error {
+	query := a.kindQuery(kind).
+		Order(a.property("p_type")).Order(a.property("v0")).Order(a.property("v1")).Order(a.property("v2")).
+		Order(a.property("v3")).Order(a.property("v4")).Order(a.property("v5"))
+
+	var last *CasbinRule
+	_, err := a.paginate(ctx, query, false, "", func(page []*datastore.Key, rules []CasbinRule) error {
+		var keys []*datastore.Key
+		for i := range rules {
+			switch {
+			case rules[i].deleted():
+				// Tombstones are left for PurgeDeletedPolicies.
+				continue
+			case ptypes != nil && !ptypes[rules[i].PType]:
+				report.Orphans++
+			case last != nil && ruleFields(*last) == ruleFields(rules[i]):
+				report.Duplicates++
+			default:
+				last = &rules[i]
+				continue
+			}
+			keys = append(keys, page[i])
+		}
+		return a.deleteRules(ctx, false, keys)
+	})
+	return err
+}
@@ -0,0 +1,80 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2"
+)
+
+func TestCleanupPolicies(t *testing.T) {
+	ctx := context.Background()
+	config := Config{Kind: "casbin_test_cleanup", Namespace: "unittest"}
+	initPolicy(t, config)
+
+	// Drop the model a previous run may have stored.
+	modelKey := datastore.NameKey(config.Kind, "conf", nil)
+	modelKey.Namespace = config.Namespace
+	if err := getDatastore().Delete(ctx, modelKey); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	a := NewAdapterWithConfig(getDatastore(), config)
+	for _, rule := range [][]string{{"p", "alice", "data1", "read"}, {"p", "alice", "data1", "read"}, {"p2", "bob", "data2", "read"}} {
+		if err := a.AddPolicy("p", rule[0], rule[1:]); err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+	}
+
+	// Without a stored model, only the duplicates are deleted.
+	report, err := a.CleanupPolicies(ctx)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if *report != (CleanupReport{Duplicates: 2}) {
+		t.Errorf("got %+v, wants 2 duplicates", *report)
+	}
+
+	if err := SaveModelWithConfig(getDatastore(), "examples/rbac_model.conf", config); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	defer getDatastore().Delete(ctx, modelKey)
+
+	report, err = a.CleanupPolicies(ctx)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if *report != (CleanupReport{Orphans: 1}) {
+		t.Errorf("got %+v, wants 1 orphan", *report)
+	}
+
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+	if n := len(e.GetPolicy()); n != 4 {
+		t.Errorf("got %d rules, wants 4", n)
+	}
+}
+
+func TestCleanupPoliciesInPages(t *testing.T) {
+	config := Config{Kind: "casbin_test_cleanup_pages", Namespace: "unittest", PageSize: 3}
+	initPolicy(t, config)
+
+	// Duplicates spanning page boundaries are detected.
+	a := NewAdapterWithConfig(getDatastore(), config)
+	for i := 0; i < 5; i++ {
+		if err := a.AddPolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+	}
+
+	report, err := a.CleanupPolicies(context.Background())
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if *report != (CleanupReport{Duplicates: 5}) {
+		t.Errorf("got %+v, wants 5 duplicates", *report)
+	}
+}
@@ -0,0 +1,52 @@
+package datastoreadapter
+
+import (
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// Clock tells the time the adapter stamps and expires entities with, e.g.
+// the timestamps of the audit entries and the expiry of the idempotency
+// keys. Tests can freeze or advance it instead of waiting:
+//
+//	type fakeClock struct{ t time.Time }
+//
+//	func (c *fakeClock) Now() time.Time { return c.t }
+//
+// The durations the adapter measures, such as those of the operations, the
+// timeouts and the rate limits, are always measured in real time.
+type Clock interface {
+	Now() time.Time
+}
+
+// KeyGenerator returns the keys of the new entities the adapter writes in
+// batches, such as the rules and the audit entries, which are incomplete
+// keys that datastore completes by default. Tests can return complete keys
+// instead, to assert the keys written.
+type KeyGenerator interface {
+	// NewKey returns the key of a new entity of kind, descending from
+	// parent, if not nil. Its namespace is set by the adapter.
+	NewKey(kind string, parent *datastore.Key) *datastore.Key
+}
+
+// now returns the current time of Config.Clock.
+func (a *Adapter) now() time.Time {
+	if a.clock != nil {
+		return a.clock.Now()
+	}
+	return time.Now()
+}
+
+// newKey returns the key of a new entity of kind in the namespace of the
+// adapter, generated by Config.KeyGenerator.
+func (a *Adapter) newKey(kind string, parent *datastore.Key) *datastore.Key {
+	var key *datastore.Key
+	if a.keyGenerator != nil {
+		key = a.keyGenerator.NewKey(kind, parent)
+	} else {
+		key = datastore.IncompleteKey(kind, parent)
+	}
+	key.Namespace = a.namespace
+	return key
+}
@@ -0,0 +1,75 @@
+package datastoreadapter
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.t }
+
+// sequentialKeys names the keys of each kind after their position.
+type sequentialKeys map[string]int
+
+func (g sequentialKeys) NewKey(kind string, parent *datastore.Key) *datastore.Key {
+	g[kind]++
+	return datastore.NameKey(kind, fmt.Sprintf("%s-%d", kind, g[kind]), parent)
+}
+
+func TestClockAndKeyGenerator(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+	keys := sequentialKeys{}
+	config := Config{Kind: "casbin_test_clock", Namespace: "unittest", Audit: true, Clock: clock, KeyGenerator: keys}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+	ctx := context.Background()
+
+	if err := a.AddPolicyWithExpiry(ctx, "p", "p", []string{"carol", "data3", "read"}, clock.t.Add(time.Hour)); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	var rule CasbinRule
+	key := datastore.NameKey(config.Kind, config.Kind+"-6", a.rootKeyOf(config.Kind))
+	key.Namespace = config.Namespace
+	if err := a.db.Get(ctx, key, a.entity(&rule)); err != nil {
+		t.Fatalf("got %v, wants the rule stored under the generated key", err)
+	}
+	if rule.V0 != "carol" || !rule.CreatedAt.Equal(clock.t) {
+		t.Errorf("got %+v, wants carol's rule created at %v", rule, clock.t)
+	}
+
+	var entries []AuditEntry
+	err := a.ListAuditEntries(ctx, clock.t, clock.t.Add(time.Second), func(entry AuditEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	// The SavePolicy of initPolicy is stamped at the same time.
+	if n := len(entries); n == 0 || entries[n-1].Op != "AddPolicy" || !entries[n-1].Timestamp.Equal(clock.t) {
+		t.Errorf("got %+v, wants an AddPolicy entry stamped %v", entries, clock.t)
+	}
+	if keys[config.Kind+auditKindSuffix] != 2 {
+		t.Errorf("got %d audit keys generated, wants 2", keys[config.Kind+auditKindSuffix])
+	}
+
+	// The rule expires once the clock passes its expiry, without waiting.
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	if !e.HasPolicy("carol", "data3", "read") {
+		t.Error("got no rule, wants it loaded before its expiry")
+	}
+	clock.t = clock.t.Add(2 * time.Hour)
+	if err := e.LoadPolicy(); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if e.HasPolicy("carol", "data3", "read") {
+		t.Error("got the rule, wants it expired")
+	}
+}
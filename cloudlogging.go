@@ -0,0 +1,112 @@
+package datastoreadapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Severities of the Cloud Logging entries written by CloudLoggingNotifier.
+const (
+	SeverityNotice  = "NOTICE"
+	SeverityWarning = "WARNING"
+)
+
+// CloudLoggingConfig is the configuration of CloudLoggingNotifier.
+type CloudLoggingConfig struct {
+	// Writer the entries are written to, one JSON object per line.
+	// Optional. (Default: os.Stdout)
+	Writer io.Writer
+	// Labels added to every entry, e.g. to tell the services apart. They
+	// override the labels set from the event.
+	// Optional. (Default: nil)
+	Labels map[string]string
+	// Function returning the severity of the entry of an event.
+	// Optional. (Default: NOTICE for the operations adding rules, WARNING for
+	// the others)
+	Severity func(PolicyEvent) string
+}
+
+// CloudLoggingNotifier is a Notifier which writes the events as structured
+// log entries, in the JSON format the logging agents of Cloud Run, GKE, App
+// Engine and Cloud Functions forward to Cloud Logging. Each entry carries
+// the severity, a message, the event as jsonPayload.event, and the labels
+// "op", "kind", "namespace", "ptype" and "actor", so that log-based alerts
+// and metrics can be defined on them, e.g.
+//
+//	jsonPayload.event.op="AddPolicy" AND labels.ptype="g" AND jsonPayload.event.rule="admin"
+type CloudLoggingNotifier struct {
+	config CloudLoggingConfig
+
+	// mu serializes the writes, so that entries are not interleaved.
+	mu sync.Mutex
+}
+
+var _ Notifier = (*CloudLoggingNotifier)(nil)
+
+// cloudLoggingEntry is the structured log entry of an event.
+type cloudLoggingEntry struct {
+	Severity string            `json:"severity"`
+	Message  string            `json:"message"`
+	Time     string            `json:"time"`
+	Labels   map[string]string `json:"logging.googleapis.com/labels,omitempty"`
+	Event    PolicyEvent       `json:"event"`
+}
+
+// NewCloudLoggingNotifier is the constructor for CloudLoggingNotifier.
+func NewCloudLoggingNotifier(config CloudLoggingConfig) *CloudLoggingNotifier {
+	if config.Writer == nil {
+		config.Writer = os.Stdout
+	}
+	if config.Severity == nil {
+		config.Severity = defaultSeverity
+	}
+	return &CloudLoggingNotifier{config: config}
+}
+
+// defaultSeverity is the default of CloudLoggingConfig.Severity.
+func defaultSeverity(event PolicyEvent) string {
+	if strings.HasPrefix(event.Op, "Add") {
+		return SeverityNotice
+	}
+	return SeverityWarning
+}
+
+// Notify writes the entry of event.
+func (n *CloudLoggingNotifier) Notify(ctx context.Context, event PolicyEvent) error {
+	labels := map[string]string{"op": event.Op, "kind": event.Kind}
+	for k, v := range map[string]string{"namespace": event.Namespace, "ptype": event.PType, "actor": event.Actor} {
+		if v != "" {
+			labels[k] = v
+		}
+	}
+	for k, v := range n.config.Labels {
+		labels[k] = v
+	}
+	message := event.Op
+	if event.PType != "" {
+		message += " " + event.PType
+	}
+	if len(event.Rule) > 0 {
+		message += " " + strings.Join(event.Rule, ", ")
+	}
+	b, err := json.Marshal(cloudLoggingEntry{
+		Severity: n.config.Severity(event),
+		Message:  message,
+		Time:     event.Timestamp.UTC().Format(time.RFC3339Nano),
+		Labels:   labels,
+		Event:    event,
+	})
+	if err != nil {
+		return fmt.Errorf("cloud logging entry: %w", err)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, err = n.config.Writer.Write(append(b, '\n'))
+	return err
+}
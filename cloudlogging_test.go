@@ -0,0 +1,57 @@
+package datastoreadapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCloudLoggingNotifier(t *testing.T) {
+	var buf bytes.Buffer
+	n := NewCloudLoggingNotifier(CloudLoggingConfig{Writer: &buf, Labels: map[string]string{"service": "authz"}})
+	config := Config{Kind: "casbin_test_cloud_logging", Namespace: "unittest", Notifiers: []Notifier{n}}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+	ctx := WithActor(context.Background(), "alice")
+
+	buf.Reset()
+	if err := a.AddPolicyCtx(ctx, "g", "g", []string{"carol", "data2_admin"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.RemovePolicyCtx(ctx, "g", "g", []string{"carol", "data2_admin"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %q, wants 2 entries", lines)
+	}
+	wants := []struct{ severity, message, op string }{
+		{SeverityNotice, "AddPolicy g carol, data2_admin", "AddPolicy"},
+		{SeverityWarning, "RemovePolicy g carol, data2_admin", "RemovePolicy"},
+	}
+	for i, line := range lines {
+		var entry cloudLoggingEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+		want := wants[i]
+		if entry.Severity != want.severity || entry.Message != want.message || entry.Time == "" {
+			t.Errorf("got %+v, wants severity %s and message %q", entry, want.severity, want.message)
+		}
+		labels := map[string]string{"op": want.op, "kind": config.Kind, "namespace": "unittest", "ptype": "g", "actor": "alice", "service": "authz"}
+		if len(entry.Labels) != len(labels) {
+			t.Errorf("got labels %v, wants %v", entry.Labels, labels)
+		}
+		for k, v := range labels {
+			if entry.Labels[k] != v {
+				t.Errorf("got labels %v, wants %v", entry.Labels, labels)
+			}
+		}
+		if entry.Event.Op != want.op || len(entry.Event.Rule) != 2 || entry.Event.Actor != "alice" {
+			t.Errorf("got event %+v, wants the %s of the rule by alice", entry.Event, want.op)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Command casbin-datastore administers Casbin policies stored in Cloud
+// Datastore by datastoreadapter.
+//
+// Usage:
+//
+//	casbin-datastore [flags] <command> [arguments]
+//
+// The commands are:
+//
+//	list                           print the rules as policy file lines
+//	add <ptype> <value>...         add a rule
+//	remove <ptype> <value>...      remove a rule
+//	import [-replace] <file>       import a policy file ("-" for stdin)
+//	export [<file>]                export the rules as a policy file
+//	backup -bucket <b> [-prefix <p>]
+//	                               back up the model and rules to GCS
+//	restore [-replace] -bucket <b> -object <o>
+//	                               restore a backup from GCS
+//	migrate [-replace] -model <conf> -policy <csv>
+//	                               migrate the rules of a policy file
+//	model push <conf>              store a model definition
+//	model pull                     print the stored model definition
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+	"cloud.google.com/go/storage"
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+
+	datastoreadapter "github.com/reedom/datastore-adapter/v3"
+)
+
+var errUsage = errors.New("usage: casbin-datastore [-project p] [-namespace ns] [-kind k] [-model-name m] <command> [arguments]")
+
+func main() {
+	if err := run(context.Background(), os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("casbin-datastore", flag.ContinueOnError)
+	project := fs.String("project", os.Getenv("GOOGLE_CLOUD_PROJECT"), "GCP project ID")
+	var config datastoreadapter.Config
+	fs.StringVar(&config.Namespace, "namespace", "", "datastore namespace")
+	fs.StringVar(&config.Kind, "kind", "casbin", "datastore kind")
+	fs.StringVar(&config.ModelName, "model-name", "", "name of the model definition")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errUsage
+	}
+
+	db, err := datastore.NewClient(ctx, *project)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	a := datastoreadapter.NewAdapterWithSharedClient(db, config)
+
+	cmd, args := fs.Arg(0), fs.Args()[1:]
+	switch cmd {
+	case "list":
+		return a.ExportPolicyCSV(ctx, stdout)
+
+	case "add", "remove":
+		// The section of the rule is the first letter of its ptype.
+		if len(args) < 2 || !strings.HasPrefix(args[0], "p") && !strings.HasPrefix(args[0], "g") {
+			return fmt.Errorf("usage: casbin-datastore %s <ptype> <value>...", cmd)
+		}
+		if cmd == "add" {
+			return a.AddPolicyCtx(ctx, args[0][:1], args[0], args[1:])
+		}
+		return a.RemovePolicyCtx(ctx, args[0][:1], args[0], args[1:])
+
+	case "import":
+		cfs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+		replace := cfs.Bool("replace", false, "replace the stored rules instead of merging")
+		if err := cfs.Parse(args); err != nil {
+			return err
+		}
+		if cfs.NArg() != 1 {
+			return errors.New("usage: casbin-datastore import [-replace] <file>")
+		}
+		r, err := openInput(cfs.Arg(0), stdin)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		return a.ImportPolicyCSV(ctx, r, importMode(*replace))
+
+	case "export":
+		if len(args) == 0 || args[0] == "-" {
+			return a.ExportPolicyCSV(ctx, stdout)
+		}
+		f, err := os.Create(args[0])
+		if err != nil {
+			return err
+		}
+		if err := a.ExportPolicyCSV(ctx, f); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+
+	case "backup", "restore":
+		cfs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+		bucket := cfs.String("bucket", "", "GCS bucket")
+		prefix := cfs.String("prefix", "casbin", "object name prefix of the backup")
+		object := cfs.String("object", "", "object name of the backup to restore")
+		replace := cfs.Bool("replace", false, "replace the stored rules instead of merging")
+		if err := cfs.Parse(args); err != nil {
+			return err
+		}
+		if *bucket == "" || cmd == "restore" && *object == "" {
+			return fmt.Errorf("usage: casbin-datastore %s -bucket <bucket> ...", cmd)
+		}
+		client, err := storage.NewClient(ctx)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		if cmd == "restore" {
+			return a.RestoreFromGCS(ctx, client.Bucket(*bucket), *object, importMode(*replace))
+		}
+		name, err := a.BackupToGCS(ctx, client.Bucket(*bucket), *prefix)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, name)
+		return nil
+
+	case "migrate":
+		cfs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+		modelPath := cfs.String("model", "", "model definition of the policy file")
+		policyPath := cfs.String("policy", "", "policy file to migrate")
+		replace := cfs.Bool("replace", false, "replace the stored rules instead of merging")
+		if err := cfs.Parse(args); err != nil {
+			return err
+		}
+		if *modelPath == "" || *policyPath == "" {
+			return errors.New("usage: casbin-datastore migrate [-replace] -model <conf> -policy <csv>")
+		}
+		src, err := casbin.NewEnforcer(*modelPath, *policyPath)
+		if err != nil {
+			return err
+		}
+		m, err := model.NewModelFromFile(*modelPath)
+		if err != nil {
+			return err
+		}
+		return a.MigrateFrom(ctx, src.GetAdapter(), datastoreadapter.MigrateOptions{
+			Model:    m,
+			Mode:     importMode(*replace),
+			Progress: func(n int) { fmt.Fprintf(stdout, "%d rules written\n", n) },
+		})
+
+	case "model":
+		switch {
+		case len(args) == 2 && args[0] == "push":
+			return datastoreadapter.SaveModelCtx(ctx, db, args[1], config)
+		case len(args) == 1 && args[0] == "pull":
+			text, err := datastoreadapter.LoadModelText(ctx, db, config)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(stdout, text)
+			return err
+		}
+		return errors.New("usage: casbin-datastore model push <conf> | model pull")
+	}
+	return fmt.Errorf("unknown command %q\n%v", cmd, errUsage)
+}
+
+func importMode(replace bool) datastoreadapter.ImportMode {
+	if replace {
+		return datastoreadapter.ImportReplace
+	}
+	return datastoreadapter.ImportMerge
+}
+
+func openInput(path string, stdin io.Reader) (io.ReadCloser, error) {
+	if path == "-" {
+		return ioutil.NopCloser(stdin), nil
+	}
+	return os.Open(path)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	flags := []string{"-project", "test", "-namespace", "unittest_cli", "-kind", "casbin_test_cli"}
+	cli := func(stdin string, args ...string) string {
+		var stdout bytes.Buffer
+		if err := run(ctx, append(flags, args...), strings.NewReader(stdin), &stdout); err != nil {
+			t.Fatalf("%v: got %v, wants no error", args, err)
+		}
+		return stdout.String()
+	}
+
+	cli("", "model", "push", "../../examples/rbac_model.conf")
+	if got := cli("", "model", "pull"); !strings.Contains(got, "[request_definition]") {
+		t.Errorf("got %q, wants the model definition", got)
+	}
+
+	cli("p, alice, data1, read\n", "import", "-replace", "-")
+	cli("", "add", "g", "alice", "admin")
+	cli("", "remove", "p", "alice", "data1", "read")
+	if got := cli("", "list"); got != "g, alice, admin\n" {
+		t.Errorf("got %q, wants the added rule", got)
+	}
+
+	for _, args := range [][]string{{"unknown"}, {"add", "", "alice"}, {"remove", "x", "alice"}} {
+		if err := run(ctx, append(flags, args...), strings.NewReader(""), &bytes.Buffer{}); err == nil {
+			t.Errorf("%v: got no error, wants an error", args)
+		}
+	}
+}
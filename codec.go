@@ -0,0 +1,129 @@
+package datastoreadapter
+
+import (
+	"context"
+)
+
+// Codec encodes the rule values to the strings stored in datastore
+// and decodes them back, e.g. to compress, escape or normalize them. Field is
+// the index of the value in the rule. Empty values are stored as they are.
+//
+// Encode must be deterministic, since the values RemovePolicy,
+// RemoveFilteredPolicy and LoadFilteredPolicy match are encoded the same way
+// to query the stored ones.
+type Codec interface {
+	Encode(ctx context.Context, ptype string, field int, value string) (string, error)
+	Decode(ctx context.Context, ptype string, field int, stored string) (string, error)
+}
+
+// newCodecs returns the codecs of a configured with config, in the order they
+// encode values: Config.ValueTransformer, Config.Codec and then the
+// encryption with Config.KeyEncrypter.
+func newCodecs(a *Adapter, config Config) []Codec {
+	var codecs []Codec
+	if config.ValueTransformer != nil {
+		codecs = append(codecs, transformerCodec(config.ValueTransformer))
+	}
+	if config.Codec != nil {
+		codecs = append(codecs, config.Codec)
+	}
+	if config.KeyEncrypter != nil {
+		codecs = append(codecs, encryptionCodec{adapter: a})
+	}
+	return codecs
+}
+
+// encodeValue returns the stored form of value, the field-th value of a rule
+// of ptype.
+func (a *Adapter) encodeValue(ctx context.Context, ptype string, field int, value string) (string, error) {
+	if value == "" {
+		return value, nil
+	}
+	for _, c := range a.codecs {
+		var err error
+		if value, err = c.Encode(ctx, ptype, field, value); err != nil {
+			return "", err
+		}
+	}
+	return value, nil
+}
+
+// encodeRule returns a copy of line whose values are encoded.
+func (a *Adapter) encodeRule(ctx context.Context, line CasbinRule) (CasbinRule, error) {
+	if len(a.codecs) == 0 {
+		return line, nil
+	}
+	line.Extra = append([]string(nil), line.Extra...)
+	for field, v := range line.values() {
+		var err error
+		if *v, err = a.encodeValue(ctx, line.PType, field, *v); err != nil {
+			return line, err
+		}
+	}
+	return line, nil
+}
+
+// encodeRules returns copies of lines, which are *CasbinRule, encoded with
+// encodeRule.
+func (a *Adapter) encodeRules(ctx context.Context, lines []interface{}) ([]interface{}, error) {
+	if len(a.codecs) == 0 {
+		return lines, nil
+	}
+	encoded := make([]interface{}, len(lines))
+	for i, line := range lines {
+		e, err := a.encodeRule(ctx, *line.(*CasbinRule))
+		if err != nil {
+			return nil, err
+		}
+		encoded[i] = &e
+	}
+	return encoded, nil
+}
+
+// decodeValue returns the value stored as stored.
+func (a *Adapter) decodeValue(ctx context.Context, ptype string, field int, stored string) (string, error) {
+	if stored == "" {
+		return stored, nil
+	}
+	for i := len(a.codecs) - 1; i >= 0; i-- {
+		var err error
+		if stored, err = a.codecs[i].Decode(ctx, ptype, field, stored); err != nil {
+			return "", err
+		}
+	}
+	return stored, nil
+}
+
+// decodeRules decodes the values of rules in place.
+func (a *Adapter) decodeRules(ctx context.Context, rules []CasbinRule) error {
+	if len(a.codecs) == 0 {
+		return nil
+	}
+	for i := range rules {
+		if err := a.decodeRule(ctx, &rules[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeRule decodes the values of rule in place.
+func (a *Adapter) decodeRule(ctx context.Context, rule *CasbinRule) error {
+	for field, v := range rule.values() {
+		var err error
+		if *v, err = a.decodeValue(ctx, rule.PType, field, *v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// values returns pointers to the rule values of line, including the extra
+// ones.
+func (line *CasbinRule) values() []*string {
+	values := []*string{&line.V0, &line.V1, &line.V2, &line.V3, &line.V4, &line.V5}
+	for i := range line.Extra {
+		values = append(values, &line.Extra[i])
+	}
+	return values
+}
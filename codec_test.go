@@ -0,0 +1,61 @@
+package datastoreadapter
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2"
+)
+
+// upperCodec stores values in upper case, prefixed with their field.
+type upperCodec struct{}
+
+func (upperCodec) Encode(_ context.Context, _ string, field int, value string) (string, error) {
+	return string(rune('0'+field)) + ":" + strings.ToUpper(value), nil
+}
+
+func (upperCodec) Decode(_ context.Context, _ string, _ int, stored string) (string, error) {
+	return strings.ToLower(stored[2:]), nil
+}
+
+func TestCodec(t *testing.T) {
+	config := Config{Kind: "casbin_test_codec", Namespace: "unittest", Codec: upperCodec{}, IndexFallback: true}
+	initPolicy(t, config)
+	ctx := context.Background()
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	var raw []CasbinRule
+	query := datastore.NewQuery(config.Kind).Namespace(config.Namespace).Ancestor(a.pseudoRootKey()).Filter("p_type =", "g")
+	if _, err := a.db.GetAll(ctx, query, &raw); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(raw) != 1 || raw[0].V0 != "0:ALICE" || raw[0].V1 != "1:DATA2_ADMIN" || raw[0].V2 != "" {
+		t.Errorf("got %+v, wants encoded values", raw)
+	}
+
+	if err := a.RemovePolicyCtx(ctx, "p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	plans, err := a.filteredPlans(ctx, Filter{PType: "p", FieldIndex: 1, FieldValues: []string{"data2", "write"}})
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	var matched int
+	err = a.paginateFallback(ctx, plans[0], true, func(keys []*datastore.Key, _ []CasbinRule) error {
+		matched += len(keys)
+		return nil
+	})
+	if err != nil || matched != 2 {
+		t.Errorf("got %d, %v, wants 2 rules matched by the fallback", matched, err)
+	}
+	if err := a.RemoveFilteredPolicyCtx(ctx, "p", "p", 1, "data2", "write"); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	testGetPolicy(e, [][]string{{"data2_admin", "data2", "read"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+}
@@ -0,0 +1,34 @@
+package datastoreadapter
+
+import (
+	"context"
+
+	"cloud.google.com/go/datastore"
+)
+
+type readTransactionKey struct{}
+
+// readTransaction returns the read-only transaction the reads of the
+// operation running with ctx are made in, or nil.
+func readTransaction(ctx context.Context) *datastore.Transaction {
+	tx, _ := ctx.Value(readTransactionKey{}).(*datastore.Transaction)
+	return tx
+}
+
+// readConsistently runs fn, which reads the rules, in a read-only transaction
+// if Config.ConsistentLoad is set, so that all the pages fn reads, along with
+// the policy version, reflect the same state of the policy. The queries and
+// lookups made by fetchPage and readVersion with the context fn is given join
+// the transaction.
+//
+// The transaction is attempted once only, since fn feeds the rules to the
+// model as they arrive.
+func (a *Adapter) readConsistently(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !a.consistentLoad || readTransaction(ctx) != nil {
+		return fn(ctx)
+	}
+	_, err := a.db.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		return fn(context.WithValue(ctx, readTransactionKey{}, tx))
+	}, datastore.ReadOnly, datastore.MaxAttempts(1))
+	return err
+}
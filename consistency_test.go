@@ -0,0 +1,60 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+)
+
+// txCodec records whether the values it decodes are read in a transaction.
+type txCodec struct {
+	decoded, inTransaction int
+}
+
+func (c *txCodec) Encode(ctx context.Context, ptype string, field int, value string) (string, error) {
+	return value, nil
+}
+
+func (c *txCodec) Decode(ctx context.Context, ptype string, field int, stored string) (string, error) {
+	c.decoded++
+	if readTransaction(ctx) != nil {
+		c.inTransaction++
+	}
+	return stored, nil
+}
+
+func TestConsistentLoad(t *testing.T) {
+	config := Config{Kind: "casbin_test_consistent", Namespace: "unittest", PageSize: 2}
+	initPolicy(t, config)
+
+	for _, consistent := range []bool{false, true} {
+		codec := &txCodec{}
+		config.Codec = codec
+		config.ConsistentLoad = consistent
+		a := NewAdapterWithConfig(getDatastore(), config)
+
+		e, err := casbin.NewEnforcer("examples/rbac_model.conf", a)
+		if err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+		testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+			t.Error("got: ", actual, ", wants ", wants)
+		})
+		if codec.decoded == 0 {
+			t.Fatalf("got no value decoded")
+		}
+		if wants := map[bool]int{false: 0, true: codec.decoded}[consistent]; codec.inTransaction != wants {
+			t.Errorf("got %d of %d values read in a transaction with ConsistentLoad %v, wants %d", codec.inTransaction, codec.decoded, consistent, wants)
+		}
+
+		// The filtered loads read in a transaction as well.
+		inTransaction := codec.inTransaction
+		if err := e.LoadFilteredPolicy(Filter{PType: "p", FieldValues: []string{"alice"}}); err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+		if read := codec.inTransaction > inTransaction; read != consistent {
+			t.Errorf("got values read in a transaction %v with ConsistentLoad %v, wants %v", read, consistent, consistent)
+		}
+	}
+}
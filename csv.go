@@ -0,0 +1,166 @@
+package datastoreadapter
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+)
+
+// ImportMode selects how ImportPolicyCSV treats the rules already stored.
+type ImportMode int
+
+const (
+	// ImportMerge adds the imported rules which are not stored yet.
+	ImportMerge ImportMode = iota
+	// ImportReplace replaces the stored rules with the imported ones.
+	ImportReplace
+)
+
+// ExportPolicyCSV writes the stored rules to w in the format of the policy
+// files of the Casbin file adapter, e.g. "p, alice, data1, read". Rules are
+// streamed page by page. Expired and soft deleted rules are left out.
+func (a *Adapter) ExportPolicyCSV(ctx context.Context, w io.Writer) error {
+	return a.do(ctx, "ExportPolicyCSV", func(ctx context.Context) error {
+		bw := bufio.NewWriter(w)
+		now := a.now()
+		_, err := a.paginateRules(ctx, false, "", func(_ []*datastore.Key, rules []CasbinRule) error {
+			for _, rule := range rules {
+				if rule.deleted() || rule.expired(now) {
+					continue
+				}
+				if _, err := fmt.Fprintln(bw, policyCSVLine(rule)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return bw.Flush()
+	})
+}
+
+// ImportPolicyCSV reads rules from r, in the format of the policy files of
+// the Casbin file adapter, and stores them according to mode. Blank lines and
+// lines starting with "#" are skipped, as are duplicate rules.
+//
+// The file is streamed and written in batches, so a large one is not
+// imported atomically; on failure, the rules of the batches written so far
+// are kept. ImportReplace drops the stored rules first, preserving the
+// metadata of those imported again, as SavePolicy does.
+func (a *Adapter) ImportPolicyCSV(ctx context.Context, r io.Reader, mode ImportMode) error {
+	return a.do(ctx, "ImportPolicyCSV", func(ctx context.Context) error {
+		return a.importRules(ctx, mode, func(add func(CasbinRule) error) error {
+			scanner := bufio.NewScanner(r)
+			for n := 1; scanner.Scan(); n++ {
+				line, ok, err := parsePolicyCSVLine(scanner.Text())
+				if err != nil {
+					return fmt.Errorf("line %d: %w", n, err)
+				}
+				if !ok {
+					continue
+				}
+				if err := add(line); err != nil {
+					return err
+				}
+			}
+			return scanner.Err()
+		}, nil)
+	})
+}
+
+// importRules stores the rules scan adds according to mode, in batches of up
+// to maxRuleMutations rules. Duplicate rules are skipped. If progress is not
+// nil, it is called with the number of rules written so far after each batch.
+func (a *Adapter) importRules(ctx context.Context, mode ImportMode, scan func(add func(CasbinRule) error) error, progress func(int)) error {
+	if a.readOnly {
+		return ErrReadOnly
+	}
+	defer a.lockRules()()
+	a.audit(ctx, AuditEntry{})
+
+	stored := make(ruleMetadata)
+	var commits batchCommits
+	_, err := a.paginateRules(ctx, false, "", func(keys []*datastore.Key, rules []CasbinRule) error {
+		stored.collect(rules)
+		if mode != ImportReplace {
+			return nil
+		}
+		live := liveKeys(keys, rules)
+		if err := a.deleteRules(ctx, false, live); err != nil {
+			return err
+		}
+		commits.delete(live)
+		return nil
+	})
+	if err != nil {
+		return commits.fail(err, nil)
+	}
+
+	written := make(map[ruleID]bool)
+	var batch []interface{}
+	n := 0
+	flush := func() error {
+		stored.stamp(ctx, batch, a.now())
+		if err := a.putRules(ctx, false, batch, nil); err != nil {
+			// The error lists the rules of the batch.
+			batch = nil
+			return err
+		}
+		commits.write(batch)
+		n += len(batch)
+		batch = batch[:0]
+		if progress != nil {
+			progress(n)
+		}
+		return nil
+	}
+
+	err = scan(func(line CasbinRule) error {
+		if written[ruleFields(line)] {
+			return nil
+		}
+		if _, ok := stored[ruleFields(line)]; ok && mode == ImportMerge {
+			return nil
+		}
+		written[ruleFields(line)] = true
+
+		batch = append(batch, &line)
+		if len(batch) == maxRuleMutations {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return commits.fail(err, batch)
+	}
+	return commits.fail(flush(), nil)
+}
+
+// policyCSVLine formats rule as a line of a policy file.
+func policyCSVLine(rule CasbinRule) string {
+	return strings.Join(append([]string{rule.PType}, ruleValues(rule)...), ", ")
+}
+
+// parsePolicyCSVLine parses a line of a policy file. It reports false for
+// blank lines and comments. The values past v5 go to the Extra values.
+func parsePolicyCSVLine(text string) (CasbinRule, bool, error) {
+	text = strings.TrimSpace(text)
+	if text == "" || strings.HasPrefix(text, "#") {
+		return CasbinRule{}, false, nil
+	}
+
+	fields := strings.Split(text, ",")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	if len(fields) < 2 {
+		return CasbinRule{}, false, fmt.Errorf("invalid rule %q", text)
+	}
+	return savePolicyLine(fields[0], fields[1:]), true, nil
+}
@@ -0,0 +1,91 @@
+package datastoreadapter
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+)
+
+func TestPolicyCSV(t *testing.T) {
+	ctx := context.Background()
+	config := Config{Kind: "casbin_test_csv", Namespace: "unittest"}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	// The export matches the policy file the policy was saved from.
+	var buf bytes.Buffer
+	if err := a.ExportPolicyCSV(ctx, &buf); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	b, _ := ioutil.ReadFile("examples/rbac_policy.csv")
+	if got, wants := sortedLines(buf.String()), sortedLines(string(b)); got != wants {
+		t.Errorf("got %q, wants %q", got, wants)
+	}
+
+	// Merging skips the rules already stored and duplicates.
+	csv := "# comment\n\np, alice, data1, read\np, carol, data3, read\np, carol, data3, read\n"
+	if err := a.ImportPolicyCSV(ctx, strings.NewReader(csv), ImportMerge); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if n, _ := a.CountPolicies(ctx); n != 6 {
+		t.Errorf("got %d rules, wants 6", n)
+	}
+
+	if err := a.ImportPolicyCSV(ctx, strings.NewReader(csv), ImportReplace); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"carol", "data3", "read"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+
+	if err := a.ImportPolicyCSV(ctx, strings.NewReader("p\n"), ImportMerge); err == nil {
+		t.Error("got no error, wants an error")
+	}
+}
+
+func TestPolicyCSVExtraValues(t *testing.T) {
+	ctx := context.Background()
+	config := Config{Kind: "casbin_test_csv_extra", Namespace: "unittest"}
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	csv := "p, alice, data1, read, allow, tenant1, region1, zone1, rack1\np, bob, data2, write\n"
+	if err := a.ImportPolicyCSV(ctx, strings.NewReader(csv), ImportReplace); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	// The export imports back into the same rules.
+	var buf bytes.Buffer
+	if err := a.ExportPolicyCSV(ctx, &buf); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if got, wants := sortedLines(buf.String()), sortedLines(csv); got != wants {
+		t.Errorf("got %q, wants %q", got, wants)
+	}
+	if err := a.ImportPolicyCSV(ctx, bytes.NewReader(buf.Bytes()), ImportReplace); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	buf.Reset()
+	if err := a.ExportPolicyCSV(ctx, &buf); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if got, wants := sortedLines(buf.String()), sortedLines(csv); got != wants {
+		t.Errorf("got %q, wants %q", got, wants)
+	}
+}
+
+func sortedLines(s string) string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
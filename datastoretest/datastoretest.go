@@ -0,0 +1,246 @@
+// Package datastoretest helps to write integration tests of code using the
+// datastore adapter against the Datastore emulator.
+//
+// Tests connect to the emulator DATASTORE_EMULATOR_HOST points to. Packages
+// can instead start one for the duration of their tests from TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		datastoretest.Main(m)
+//	}
+//
+// Each test then gets an isolated namespace, which is emptied when it ends:
+//
+//	func TestSomething(t *testing.T) {
+//		env := datastoretest.New(t)
+//		a := env.Seed(env.NewAdapter(datastoreadapter.Config{}),
+//			[]string{"p", "alice", "data1", "read"},
+//			[]string{"g", "alice", "admin"},
+//		)
+//		...
+//	}
+package datastoretest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	datastoreadapter "github.com/reedom/datastore-adapter/v3"
+)
+
+// DefaultProjectID is the project ID used with the emulator when
+// DATASTORE_PROJECT_ID is not set.
+const DefaultProjectID = "datastoretest"
+
+// Emulator is a Datastore emulator process started by StartEmulator.
+type Emulator struct {
+	// Host is the host:port the emulator listens on.
+	Host string
+	cmd  *exec.Cmd
+}
+
+// StartEmulator starts the Datastore emulator with gcloud and waits until it
+// accepts requests. The emulator keeps its data in memory only.
+func StartEmulator(ctx context.Context) (*Emulator, error) {
+	port, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	host := fmt.Sprintf("localhost:%d", port)
+
+	cmd := exec.Command("gcloud", "beta", "emulators", "datastore", "start",
+		"--no-store-on-disk", "--consistency=1.0",
+		"--host-port="+host, "--project="+projectID())
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	e := &Emulator{Host: host, cmd: cmd}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		resp, err := http.Get("http://" + host)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return e, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			e.Stop()
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop shuts the emulator down.
+func (e *Emulator) Stop() error {
+	resp, err := http.Post("http://"+e.Host+"/shutdown", "", nil)
+	if err == nil {
+		resp.Body.Close()
+	} else {
+		e.cmd.Process.Kill()
+	}
+	return e.cmd.Wait()
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// Main runs the tests of m, starting the emulator for the duration of them if
+// DATASTORE_EMULATOR_HOST is not set, and exits. If gcloud is not installed,
+// the tests using New are skipped.
+func Main(m *testing.M) {
+	var e *Emulator
+	if os.Getenv("DATASTORE_EMULATOR_HOST") == "" {
+		if _, err := exec.LookPath("gcloud"); err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			e, err = StartEmulator(ctx)
+			cancel()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "datastoretest: cannot start the emulator:", err)
+				os.Exit(1)
+			}
+			os.Setenv("DATASTORE_EMULATOR_HOST", e.Host)
+		}
+	}
+
+	code := m.Run()
+	if e != nil {
+		e.Stop()
+	}
+	os.Exit(code)
+}
+
+func projectID() string {
+	if id := os.Getenv("DATASTORE_PROJECT_ID"); id != "" {
+		return id
+	}
+	return DefaultProjectID
+}
+
+// Env is the environment of a test created by New.
+type Env struct {
+	// Client is connected to the emulator.
+	Client *datastore.Client
+	// Namespace is the namespace isolating the test.
+	Namespace string
+
+	t testing.TB
+}
+
+var namespaceSeq int64
+
+// New connects to the emulator and returns the environment of the test t,
+// whose namespace is emptied when t ends. It skips t if
+// DATASTORE_EMULATOR_HOST is not set.
+func New(t testing.TB) *Env {
+	t.Helper()
+	if os.Getenv("DATASTORE_EMULATOR_HOST") == "" {
+		t.Skip("DATASTORE_EMULATOR_HOST is not set; run the emulator or use datastoretest.Main")
+	}
+
+	ctx := context.Background()
+	client, err := datastore.NewClient(ctx, projectID())
+	if err != nil {
+		t.Fatalf("datastoretest: %v", err)
+	}
+
+	e := &Env{
+		Client:    client,
+		Namespace: namespaceFor(t),
+		t:         t,
+	}
+	t.Cleanup(func() {
+		if err := e.clear(ctx); err != nil {
+			t.Errorf("datastoretest: clearing namespace %q: %v", e.Namespace, err)
+		}
+		client.Close()
+	})
+	return e
+}
+
+// namespaceFor returns a namespace unique to t in the test run. Namespaces
+// only allow [0-9A-Za-z._-].
+func namespaceFor(t testing.TB) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, t.Name())
+	if len(name) > 60 {
+		name = name[:60]
+	}
+	return fmt.Sprintf("%s-%d-%d", name, os.Getpid(), atomic.AddInt64(&namespaceSeq, 1))
+}
+
+// clear deletes every entity in the namespace of e.
+func (e *Env) clear(ctx context.Context) error {
+	keys, err := e.Client.GetAll(ctx, datastore.NewQuery("").Namespace(e.Namespace).KeysOnly(), nil)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(keys); start += 500 {
+		end := start + 500
+		if end > len(keys) {
+			end = len(keys)
+		}
+		if err := e.Client.DeleteMulti(ctx, keys[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewAdapter returns an adapter with config, whose Namespace is replaced with
+// the namespace of e. The adapter doesn't close the client of e when
+// released; e closes it once the test is done.
+func (e *Env) NewAdapter(config datastoreadapter.Config) *datastoreadapter.Adapter {
+	config.Namespace = e.Namespace
+	return datastoreadapter.NewAdapterWithSharedClient(e.Client, config)
+}
+
+// Seed adds rules, each of which is a ptype followed by the rule values, to a
+// and returns a. It fails the test on error.
+func (e *Env) Seed(a *datastoreadapter.Adapter, rules ...[]string) *datastoreadapter.Adapter {
+	e.t.Helper()
+	for _, rule := range rules {
+		if len(rule) == 0 {
+			e.t.Fatal("datastoretest: empty rule")
+		}
+		if err := a.AddPolicyCtx(context.Background(), rule[0][:1], rule[0], rule[1:]); err != nil {
+			e.t.Fatalf("datastoretest: seeding %v: %v", rule, err)
+		}
+	}
+	return a
+}
+
+// SaveModel stores the model definition in the file at path with config,
+// whose Namespace is replaced with the namespace of e. It fails the test on
+// error.
+func (e *Env) SaveModel(path string, config datastoreadapter.Config) {
+	e.t.Helper()
+	config.Namespace = e.Namespace
+	if err := datastoreadapter.SaveModelCtx(context.Background(), e.Client, path, config); err != nil {
+		e.t.Fatalf("datastoretest: saving model: %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package datastoretest
+
+import (
+	"context"
+	"testing"
+
+	datastoreadapter "github.com/reedom/datastore-adapter/v3"
+)
+
+func TestMain(m *testing.M) {
+	Main(m)
+}
+
+func TestEnv(t *testing.T) {
+	var namespace string
+	t.Run("seed", func(t *testing.T) {
+		env := New(t)
+		namespace = env.Namespace
+		env.SaveModel("../examples/rbac_model.conf", datastoreadapter.Config{})
+		a := env.Seed(env.NewAdapter(datastoreadapter.Config{}),
+			[]string{"p", "alice", "data1", "read"},
+			[]string{"g", "alice", "data2_admin"},
+		)
+
+		n, err := a.CountPolicies(context.Background())
+		if err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+		if n != 2 {
+			t.Errorf("got %d rules, wants 2", n)
+		}
+	})
+
+	env := New(t)
+	if env.Namespace == namespace {
+		t.Errorf("got namespace %q twice, wants a namespace per test", namespace)
+	}
+	n, err := datastoreadapter.NewAdapterWithSharedClient(env.Client, datastoreadapter.Config{Namespace: namespace}).CountPolicies(context.Background())
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if n != 0 {
+		t.Errorf("got %d rules left, wants 0", n)
+	}
+}
@@ -0,0 +1,109 @@
+package datastoreadapter
+
+import (
+	"context"
+	"sort"
+
+	"github.com/casbin/casbin/v2/model"
+)
+
+// PolicyDiff describes how the stored rules differ from another policy.
+// A rule whose values differ shows up as removed and added.
+type PolicyDiff struct {
+	// Added are the rules of the other policy which are not stored.
+	Added []PolicyRule
+	// Removed are the stored rules which the other policy lacks.
+	Removed []PolicyRule
+	// Changed are the rules of both whose expiry differs.
+	Changed []PolicyRule
+}
+
+// ruleSetDiff is the difference between two sets of rules.
+type ruleSetDiff struct {
+	added, removed, changed []*storedRule
+}
+
+// diffRuleSets returns how stored differs from target. The rules of added
+// and changed are those of target. Each of them is sorted.
+func diffRuleSets(stored, target map[ruleID]*storedRule) ruleSetDiff {
+	var diff ruleSetDiff
+	for fields, t := range target {
+		s, ok := stored[fields]
+		switch {
+		case !ok:
+			diff.added = append(diff.added, t)
+		case !s.rule.ExpiresAt.Equal(t.rule.ExpiresAt):
+			diff.changed = append(diff.changed, t)
+		}
+	}
+	for fields, s := range stored {
+		if _, ok := target[fields]; !ok {
+			diff.removed = append(diff.removed, s)
+		}
+	}
+
+	for _, rules := range [][]*storedRule{diff.added, diff.removed, diff.changed} {
+		sort.Slice(rules, func(i, j int) bool { return policyCSVLine(rules[i].rule) < policyCSVLine(rules[j].rule) })
+	}
+	return diff
+}
+
+func (d ruleSetDiff) policyDiff() *PolicyDiff {
+	rules := func(s []*storedRule) []PolicyRule {
+		var rules []PolicyRule
+		for _, r := range s {
+			rules = append(rules, newPolicyRule(r.rule))
+		}
+		return rules
+	}
+	return &PolicyDiff{Added: rules(d.added), Removed: rules(d.removed), Changed: rules(d.changed)}
+}
+
+// DiffPolicies returns how the rules stored by a differ from those stored by
+// other, e.g. another namespace or project, for reviewing a promotion before
+// SyncPolicies applies it. Soft deleted and expired rules are ignored.
+func (a *Adapter) DiffPolicies(ctx context.Context, other *Adapter) (*PolicyDiff, error) {
+	var diff *PolicyDiff
+	err := a.do(ctx, "DiffPolicies", func(ctx context.Context) error {
+		stored, err := a.liveRuleSet(ctx)
+		if err != nil {
+			return err
+		}
+		target, err := other.liveRuleSet(ctx)
+		if err != nil {
+			return err
+		}
+		diff = diffRuleSets(stored, target).policyDiff()
+		return nil
+	})
+	return diff, err
+}
+
+// DiffWithModel returns how the rules stored by a differ from those of m,
+// e.g. before SavePolicy stores them. Soft deleted and expired rules are
+// ignored, and rules differing only in their expiry are not reported.
+func (a *Adapter) DiffWithModel(ctx context.Context, m model.Model) (*PolicyDiff, error) {
+	var diff *PolicyDiff
+	err := a.do(ctx, "DiffWithModel", func(ctx context.Context) error {
+		stored, err := a.liveRuleSet(ctx)
+		if err != nil {
+			return err
+		}
+
+		target := make(map[ruleID]*storedRule)
+		for _, sec := range []string{"p", "g"} {
+			for ptype, ast := range m[sec] {
+				for _, rule := range ast.Policy {
+					line := savePolicyLine(ptype, rule)
+					if s, ok := stored[ruleFields(line)]; ok {
+						line.ExpiresAt = s.rule.ExpiresAt
+					}
+					target[ruleFields(line)] = &storedRule{rule: line}
+				}
+			}
+		}
+		diff = diffRuleSets(stored, target).policyDiff()
+		return nil
+	})
+	return diff, err
+}
@@ -0,0 +1,56 @@
+package datastoreadapter
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+)
+
+func TestDiffPolicies(t *testing.T) {
+	ctx := context.Background()
+	config := Config{Kind: "casbin_test_diff", Namespace: "unittest"}
+	initPolicy(t, config)
+	initPolicy(t, Config{Kind: config.Kind, Namespace: "unittest_diff"})
+	a := NewAdapterWithConfig(getDatastore(), config)
+	other := a.ForNamespace("unittest_diff")
+
+	if err := other.AddPolicy("p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := other.RemovePolicy("p", "p", []string{"bob", "data2", "write"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := other.RemovePolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := other.AddPolicyWithExpiry(ctx, "p", "p", []string{"alice", "data1", "read"}, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	diff, err := a.DiffPolicies(ctx, other)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	wants := &PolicyDiff{
+		Added:   []PolicyRule{{PType: "p", Rule: []string{"carol", "data3", "read"}}},
+		Removed: []PolicyRule{{PType: "p", Rule: []string{"bob", "data2", "write"}}},
+		Changed: []PolicyRule{{PType: "p", Rule: []string{"alice", "data1", "read"}}},
+	}
+	if !reflect.DeepEqual(diff, wants) {
+		t.Errorf("got %+v, wants %+v", diff, wants)
+	}
+
+	// The model of an enforcer loaded from other lacks expiries.
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", other)
+	diff, err = a.DiffWithModel(ctx, e.GetModel())
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	wants.Changed = nil
+	if !reflect.DeepEqual(diff, wants) {
+		t.Errorf("got %+v, wants %+v", diff, wants)
+	}
+}
@@ -0,0 +1,104 @@
+package datastoreadapter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2/model"
+)
+
+// domainColumn returns the position of the domain among the values of the
+// rules of ptype, as the RBAC with domains models define them: the second
+// value of the p rules, after the subject, and the third one of the g rules,
+// after the user and the role.
+//
+//	p = sub, dom, obj, act
+//	g = _, _, _
+func domainColumn(ptype string) int {
+	if strings.HasPrefix(ptype, "g") {
+		return 2
+	}
+	return 1
+}
+
+// LoadDomainPolicy loads the rules of domain into the model, that is, the
+// rules of each ptype the model defines whose domain, as domainColumn places
+// it, is domain. The rules of the ptypes defined without a domain, such as
+// g = _, _, are loaded whole, since they apply to every domain. Like
+// LoadFilteredPolicy, it marks the adapter as filtered, so that SavePolicy
+// fails.
+func (a *Adapter) LoadDomainPolicy(ctx context.Context, model model.Model, domain string) error {
+	return a.do(ctx, "LoadDomainPolicy", func(ctx context.Context) error {
+		if domain == "" {
+			return wrapError("LoadDomainPolicy", fmt.Errorf("%w: empty domain", ErrInvalidFilter))
+		}
+		arity := modelArity(model)
+		ptypes := make([]string, 0, len(arity))
+		for ptype := range arity {
+			ptypes = append(ptypes, ptype)
+		}
+		sort.Strings(ptypes)
+
+		filters := make([]Filter, len(ptypes))
+		for i, ptype := range ptypes {
+			filters[i] = Filter{PType: ptype}
+			if column := domainColumn(ptype); column < arity[ptype] {
+				filters[i].FieldIndex = column
+				filters[i].FieldValues = []string{domain}
+			}
+		}
+		return a.loadFiltered(ctx, "LoadDomainPolicy", model, filters)
+	})
+}
+
+// RemoveDomainPolicies removes the stored rules of domain, that is, the p and
+// g rules whose domain, as domainColumn places it, is domain, e.g. when a
+// tenant leaves, and returns the number of rules removed. The ptypes are
+// listed with a projection query, and their rules are removed as with
+// RemoveFilteredPolicy, in batches.
+func (a *Adapter) RemoveDomainPolicies(ctx context.Context, domain string) (int, error) {
+	removed := 0
+	err := a.do(ctx, "RemoveDomainPolicies", func(ctx context.Context) error {
+		if a.readOnly {
+			return ErrReadOnly
+		}
+		if domain == "" {
+			return fmt.Errorf("%w: empty domain", ErrInvalidFilter)
+		}
+		defer a.lockRules()()
+
+		ptypes, err := a.storedPTypes(ctx)
+		if err != nil {
+			return err
+		}
+		a.audit(ctx, AuditEntry{Rule: []string{domain}})
+
+		var commits batchCommits
+		for _, ptype := range ptypes {
+			if !strings.HasPrefix(ptype, "p") && !strings.HasPrefix(ptype, "g") {
+				continue
+			}
+			plans, err := a.filteredPlans(ctx, Filter{PType: ptype, FieldIndex: domainColumn(ptype), FieldValues: []string{domain}})
+			if err != nil {
+				return err
+			}
+			err = a.paginatePlans(ctx, plans, true, func(keys []*datastore.Key, _ []CasbinRule) error {
+				n, err := a.removeRules(ctx, keys)
+				if err != nil {
+					return err
+				}
+				removed += n
+				commits.delete(keys)
+				return nil
+			})
+			if err != nil {
+				return commits.fail(err, nil)
+			}
+		}
+		return nil
+	})
+	return removed, err
+}
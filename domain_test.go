@@ -0,0 +1,87 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/casbin/casbin/v2/model"
+)
+
+const domainModel = `
+[request_definition]
+r = sub, dom, obj, act
+
+[policy_definition]
+p = sub, dom, obj, act
+
+[role_definition]
+g = _, _, _
+g2 = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub, r.dom) && r.dom == p.dom && r.obj == p.obj && r.act == p.act
+`
+
+func TestDomainPolicy(t *testing.T) {
+	config := Config{Kind: "casbin_test_domain", Namespace: "unittest"}
+	a := NewAdapterWithConfig(getDatastore(), config)
+	ctx := context.Background()
+
+	m, err := model.NewModelFromString(domainModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.AddPolicy("p", "p", []string{"admin", "domain1", "data1", "read"})
+	m.AddPolicy("p", "p", []string{"admin", "domain2", "data2", "read"})
+	m.AddPolicy("g", "g", []string{"alice", "admin", "domain1"})
+	m.AddPolicy("g", "g", []string{"bob", "admin", "domain2"})
+	m.AddPolicy("g", "g2", []string{"data1", "data_group"})
+	if err := a.SavePolicyCtx(ctx, m); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	loaded, err := model.NewModelFromString(domainModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.LoadDomainPolicy(ctx, loaded, "domain1"); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if p := loaded["p"]["p"].Policy; len(p) != 1 || p[0][1] != "domain1" {
+		t.Errorf("got %v, wants the p rule of domain1", p)
+	}
+	if g := loaded["g"]["g"].Policy; len(g) != 1 || g[0][0] != "alice" {
+		t.Errorf("got %v, wants the g rule of domain1", g)
+	}
+	if g2 := loaded["g"]["g2"].Policy; len(g2) != 1 {
+		t.Errorf("got %v, wants the g2 rule without a domain", g2)
+	}
+	if !a.IsFiltered() {
+		t.Errorf("got unfiltered, wants filtered")
+	}
+
+	n, err := a.RemoveDomainPolicies(ctx, "domain1")
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if n != 2 {
+		t.Errorf("got %d, wants 2 rules removed", n)
+	}
+	rules := storedRules(t, a)
+	if len(rules) != 3 {
+		t.Errorf("got %v, wants the rules of domain2 and the g2 rule", rules)
+	}
+	for _, rule := range rules {
+		if rule.V1 == "domain1" || rule.V2 == "domain1" {
+			t.Errorf("got %+v, wants the rules of domain1 removed", rule)
+		}
+	}
+
+	if _, err := a.RemoveDomainPolicies(ctx, ""); !errors.Is(err, ErrInvalidFilter) {
+		t.Errorf("got %v, wants %v", err, ErrInvalidFilter)
+	}
+}
@@ -0,0 +1,64 @@
+package datastoreadapter
+
+import (
+	"context"
+
+	"cloud.google.com/go/datastore"
+)
+
+// MutationKind is the kind of a Mutation.
+type MutationKind string
+
+const (
+	// MutationPut stores a new rule.
+	MutationPut MutationKind = "put"
+	// MutationDelete deletes a rule.
+	MutationDelete MutationKind = "delete"
+	// MutationSoftDelete marks a rule as deleted; see Config.SoftDelete.
+	MutationSoftDelete MutationKind = "soft_delete"
+	// MutationUpdate rewrites the expiry of a rule; see SyncPolicies.
+	MutationUpdate MutationKind = "update"
+)
+
+// Mutation is a mutation of a rule an operation would perform under
+// WithDryRun.
+type Mutation struct {
+	Kind MutationKind
+	// Key is the key of the rule deleted or updated, or nil for
+	// MutationPut.
+	Key *datastore.Key
+	// Rule is the rule stored, or zero for deletes.
+	Rule PolicyRule
+}
+
+type dryRunKey struct{}
+
+// WithDryRun returns a context under which the mutating operations, such as
+// AddPolicy, RemovePolicy and SavePolicy, call record with each mutation of
+// a rule they would perform instead of writing anything. They still read the
+// stored rules, e.g. to find the ones to delete, but neither write audit
+// entries nor take the policy lock.
+func WithDryRun(ctx context.Context, record func(Mutation)) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, record)
+}
+
+// dryRun returns the function recording the mutations of the dry run ctx is
+// for, or nil.
+func dryRun(ctx context.Context) func(Mutation) {
+	record, _ := ctx.Value(dryRunKey{}).(func(Mutation))
+	return record
+}
+
+// recordPuts records the puts of lines, which are *CasbinRule.
+func recordPuts(record func(Mutation), lines []interface{}) {
+	for _, line := range lines {
+		record(Mutation{Kind: MutationPut, Rule: newPolicyRule(*line.(*CasbinRule))})
+	}
+}
+
+// recordDeletes records the deletes, or the updates, of keys.
+func recordDeletes(record func(Mutation), kind MutationKind, keys []*datastore.Key) {
+	for _, key := range keys {
+		record(Mutation{Kind: kind, Key: key})
+	}
+}
@@ -0,0 +1,53 @@
+package datastoreadapter
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+)
+
+func TestDryRun(t *testing.T) {
+	config := Config{Kind: "casbin_test_dryrun", Namespace: "unittest"}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	var mutations []Mutation
+	ctx := WithDryRun(context.Background(), func(m Mutation) { mutations = append(mutations, m) })
+
+	if err := a.AddPolicyCtx(ctx, "p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.RemoveFilteredPolicyCtx(ctx, "p", "p", 0, "data2_admin"); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	if len(mutations) != 3 {
+		t.Fatalf("got %d mutations, wants 3", len(mutations))
+	}
+	wants := Mutation{Kind: MutationPut, Rule: PolicyRule{PType: "p", Rule: []string{"carol", "data3", "read"}}}
+	if !reflect.DeepEqual(mutations[0], wants) {
+		t.Errorf("got %+v, wants %+v", mutations[0], wants)
+	}
+	for _, m := range mutations[1:] {
+		if m.Kind != MutationDelete || m.Key == nil {
+			t.Errorf("got %+v, wants a delete", m)
+		}
+	}
+
+	// Nothing is written.
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+
+	// SavePolicy reports replacing every rule.
+	mutations = nil
+	if err := a.SavePolicyCtx(ctx, e.GetModel()); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(mutations) != 10 {
+		t.Errorf("got %d mutations, wants 10", len(mutations))
+	}
+}
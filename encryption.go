@@ -0,0 +1,261 @@
+package datastoreadapter
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// KeyEncrypter encrypts and decrypts the data key which encrypts the rule
+// values, such as with a Cloud KMS key:
+//
+//	type kmsEncrypter struct {
+//		client *kms.KeyManagementClient
+//		name   string // projects/p/locations/l/keyRings/r/cryptoKeys/k
+//	}
+//
+//	func (e kmsEncrypter) Encrypt(ctx context.Context, plaintext []byte) ([]byte, error) {
+//		resp, err := e.client.Encrypt(ctx, &kmspb.EncryptRequest{Name: e.name, Plaintext: plaintext})
+//		if err != nil {
+//			return nil, err
+//		}
+//		return resp.Ciphertext, nil
+//	}
+//
+//	func (e kmsEncrypter) Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error) {
+//		resp, err := e.client.Decrypt(ctx, &kmspb.DecryptRequest{Name: e.name, Ciphertext: ciphertext})
+//		if err != nil {
+//			return nil, err
+//		}
+//		return resp.Plaintext, nil
+//	}
+type KeyEncrypter interface {
+	Encrypt(ctx context.Context, plaintext []byte) ([]byte, error)
+	Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error)
+}
+
+// dataKeyName is the key name of the entity holding the encrypted data key.
+const dataKeyName = "data_key"
+
+// encryptedPrefix marks encrypted rule values.
+const encryptedPrefix = "enc:"
+
+// dataKey is the entity holding the data key encrypted by the KeyEncrypter.
+// It is a root entity, so it isn't scanned along with the rules.
+type dataKey struct {
+	Key       []byte    `datastore:"key,noindex"`
+	CreatedAt time.Time `datastore:"created_at,noindex"`
+}
+
+// valueCipher encrypts rule values deterministically, so that the exact-match
+// queries of RemovePolicy, RemoveFilteredPolicy and Config.Deduplicate still
+// work: the nonce is derived from the value with HMAC-SHA256, as in SIV
+// modes. It discloses which values are equal, but nothing else.
+type valueCipher struct {
+	aead   cipher.AEAD
+	macKey []byte
+}
+
+func newValueCipher(key []byte) (*valueCipher, error) {
+	if len(key) != 64 {
+		return nil, errors.New("invalid data key")
+	}
+	block, err := aes.NewCipher(key[:32])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &valueCipher{aead: aead, macKey: key[32:]}, nil
+}
+
+func (c *valueCipher) encrypt(value string) string {
+	mac := hmac.New(sha256.New, c.macKey)
+	mac.Write([]byte(value))
+	nonce := mac.Sum(nil)[:c.aead.NonceSize()]
+	sealed := c.aead.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedPrefix + base64.RawURLEncoding.EncodeToString(sealed)
+}
+
+func (c *valueCipher) decrypt(stored string) (string, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(stored, encryptedPrefix))
+	if err != nil {
+		return "", err
+	}
+	n := c.aead.NonceSize()
+	if len(sealed) < n {
+		return "", errors.New("invalid encrypted value")
+	}
+	value, err := c.aead.Open(nil, sealed[:n], sealed[n:], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+func (a *Adapter) dataKeyKey() *datastore.Key {
+	key := datastore.NameKey(a.kind, dataKeyName, nil)
+	key.Namespace = a.namespace
+	return key
+}
+
+// valueCipher returns the cipher of the rule values. The data key is generated and stored on
+// first use, and decrypted once per adapter.
+func (a *Adapter) valueCipher(ctx context.Context) (*valueCipher, error) {
+	a.keyMu.Lock()
+	defer a.keyMu.Unlock()
+	if a.cipher != nil {
+		return a.cipher, nil
+	}
+
+	var stored dataKey
+	_, err := a.db.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		err := tx.Get(a.dataKeyKey(), &stored)
+		if err != datastore.ErrNoSuchEntity {
+			return err
+		}
+
+		key := make([]byte, 64)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		encrypted, err := a.keyEncrypter.Encrypt(ctx, key)
+		if err != nil {
+			return err
+		}
+		stored = dataKey{Key: encrypted, CreatedAt: a.now()}
+		_, err = tx.Put(a.dataKeyKey(), &stored)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := a.keyEncrypter.Decrypt(ctx, stored.Key)
+	if err != nil {
+		return nil, err
+	}
+	a.cipher, err = newValueCipher(key)
+	return a.cipher, err
+}
+
+// encryptionCodec encrypts the values with the data key of adapter.
+type encryptionCodec struct {
+	adapter *Adapter
+}
+
+func (c encryptionCodec) Encode(ctx context.Context, _ string, _ int, value string) (string, error) {
+	vc, err := c.adapter.valueCipher(ctx)
+	if err != nil {
+		return "", err
+	}
+	return vc.encrypt(value), nil
+}
+
+// Decode leaves the values stored before Config.KeyEncrypter was set as they
+// are.
+func (c encryptionCodec) Decode(ctx context.Context, _ string, _ int, stored string) (string, error) {
+	if !strings.HasPrefix(stored, encryptedPrefix) {
+		return stored, nil
+	}
+	vc, err := c.adapter.valueCipher(ctx)
+	if err != nil {
+		return "", err
+	}
+	return vc.decrypt(stored)
+}
+
+// redactedValue stands for a value which couldn't be encrypted in the
+// records kept outside the rules.
+const redactedValue = "[redacted]"
+
+// encryptValues returns values encrypted as the stored rule values are, if
+// Config.KeyEncrypter is set, so that the records of the rules kept outside
+// them, such as the audit entries, don't disclose them either. Empty values
+// are kept as they are.
+func (a *Adapter) encryptValues(ctx context.Context, values []string) ([]string, error) {
+	if a.keyEncrypter == nil || len(values) == 0 {
+		return values, nil
+	}
+	vc, err := a.valueCipher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	encrypted := make([]string, len(values))
+	for i, v := range values {
+		if v != "" {
+			v = vc.encrypt(v)
+		}
+		encrypted[i] = v
+	}
+	return encrypted, nil
+}
+
+// decryptValues returns the values encrypted by encryptValues decrypted.
+func (a *Adapter) decryptValues(ctx context.Context, values []string) ([]string, error) {
+	if a.keyEncrypter == nil || len(values) == 0 {
+		return values, nil
+	}
+	codec := encryptionCodec{adapter: a}
+	decrypted := make([]string, len(values))
+	for i, v := range values {
+		var err error
+		if decrypted[i], err = codec.Decode(ctx, "", i, v); err != nil {
+			return nil, err
+		}
+	}
+	return decrypted, nil
+}
+
+// encryptRules returns copies of rules whose values are encrypted with
+// encryptValues.
+func (a *Adapter) encryptRules(ctx context.Context, rules []CasbinRule) ([]CasbinRule, error) {
+	return a.transformRules(rules, func(values []string) ([]string, error) {
+		return a.encryptValues(ctx, values)
+	})
+}
+
+// decryptRules returns copies of rules whose values are decrypted with
+// decryptValues.
+func (a *Adapter) decryptRules(ctx context.Context, rules []CasbinRule) ([]CasbinRule, error) {
+	return a.transformRules(rules, func(values []string) ([]string, error) {
+		return a.decryptValues(ctx, values)
+	})
+}
+
+// transformRules returns copies of rules whose values are replaced with
+// those f returns for them.
+func (a *Adapter) transformRules(rules []CasbinRule, f func([]string) ([]string, error)) ([]CasbinRule, error) {
+	if a.keyEncrypter == nil {
+		return rules, nil
+	}
+	transformed := make([]CasbinRule, len(rules))
+	for i, rule := range rules {
+		rule.Extra = append([]string(nil), rule.Extra...)
+		fields := rule.values()
+		values := make([]string, len(fields))
+		for j, v := range fields {
+			values[j] = *v
+		}
+		values, err := f(values)
+		if err != nil {
+			return nil, err
+		}
+		for j, v := range fields {
+			*v = values[j]
+		}
+		transformed[i] = rule
+	}
+	return transformed, nil
+}
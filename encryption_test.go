@@ -0,0 +1,159 @@
+package datastoreadapter
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2"
+)
+
+// xorEncrypter stands in for a KMS key.
+type xorEncrypter byte
+
+func (e xorEncrypter) Encrypt(_ context.Context, plaintext []byte) ([]byte, error) {
+	return e.xor(plaintext), nil
+}
+
+func (e xorEncrypter) Decrypt(_ context.Context, ciphertext []byte) ([]byte, error) {
+	return e.xor(ciphertext), nil
+}
+
+func (e xorEncrypter) xor(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[i] = b[i] ^ byte(e)
+	}
+	return out
+}
+
+func TestEncryption(t *testing.T) {
+	config := Config{Kind: "casbin_test_encryption", Namespace: "unittest", KeyEncrypter: xorEncrypter(0x5a), Deduplicate: true}
+	db := getDatastore()
+	db.Delete(context.Background(), NewAdapterWithConfig(db, config).dataKeyKey())
+	initPolicy(t, config)
+	ctx := context.Background()
+
+	// A new adapter decrypts the same data key.
+	a := NewAdapterWithConfig(db, config)
+	if err := a.AddPolicyCtx(ctx, "p", "p", []string{"carol@example.com", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.AddPolicyCtx(ctx, "p", "p", []string{"carol@example.com", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	// The stored values are encrypted.
+	var raw []CasbinRule
+	query := datastore.NewQuery(config.Kind).Namespace(config.Namespace).Ancestor(a.pseudoRootKey()).Filter("p_type =", "p")
+	if _, err := db.GetAll(ctx, query, &raw); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(raw) != 5 {
+		t.Errorf("got %d rules, wants 5", len(raw))
+	}
+	for _, line := range raw {
+		for _, v := range []string{line.V0, line.V1, line.V2} {
+			if !strings.HasPrefix(v, encryptedPrefix) {
+				t.Errorf("got %q stored, wants an encrypted value", v)
+			}
+		}
+	}
+
+	// Exact matches still work.
+	if err := a.RemovePolicyCtx(ctx, "p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.RemoveFilteredPolicyCtx(ctx, "p", "p", 0, "data2_admin"); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", NewAdapterWithConfig(db, config))
+	testGetPolicy(e, [][]string{{"bob", "data2", "write"}, {"carol@example.com", "data3", "read"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+	if g := e.GetGroupingPolicy(); !SamePolicy(g, [][]string{{"alice", "data2_admin"}}) {
+		t.Errorf("got %v, wants the grouping policy decrypted", g)
+	}
+}
+
+// eventRecorder records the events it is notified of.
+type eventRecorder []PolicyEvent
+
+func (r *eventRecorder) Notify(_ context.Context, event PolicyEvent) error {
+	*r = append(*r, event)
+	return nil
+}
+
+func TestEncryptionOutsideRules(t *testing.T) {
+	var events eventRecorder
+	config := Config{Kind: "casbin_test_encryption_records", Namespace: "unittest", KeyEncrypter: xorEncrypter(0x5a), Audit: true, Notifiers: []Notifier{&events}}
+	initPolicy(t, config)
+	events = nil
+	db := getDatastore()
+	a := NewAdapterWithConfig(db, config)
+	ctx := context.Background()
+
+	from := time.Now()
+	rule := []string{"carol@example.com", "data3", "read"}
+	if err := a.AddPolicyCtx(ctx, "p", "p", rule); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	to := time.Now().Add(time.Millisecond)
+
+	// The audit entry and the event hold the encrypted values.
+	encrypted := func(values []string) bool {
+		for _, v := range values {
+			if !strings.HasPrefix(v, encryptedPrefix) {
+				return false
+			}
+		}
+		return len(values) > 0
+	}
+	var raw []AuditEntry
+	query := datastore.NewQuery(a.auditKind()).Namespace(config.Namespace).Filter("timestamp >=", from)
+	if _, err := db.GetAll(ctx, query, &raw); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(raw) != 1 || !encrypted(raw[0].Rule) {
+		t.Errorf("got %+v stored, wants an audit entry with encrypted values", raw)
+	}
+	if len(events) != 1 || !encrypted(events[0].Rule) {
+		t.Errorf("got %+v, wants an event with encrypted values", events)
+	}
+	err := a.ListAuditEntries(ctx, from, to, func(entry AuditEntry) error {
+		if !reflect.DeepEqual(entry.Rule, rule) {
+			t.Errorf("got %v, wants %v decrypted", entry.Rule, rule)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	// So do the snapshots of the shared cache.
+	shared := &mapCache{m: make(map[string][]byte)}
+	newEnforcer := func() *casbin.Enforcer {
+		config := config
+		config.Notifiers = nil
+		cached := NewCachedAdapterWithConfig(NewAdapterWithConfig(db, config), CacheConfig{Shared: shared})
+		e, _ := casbin.NewEnforcer("examples/rbac_model.conf", cached)
+		return e
+	}
+	newEnforcer()
+	for _, b := range shared.m {
+		if strings.Contains(string(b), "carol@example.com") {
+			t.Errorf("got %s, wants no plaintext value", b)
+		}
+	}
+	e := newEnforcer()
+	if shared.hits != 1 {
+		t.Fatalf("got %d hits, wants 1", shared.hits)
+	}
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, rule}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+}
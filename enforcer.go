@@ -0,0 +1,33 @@
+package datastoreadapter
+
+import (
+	"context"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/persist"
+)
+
+// NewEnforcerFromDatastore loads the model stored with config, constructs an
+// adapter with config and returns an enforcer which has loaded the policy
+// through it. If watcher is not nil, it is set on the enforcer.
+//
+// Unlike NewAdapterWithConfig, the adapter doesn't close db when released;
+// the caller owns db and closes it once done.
+func NewEnforcerFromDatastore(ctx context.Context, db *datastore.Client, config Config, watcher persist.Watcher) (*casbin.Enforcer, error) {
+	m, err := LoadModelCtx(ctx, db, config)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := casbin.NewEnforcer(m, newAdapter(db, config))
+	if err != nil {
+		return nil, err
+	}
+	if watcher != nil {
+		if err := e.SetWatcher(watcher); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
@@ -0,0 +1,30 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestNewEnforcerFromDatastore(t *testing.T) {
+	ctx := context.Background()
+	db := getDatastore()
+	config := Config{Kind: "casbin_test_enforcer", Namespace: "unittest"}
+	initPolicy(t, config)
+	if err := SaveModelCtx(ctx, db, "examples/rbac_model.conf", config); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	e, err := NewEnforcerFromDatastore(ctx, db, config, nil)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+
+	config.ModelName = "unknown"
+	if _, err := NewEnforcerFromDatastore(ctx, db, config, nil); !errors.Is(err, ErrModelNotFound) {
+		t.Errorf("got %v, wants ErrModelNotFound", err)
+	}
+}
@@ -0,0 +1,270 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrPolicyNotFound is reported when a rule looked up by its key, such as
+	// a quarantined rule, is not stored. Removing a rule which is not stored
+	// is not an error, since casbin does so with auto-save when the model
+	// lacks the rule.
+	ErrPolicyNotFound = errors.New("policy not found")
+	// ErrModelNotFound is reported when no model definition is stored.
+	ErrModelNotFound = errors.New("model not found")
+	// ErrTooManyRules is reported when a batch has more rules than a single
+	// transaction can write, e.g. the changes of WithTransaction.
+	ErrTooManyRules = errors.New("too many rules")
+	// ErrTxnTooLarge is reported when a transaction exceeds the datastore
+	// mutation limit.
+	ErrTxnTooLarge = errors.New("transaction too large")
+	// ErrReadOnly is reported when a mutation is attempted on a read-only adapter.
+	ErrReadOnly = errors.New("adapter is read-only")
+	// ErrInvalidFilter is reported when LoadFilteredPolicy is given a filter of
+	// an unsupported type.
+	ErrInvalidFilter = errors.New("invalid filter")
+	// ErrConflict is reported when another writer has modified the policy,
+	// or the model, concurrently.
+	ErrConflict = errors.New("policy modified concurrently")
+	// ErrLocked is reported when the policy lock is held by another writer.
+	ErrLocked = errors.New("policy is locked")
+	// ErrMissingIndex is reported when a query needs a composite index which
+	// has not been created; see RequiredIndexes and Config.IndexFallback.
+	ErrMissingIndex = errors.New("missing composite index")
+	// ErrHistoryUnavailable is reported by LoadPolicyAt when the adapter
+	// doesn't keep the history of the rules, see Config.SoftDelete, or when
+	// rules have been deleted for good since the time to load.
+	ErrHistoryUnavailable = errors.New("policy history unavailable")
+	// ErrBlueGreenDisabled is reported by RollbackPolicy when
+	// Config.BlueGreen is not set.
+	ErrBlueGreenDisabled = errors.New("blue/green deployment disabled")
+	// ErrNoRollback is reported by RollbackPolicy when SavePolicy has never
+	// switched the slots of Config.BlueGreen, or has begun overwriting the
+	// slot it would switch back to.
+	ErrNoRollback = errors.New("no previous policy to roll back to")
+	// ErrCircuitOpen is reported by the operations rejected while the
+	// circuit breaker of Config.CircuitBreakerErrorRate is open.
+	ErrCircuitOpen = errors.New("circuit breaker open")
+	// ErrUnsupportedInTransaction is reported by the operations of the adapter
+	// WithTransaction passes to its function which can't be staged.
+	ErrUnsupportedInTransaction = errors.New("operation not supported in a transaction")
+	// ErrChangeRejected is reported by ApplyChangeSet when the validation
+	// rejects the changes; see ChangeRejectedError.
+	ErrChangeRejected = errors.New("changes rejected")
+	// ErrUnknownPType is reported for the rules whose ptype the model
+	// doesn't define.
+	ErrUnknownPType = errors.New("ptype not defined in the model")
+	// ErrRuleArity is reported for the rules whose number of values differs
+	// from the definition of their ptype in the model.
+	ErrRuleArity = errors.New("rule arity mismatch")
+)
+
+// maxTxnMutations is the maximum number of mutations datastore accepts in a
+// single commit.
+const maxTxnMutations = 500
+
+// OpError is the error type returned by the adapter and the model helpers.
+// It records the failed operation along with the underlying error, which can
+// be inspected with errors.Is and errors.As.
+type OpError struct {
+	// Op is the name of the failed operation, e.g. "SavePolicy".
+	Op string
+	// Err is the underlying error.
+	Err error
+
+	// kind is the sentinel error Err has been classified as, if any.
+	kind error
+}
+
+func (e *OpError) Error() string {
+	if e.kind != nil && e.kind != e.Err {
+		return "datastoreadapter: " + e.Op + ": " + e.kind.Error() + ": " + e.Err.Error()
+	}
+	return "datastoreadapter: " + e.Op + ": " + e.Err.Error()
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error has been classified as target.
+func (e *OpError) Is(target error) bool {
+	return e.kind != nil && e.kind == target
+}
+
+// wrapError wraps err with the operation name, classifying well-known
+// datastore failures as one of the package's sentinel errors.
+// It returns nil if err is nil.
+func wrapError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var opErr *OpError
+	if errors.As(err, &opErr) {
+		return err
+	}
+	return &OpError{Op: op, Err: err, kind: classifyError(err)}
+}
+
+// MultiError is reported when a batch operation, such as SavePolicy in pages,
+// the imports or RemoveFilteredPolicy, fails part way. The rules are written
+// and deleted in transactions of up to maxTxnMutations of them, so it lists
+// the rules which were committed before the failure and those which were not,
+// including the ones of the batches not attempted, so that only the latter
+// need retrying.
+type MultiError struct {
+	// Written are the rules which have been written, and Unwritten those
+	// which have not.
+	Written, Unwritten []CasbinRule
+	// Deleted are the keys of the rules which have been deleted, or soft
+	// deleted, and Undeleted those of the rules which have not.
+	Deleted, Undeleted []*datastore.Key
+	// Errors are the errors of the failed batches.
+	Errors []error
+}
+
+func (e *MultiError) Error() string {
+	failed := len(e.Unwritten) + len(e.Undeleted)
+	total := failed + len(e.Written) + len(e.Deleted)
+	msg := fmt.Sprintf("%d of %d rules not committed: %v", failed, total, e.Errors[0])
+	if len(e.Errors) > 1 {
+		msg += fmt.Sprintf(" (and %d more errors)", len(e.Errors)-1)
+	}
+	return msg
+}
+
+// Unwrap returns the error of the first failed batch.
+func (e *MultiError) Unwrap() error {
+	return e.Errors[0]
+}
+
+// Is reports whether the error of any of the failed batches matches target.
+func (e *MultiError) Is(target error) bool {
+	for _, err := range e.Errors[1:] {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeError returns the MultiError of writing lines, which failed with err
+// at the batch starting at start.
+func writeError(lines []interface{}, start int, err error) *MultiError {
+	e := &MultiError{Errors: []error{err}}
+	for i, line := range lines {
+		if i < start {
+			e.Written = append(e.Written, *line.(*CasbinRule))
+		} else {
+			e.Unwritten = append(e.Unwritten, *line.(*CasbinRule))
+		}
+	}
+	return e
+}
+
+// deleteError returns the MultiError of deleting keys, which failed with err
+// at the batch starting at start.
+func deleteError(keys []*datastore.Key, start int, err error) *MultiError {
+	return &MultiError{
+		Deleted:   keys[:start:start],
+		Undeleted: keys[start:],
+		Errors:    []error{err},
+	}
+}
+
+// abortsBatches reports whether err, which a batch failed with, fails the
+// following batches as well, so that a batch operation should stop rather
+// than go on and report the errors of all of them.
+func abortsBatches(ctx context.Context, err error) bool {
+	return ctx.Err() != nil || errors.Is(err, ErrConflict) || errors.Is(err, ErrLocked)
+}
+
+// batchCommits tracks the rules committed by the batches of an operation
+// which calls putRules and deleteRules several times, so that the MultiError
+// of a failed batch lists those of the previous ones as well.
+type batchCommits struct {
+	written []CasbinRule
+	deleted []*datastore.Key
+
+	// undeleted and errs are those of the failed batches the operation has
+	// gone on after; see skip.
+	undeleted []*datastore.Key
+	errs      []error
+}
+
+// skip records e, the error of the batches the operation goes on after.
+func (c *batchCommits) skip(e *MultiError) {
+	c.written = append(c.written, e.Written...)
+	c.deleted = append(c.deleted, e.Deleted...)
+	c.undeleted = append(c.undeleted, e.Undeleted...)
+	c.errs = append(c.errs, e.Errors...)
+}
+
+func (c *batchCommits) write(lines []interface{}) {
+	for _, line := range lines {
+		c.written = append(c.written, *line.(*CasbinRule))
+	}
+}
+
+func (c *batchCommits) delete(keys []*datastore.Key) {
+	c.deleted = append(c.deleted, keys...)
+}
+
+// fail returns err, which the operation failed with, as a MultiError which
+// also lists the rules the previous batches committed, those of the skipped
+// ones, and unwritten, the rules the operation was yet to write. err may be
+// nil if batches have been skipped. fail returns err as is if nothing has been
+// committed or skipped, and nothing was yet to be written.
+func (c *batchCommits) fail(err error, unwritten []interface{}) error {
+	if err == nil && len(c.errs) == 0 {
+		return nil
+	}
+	e := &MultiError{}
+	if err != nil && !errors.As(err, &e) {
+		if len(c.written) == 0 && len(c.deleted) == 0 && len(c.errs) == 0 && len(unwritten) == 0 {
+			return err
+		}
+		e = &MultiError{Errors: []error{err}}
+	}
+
+	merged := &MultiError{
+		Written:   append(append([]CasbinRule(nil), c.written...), e.Written...),
+		Unwritten: e.Unwritten,
+		Deleted:   append(append([]*datastore.Key(nil), c.deleted...), e.Deleted...),
+		Undeleted: append(append([]*datastore.Key(nil), c.undeleted...), e.Undeleted...),
+		Errors:    append(append([]error(nil), c.errs...), e.Errors...),
+	}
+	for _, line := range unwritten {
+		merged.Unwritten = append(merged.Unwritten, *line.(*CasbinRule))
+	}
+	return merged
+}
+
+func classifyError(err error) error {
+	if errors.Is(err, datastore.ErrNoSuchEntity) {
+		return ErrPolicyNotFound
+	}
+	if errors.Is(err, datastore.ErrConcurrentTransaction) {
+		return ErrConflict
+	}
+
+	s, ok := status.FromError(err)
+	if !ok {
+		return nil
+	}
+	if s.Code() == codes.InvalidArgument &&
+		(strings.Contains(s.Message(), "too many") || strings.Contains(s.Message(), "more than 500")) {
+		return ErrTxnTooLarge
+	}
+	if s.Code() == codes.FailedPrecondition && strings.Contains(s.Message(), "index") {
+		return ErrMissingIndex
+	}
+	return nil
+}
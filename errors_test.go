@@ -0,0 +1,64 @@
+package datastoreadapter
+
+import (
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestWrapError(t *testing.T) {
+	if err := wrapError("LoadPolicy", nil); err != nil {
+		t.Errorf("got %v, wants nil", err)
+	}
+
+	err := wrapError("RestoreQuarantinedRule", datastore.ErrNoSuchEntity)
+	if !errors.Is(err, ErrPolicyNotFound) {
+		t.Errorf("got %v, wants ErrPolicyNotFound", err)
+	}
+	if !errors.Is(err, datastore.ErrNoSuchEntity) {
+		t.Errorf("got %v, wants datastore.ErrNoSuchEntity to be wrapped", err)
+	}
+
+	err = wrapError("SavePolicy", datastore.ErrConcurrentTransaction)
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("got %v, wants ErrConflict", err)
+	}
+	if !errors.Is(err, datastore.ErrConcurrentTransaction) {
+		t.Errorf("got %v, wants datastore.ErrConcurrentTransaction to be wrapped", err)
+	}
+
+	err = wrapError("SavePolicy", status.Error(codes.InvalidArgument, "cannot write more than 500 entities in a single call"))
+	if !errors.Is(err, ErrTxnTooLarge) {
+		t.Errorf("got %v, wants ErrTxnTooLarge", err)
+	}
+	var opErr *OpError
+	if !errors.As(err, &opErr) || opErr.Op != "SavePolicy" {
+		t.Errorf("got %v, wants an OpError for SavePolicy", err)
+	}
+
+	// An already wrapped error keeps its original operation.
+	if wrapped := wrapError("AddPolicy", err); wrapped != err {
+		t.Errorf("got %v, wants %v", wrapped, err)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	config := Config{Kind: "casbin_test", Namespace: "unittest", ReadOnly: true}
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	if err := a.AddPolicy("p", "p", []string{"alice", "data1", "read"}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("got %v, wants ErrReadOnly", err)
+	}
+	if err := a.RemovePolicy("p", "p", []string{"alice", "data1", "read"}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("got %v, wants ErrReadOnly", err)
+	}
+	if err := a.RemoveFilteredPolicy("p", "p", 0, "alice"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("got %v, wants ErrReadOnly", err)
+	}
+	if err := SaveModelWithConfig(getDatastore(), "examples/rbac_model.conf", config); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("got %v, wants ErrReadOnly", err)
+	}
+}
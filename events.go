@@ -0,0 +1,52 @@
+package datastoreadapter
+
+import (
+	"context"
+	"time"
+)
+
+// PolicyEvent describes an operation which has modified the policy, as the
+// Notifiers of Config.Notifiers are notified of it.
+type PolicyEvent struct {
+	// Op is the name of the operation, such as "AddPolicy".
+	Op string `json:"op"`
+	// Kind and Namespace are those of the adapter.
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	// PType is the ptype of the rule, or empty for the operations writing
+	// many rules, such as SavePolicy.
+	PType string `json:"ptype,omitempty"`
+	// Rule is the rule added or removed, or the field values for
+	// RemoveFilteredPolicy. With Config.KeyEncrypter, its values are
+	// encrypted as the stored ones are.
+	Rule []string `json:"rule,omitempty"`
+	// FieldIndex is the field index for RemoveFilteredPolicy.
+	FieldIndex int `json:"field_index,omitempty"`
+	// Actor and RequestID are those of the context of the operation; see
+	// WithActor, WithRequestID and Config.ContextExtractor.
+	Actor     string `json:"actor,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	// Timestamp is the time the operation started.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Notifier is notified of the operations which have modified the policy,
+// once they succeed, e.g. to let external systems learn about permission
+// changes. Notify is called synchronously by the operation, so it must not
+// block; the error it returns is reported to Config.Logger as a warning.
+type Notifier interface {
+	Notify(ctx context.Context, event PolicyEvent) error
+}
+
+// notify notifies the Notifiers of the event of the operation, if it has
+// committed any mutation.
+func (o *operation) notify() {
+	if o == nil || o.event == nil || !o.committed {
+		return
+	}
+	for _, n := range o.adapter.notifiers {
+		if err := n.Notify(o.ctx, *o.event); err != nil {
+			o.warn(err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package datastoreadapter
+
+import (
+	"context"
+
+	"cloud.google.com/go/datastore"
+)
+
+// ExistsPolicy reports whether rule of ptype is stored, live and not expired,
+// without loading the policy. It looks the rule up with the query
+// Config.Deduplicate uses, so it needs the same index; see RequiredIndexes.
+// The rules are keyed by allocated IDs, so they can't be looked up by key.
+func (a *Adapter) ExistsPolicy(ctx context.Context, ptype string, rule []string) (bool, error) {
+	exists := false
+	err := a.do(ctx, "ExistsPolicy", func(ctx context.Context) error {
+		line, err := a.encodeRule(ctx, savePolicyLine(ptype, rule))
+		if err != nil {
+			return wrapError("ExistsPolicy", err)
+		}
+
+		keys, err := a.db.GetAll(ctx, a.ruleQuery(line), nil)
+		if err != nil {
+			return wrapError("ExistsPolicy", err)
+		}
+		operationFromContext(ctx).read(len(keys))
+		if len(keys) == 0 {
+			return nil
+		}
+		rules, err := a.getRules(func(keys []*datastore.Key, dst interface{}) error {
+			return a.db.GetMulti(ctx, keys, dst)
+		}, keys)
+		if err != nil {
+			return wrapError("ExistsPolicy", err)
+		}
+
+		now := a.now()
+		for _, stored := range rules {
+			if stored.deleted() || stored.expired(now) || ruleFields(stored) != ruleFields(line) {
+				continue
+			}
+			// Rules stored without a token count end at their first empty value.
+			if stored.Tokens == 0 || stored.Tokens == line.Tokens {
+				exists = true
+				return nil
+			}
+		}
+		return nil
+	})
+	return exists, err
+}
@@ -0,0 +1,72 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestExistsPolicy(t *testing.T) {
+	config := Config{Kind: "casbin_test_exists", Namespace: "unittest", SoftDelete: true}
+	initPolicy(t, config)
+	ctx := context.Background()
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	if err := a.AddPolicyWithExpiry(ctx, "p", "p", []string{"carol", "data3", "read"}, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.RemovePolicyCtx(ctx, "p", "p", []string{"bob", "data2", "write"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	for _, test := range []struct {
+		ptype string
+		rule  []string
+		wants bool
+	}{
+		{"p", []string{"alice", "data1", "read"}, true},
+		{"g", []string{"alice", "data2_admin"}, true},
+		{"p", []string{"alice", "data1", "write"}, false},
+		{"p", []string{"alice", "data1"}, false},
+		{"p", []string{"alice", "data1", "read", ""}, false},
+		// Soft deleted and expired rules don't exist.
+		{"p", []string{"bob", "data2", "write"}, false},
+		{"p", []string{"carol", "data3", "read"}, false},
+	} {
+		exists, err := a.ExistsPolicy(ctx, test.ptype, test.rule)
+		if err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+		if exists != test.wants {
+			t.Errorf("got %v for %s %v, wants %v", exists, test.ptype, test.rule, test.wants)
+		}
+	}
+}
+
+func TestRemovePolicyExisted(t *testing.T) {
+	config := Config{Kind: "casbin_test_remove_existed", Namespace: "unittest", SoftDelete: true}
+	initPolicy(t, config)
+	ctx := context.Background()
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	existed, err := a.RemovePolicyExisted(ctx, "p", "p", []string{"alice", "data1", "read"})
+	if err != nil || !existed {
+		t.Errorf("got %v, %v, wants true, no error", existed, err)
+	}
+	version, err := a.GetPolicyVersion(ctx)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	// The tombstone of the rule and a rule never stored are not removed
+	// again, so the policy version doesn't change.
+	for _, rule := range [][]string{{"alice", "data1", "read"}, {"carol", "data3", "read"}} {
+		existed, err := a.RemovePolicyExisted(ctx, "p", "p", rule)
+		if err != nil || existed {
+			t.Errorf("got %v, %v for %v, wants false, no error", existed, err, rule)
+		}
+	}
+	if v, err := a.GetPolicyVersion(ctx); err != nil || v != version {
+		t.Errorf("got %d, %v, wants %d", v, err, version)
+	}
+}
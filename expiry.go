@@ -0,0 +1,50 @@
+package datastoreadapter
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// expired reports whether line has expired at now.
+func (line CasbinRule) expired(now time.Time) bool {
+	return !line.ExpiresAt.IsZero() && !now.Before(line.ExpiresAt)
+}
+
+// PurgeExpiredPolicies deletes the rules which have expired, page by page,
+// and returns how many of them it deleted. It is meant to be run
+// periodically, e.g. from a cron job; expired rules are not loaded meanwhile.
+// It also deletes the expired records of the idempotency keys.
+func (a *Adapter) PurgeExpiredPolicies(ctx context.Context) (int, error) {
+	n := 0
+	err := a.do(ctx, "PurgeExpiredPolicies", func(ctx context.Context) error {
+		if a.readOnly {
+			return ErrReadOnly
+		}
+		a.audit(ctx, AuditEntry{})
+
+		// Rules which never expire store the zero time, which the first filter
+		// leaves out. It also leaves out the entities which aren't rules.
+		for _, kind := range a.ruleKinds() {
+			query := datastore.NewQuery(kind).
+				Namespace(a.namespace).
+				Ancestor(a.rootKeyOf(kind)).
+				Filter(a.property("expires_at")+" >", time.Time{}).
+				Filter(a.property("expires_at")+" <=", a.now())
+
+			_, err := a.paginate(ctx, query, true, "", func(keys []*datastore.Key, _ []CasbinRule) error {
+				if err := a.deleteRules(ctx, false, keys); err != nil {
+					return err
+				}
+				n += len(keys)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return a.purgeIdempotencyKeys(ctx)
+	})
+	return n, err
+}
@@ -0,0 +1,48 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+)
+
+func TestExpiringPolicies(t *testing.T) {
+	ctx := context.Background()
+	config := Config{Kind: "casbin_test_expiry", Namespace: "unittest"}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	if err := a.AddPolicyWithExpiry(ctx, "p", "p", []string{"bob", "data3", "read"}, time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.AddPolicyWithExpiry(ctx, "p", "p", []string{"bob", "data4", "read"}, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	// The expired rule is not loaded.
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"bob", "data4", "read"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+
+	n, err := a.PurgeExpiredPolicies(ctx)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if n != 1 {
+		t.Errorf("got %d purged rules, wants 1", n)
+	}
+	if got := len(storedRules(t, a)); got != 6 {
+		t.Errorf("got %d stored rules, wants 6", got)
+	}
+
+	// SavePolicy preserves the expiry of the rules already stored.
+	if err := a.SavePolicy(e.GetModel()); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if got := storedRules(t, a)[ruleFields(savePolicyLine("p", []string{"bob", "data4", "read"}))]; got.ExpiresAt.IsZero() {
+		t.Errorf("got %+v, wants the expiry preserved", got)
+	}
+}
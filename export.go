@@ -0,0 +1,196 @@
+package datastoreadapter
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/api/iterator"
+)
+
+// The files of the archives ExportNamespace writes.
+const (
+	exportManifestFile       = "manifest.json"
+	exportPolicyFile         = "policy.json"
+	exportRulesFile          = "rules.json"
+	exportModelRevisionsFile = "model_revisions.json"
+	exportAuditFile          = "audit.json"
+)
+
+// ExportManifest describes an archive ExportNamespace writes, as its
+// manifest.json.
+type ExportManifest struct {
+	Kind       string    `json:"kind"`
+	Namespace  string    `json:"namespace"`
+	ExportedAt time.Time `json:"exported_at"`
+	// Rules, ModelRevisions and AuditEntries are the number of entries of
+	// rules.json, model_revisions.json and audit.json.
+	Rules          int `json:"rules"`
+	ModelRevisions int `json:"model_revisions"`
+	AuditEntries   int `json:"audit_entries"`
+}
+
+// ExportedRule is a stored rule along with its metadata, as an entry of the
+// rules.json of an archive ExportNamespace writes. The times which are not
+// set are left out.
+type ExportedRule struct {
+	PType     string     `json:"ptype"`
+	Rule      []string   `json:"rule"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy string     `json:"deleted_by,omitempty"`
+}
+
+func newExportedRule(rule CasbinRule) ExportedRule {
+	optional := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+		t = t.UTC()
+		return &t
+	}
+	return ExportedRule{
+		PType:     rule.PType,
+		Rule:      ruleValues(rule),
+		CreatedAt: optional(rule.CreatedAt),
+		UpdatedAt: optional(rule.UpdatedAt),
+		CreatedBy: rule.CreatedBy,
+		ExpiresAt: optional(rule.ExpiresAt),
+		DeletedAt: optional(rule.DeletedAt),
+		DeletedBy: rule.DeletedBy,
+	}
+}
+
+// ExportNamespace writes to w a gzip-compressed tar archive of the data the
+// adapter stores in namespace, e.g. to answer a data portability request of
+// a tenant. The archive holds the JSON files:
+//
+//	manifest.json         the ExportManifest
+//	policy.json           the PolicySnapshot of the model and the live rules,
+//	                      which ImportJSON restores
+//	rules.json            the ExportedRule of every stored rule, including
+//	                      the expired and soft deleted ones
+//	model_revisions.json  the ModelRevision of every model stored
+//	audit.json            the AuditEntry of every operation audited
+//
+// The values of the rules are decoded by Config.Codecs, if any. Each file is
+// read in full before it is written, and the files aren't read at a single
+// point in time, so that the writes made meanwhile may show in some of them.
+func (a *Adapter) ExportNamespace(ctx context.Context, namespace string, w io.Writer) error {
+	b := a.ForNamespace(namespace)
+	return b.do(ctx, "ExportNamespace", func(ctx context.Context) error {
+		snapshot, err := b.snapshotPolicy(ctx)
+		if err != nil {
+			return err
+		}
+		manifest := ExportManifest{Kind: b.kind, Namespace: namespace, ExportedAt: snapshot.ExportedAt}
+
+		rules := []ExportedRule{}
+		_, err = b.paginateRules(ctx, false, "", func(_ []*datastore.Key, page []CasbinRule) error {
+			for _, rule := range page {
+				rules = append(rules, newExportedRule(rule))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		sort.SliceStable(rules, func(i, j int) bool {
+			x, y := rules[i], rules[j]
+			return policyCSVLine(savePolicyLine(x.PType, x.Rule)) < policyCSVLine(savePolicyLine(y.PType, y.Rule))
+		})
+		manifest.Rules = len(rules)
+
+		revisions := []ModelRevision{}
+		err = b.readAll(ctx, datastore.NewQuery(b.kind+modelRevisionKindSuffix).Namespace(namespace), func(it *datastore.Iterator) error {
+			var revision ModelRevision
+			if _, err := it.Next(&revision); err != nil {
+				return err
+			}
+			revisions = append(revisions, revision)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		sort.SliceStable(revisions, func(i, j int) bool {
+			return revisions[i].Timestamp.Before(revisions[j].Timestamp)
+		})
+		manifest.ModelRevisions = len(revisions)
+
+		entries := []AuditEntry{}
+		err = b.readAll(ctx, datastore.NewQuery(b.auditKind()).Namespace(namespace).Order("timestamp"), func(it *datastore.Iterator) error {
+			var entry AuditEntry
+			if _, err := it.Next(&entry); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		manifest.AuditEntries = len(entries)
+
+		zw := gzip.NewWriter(w)
+		tw := tar.NewWriter(zw)
+		files := []struct {
+			name string
+			v    interface{}
+		}{
+			{exportManifestFile, manifest},
+			{exportPolicyFile, snapshot},
+			{exportRulesFile, rules},
+			{exportModelRevisionsFile, revisions},
+			{exportAuditFile, entries},
+		}
+		for _, f := range files {
+			data, err := json.MarshalIndent(f.v, "", "  ")
+			if err != nil {
+				return err
+			}
+			header := &tar.Header{Name: f.name, Mode: 0644, Size: int64(len(data)), ModTime: snapshot.ExportedAt}
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+			if _, err := tw.Write(data); err != nil {
+				return err
+			}
+		}
+		if err := tw.Close(); err != nil {
+			return err
+		}
+		return zw.Close()
+	})
+}
+
+// ExportNamespace is the same as Adapter.ExportNamespace.
+func (m *MultiTenantAdapter) ExportNamespace(ctx context.Context, namespace string, w io.Writer) error {
+	return m.adapter.ExportNamespace(ctx, namespace, w)
+}
+
+// readAll runs query and calls next with its iterator until it returns
+// iterator.Done.
+func (a *Adapter) readAll(ctx context.Context, query *datastore.Query, next func(it *datastore.Iterator) error) error {
+	return a.limited(ctx, func() error {
+		it := a.db.Run(ctx, query)
+		for {
+			err := next(it)
+			if err == iterator.Done {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			operationFromContext(ctx).read(1)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package datastoreadapter
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestExportNamespace(t *testing.T) {
+	config := Config{Kind: "casbin_test_export", Namespace: "unittest_export", Audit: true, SoftDelete: true}
+	initPolicy(t, config)
+	db := getDatastore()
+	a := NewAdapterWithConfig(db, config)
+	ctx := WithActor(context.Background(), "alice")
+
+	if err := SaveModelWithConfig(db, "examples/rbac_model.conf", config); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.AddPolicyCtx(ctx, "p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.RemovePolicyCtx(ctx, "p", "p", []string{"bob", "data2", "write"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	var buf bytes.Buffer
+	if err := a.ExportNamespace(ctx, config.Namespace, &buf); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	files := make(map[string][]byte)
+	tr := tar.NewReader(zr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+		if files[header.Name], err = ioutil.ReadAll(tr); err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+	}
+
+	var manifest ExportManifest
+	if err := json.Unmarshal(files["manifest.json"], &manifest); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if manifest.Namespace != config.Namespace || manifest.Rules != 6 || manifest.ModelRevisions != 1 || manifest.AuditEntries != 3 {
+		t.Errorf("got %+v, wants the counts of the namespace", manifest)
+	}
+
+	var rules []ExportedRule
+	if err := json.Unmarshal(files["rules.json"], &rules); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	var added, removed bool
+	for _, rule := range rules {
+		switch rule.Rule[0] {
+		case "carol":
+			added = rule.CreatedBy == "alice" && rule.CreatedAt != nil
+		case "bob":
+			removed = rule.DeletedBy == "alice" && rule.DeletedAt != nil
+		}
+	}
+	if len(rules) != 6 || !added || !removed {
+		t.Errorf("got %+v, wants the rules along with their metadata", rules)
+	}
+
+	var audit []AuditEntry
+	if err := json.Unmarshal(files["audit.json"], &audit); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	// The seed policy has been saved with auditing too.
+	if len(audit) != 3 || audit[1].Op != "AddPolicy" || audit[1].Actor != "alice" {
+		t.Errorf("got %+v, wants the audit entries", audit)
+	}
+
+	// policy.json can be imported.
+	copied := Config{Kind: "casbin_test_export_copy", Namespace: "unittest"}
+	initPolicy(t, copied)
+	b := NewAdapterWithConfig(db, copied)
+	if err := b.ImportJSON(context.Background(), bytes.NewReader(files["policy.json"]), ImportReplace); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if got := storedRules(t, b); len(got) != 5 {
+		t.Errorf("got %d rules, wants the 5 live ones", len(got))
+	}
+}
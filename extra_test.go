@@ -0,0 +1,56 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+)
+
+func TestExtraValues(t *testing.T) {
+	config := Config{Kind: "casbin_test_extra", Namespace: "unittest", Deduplicate: true}
+	initPolicy(t, config)
+	ctx := context.Background()
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	long := []string{"alice", "data1", "read", "a", "b", "c", "seven", "eight"}
+	other := []string{"alice", "data1", "read", "a", "b", "c", "other"}
+	for _, rule := range [][]string{long, other, long} {
+		if err := a.AddPolicyCtx(ctx, "p", "p", rule); err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+	}
+
+	m, err := model.NewModelFromFile("examples/rbac_model.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.LoadPolicyCtx(ctx, m); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	wants := [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, long, other}
+	if actual := m["p"]["p"].Policy; len(actual) != len(wants) || !SamePolicy(actual, wants) {
+		t.Errorf("got %v, wants %v", actual, wants)
+	}
+
+	// Only the rule with the same extra values is removed.
+	if err := a.RemovePolicyCtx(ctx, "p", "p", other); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.RemoveFilteredPolicyCtx(ctx, "p", "p", 7, "nine"); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, long}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+
+	if err := a.RemoveFilteredPolicyCtx(ctx, "p", "p", 7, "eight"); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	e.LoadPolicy()
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+}
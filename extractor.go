@@ -0,0 +1,80 @@
+package datastoreadapter
+
+import "context"
+
+// ContextExtractor derives the namespace, the actor and the request ID of an
+// operation from its context, for services which carry them under context
+// keys of their own, e.g. set by an authentication middleware:
+//
+//	type authExtractor struct{}
+//
+//	func (authExtractor) Namespace(ctx context.Context) (string, bool) {
+//		claims, ok := auth.FromContext(ctx)
+//		return claims.Tenant, ok
+//	}
+//
+//	func (authExtractor) Actor(ctx context.Context) string {
+//		claims, _ := auth.FromContext(ctx)
+//		return claims.Subject
+//	}
+//
+//	func (authExtractor) RequestID(ctx context.Context) string {
+//		return middleware.RequestIDFromContext(ctx)
+//	}
+//
+// The values it returns take precedence over the ones set with
+// WithNamespace, WithActor and WithRequestID, unless they are empty.
+type ContextExtractor interface {
+	// Namespace returns the namespace MultiTenantAdapter targets, and
+	// whether there is one.
+	Namespace(ctx context.Context) (string, bool)
+	// Actor returns the actor the audit entries, the soft deleted rules and
+	// the other records of the operation are attributed to.
+	Actor(ctx context.Context) string
+	// RequestID returns the ID of the request the operation serves, which is
+	// recorded in its audit entries and reported to the Tracer and the
+	// MetricsCollector.
+	RequestID(ctx context.Context) string
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context which makes the operations run with it
+// record requestID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID set with WithRequestID, or an
+// empty string.
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// extract returns ctx along with the actor and the request ID
+// Config.ContextExtractor derives from it, if any, so that they are found
+// by ActorFromContext and RequestIDFromContext.
+func (a *Adapter) extract(ctx context.Context) context.Context {
+	if a.extractor == nil {
+		return ctx
+	}
+	if actor := a.extractor.Actor(ctx); actor != "" {
+		ctx = WithActor(ctx, actor)
+	}
+	if requestID := a.extractor.RequestID(ctx); requestID != "" {
+		ctx = WithRequestID(ctx, requestID)
+	}
+	return ctx
+}
+
+// contextNamespace returns the namespace Config.ContextExtractor derives
+// from ctx, or the one set with WithNamespace.
+func (a *Adapter) contextNamespace(ctx context.Context) (string, bool) {
+	if a.extractor != nil {
+		if namespace, ok := a.extractor.Namespace(ctx); ok && namespace != "" {
+			return namespace, true
+		}
+	}
+	return NamespaceFromContext(ctx)
+}
@@ -0,0 +1,87 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+)
+
+type claimsKey struct{}
+
+// claims stands for the attributes an authentication middleware sets on the
+// context of a request.
+type claims struct {
+	tenant, subject, request string
+}
+
+type claimsExtractor struct{}
+
+func (claimsExtractor) Namespace(ctx context.Context) (string, bool) {
+	c, ok := ctx.Value(claimsKey{}).(claims)
+	return c.tenant, ok
+}
+
+func (claimsExtractor) Actor(ctx context.Context) string {
+	c, _ := ctx.Value(claimsKey{}).(claims)
+	return c.subject
+}
+
+func (claimsExtractor) RequestID(ctx context.Context) string {
+	c, _ := ctx.Value(claimsKey{}).(claims)
+	return c.request
+}
+
+func TestContextExtractor(t *testing.T) {
+	var stats statsRecorder
+	config := Config{Kind: "casbin_test_extractor", Namespace: "unittest", Audit: true, Metrics: &stats, ContextExtractor: claimsExtractor{}}
+	initPolicy(t, config)
+	initPolicy(t, Config{Kind: config.Kind, Namespace: "unittest_tenant"})
+	m := NewMultiTenantAdapter(getDatastore(), config)
+	stats = nil
+
+	ctx := context.WithValue(context.Background(), claimsKey{}, claims{tenant: "unittest_tenant", subject: "carol", request: "req-1"})
+	from := time.Now()
+	if err := m.RemovePolicyCtx(ctx, "p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	to := time.Now().Add(time.Millisecond)
+
+	// Only the policy of the tenant is modified.
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf")
+	if err := m.LoadPolicyCtx(ctx, e.GetModel()); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	testGetPolicy(e, [][]string{{"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+	e, _ = casbin.NewEnforcer("examples/rbac_model.conf", m.ForContext(context.Background()))
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+
+	var entries []AuditEntry
+	err := m.ForContext(ctx).ListAuditEntries(ctx, from, to, func(entry AuditEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(entries) != 1 || entries[0].Actor != "carol" || entries[0].RequestID != "req-1" {
+		t.Errorf("got %+v, wants an entry attributed to carol and req-1", entries)
+	}
+	if len(stats) == 0 || stats[0].Op != "RemovePolicy" || stats[0].RequestID != "req-1" {
+		t.Errorf("got %+v, wants the request ID reported", stats)
+	}
+
+	// The values set with the context helpers are used when it derives none.
+	ctx = WithRequestID(WithActor(WithNamespace(context.Background(), "unittest_tenant"), "dave"), "req-2")
+	if got := m.ForContext(ctx); got != m.ForNamespace("unittest_tenant") {
+		t.Errorf("got the adapter of %q, wants the one of unittest_tenant", got.namespace)
+	}
+	if ctx := m.adapter.extract(ctx); ActorFromContext(ctx) != "dave" || RequestIDFromContext(ctx) != "req-2" {
+		t.Errorf("got %q and %q, wants dave and req-2", ActorFromContext(ctx), RequestIDFromContext(ctx))
+	}
+}
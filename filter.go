@@ -0,0 +1,126 @@
+package datastoreadapter
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+)
+
+// Filter specifies the rules LoadFilteredPolicy loads. It selects the rules of
+// PType whose values match FieldValues starting at FieldIndex, in the same way
+// as RemoveFilteredPolicy does. Empty field values match any value, and
+// MatchEmpty matches empty values only.
+type Filter struct {
+	PType       string
+	FieldIndex  int
+	FieldValues []string
+	// IgnoreCase makes the field values match ignoring case. It queries the
+	// values stored by Config.CaseFolding, and otherwise scans the rules of
+	// PType, matching them in memory.
+	IgnoreCase bool
+	// Prefix makes the last of FieldValues match the values starting with
+	// it, e.g. the rules whose object starts with "/api/v2/":
+	//
+	//	Filter{PType: "p", FieldIndex: 1, FieldValues: []string{"/api/v2/"}, Prefix: true}
+	//
+	// It is queried with a range filter, which the indexes of
+	// RequiredIndexes serve, but is matched in memory along with IgnoreCase
+	// or codecs, such as ValueTransformer.
+	Prefix bool
+}
+
+// MatchEmpty is a field value of Filter and RemoveFilteredPolicy which only
+// matches the rules whose value is empty, since an empty field value matches
+// any value, e.g. to remove the rules of alice without a domain:
+//
+//	a.RemoveFilteredPolicy("p", "p", 0, "alice", datastoreadapter.MatchEmpty)
+const MatchEmpty = "\x00"
+
+var _ persist.FilteredAdapter = (*Adapter)(nil)
+
+// LoadFilteredPolicy loads the rules matching filter, which must be either a
+// Filter or a *Filter, into the model.
+func (a *Adapter) LoadFilteredPolicy(model model.Model, filter interface{}) error {
+	return a.LoadFilteredPolicyCtx(context.Background(), model, filter)
+}
+
+// LoadFilteredPolicyCtx is the same as LoadFilteredPolicy but honors ctx.
+func (a *Adapter) LoadFilteredPolicyCtx(ctx context.Context, model model.Model, filter interface{}) error {
+	return a.do(ctx, "LoadFilteredPolicy", func(ctx context.Context) error {
+		f, err := toFilter(filter)
+		if err != nil {
+			return wrapError("LoadFilteredPolicy", err)
+		}
+		return a.loadFiltered(ctx, "LoadFilteredPolicy", model, []Filter{f})
+	})
+}
+
+// loadFiltered loads the rules matching each of filters in turn into the
+// model, for the operation op, and marks the adapter as filtered.
+func (a *Adapter) loadFiltered(ctx context.Context, op string, model model.Model, filters []Filter) error {
+	plans := make([][]queryPlan, len(filters))
+	for i, f := range filters {
+		var err error
+		if plans[i], err = a.filteredPlans(ctx, f); err != nil {
+			return wrapError(op, err)
+		}
+	}
+	a.observeModel(model)
+	ctx, malformed := a.collectMalformed(ctx)
+	err := a.readConsistently(ctx, func(ctx context.Context) error {
+		load := func(keys []*datastore.Key, rules []CasbinRule) error {
+			for i, line := range rules {
+				if err := a.loadRule(ctx, model, keys[i], line); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		for i, f := range filters {
+			var err error
+			if column := a.reverseIndexColumn(f); column >= 0 {
+				err = a.paginateReverseIndex(ctx, f, column, plans[i][0].match, load)
+			} else {
+				err = a.paginatePlans(ctx, plans[i], false, load)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return wrapError(op, err)
+	}
+
+	a.setFiltered(true)
+	return wrapError(op, a.flushMalformed(ctx, malformed))
+}
+
+// IsFiltered reports whether the last load was a filtered one.
+func (a *Adapter) IsFiltered() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.filtered
+}
+
+func (a *Adapter) setFiltered(filtered bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.filtered = filtered
+}
+
+func toFilter(filter interface{}) (Filter, error) {
+	switch f := filter.(type) {
+	case Filter:
+		return f, nil
+	case *Filter:
+		if f != nil {
+			return *f, nil
+		}
+	}
+	return Filter{}, fmt.Errorf("%w: %T", ErrInvalidFilter, filter)
+}
@@ -0,0 +1,103 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+)
+
+func TestLoadFilteredPolicy(t *testing.T) {
+	config := Config{Kind: "casbin_test", Namespace: "unittest"}
+	initPolicy(t, config)
+
+	a := NewAdapterWithConfig(getDatastore(), config)
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+
+	if err := e.LoadFilteredPolicy(&Filter{PType: "p", FieldIndex: 1, FieldValues: []string{"data2"}}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if !a.IsFiltered() {
+		t.Error("got IsFiltered() == false, wants true")
+	}
+	testGetPolicy(e, [][]string{{"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+
+	if err := a.LoadFilteredPolicy(e.GetModel(), "p"); !errors.Is(err, ErrInvalidFilter) {
+		t.Errorf("got %v, wants ErrInvalidFilter", err)
+	}
+
+	if err := e.LoadPolicy(); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if a.IsFiltered() {
+		t.Error("got IsFiltered() == true, wants false")
+	}
+}
+
+func TestMatchEmpty(t *testing.T) {
+	config := Config{Kind: "casbin_test_match_empty", Namespace: "unittest"}
+	initPolicy(t, config)
+	ctx := context.Background()
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	if err := a.AddPolicyCtx(ctx, "p", "p", []string{"alice", "data1", "read", "tenant1"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	if err := e.LoadFilteredPolicy(&Filter{PType: "p", FieldValues: []string{"alice", "", "", MatchEmpty}}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+
+	if err := a.RemoveFilteredPolicyCtx(ctx, "p", "p", 3, MatchEmpty); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := e.LoadPolicy(); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	testGetPolicy(e, [][]string{{"alice", "data1", "read", "tenant1"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+}
+
+func TestPrefixFilter(t *testing.T) {
+	config := Config{Kind: "casbin_test_prefix", Namespace: "unittest"}
+	initPolicy(t, config)
+	ctx := context.Background()
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	for _, rule := range [][]string{{"carol", "/api/v2/users", "read"}, {"carol", "/api/v2/", "write"}, {"carol", "/api/v1/users", "read"}, {"dave", "/api/v2/users", "read"}} {
+		if err := a.AddPolicyCtx(ctx, "p", "p", rule); err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+	}
+
+	for _, test := range []struct {
+		filter Filter
+		wants  [][]string
+	}{
+		{Filter{PType: "p", FieldIndex: 1, FieldValues: []string{"/api/v2/"}, Prefix: true},
+			[][]string{{"carol", "/api/v2/users", "read"}, {"carol", "/api/v2/", "write"}, {"dave", "/api/v2/users", "read"}}},
+		{Filter{PType: "p", FieldValues: []string{"carol", "/api/v2/u"}, Prefix: true},
+			[][]string{{"carol", "/api/v2/users", "read"}}},
+		{Filter{PType: "p", FieldValues: []string{"CAROL", "/API/"}, Prefix: true, IgnoreCase: true},
+			[][]string{{"carol", "/api/v2/users", "read"}, {"carol", "/api/v2/", "write"}, {"carol", "/api/v1/users", "read"}}},
+		// Without Prefix, the values must match exactly.
+		{Filter{PType: "p", FieldIndex: 1, FieldValues: []string{"/api/v2/"}},
+			[][]string{{"carol", "/api/v2/", "write"}}},
+	} {
+		e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+		if err := e.LoadFilteredPolicy(test.filter); err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+		testGetPolicy(e, test.wants, func(actual, wants [][]string) {
+			t.Errorf("%+v: got %v, wants %v", test.filter, actual, wants)
+		})
+	}
+}
@@ -0,0 +1,357 @@
+// Package firestoreadapter is the variant of the datastore adapter for
+// projects in Firestore native mode, which can't use datastore. It stores the
+// rules as documents of a collection, under the same property names as
+// datastoreadapter.CasbinRule.
+//
+// It lives in a module of its own, so that the users of the datastore adapter
+// don't depend on the Firestore client.
+package firestoreadapter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/firestore"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	datastoreadapter "github.com/reedom/datastore-adapter/v3"
+	"google.golang.org/api/iterator"
+)
+
+const casbinCollection = "casbin"
+
+// maxBatchWrites is the maximum number of writes Firestore accepts in a
+// single batch.
+const maxBatchWrites = 500
+
+// Config is the configuration of Adapter.
+type Config struct {
+	// Firestore collection name.
+	// Optional. (Default: "casbin")
+	Collection string
+	// ReadOnly makes every mutating operation fail with
+	// datastoreadapter.ErrReadOnly.
+	// Optional. (Default: false)
+	ReadOnly bool
+}
+
+// Adapter represents the Firestore adapter for policy storage.
+type Adapter struct {
+	db         *firestore.Client
+	collection string
+	readOnly   bool
+
+	mu       sync.Mutex
+	filtered bool
+}
+
+var _ persist.FilteredAdapter = (*Adapter)(nil)
+
+// NewAdapter is the constructor for Adapter.
+func NewAdapter(db *firestore.Client) *Adapter {
+	return NewAdapterWithConfig(db, Config{})
+}
+
+// NewAdapterWithConfig is the constructor for Adapter.
+func NewAdapterWithConfig(db *firestore.Client, config Config) *Adapter {
+	collection := config.Collection
+	if collection == "" {
+		collection = casbinCollection
+	}
+	return &Adapter{
+		db:         db,
+		collection: collection,
+		readOnly:   config.ReadOnly,
+	}
+}
+
+func (a *Adapter) rules() *firestore.CollectionRef {
+	return a.db.Collection(a.collection)
+}
+
+// each calls fn with every rule matched by query.
+func each(ctx context.Context, query firestore.Query, fn func(*firestore.DocumentRef, datastoreadapter.CasbinRule) error) error {
+	it := query.Documents(ctx)
+	defer it.Stop()
+	for {
+		doc, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var line datastoreadapter.CasbinRule
+		if err := doc.DataTo(&line); err != nil {
+			return err
+		}
+		if err := fn(doc.Ref, line); err != nil {
+			return err
+		}
+	}
+}
+
+// write applies the deletions of refs and the creations of lines in batches,
+// so that the policy is replaced atomically only if it fits a single batch.
+func (a *Adapter) write(ctx context.Context, refs []*firestore.DocumentRef, lines []datastoreadapter.CasbinRule) error {
+	batch, n := a.db.Batch(), 0
+	flush := func(force bool) error {
+		if n == 0 || !force && n < maxBatchWrites {
+			return nil
+		}
+		_, err := batch.Commit(ctx)
+		batch, n = a.db.Batch(), 0
+		return err
+	}
+	for _, ref := range refs {
+		batch.Delete(ref)
+		n++
+		if err := flush(false); err != nil {
+			return err
+		}
+	}
+	for i := range lines {
+		batch.Create(a.rules().NewDoc(), &lines[i])
+		n++
+		if err := flush(false); err != nil {
+			return err
+		}
+	}
+	return flush(true)
+}
+
+func wrapError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &datastoreadapter.OpError{Op: op, Err: err}
+}
+
+func (a *Adapter) LoadPolicy(model model.Model) error {
+	return a.LoadPolicyCtx(context.Background(), model)
+}
+
+// LoadPolicyCtx is the same as LoadPolicy but honors ctx.
+func (a *Adapter) LoadPolicyCtx(ctx context.Context, model model.Model) error {
+	err := each(ctx, a.rules().Query, func(_ *firestore.DocumentRef, line datastoreadapter.CasbinRule) error {
+		datastoreadapter.LoadPolicyLine(line, model)
+		return nil
+	})
+	if err != nil {
+		return wrapError("LoadPolicy", err)
+	}
+	a.setFiltered(false)
+	return nil
+}
+
+func (a *Adapter) SavePolicy(model model.Model) error {
+	return a.SavePolicyCtx(context.Background(), model)
+}
+
+// SavePolicyCtx is the same as SavePolicy but honors ctx.
+func (a *Adapter) SavePolicyCtx(ctx context.Context, model model.Model) error {
+	if a.readOnly {
+		return wrapError("SavePolicy", datastoreadapter.ErrReadOnly)
+	}
+
+	var refs []*firestore.DocumentRef
+	err := each(ctx, a.rules().Select(), func(ref *firestore.DocumentRef, _ datastoreadapter.CasbinRule) error {
+		refs = append(refs, ref)
+		return nil
+	})
+	if err != nil {
+		return wrapError("SavePolicy", err)
+	}
+
+	var lines []datastoreadapter.CasbinRule
+	for _, sec := range []string{"p", "g"} {
+		for ptype, ast := range model[sec] {
+			for _, rule := range ast.Policy {
+				lines = append(lines, datastoreadapter.NewCasbinRule(ptype, rule))
+			}
+		}
+	}
+	return wrapError("SavePolicy", a.write(ctx, refs, lines))
+}
+
+func (a *Adapter) AddPolicy(sec string, ptype string, rule []string) error {
+	return a.AddPolicyCtx(context.Background(), sec, ptype, rule)
+}
+
+// AddPolicyCtx is the same as AddPolicy but honors ctx.
+func (a *Adapter) AddPolicyCtx(ctx context.Context, sec string, ptype string, rule []string) error {
+	if a.readOnly {
+		return wrapError("AddPolicy", datastoreadapter.ErrReadOnly)
+	}
+	line := datastoreadapter.NewCasbinRule(ptype, rule)
+	_, err := a.rules().NewDoc().Create(ctx, &line)
+	return wrapError("AddPolicy", err)
+}
+
+func (a *Adapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	return a.RemovePolicyCtx(context.Background(), sec, ptype, rule)
+}
+
+// RemovePolicyCtx is the same as RemovePolicy but honors ctx.
+func (a *Adapter) RemovePolicyCtx(ctx context.Context, sec string, ptype string, rule []string) error {
+	if a.readOnly {
+		return wrapError("RemovePolicy", datastoreadapter.ErrReadOnly)
+	}
+	values := datastoreadapter.NewCasbinRule(ptype, rule).Rule()
+	match := func(line datastoreadapter.CasbinRule) bool {
+		return sameValues(line.Rule(), values)
+	}
+	return wrapError("RemovePolicy", a.removeMatching(ctx, filterQuery(a.rules().Query, ptype, 0, rule...), match))
+}
+
+func (a *Adapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	return a.RemoveFilteredPolicyCtx(context.Background(), sec, ptype, fieldIndex, fieldValues...)
+}
+
+// RemoveFilteredPolicyCtx is the same as RemoveFilteredPolicy but honors ctx.
+func (a *Adapter) RemoveFilteredPolicyCtx(ctx context.Context, sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	if a.readOnly {
+		return wrapError("RemoveFilteredPolicy", datastoreadapter.ErrReadOnly)
+	}
+	query := filterQuery(a.rules().Query, ptype, fieldIndex, fieldValues...)
+	return wrapError("RemoveFilteredPolicy", a.removeMatching(ctx, query, matcher(datastoreadapter.Filter{FieldIndex: fieldIndex, FieldValues: fieldValues})))
+}
+
+// removeMatching deletes the rules of query which match.
+func (a *Adapter) removeMatching(ctx context.Context, query firestore.Query, match func(datastoreadapter.CasbinRule) bool) error {
+	var refs []*firestore.DocumentRef
+	err := each(ctx, query, func(ref *firestore.DocumentRef, line datastoreadapter.CasbinRule) error {
+		if match(line) {
+			refs = append(refs, ref)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return a.write(ctx, refs, nil)
+}
+
+// LoadFilteredPolicy loads the rules matching filter, which must be either a
+// datastoreadapter.Filter or a *datastoreadapter.Filter, into the model.
+func (a *Adapter) LoadFilteredPolicy(model model.Model, filter interface{}) error {
+	return a.LoadFilteredPolicyCtx(context.Background(), model, filter)
+}
+
+// LoadFilteredPolicyCtx is the same as LoadFilteredPolicy but honors ctx.
+func (a *Adapter) LoadFilteredPolicyCtx(ctx context.Context, model model.Model, filter interface{}) error {
+	var f datastoreadapter.Filter
+	switch filter := filter.(type) {
+	case datastoreadapter.Filter:
+		f = filter
+	case *datastoreadapter.Filter:
+		if filter == nil {
+			return wrapError("LoadFilteredPolicy", fmt.Errorf("%w: %T", datastoreadapter.ErrInvalidFilter, filter))
+		}
+		f = *filter
+	default:
+		return wrapError("LoadFilteredPolicy", fmt.Errorf("%w: %T", datastoreadapter.ErrInvalidFilter, filter))
+	}
+
+	// The values of IgnoreCase and the prefix of Prefix are matched in
+	// memory only.
+	queried := f.FieldValues
+	if f.IgnoreCase {
+		queried = nil
+	} else if f.Prefix && len(queried) > 0 {
+		queried = queried[:len(queried)-1]
+	}
+	match := matcher(f)
+	query := filterQuery(a.rules().Query, f.PType, f.FieldIndex, queried...)
+	err := each(ctx, query, func(_ *firestore.DocumentRef, line datastoreadapter.CasbinRule) error {
+		if match(line) {
+			datastoreadapter.LoadPolicyLine(line, model)
+		}
+		return nil
+	})
+	if err != nil {
+		return wrapError("LoadFilteredPolicy", err)
+	}
+	a.setFiltered(true)
+	return nil
+}
+
+// IsFiltered reports whether the last load was a filtered one.
+func (a *Adapter) IsFiltered() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.filtered
+}
+
+func (a *Adapter) setFiltered(filtered bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.filtered = filtered
+}
+
+// filterQuery narrows query down to the rules of ptype whose values v0 to v5
+// match fieldValues starting at fieldIndex. Empty field values match any
+// value, and datastoreadapter.MatchEmpty matches empty values only.
+func filterQuery(query firestore.Query, ptype string, fieldIndex int, fieldValues ...string) firestore.Query {
+	query = query.Where("p_type", "==", ptype)
+	for i, value := range fieldValues {
+		field := fieldIndex + i
+		if field < 0 || field >= 6 || value == "" {
+			continue
+		}
+		if value == datastoreadapter.MatchEmpty {
+			value = ""
+		}
+		query = query.Where(fmt.Sprintf("v%d", field), "==", value)
+	}
+	return query
+}
+
+// matcher returns a func reporting whether the values of a rule match the
+// field values of f, including the ones after v5 which filterQuery doesn't
+// match.
+func matcher(f datastoreadapter.Filter) func(datastoreadapter.CasbinRule) bool {
+	equal := func(stored, value string) bool {
+		return stored == value || f.IgnoreCase && strings.EqualFold(stored, value)
+	}
+	return func(line datastoreadapter.CasbinRule) bool {
+		values := line.Rule()
+		for i, value := range f.FieldValues {
+			field := f.FieldIndex + i
+			if field < 0 || value == "" {
+				continue
+			}
+			if value == datastoreadapter.MatchEmpty {
+				if field < len(values) && values[field] != "" {
+					return false
+				}
+				continue
+			}
+			if field >= len(values) {
+				return false
+			}
+			stored := values[field]
+			if f.Prefix && i == len(f.FieldValues)-1 && len(stored) >= len(value) {
+				stored = stored[:len(value)]
+			}
+			if !equal(stored, value) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func sameValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+package firestoreadapter
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	"github.com/casbin/casbin/v2/model"
+	datastoreadapter "github.com/reedom/datastore-adapter/v3"
+)
+
+func getFirestore(t *testing.T) *firestore.Client {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST is not set")
+	}
+	db, err := firestore.NewClient(context.Background(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func loadPolicy(t *testing.T, a *Adapter, filter interface{}) [][]string {
+	m, err := model.NewModelFromFile("../examples/rbac_model.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter == nil {
+		err = a.LoadPolicy(m)
+	} else {
+		err = a.LoadFilteredPolicy(m, filter)
+	}
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	var policy [][]string
+	for _, sec := range []string{"p", "g"} {
+		for _, ast := range m[sec] {
+			policy = append(policy, ast.Policy...)
+		}
+	}
+	sort.Slice(policy, func(i, j int) bool {
+		return strings.Join(policy[i], ",") < strings.Join(policy[j], ",")
+	})
+	return policy
+}
+
+func TestAdapter(t *testing.T) {
+	a := NewAdapterWithConfig(getFirestore(t), Config{Collection: "casbin_test"})
+
+	m, err := model.NewModelFromFile("../examples/rbac_model.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.AddPolicy("p", "p", []string{"alice", "data1", "read"})
+	m.AddPolicy("p", "p", []string{"bob", "data2", "write"})
+	m.AddPolicy("g", "g", []string{"alice", "data2_admin"})
+	if err := a.SavePolicy(m); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	if err := a.AddPolicy("p", "p", []string{"carol", "", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.RemovePolicy("p", "p", []string{"bob", "data2", "write"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	wants := [][]string{{"alice", "data1", "read"}, {"alice", "data2_admin"}, {"carol", "", "read"}}
+	if actual := loadPolicy(t, a, nil); !reflect.DeepEqual(actual, wants) {
+		t.Errorf("got %v, wants %v", actual, wants)
+	}
+
+	filter := datastoreadapter.Filter{PType: "p", FieldIndex: 2, FieldValues: []string{"read"}}
+	wants = [][]string{{"alice", "data1", "read"}, {"carol", "", "read"}}
+	if actual := loadPolicy(t, a, filter); !reflect.DeepEqual(actual, wants) {
+		t.Errorf("got %v, wants %v", actual, wants)
+	}
+	if !a.IsFiltered() {
+		t.Error("got IsFiltered false, wants true")
+	}
+
+	if err := a.RemoveFilteredPolicy("p", "p", 0, "alice"); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	wants = [][]string{{"alice", "data2_admin"}, {"carol", "", "read"}}
+	if actual := loadPolicy(t, a, nil); !reflect.DeepEqual(actual, wants) {
+		t.Errorf("got %v, wants %v", actual, wants)
+	}
+}
@@ -0,0 +1,12 @@
+module github.com/reedom/datastore-adapter/v3/firestore
+
+go 1.14
+
+require (
+	cloud.google.com/go/firestore v1.1.1
+	github.com/casbin/casbin/v2 v2.2.2
+	github.com/reedom/datastore-adapter/v3 v3.0.0
+	google.golang.org/api v0.17.0
+)
+
+replace github.com/reedom/datastore-adapter/v3 => ../
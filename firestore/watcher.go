@@ -0,0 +1,108 @@
+package firestoreadapter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/casbin/casbin/v2/persist"
+)
+
+// watcherRetryDelay is how long Watcher waits before listening again after
+// its listener failed.
+const watcherRetryDelay = time.Second
+
+// Watcher notifies enforcers of the changes to the rules stored with a
+// Config, through a real-time snapshot listener on their collection, so that
+// the changes propagate within a second without Pub/Sub:
+//
+//	w := firestoreadapter.NewWatcher(ctx, db, config)
+//	defer w.Close()
+//	e.SetWatcher(w)
+//
+// The listener receives every rule of the collection when it starts, and
+// again whenever it has to listen anew after a failure; the latter is
+// reported as a change, since changes may have been missed meanwhile.
+type Watcher struct {
+	query  firestore.Query
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu       sync.Mutex
+	callback func(string)
+}
+
+var _ persist.Watcher = (*Watcher)(nil)
+
+// NewWatcher is the constructor for Watcher. It listens until ctx is done or
+// Close is called.
+func NewWatcher(ctx context.Context, db *firestore.Client, config Config) *Watcher {
+	a := NewAdapterWithConfig(db, config)
+	ctx, cancel := context.WithCancel(ctx)
+	w := &Watcher{
+		query:  a.rules().Query,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go w.listen(ctx)
+	return w
+}
+
+// listen calls the callback on every snapshot but the first one, listening
+// anew whenever the listener fails.
+func (w *Watcher) listen(ctx context.Context) {
+	defer close(w.done)
+	first := true
+	for {
+		it := w.query.Snapshots(ctx)
+		for {
+			snap, err := it.Next()
+			if err != nil {
+				break
+			}
+			if !first && len(snap.Changes) > 0 {
+				w.notify()
+			}
+			first = false
+		}
+		it.Stop()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(watcherRetryDelay):
+		}
+		w.notify()
+		first = true
+	}
+}
+
+func (w *Watcher) notify() {
+	w.mu.Lock()
+	callback := w.callback
+	w.mu.Unlock()
+	if callback != nil {
+		callback("")
+	}
+}
+
+// SetUpdateCallback sets the func called on the changes to the rules.
+func (w *Watcher) SetUpdateCallback(callback func(string)) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.callback = callback
+	return nil
+}
+
+// Update does nothing: the listeners of the other instances are notified of
+// the writes themselves.
+func (w *Watcher) Update() error {
+	return nil
+}
+
+// Close stops listening and waits for the listener to return.
+func (w *Watcher) Close() {
+	w.cancel()
+	<-w.done
+}
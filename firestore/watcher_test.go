@@ -0,0 +1,35 @@
+package firestoreadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	db := getFirestore(t)
+	config := Config{Collection: "casbin_test_watcher"}
+	w := NewWatcher(context.Background(), db, config)
+	defer w.Close()
+
+	updated := make(chan struct{}, 1)
+	if err := w.SetUpdateCallback(func(string) {
+		select {
+		case updated <- struct{}{}:
+		default:
+		}
+	}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	// Let the listener receive its first snapshot.
+	time.Sleep(time.Second)
+
+	if err := NewAdapterWithConfig(db, config).AddPolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	select {
+	case <-updated:
+	case <-time.After(5 * time.Second):
+		t.Error("got no update, wants one")
+	}
+}
@@ -4,5 +4,8 @@ go 1.14
 
 require (
 	cloud.google.com/go/datastore v1.1.0
+	cloud.google.com/go/storage v1.5.0
 	github.com/casbin/casbin/v2 v2.2.2
+	google.golang.org/api v0.17.0
+	google.golang.org/grpc v1.27.1
 )
@@ -0,0 +1,383 @@
+// Package grpcadmin serves a gRPC API to manage the policy stored by the
+// datastore adapter, so that services in other languages and internal
+// dashboards can list, add and remove rules, reload the model of an enforcer
+// and back the policy up:
+//
+//	s := grpc.NewServer()
+//	grpcadmin.RegisterServer(s, grpcadmin.NewServerWithConfig(db, config, grpcadmin.ServerConfig{
+//		Enforcer: e,
+//	}))
+//
+// The messages are JSON-encoded, following the proto3 JSON mapping of the
+// messages of admin.proto, with the codec the package registers under the
+// name "datastoreadapter-json", which clients select with the content subtype
+// "application/grpc+datastoreadapter-json"; Go clients can use Client. The
+// service is "datastoreadapter.admin.v1.PolicyAdmin" and its methods take and
+// return the Request and Response types of the same names, e.g.
+// "/datastoreadapter.admin.v1.PolicyAdmin/ListPolicies".
+package grpcadmin
+
+import (
+	"context"
+	"encoding/json"
+
+	"cloud.google.com/go/datastore"
+	"cloud.google.com/go/storage"
+	"github.com/casbin/casbin/v2"
+	datastoreadapter "github.com/reedom/datastore-adapter/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+)
+
+// ServiceName is the full name of the gRPC service.
+const ServiceName = "datastoreadapter.admin.v1.PolicyAdmin"
+
+// CodecName is the name of the codec of the messages. It is specific to the
+// package, so that registering it doesn't replace the "json" codec other
+// services of the process may use.
+const CodecName = "datastoreadapter-json"
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// jsonCodec encodes the messages as JSON.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+func (jsonCodec) Name() string { return CodecName }
+
+// Rule is a rule of ptype.
+type Rule struct {
+	PType  string   `json:"ptype"`
+	Values []string `json:"values"`
+}
+
+// ListPoliciesRequest is the request of ListPolicies.
+type ListPoliciesRequest struct {
+	// PType restricts the rules to the ones of a ptype.
+	PType string `json:"ptype,omitempty"`
+	// PageSize is the maximum number of rules of the page. Zero, or above
+	// Config.PageSize, is Config.PageSize.
+	PageSize int `json:"pageSize,omitempty"`
+	// PageToken is the NextPageToken of the previous page, or empty for the
+	// first one.
+	PageToken string `json:"pageToken,omitempty"`
+}
+
+// ListPoliciesResponse is the response of ListPolicies.
+type ListPoliciesResponse struct {
+	Rules []Rule `json:"rules"`
+	// NextPageToken is the token of the next page, or empty once there is no
+	// more rule.
+	NextPageToken string `json:"nextPageToken,omitempty"`
+}
+
+// AddPoliciesRequest is the request of AddPolicies.
+type AddPoliciesRequest struct {
+	Rules []Rule `json:"rules"`
+}
+
+// AddPoliciesResponse is the response of AddPolicies.
+type AddPoliciesResponse struct{}
+
+// RemovePoliciesRequest is the request of RemovePolicies.
+type RemovePoliciesRequest struct {
+	Rules []Rule `json:"rules"`
+}
+
+// RemovePoliciesResponse is the response of RemovePolicies.
+type RemovePoliciesResponse struct{}
+
+// ReloadModelRequest is the request of ReloadModel.
+type ReloadModelRequest struct{}
+
+// ReloadModelResponse is the response of ReloadModel.
+type ReloadModelResponse struct{}
+
+// BackupRequest is the request of Backup.
+type BackupRequest struct{}
+
+// BackupResponse is the response of Backup.
+type BackupResponse struct {
+	// Object is the name of the backup object.
+	Object string `json:"object"`
+}
+
+// PolicyAdminServer is the server API of the service.
+type PolicyAdminServer interface {
+	ListPolicies(context.Context, *ListPoliciesRequest) (*ListPoliciesResponse, error)
+	AddPolicies(context.Context, *AddPoliciesRequest) (*AddPoliciesResponse, error)
+	RemovePolicies(context.Context, *RemovePoliciesRequest) (*RemovePoliciesResponse, error)
+	ReloadModel(context.Context, *ReloadModelRequest) (*ReloadModelResponse, error)
+	Backup(context.Context, *BackupRequest) (*BackupResponse, error)
+}
+
+// ServerConfig is the configuration of Server.
+type ServerConfig struct {
+	// Enforcer whose model and policy ReloadModel reloads.
+	// Optional. (Default: nil, ReloadModel fails with FailedPrecondition)
+	Enforcer *casbin.Enforcer
+	// Bucket Backup writes the backups to.
+	// Optional. (Default: nil, Backup fails with FailedPrecondition)
+	Bucket *storage.BucketHandle
+	// Prefix of the names of the backup objects.
+	// Optional. (Default: "casbin")
+	BackupPrefix string
+}
+
+// Server implements PolicyAdminServer with the policy stored with a Config.
+type Server struct {
+	db      *datastore.Client
+	config  datastoreadapter.Config
+	adapter *datastoreadapter.Adapter
+
+	enforcer     *casbin.Enforcer
+	bucket       *storage.BucketHandle
+	backupPrefix string
+}
+
+var _ PolicyAdminServer = (*Server)(nil)
+
+// NewServer is the constructor for Server.
+func NewServer(db *datastore.Client, config datastoreadapter.Config) *Server {
+	return NewServerWithConfig(db, config, ServerConfig{})
+}
+
+// NewServerWithConfig is the constructor for Server. The caller owns db and
+// closes it once the server is done.
+func NewServerWithConfig(db *datastore.Client, config datastoreadapter.Config, serverConfig ServerConfig) *Server {
+	prefix := serverConfig.BackupPrefix
+	if prefix == "" {
+		prefix = "casbin"
+	}
+	return &Server{
+		db:           db,
+		config:       config,
+		adapter:      datastoreadapter.NewAdapterWithSharedClient(db, config),
+		enforcer:     serverConfig.Enforcer,
+		bucket:       serverConfig.Bucket,
+		backupPrefix: prefix,
+	}
+}
+
+// statusError converts err to a gRPC status error.
+func statusError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return status.Error(datastoreadapter.ErrorCode(err), err.Error())
+}
+
+// ListPolicies returns a page of the stored rules, except soft deleted and
+// expired ones; see datastoreadapter.Adapter.ListPolicies.
+func (s *Server) ListPolicies(ctx context.Context, req *ListPoliciesRequest) (*ListPoliciesResponse, error) {
+	var filter interface{}
+	if req.PType != "" {
+		filter = datastoreadapter.Filter{PType: req.PType}
+	}
+	rules, next, err := s.adapter.ListPolicies(ctx, filter, req.PageSize, datastoreadapter.ResumeToken(req.PageToken))
+	if err != nil {
+		return nil, statusError(err)
+	}
+	resp := &ListPoliciesResponse{Rules: []Rule{}, NextPageToken: string(next)}
+	for _, line := range rules {
+		resp.Rules = append(resp.Rules, Rule{PType: line.PType, Values: line.Rule()})
+	}
+	return resp, nil
+}
+
+// AddPolicies adds the rules one by one. If one fails, the ones before it
+// stay added.
+func (s *Server) AddPolicies(ctx context.Context, req *AddPoliciesRequest) (*AddPoliciesResponse, error) {
+	if err := validate(req.Rules); err != nil {
+		return nil, err
+	}
+	for _, rule := range req.Rules {
+		if err := s.adapter.AddPolicyCtx(ctx, rule.PType[:1], rule.PType, rule.Values); err != nil {
+			return nil, statusError(err)
+		}
+	}
+	return &AddPoliciesResponse{}, nil
+}
+
+// RemovePolicies removes the rules one by one. If one fails, the ones before
+// it stay removed.
+func (s *Server) RemovePolicies(ctx context.Context, req *RemovePoliciesRequest) (*RemovePoliciesResponse, error) {
+	if err := validate(req.Rules); err != nil {
+		return nil, err
+	}
+	for _, rule := range req.Rules {
+		if err := s.adapter.RemovePolicyCtx(ctx, rule.PType[:1], rule.PType, rule.Values); err != nil {
+			return nil, statusError(err)
+		}
+	}
+	return &RemovePoliciesResponse{}, nil
+}
+
+// ReloadModel sets the stored model on the enforcer of ServerConfig and
+// reloads its policy.
+func (s *Server) ReloadModel(ctx context.Context, _ *ReloadModelRequest) (*ReloadModelResponse, error) {
+	if s.enforcer == nil {
+		return nil, status.Error(codes.FailedPrecondition, "no enforcer to reload")
+	}
+	m, err := datastoreadapter.LoadModelCtx(ctx, s.db, s.config)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	s.enforcer.SetModel(m)
+	if err := s.enforcer.LoadPolicy(); err != nil {
+		return nil, statusError(err)
+	}
+	return &ReloadModelResponse{}, nil
+}
+
+// Backup backs the model and the rules up to the bucket of ServerConfig; see
+// datastoreadapter.Adapter.BackupToGCS.
+func (s *Server) Backup(ctx context.Context, _ *BackupRequest) (*BackupResponse, error) {
+	if s.bucket == nil {
+		return nil, status.Error(codes.FailedPrecondition, "no backup bucket")
+	}
+	object, err := s.adapter.BackupToGCS(ctx, s.bucket, s.backupPrefix)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &BackupResponse{Object: object}, nil
+}
+
+// validate reports InvalidArgument unless every rule has a p or g ptype.
+func validate(rules []Rule) error {
+	for _, rule := range rules {
+		if rule.PType == "" || rule.PType[0] != 'p' && rule.PType[0] != 'g' {
+			return status.Errorf(codes.InvalidArgument, "invalid ptype %q", rule.PType)
+		}
+	}
+	return nil
+}
+
+// RegisterServer registers srv on s.
+func RegisterServer(s *grpc.Server, srv PolicyAdminServer) {
+	s.RegisterService(&ServiceDesc, srv)
+}
+
+// unaryHandler returns the handler of method, calling call with a new
+// request decoded by dec.
+func unaryHandler(method string, newRequest func() interface{}, call func(PolicyAdminServer, context.Context, interface{}) (interface{}, error)) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := newRequest()
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(srv.(PolicyAdminServer), ctx, req)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/" + method}
+		return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(srv.(PolicyAdminServer), ctx, req)
+		})
+	}
+}
+
+// ServiceDesc is the description of the service.
+var ServiceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*PolicyAdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListPolicies",
+			Handler: unaryHandler("ListPolicies", func() interface{} { return new(ListPoliciesRequest) },
+				func(srv PolicyAdminServer, ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.ListPolicies(ctx, req.(*ListPoliciesRequest))
+				}),
+		},
+		{
+			MethodName: "AddPolicies",
+			Handler: unaryHandler("AddPolicies", func() interface{} { return new(AddPoliciesRequest) },
+				func(srv PolicyAdminServer, ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.AddPolicies(ctx, req.(*AddPoliciesRequest))
+				}),
+		},
+		{
+			MethodName: "RemovePolicies",
+			Handler: unaryHandler("RemovePolicies", func() interface{} { return new(RemovePoliciesRequest) },
+				func(srv PolicyAdminServer, ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.RemovePolicies(ctx, req.(*RemovePoliciesRequest))
+				}),
+		},
+		{
+			MethodName: "ReloadModel",
+			Handler: unaryHandler("ReloadModel", func() interface{} { return new(ReloadModelRequest) },
+				func(srv PolicyAdminServer, ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.ReloadModel(ctx, req.(*ReloadModelRequest))
+				}),
+		},
+		{
+			MethodName: "Backup",
+			Handler: unaryHandler("Backup", func() interface{} { return new(BackupRequest) },
+				func(srv PolicyAdminServer, ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.Backup(ctx, req.(*BackupRequest))
+				}),
+		},
+	},
+	Metadata: "grpcadmin",
+}
+
+// Client is a client of the service.
+type Client struct {
+	cc *grpc.ClientConn
+}
+
+// NewClient is the constructor for Client.
+func NewClient(cc *grpc.ClientConn) *Client {
+	return &Client{cc: cc}
+}
+
+func (c *Client) invoke(ctx context.Context, method string, req, resp interface{}, opts []grpc.CallOption) error {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(CodecName)}, opts...)
+	return c.cc.Invoke(ctx, "/"+ServiceName+"/"+method, req, resp, opts...)
+}
+
+func (c *Client) ListPolicies(ctx context.Context, req *ListPoliciesRequest, opts ...grpc.CallOption) (*ListPoliciesResponse, error) {
+	resp := new(ListPoliciesResponse)
+	if err := c.invoke(ctx, "ListPolicies", req, resp, opts); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) AddPolicies(ctx context.Context, req *AddPoliciesRequest, opts ...grpc.CallOption) (*AddPoliciesResponse, error) {
+	resp := new(AddPoliciesResponse)
+	if err := c.invoke(ctx, "AddPolicies", req, resp, opts); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) RemovePolicies(ctx context.Context, req *RemovePoliciesRequest, opts ...grpc.CallOption) (*RemovePoliciesResponse, error) {
+	resp := new(RemovePoliciesResponse)
+	if err := c.invoke(ctx, "RemovePolicies", req, resp, opts); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) ReloadModel(ctx context.Context, req *ReloadModelRequest, opts ...grpc.CallOption) (*ReloadModelResponse, error) {
+	resp := new(ReloadModelResponse)
+	if err := c.invoke(ctx, "ReloadModel", req, resp, opts); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) Backup(ctx context.Context, req *BackupRequest, opts ...grpc.CallOption) (*BackupResponse, error) {
+	resp := new(BackupResponse)
+	if err := c.invoke(ctx, "Backup", req, resp, opts); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,98 @@
+package grpcadmin
+
+import (
+	"context"
+	"testing"
+
+	datastoreadapter "github.com/reedom/datastore-adapter/v3"
+	"github.com/reedom/datastore-adapter/v3/datastoretest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+)
+
+func TestMain(m *testing.M) {
+	datastoretest.Main(m)
+}
+
+// call calls method of the service with the JSON request, as the gRPC
+// server would.
+func call(t *testing.T, srv PolicyAdminServer, method string, request string) (interface{}, error) {
+	t.Helper()
+	codec := encoding.GetCodec(CodecName)
+	for _, desc := range ServiceDesc.Methods {
+		if desc.MethodName == method {
+			return desc.Handler(srv, context.Background(), func(req interface{}) error {
+				return codec.Unmarshal([]byte(request), req)
+			}, nil)
+		}
+	}
+	t.Fatalf("no method %s", method)
+	return nil, nil
+}
+
+func TestServer(t *testing.T) {
+	env := datastoretest.New(t)
+	config := datastoreadapter.Config{Namespace: env.Namespace}
+	env.SaveModel("../examples/rbac_model.conf", config)
+	env.Seed(env.NewAdapter(config),
+		[]string{"p", "alice", "data1", "read"},
+		[]string{"g", "alice", "data2_admin"},
+	)
+	e, err := datastoreadapter.NewEnforcerFromDatastore(context.Background(), env.Client, config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServerWithConfig(env.Client, config, ServerConfig{Enforcer: e})
+
+	if _, err := call(t, srv, "AddPolicies", `{"rules":[{"ptype":"p","values":["bob","data2","write"]}]}`); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if _, err := call(t, srv, "RemovePolicies", `{"rules":[{"ptype":"g","values":["alice","data2_admin"]}]}`); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	resp, err := call(t, srv, "ListPolicies", `{"ptype":"p"}`)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	var actual [][]string
+	for _, rule := range resp.(*ListPoliciesResponse).Rules {
+		actual = append(actual, rule.Values)
+	}
+	if wants := [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}}; len(actual) != len(wants) {
+		t.Errorf("got %v, wants %v", actual, wants)
+	}
+
+	// The rules are listed page by page.
+	resp, err = call(t, srv, "ListPolicies", `{"ptype":"p","pageSize":1}`)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	first := resp.(*ListPoliciesResponse)
+	if len(first.Rules) != 1 || first.NextPageToken == "" {
+		t.Fatalf("got %v, wants a rule and a token to the next page", first)
+	}
+	resp, err = call(t, srv, "ListPolicies", `{"ptype":"p","pageSize":1,"pageToken":"`+first.NextPageToken+`"}`)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if second := resp.(*ListPoliciesResponse); len(second.Rules) != 1 || second.Rules[0].Values[0] == first.Rules[0].Values[0] {
+		t.Errorf("got %v after %v, wants the other rule", second.Rules, first.Rules)
+	}
+
+	if _, err := call(t, srv, "ReloadModel", `{}`); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if policy := e.GetPolicy(); len(policy) != 2 {
+		t.Errorf("got %v, wants the rules of alice and bob", policy)
+	}
+
+	_, err = call(t, srv, "AddPolicies", `{"rules":[{"ptype":"x","values":["carol"]}]}`)
+	if code := status.Code(err); code != codes.InvalidArgument {
+		t.Errorf("got %v, wants InvalidArgument", err)
+	}
+	_, err = call(t, srv, "Backup", `{}`)
+	if code := status.Code(err); code != codes.FailedPrecondition {
+		t.Errorf("got %v, wants FailedPrecondition", err)
+	}
+}
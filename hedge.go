@@ -0,0 +1,82 @@
+package datastoreadapter
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+type hedgeKey struct{}
+
+// withHedging returns a context whose page reads are hedged, if
+// Config.HedgeDelay is set.
+func withHedging(ctx context.Context) context.Context {
+	return context.WithValue(ctx, hedgeKey{}, true)
+}
+
+func hedging(ctx context.Context) bool {
+	hedged, _ := ctx.Value(hedgeKey{}).(bool)
+	return hedged
+}
+
+// page is the result of a page read.
+type page struct {
+	keys  []*datastore.Key
+	rules []CasbinRule
+	next  ResumeToken
+	// read is the number of entities the query returned, including the
+	// malformed rules dropped from keys and rules.
+	read int
+	err  error
+	// malformed are the malformed rules the read has come across, if it
+	// collects them on its own; see fetchHedgedPage.
+	malformed *malformedRules
+}
+
+// fetchHedgedPage is the same as fetchPageOnce, but runs the same read again
+// if it has not returned within a.hedgeDelay, and returns whichever returns
+// first. A read which fails is only superseded by the other one, if already
+// running. Each read collects the malformed rules on its own, so that only
+// those of the returned read are added to the collector of ctx.
+func (a *Adapter) fetchHedgedPage(ctx context.Context, q *datastore.Query, keysOnly bool, limit int, token ResumeToken) page {
+	shared := malformed(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	// Cancel the read which lost the race.
+	defer cancel()
+
+	results := make(chan page, 2)
+	read := func() {
+		ctx := ctx
+		var m *malformedRules
+		if shared != nil {
+			m = &malformedRules{}
+			ctx = withMalformed(ctx, m)
+		}
+		p := a.fetchPageOnce(ctx, q, keysOnly, limit, token)
+		p.malformed = m
+		results <- p
+	}
+	go read()
+	running := 1
+
+	timer := time.NewTimer(a.hedgeDelay)
+	defer timer.Stop()
+	hedge := timer.C
+	for {
+		select {
+		case p := <-results:
+			running--
+			if p.err == nil || running == 0 {
+				if p.err == nil && p.malformed != nil {
+					shared.merge(p.malformed)
+				}
+				return p
+			}
+		case <-hedge:
+			hedge = nil
+			go read()
+			running++
+		}
+	}
+}
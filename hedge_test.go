@@ -0,0 +1,39 @@
+package datastoreadapter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+)
+
+func TestHedgedLoad(t *testing.T) {
+	// A page size of 2 makes the 5 rules span several pages, and a delay of
+	// 1ns hedges every one of them.
+	config := Config{Kind: "casbin_test_hedge", Namespace: "unittest", PageSize: 2, HedgeDelay: time.Nanosecond}
+	initPolicy(t, config)
+
+	var stats statsRecorder
+	config.Metrics = &stats
+	a := NewAdapterWithConfig(getDatastore(), config)
+	e, err := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+	// Only the reads used are counted.
+	if len(stats) != 1 || stats[0].EntitiesRead != 5 {
+		t.Errorf("got %+v, wants a LoadPolicy reading 5 rules", stats)
+	}
+
+	cached := NewCachedAdapter(a, 0)
+	e, err = casbin.NewEnforcer("examples/rbac_model.conf", cached)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+}
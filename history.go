@@ -0,0 +1,107 @@
+package datastoreadapter
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2/model"
+)
+
+// liveAt reports whether line was live at t, according to the times it was
+// created, soft deleted and expires at. Rules stored without a creation time
+// are deemed to have always existed.
+func (line CasbinRule) liveAt(t time.Time) bool {
+	return !line.CreatedAt.After(t) &&
+		(!line.deleted() || line.DeletedAt.After(t)) &&
+		!line.expired(t)
+}
+
+// LoadPolicyAt loads into the model the rules which were live at t, e.g. to
+// investigate what an enforcer allowed during an incident.
+//
+// It is not a point-in-time read: the datastore client doesn't support reads
+// at a past time, so the policy is reconstructed from the metadata of the
+// stored rules, that is, their creation, expiry and soft deletion times,
+// which requires Config.SoftDelete. The reconstruction is only accurate
+// after the rules were last deleted for good, e.g. by SavePolicy, the imports
+// replacing the policy, PurgeExpiredPolicies, CleanupPolicies,
+// PurgeDeletedPolicies or a switch of the slots of Config.BlueGreen, so it
+// fails with ErrHistoryUnavailable for the times before, as well as without
+// Config.SoftDelete. PurgeNamespace erases the history along with the rules.
+//
+// The loaded model is marked as filtered, so that an enforcer doesn't save it
+// back over the current policy.
+func (a *Adapter) LoadPolicyAt(ctx context.Context, model model.Model, t time.Time) error {
+	return a.do(ctx, "LoadPolicyAt", func(ctx context.Context) error {
+		if !a.softDelete {
+			return ErrHistoryUnavailable
+		}
+
+		return a.readConsistently(ctx, func(ctx context.Context) error {
+			since, err := a.historySince(ctx)
+			if err != nil {
+				return err
+			}
+			if !t.After(since) {
+				return ErrHistoryUnavailable
+			}
+
+			_, err := a.paginateRules(ctx, false, "", func(keys []*datastore.Key, rules []CasbinRule) error {
+				for i, line := range rules {
+					if line.liveAt(t) && !addPolicyLine(line, model) {
+						if err := a.unknownRule(ctx, keys[i], line); err != nil {
+							return err
+						}
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			a.setFiltered(true)
+			return nil
+		})
+	})
+}
+
+// historySince returns the time after which LoadPolicyAt can reconstruct the
+// policy: the last time rules were deleted for good.
+func (a *Adapter) historySince(ctx context.Context) (time.Time, error) {
+	var v policyVersion
+	var err error
+	if tx := readTransaction(ctx); tx != nil {
+		err = tx.Get(a.policyVersionKey(), &v)
+	} else {
+		err = a.db.Get(ctx, a.policyVersionKey(), &v)
+	}
+	if err != nil && err != datastore.ErrNoSuchEntity {
+		return time.Time{}, err
+	}
+	return v.HardDeletedAt, nil
+}
+
+// markHardDelete records that rules are about to be deleted for good, so
+// that LoadPolicyAt no longer reconstructs the policy before now. It is
+// recorded beforehand, in case the deletion fails part way. It is a no-op
+// without Config.SoftDelete, since LoadPolicyAt is unavailable then, and
+// under WithDryRun.
+func (a *Adapter) markHardDelete(ctx context.Context) error {
+	if !a.softDelete || dryRun(ctx) != nil {
+		return nil
+	}
+	return a.limited(ctx, func() error {
+		_, err := a.db.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+			var v policyVersion
+			if err := tx.Get(a.policyVersionKey(), &v); err != nil && err != datastore.ErrNoSuchEntity {
+				return err
+			}
+			v.HardDeletedAt = a.now()
+			_, err := tx.Put(a.policyVersionKey(), &v)
+			return err
+		})
+		return err
+	})
+}
@@ -0,0 +1,67 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+)
+
+func TestLoadPolicyAt(t *testing.T) {
+	ctx := context.Background()
+	config := Config{Kind: "casbin_test_history", Namespace: "unittest", SoftDelete: true}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	before := time.Now()
+	time.Sleep(time.Millisecond)
+	if err := a.AddPolicyCtx(ctx, "p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.RemovePolicyCtx(ctx, "p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf")
+	load := func(at time.Time) {
+		e.ClearPolicy()
+		if err := a.LoadPolicyAt(ctx, e.GetModel(), at); err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+	}
+
+	load(before)
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+	load(time.Now())
+	testGetPolicy(e, [][]string{{"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"carol", "data3", "read"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+	if !a.IsFiltered() {
+		t.Errorf("got an unfiltered load, wants it marked as filtered")
+	}
+
+	// Once the tombstones are purged, the policy before can't be
+	// reconstructed.
+	if _, err := a.PurgeDeletedPolicies(ctx, time.Now()); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.LoadPolicyAt(ctx, e.GetModel(), before); !errors.Is(err, ErrHistoryUnavailable) {
+		t.Errorf("got %v, wants %v", err, ErrHistoryUnavailable)
+	}
+}
+
+func TestLoadPolicyAtWithoutSoftDelete(t *testing.T) {
+	a := NewAdapterWithConfig(getDatastore(), Config{Kind: "casbin_test_history", Namespace: "unittest"})
+	m, err := model.NewModelFromFile("examples/rbac_model.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.LoadPolicyAt(context.Background(), m, time.Now()); !errors.Is(err, ErrHistoryUnavailable) {
+		t.Errorf("got %v, wants %v", err, ErrHistoryUnavailable)
+	}
+}
@@ -0,0 +1,284 @@
+// Package httpadmin provides an http.Handler to manage the policy and the
+// model stored by the datastore adapter with JSON requests, to be mounted
+// into an existing service:
+//
+//	mux.Handle("/admin/", http.StripPrefix("/admin", httpadmin.NewHandlerWithConfig(db, config, httpadmin.HandlerConfig{
+//		Authenticator: func(r *http.Request) (string, error) {
+//			return verifyToken(r.Header.Get("Authorization"))
+//		},
+//	})))
+//
+// It serves:
+//
+//	GET    /policies[?ptype=p]  lists a page of the rules, as {"rules": [{"ptype": "p", "values": [...]}],
+//	                            "next_page_token": "..."}, the next one with ?page_token=...;
+//	                            page_size sets the number of rules of a page
+//	POST   /policies            adds the rules of the request, as {"rules": [...]}
+//	DELETE /policies            removes the rules of the request, as {"rules": [...]}
+//	GET    /model               returns the model, as {"text": "..."}, with its ETag
+//	PUT    /model               saves the model of the request, as {"text": "..."},
+//	                            if it still matches the If-Match header, if any
+package httpadmin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2/model"
+	datastoreadapter "github.com/reedom/datastore-adapter/v3"
+	"google.golang.org/grpc/codes"
+)
+
+// maxRequestSize is the maximum size of a request body.
+const maxRequestSize = 1 << 20
+
+// Rule is a rule of ptype.
+type Rule struct {
+	PType  string   `json:"ptype"`
+	Values []string `json:"values"`
+}
+
+// Rules is the body of the requests and responses of /policies.
+type Rules struct {
+	Rules []Rule `json:"rules"`
+	// NextPageToken is the token of the next page of the listed rules, or
+	// empty once there is no more rule.
+	NextPageToken string `json:"next_page_token,omitempty"`
+}
+
+// Model is the body of the requests and responses of /model.
+type Model struct {
+	Text string `json:"text"`
+}
+
+// HandlerConfig is the configuration of Handler.
+type HandlerConfig struct {
+	// Authenticator authenticating the requests, which returns the actor
+	// recorded in the rule metadata and the audit log. Requests it returns an
+	// error for are answered with 401 Unauthorized.
+	// Optional. (Default: nil, requests are not authenticated)
+	Authenticator func(r *http.Request) (string, error)
+}
+
+// Handler is the http.Handler of the admin endpoints.
+type Handler struct {
+	db            *datastore.Client
+	config        datastoreadapter.Config
+	adapter       *datastoreadapter.Adapter
+	authenticator func(r *http.Request) (string, error)
+}
+
+var _ http.Handler = (*Handler)(nil)
+
+// NewHandler is the constructor for Handler. Since it doesn't authenticate
+// the requests, it must be wrapped by a middleware which does.
+func NewHandler(db *datastore.Client, config datastoreadapter.Config) *Handler {
+	return NewHandlerWithConfig(db, config, HandlerConfig{})
+}
+
+// NewHandlerWithConfig is the constructor for Handler. The caller owns db and
+// closes it once the handler is done.
+func NewHandlerWithConfig(db *datastore.Client, config datastoreadapter.Config, handlerConfig HandlerConfig) *Handler {
+	return &Handler{
+		db:            db,
+		config:        config,
+		adapter:       datastoreadapter.NewAdapterWithSharedClient(db, config),
+		authenticator: handlerConfig.Authenticator,
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.authenticator != nil {
+		actor, err := h.authenticator(r)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+		r = r.WithContext(datastoreadapter.WithActor(r.Context(), actor))
+	}
+
+	var err error
+	switch r.URL.Path {
+	case "/policies":
+		switch r.Method {
+		case http.MethodGet:
+			err = h.listPolicies(w, r)
+		case http.MethodPost:
+			err = h.changePolicies(w, r, h.adapter.AddPolicyCtx)
+		case http.MethodDelete:
+			err = h.changePolicies(w, r, h.adapter.RemovePolicyCtx)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodDelete)
+			return
+		}
+	case "/model":
+		switch r.Method {
+		case http.MethodGet:
+			err = h.getModel(w, r)
+		case http.MethodPut:
+			err = h.putModel(w, r)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPut)
+			return
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		writeError(w, statusCode(err), err)
+	}
+}
+
+// listPolicies lists a page of the rules; see
+// datastoreadapter.Adapter.ListPolicies.
+func (h *Handler) listPolicies(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+	var filter interface{}
+	if ptype := query.Get("ptype"); ptype != "" {
+		filter = datastoreadapter.Filter{PType: ptype}
+	}
+	pageSize := 0
+	if size := query.Get("page_size"); size != "" {
+		var err error
+		if pageSize, err = strconv.Atoi(size); err != nil || pageSize < 0 {
+			return badRequest(fmt.Errorf("invalid page_size %q", size))
+		}
+	}
+
+	rules, next, err := h.adapter.ListPolicies(r.Context(), filter, pageSize, datastoreadapter.ResumeToken(query.Get("page_token")))
+	if err != nil {
+		return err
+	}
+	resp := Rules{Rules: []Rule{}, NextPageToken: string(next)}
+	for _, line := range rules {
+		resp.Rules = append(resp.Rules, Rule{PType: line.PType, Values: line.Rule()})
+	}
+	writeJSON(w, http.StatusOK, resp)
+	return nil
+}
+
+// changePolicies applies change to the rules of the request one by one. If
+// one fails, the ones before it stay changed.
+func (h *Handler) changePolicies(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, sec, ptype string, rule []string) error) error {
+	var req Rules
+	if err := readJSON(r, &req); err != nil {
+		return err
+	}
+	for _, rule := range req.Rules {
+		if rule.PType == "" || rule.PType[0] != 'p' && rule.PType[0] != 'g' {
+			return badRequest(fmt.Errorf("invalid ptype %q", rule.PType))
+		}
+	}
+	for _, rule := range req.Rules {
+		if err := change(r.Context(), rule.PType[:1], rule.PType, rule.Values); err != nil {
+			return err
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (h *Handler) getModel(w http.ResponseWriter, r *http.Request) error {
+	etag, err := datastoreadapter.GetModelETag(r.Context(), h.db, h.config)
+	if err != nil {
+		return err
+	}
+	text, err := datastoreadapter.LoadModelText(r.Context(), h.db, h.config)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("ETag", `"`+etag+`"`)
+	writeJSON(w, http.StatusOK, Model{Text: text})
+	return nil
+}
+
+func (h *Handler) putModel(w http.ResponseWriter, r *http.Request) error {
+	var req Model
+	if err := readJSON(r, &req); err != nil {
+		return err
+	}
+	if _, err := model.NewModelFromString(req.Text); err != nil {
+		return badRequest(err)
+	}
+	var err error
+	if match := r.Header.Get("If-Match"); match != "" {
+		err = datastoreadapter.SaveModelIfMatch(r.Context(), h.db, req.Text, strings.Trim(match, `"`), h.config)
+		if errors.Is(err, datastoreadapter.ErrConflict) {
+			writeError(w, http.StatusPreconditionFailed, err)
+			return nil
+		}
+	} else {
+		err = datastoreadapter.SaveModelFromString(r.Context(), h.db, req.Text, h.config)
+	}
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// requestError is an error of the request itself.
+type requestError struct {
+	err error
+}
+
+func (e requestError) Error() string { return e.err.Error() }
+
+func (e requestError) Unwrap() error { return e.err }
+
+func badRequest(err error) error {
+	return requestError{err: err}
+}
+
+func readJSON(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxRequestSize)).Decode(v); err != nil {
+		return badRequest(err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes err as {"error": "..."}.
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
+
+func methodNotAllowed(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+}
+
+// statusCode returns the HTTP status code of err.
+func statusCode(err error) int {
+	var reqErr requestError
+	if errors.As(err, &reqErr) {
+		return http.StatusBadRequest
+	}
+	switch datastoreadapter.ErrorCode(err) {
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.Aborted:
+		return http.StatusConflict
+	case codes.FailedPrecondition:
+		return http.StatusForbidden
+	case codes.Canceled, codes.DeadlineExceeded:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
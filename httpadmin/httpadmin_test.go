@@ -0,0 +1,96 @@
+package httpadmin
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	datastoreadapter "github.com/reedom/datastore-adapter/v3"
+	"github.com/reedom/datastore-adapter/v3/datastoretest"
+)
+
+func TestMain(m *testing.M) {
+	datastoretest.Main(m)
+}
+
+func TestHandler(t *testing.T) {
+	env := datastoretest.New(t)
+	config := datastoreadapter.Config{Namespace: env.Namespace}
+	env.SaveModel("../examples/rbac_model.conf", config)
+	env.Seed(env.NewAdapter(config), []string{"p", "alice", "data1", "read"})
+	h := NewHandlerWithConfig(env.Client, config, HandlerConfig{
+		Authenticator: func(r *http.Request) (string, error) {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				return "", errors.New("invalid token")
+			}
+			return "admin", nil
+		},
+	})
+
+	do := func(method, path, body string, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer secret")
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/policies", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("got %d without a token, wants 401", w.Code)
+	}
+
+	if w := do(http.MethodPost, "/policies", `{"rules":[{"ptype":"p","values":["bob","data2","write"]}]}`); w.Code != http.StatusNoContent {
+		t.Errorf("got %d %s, wants 204", w.Code, w.Body)
+	}
+	if w := do(http.MethodDelete, "/policies", `{"rules":[{"ptype":"p","values":["alice","data1","read"]}]}`); w.Code != http.StatusNoContent {
+		t.Errorf("got %d %s, wants 204", w.Code, w.Body)
+	}
+	w = do(http.MethodGet, "/policies?ptype=p", "")
+	if wants := `{"rules":[{"ptype":"p","values":["bob","data2","write"]}]}`; w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != wants {
+		t.Errorf("got %d %s, wants %s", w.Code, w.Body, wants)
+	}
+	if w := do(http.MethodPost, "/policies", `{"rules":[{"ptype":"x","values":["bob"]}]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("got %d for an invalid ptype, wants 400", w.Code)
+	}
+	if w := do(http.MethodGet, "/policies?page_size=x", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("got %d for an invalid page size, wants 400", w.Code)
+	}
+
+	w = do(http.MethodGet, "/model", "")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("got %d with ETag %q, wants 200 with an ETag", w.Code, etag)
+	}
+	text, err := ioutil.ReadFile("../examples/rbac_model.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := `{"text":` + quote(string(text)) + `}`
+	if w := do(http.MethodPut, "/model", body, "If-Match", etag); w.Code != http.StatusNoContent {
+		t.Errorf("got %d %s, wants 204", w.Code, w.Body)
+	}
+	if w := do(http.MethodPut, "/model", body, "If-Match", `"stale"`); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("got %d for a stale ETag, wants 412", w.Code)
+	}
+	if w := do(http.MethodPut, "/model", `{"text":"invalid"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("got %d for an invalid model, wants 400", w.Code)
+	}
+	if w := do(http.MethodPatch, "/model", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got %d, wants 405", w.Code)
+	}
+}
+
+func quote(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
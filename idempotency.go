@@ -0,0 +1,94 @@
+package datastoreadapter
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// idempotencyKindSuffix is appended to the configured kind to name the kind
+// of the records of the idempotency keys.
+const idempotencyKindSuffix = "_idempotency"
+
+// defaultIdempotencyTTL is the default Config.IdempotencyTTL.
+const defaultIdempotencyTTL = 24 * time.Hour
+
+// idempotencyRecord records that the mutation tagged with an idempotency key
+// has been committed. It belongs to the same entity group as the rules, so
+// that it is written in the same transaction as the mutation.
+type idempotencyRecord struct {
+	CreatedAt time.Time `datastore:"created_at,noindex"`
+	ExpiresAt time.Time `datastore:"expires_at"`
+}
+
+type idempotencyKey struct{}
+
+// WithIdempotencyKey returns a context which tags the AddPolicy operations
+// run with it with key, e.g. the ID of a Cloud Tasks task or of a Pub/Sub
+// message. An operation tagged with a key which has already been committed
+// succeeds without writing anything, so that a redelivered job neither
+// duplicates the rule nor its audit entry.
+//
+// The keys are recorded for Config.IdempotencyTTL, after which
+// PurgeExpiredPolicies deletes them.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// IdempotencyKeyFromContext returns the key set with WithIdempotencyKey, or
+// an empty string.
+func IdempotencyKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKey{}).(string)
+	return key
+}
+
+func (a *Adapter) idempotencyKind() string {
+	return a.kind + idempotencyKindSuffix
+}
+
+func (a *Adapter) idempotencyRecordKey(name string) *datastore.Key {
+	key := datastore.NameKey(a.idempotencyKind(), name, a.pseudoRootKey())
+	key.Namespace = a.namespace
+	return key
+}
+
+// claimIdempotencyKey records the idempotency key set on ctx, if any, in tx.
+// It returns errUnchanged if the key has already been recorded, so that the
+// mutation is rolled back.
+func (a *Adapter) claimIdempotencyKey(ctx context.Context, tx *datastore.Transaction) error {
+	name := IdempotencyKeyFromContext(ctx)
+	if name == "" {
+		return nil
+	}
+
+	key := a.idempotencyRecordKey(name)
+	var record idempotencyRecord
+	err := tx.Get(key, &record)
+	if err == nil && a.now().Before(record.ExpiresAt) {
+		return errUnchanged
+	}
+	if err != nil && err != datastore.ErrNoSuchEntity {
+		return err
+	}
+
+	now := a.now()
+	record = idempotencyRecord{CreatedAt: now, ExpiresAt: now.Add(a.idempotencyTTL)}
+	_, err = tx.Put(key, &record)
+	return err
+}
+
+// purgeIdempotencyKeys deletes the records of the idempotency keys which have
+// expired. They are not part of the policy, so deleting them doesn't change
+// the policy version.
+func (a *Adapter) purgeIdempotencyKeys(ctx context.Context) error {
+	query := datastore.NewQuery(a.idempotencyKind()).
+		Namespace(a.namespace).
+		Ancestor(a.pseudoRootKey()).
+		Filter("expires_at <=", a.now()).
+		KeysOnly()
+	_, err := a.paginate(ctx, query, true, "", func(keys []*datastore.Key, _ []CasbinRule) error {
+		return a.db.DeleteMulti(ctx, keys)
+	})
+	return err
+}
@@ -0,0 +1,66 @@
+package datastoreadapter
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	config := Config{Kind: "casbin_test_idempotency", Namespace: "unittest", Audit: true, IdempotencyTTL: time.Hour}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	start := time.Now()
+	// The keys are unique to the run, since they outlive the rules.
+	task := fmt.Sprint("task-", start.UnixNano())
+	ctx := WithIdempotencyKey(context.Background(), task+"-1")
+	for i := 0; i < 2; i++ {
+		if err := a.AddPolicyCtx(ctx, "p", "p", []string{"carol", "data3", "read"}); err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+	}
+	if n, err := a.CountPolicies(ctx); err != nil || n != 6 {
+		t.Errorf("got %d, %v, wants 6 rules", n, err)
+	}
+	var entries []AuditEntry
+	err := a.ListAuditEntries(ctx, start, time.Now().Add(time.Second), func(entry AuditEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got %d audit entries, wants 1", len(entries))
+	}
+
+	// Another key writes the rule again.
+	ctx = WithIdempotencyKey(context.Background(), task+"-2")
+	if err := a.AddPolicyCtx(ctx, "p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if n, err := a.CountPolicies(ctx); err != nil || n != 7 {
+		t.Errorf("got %d, %v, wants 7 rules", n, err)
+	}
+}
+
+func TestPurgeIdempotencyKeys(t *testing.T) {
+	config := Config{Kind: "casbin_test_idempotency", Namespace: "unittest", IdempotencyTTL: time.Nanosecond}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	ctx := WithIdempotencyKey(context.Background(), "purge-1")
+	if err := a.AddPolicyCtx(ctx, "p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := a.PurgeExpiredPolicies(ctx); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	var record idempotencyRecord
+	if err := a.db.Get(ctx, a.idempotencyRecordKey("purge-1"), &record); err == nil {
+		t.Errorf("got the record of an expired key, wants it purged")
+	}
+}
@@ -0,0 +1,105 @@
+package datastoreadapter
+
+import (
+	"context"
+
+	"cloud.google.com/go/datastore"
+)
+
+// savePolicyIncrementally replaces the stored rules with lines for
+// Config.IncrementalSave: it only deletes the stored rules lines lacks,
+// along with the extra copies of the others, and writes the rules of lines
+// which are not stored. The rules kept are left untouched, so they keep
+// their metadata.
+//
+// A delta which fits in a transaction is applied in one, failing with
+// ErrConflict if the policy has been modified since the adapter loaded it.
+// A larger one is applied in batches, as savePolicyInPages does.
+//
+// If lock is not nil, its lease is extended before every page and batch.
+func (a *Adapter) savePolicyIncrementally(ctx context.Context, lines []interface{}, lock *Lock) error {
+	stored := make(map[ruleID][]*datastore.Key)
+	_, err := a.paginateRules(ctx, false, "", func(keys []*datastore.Key, rules []CasbinRule) error {
+		if err := lock.extend(ctx); err != nil {
+			return err
+		}
+		for i, rule := range rules {
+			if !rule.deleted() {
+				stored[ruleFields(rule)] = append(stored[ruleFields(rule)], keys[i])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var added []interface{}
+	kept := make(map[ruleID]bool)
+	for _, line := range lines {
+		id := ruleFields(*line.(*CasbinRule))
+		if kept[id] {
+			continue
+		}
+		kept[id] = true
+		if _, ok := stored[id]; !ok {
+			added = append(added, line)
+		}
+	}
+	var removed []*datastore.Key
+	for id, keys := range stored {
+		if kept[id] {
+			keys = keys[1:]
+		}
+		removed = append(removed, keys...)
+	}
+	if len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+	ruleMetadata{}.stamp(ctx, added, a.now())
+
+	if len(added)*a.ruleWrites()+len(removed) > maxRuleMutations {
+		var commits batchCommits
+		if err := a.deleteRules(ctx, true, removed); err != nil {
+			return commits.fail(err, added)
+		}
+		commits.delete(removed)
+		return commits.fail(a.putRules(ctx, true, added, lock), nil)
+	}
+
+	if record := dryRun(ctx); record != nil {
+		recordDeletes(record, MutationDelete, removed)
+		recordPuts(record, added)
+		return nil
+	}
+	added, err = a.encodeRules(ctx, added)
+	if err != nil {
+		return err
+	}
+	keys := make([]*datastore.Key, len(added))
+	for i := range keys {
+		keys[i] = a.newRuleKey(added[i].(*CasbinRule))
+	}
+	keys, entities, err := a.indexedEntities(ctx, keys, added)
+	if err != nil {
+		return err
+	}
+	if err := a.markHardDelete(ctx); err != nil {
+		return err
+	}
+	err = a.mutate(ctx, true, len(removed)+len(added), func(tx *datastore.Transaction) error {
+		if err := tx.DeleteMulti(removed); err != nil {
+			return err
+		}
+		_, err := tx.PutMulti(keys, entities)
+		return err
+	})
+	if err == nil {
+		op := operationFromContext(ctx)
+		op.expect(PhaseDeleting, len(removed))
+		op.advance(PhaseDeleting, len(removed))
+		op.expect(PhaseWriting, len(added))
+		op.advance(PhaseWriting, len(added))
+	}
+	return err
+}
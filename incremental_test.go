@@ -0,0 +1,70 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2"
+)
+
+func TestIncrementalSave(t *testing.T) {
+	ctx := context.Background()
+	config := Config{Kind: "casbin_test_incremental", Namespace: "unittest", IncrementalSave: true}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	storedKeys := func() map[ruleID]*datastore.Key {
+		keys := make(map[ruleID]*datastore.Key)
+		_, err := a.paginateRules(ctx, false, "", func(page []*datastore.Key, rules []CasbinRule) error {
+			for i, rule := range rules {
+				keys[ruleFields(rule)] = page[i]
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+		return keys
+	}
+	before := storedKeys()
+
+	// A duplicate copy of a rule is dropped as well.
+	bob := savePolicyLine("p", []string{"bob", "data2", "write"})
+	if _, err := a.db.Put(ctx, a.newRuleKey(&bob), &bob); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	e.GetModel().RemovePolicy("p", "p", []string{"alice", "data1", "read"})
+	e.GetModel().AddPolicy("p", "p", []string{"carol", "data3", "read"})
+	if err := e.SavePolicy(); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	after := storedKeys()
+	if len(after) != 5 {
+		t.Errorf("got %d rules, wants 5", len(after))
+	}
+	for id, key := range before {
+		if id == ruleFields(savePolicyLine("p", []string{"alice", "data1", "read"})) {
+			continue
+		}
+		if !after[id].Equal(key) {
+			t.Errorf("got %v for %v, wants the rule kept as %v", after[id], id, key)
+		}
+	}
+	n := 0
+	_, err := a.paginateRules(ctx, true, "", func(page []*datastore.Key, _ []CasbinRule) error {
+		n += len(page)
+		return nil
+	})
+	if err != nil || n != 5 {
+		t.Errorf("got %d, %v, wants 5 entities", n, err)
+	}
+
+	e, _ = casbin.NewEnforcer("examples/rbac_model.conf", a)
+	testGetPolicy(e, [][]string{{"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"carol", "data3", "read"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+}
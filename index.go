@@ -0,0 +1,189 @@
+package datastoreadapter
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/casbin/casbin/v2/model"
+)
+
+// maxRuleFields is the number of rule values a CasbinRule holds.
+const maxRuleFields = 6
+
+// MaxCompositeIndexes is the default quota of composite indexes of a
+// Datastore project. WriteIndexYAML and WriteIndexTerraform warn when they are
+// given more indexes than that.
+const MaxCompositeIndexes = 200
+
+// Index is a composite index the queries of the adapter need.
+type Index struct {
+	Kind     string
+	Ancestor bool
+	// Properties are the indexed properties, in ascending order.
+	Properties []string
+}
+
+// RequiredIndexes returns the composite indexes the queries of an adapter
+// with config need for the policies of m:
+//
+//   - the scans of the rules, e.g. by LoadPolicy;
+//   - RemoveFilteredPolicy and LoadFilteredPolicy filtering any run of
+//     consecutive fields of the ptypes defined in m, as casbin does;
+//   - Config.Deduplicate and CleanupPolicies;
+//   - PurgeExpiredPolicies, including the records of the idempotency keys,
+//     and PurgeDeletedPolicies with Config.SoftDelete;
+//   - the filters of Filter.IgnoreCase with Config.CaseFolding, on the
+//     folded values, repeated once per filtered field.
+//
+// The indexes are returned for Kind and each of the kinds of Config.Kinds,
+// and of Config.Shards, with the property names of Config.EntityMapper.
+// Datastore builds the single-property indexes the other queries need by
+// default.
+//
+// Filters with empty values between the filtered fields need an index of
+// their own, which is left out since every combination would exceed
+// MaxCompositeIndexes; create the ones in use, or set Config.IndexFallback.
+func RequiredIndexes(m model.Model, config Config) []Index {
+	kind := config.Kind
+	if kind == "" {
+		kind = casbinKind
+	}
+	a := &Adapter{kind: kind, kinds: config.Kinds, shards: config.Shards, mapper: config.EntityMapper}
+	a.caseFolding = foldsCase(config, newCodecs(a, config))
+
+	arity := 0
+	for _, sec := range []string{"p", "g"} {
+		for _, ast := range m[sec] {
+			if len(ast.Tokens) > arity {
+				arity = len(ast.Tokens)
+			}
+		}
+	}
+	if arity > maxRuleFields {
+		arity = maxRuleFields
+	}
+
+	var indexes []Index
+	for _, kind := range a.ruleKinds() {
+		indexes = append(indexes, a.kindIndexes(kind, arity, config.SoftDelete)...)
+	}
+	return append(indexes, Index{Kind: a.idempotencyKind(), Ancestor: true, Properties: []string{"expires_at"}})
+}
+
+// kindIndexes returns the composite indexes of RequiredIndexes for the rules
+// stored in kind, whose ptypes have up to arity values.
+func (a *Adapter) kindIndexes(kind string, arity int, softDelete bool) []Index {
+	var indexes []Index
+	seen := make(map[string]bool)
+	add := func(properties ...string) {
+		id := fmt.Sprint(properties)
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+		for i := range properties {
+			properties[i] = a.property(properties[i])
+		}
+		indexes = append(indexes, Index{Kind: kind, Ancestor: true, Properties: properties})
+	}
+
+	// The rule queries filter p_type with an inequality on top of the
+	// equality filters, so every one of them needs an index led by p_type.
+	add("p_type")
+	for n := 1; n <= arity; n++ {
+		for start := 0; start+n <= arity; start++ {
+			properties := []string{"p_type"}
+			for i := start; i < start+n; i++ {
+				properties = append(properties, fmt.Sprintf("v%d", i))
+			}
+			add(properties...)
+		}
+	}
+	add("p_type", "v0", "v1", "v2", "v3", "v4")
+	add("p_type", "v0", "v1", "v2", "v3", "v4", "v5")
+	if a.caseFolding {
+		// The folded values are a single multi-valued property, filtered
+		// once per field whichever fields they are.
+		properties := []string{"p_type"}
+		for n := 1; n <= arity; n++ {
+			properties = append(properties, "folded")
+			add(append([]string(nil), properties...)...)
+		}
+	}
+	add("expires_at")
+	if softDelete {
+		add("deleted_at")
+	}
+	return indexes
+}
+
+// WriteIndexYAML writes indexes as the entries of an index.yaml file, to be
+// deployed with "gcloud datastore indexes create".
+// A comment warns when there are more than MaxCompositeIndexes of them.
+func WriteIndexYAML(w io.Writer, indexes []Index) error {
+	if err := writeQuotaWarning(w, indexes); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(w, "indexes:"); err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		ancestor := "no"
+		if index.Ancestor {
+			ancestor = "yes"
+		}
+		if _, err := fmt.Fprintf(w, "\n- kind: %s\n  ancestor: %s\n  properties:\n", index.Kind, ancestor); err != nil {
+			return err
+		}
+		for _, property := range index.Properties {
+			if _, err := fmt.Fprintf(w, "  - name: %s\n", property); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteIndexTerraform writes indexes as google_datastore_index resources
+// named with prefix and their positions. A comment warns when there are more
+// than MaxCompositeIndexes of them.
+func WriteIndexTerraform(w io.Writer, prefix string, indexes []Index) error {
+	if err := writeQuotaWarning(w, indexes); err != nil {
+		return err
+	}
+	for i, index := range indexes {
+		ancestor := "NONE"
+		if index.Ancestor {
+			ancestor = "ALL_ANCESTORS"
+		}
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		_, err := fmt.Fprintf(w, "resource \"google_datastore_index\" \"%s_%d\" {\n  kind     = %q\n  ancestor = %q\n", prefix, i, index.Kind, ancestor)
+		if err != nil {
+			return err
+		}
+		for _, property := range index.Properties {
+			_, err := fmt.Fprintf(w, "\n  properties {\n    name      = %q\n    direction = \"ASCENDING\"\n  }\n", property)
+			if err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintln(w, "}"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeQuotaWarning writes a comment warning that indexes exceed
+// MaxCompositeIndexes, if they do.
+func writeQuotaWarning(w io.Writer, indexes []Index) error {
+	if len(indexes) <= MaxCompositeIndexes {
+		return nil
+	}
+	_, err := fmt.Fprintf(w, "# WARNING: %d composite indexes exceed the default quota of %d per project.\n# Reduce Config.Kinds or Config.Shards, unset Config.CaseFolding, or request a higher quota.\n\n", len(indexes), MaxCompositeIndexes)
+	return err
+}
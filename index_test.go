@@ -0,0 +1,108 @@
+package datastoreadapter
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/casbin/casbin/v2/model"
+)
+
+func TestRequiredIndexes(t *testing.T) {
+	m, err := model.NewModelFromFile("examples/rbac_model.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indexes := RequiredIndexes(m, Config{Kind: "casbin_test", SoftDelete: true})
+	if len(indexes) != 12 {
+		t.Errorf("got %d indexes, wants 12", len(indexes))
+	}
+	wants := []Index{
+		{Kind: "casbin_test", Ancestor: true, Properties: []string{"p_type"}},
+		{Kind: "casbin_test", Ancestor: true, Properties: []string{"p_type", "v0"}},
+		{Kind: "casbin_test", Ancestor: true, Properties: []string{"p_type", "v1"}},
+		{Kind: "casbin_test", Ancestor: true, Properties: []string{"p_type", "v2"}},
+		{Kind: "casbin_test", Ancestor: true, Properties: []string{"p_type", "v0", "v1"}},
+		{Kind: "casbin_test", Ancestor: true, Properties: []string{"p_type", "v1", "v2"}},
+		{Kind: "casbin_test", Ancestor: true, Properties: []string{"p_type", "v0", "v1", "v2"}},
+	}
+	if !reflect.DeepEqual(indexes[:7], wants) {
+		t.Errorf("got %v, wants %v", indexes[:7], wants)
+	}
+	last := indexes[len(indexes)-2]
+	if !reflect.DeepEqual(last.Properties, []string{"deleted_at"}) {
+		t.Errorf("got %v, wants deleted_at last of the rule indexes", last.Properties)
+	}
+	last = indexes[len(indexes)-1]
+	if wants := (Index{Kind: "casbin_test_idempotency", Ancestor: true, Properties: []string{"expires_at"}}); !reflect.DeepEqual(last, wants) {
+		t.Errorf("got %v, wants %v last", last, wants)
+	}
+
+	var yaml bytes.Buffer
+	if err := WriteIndexYAML(&yaml, indexes[1:2]); err != nil {
+		t.Fatal(err)
+	}
+	wantsYAML := "indexes:\n\n- kind: casbin_test\n  ancestor: yes\n  properties:\n  - name: p_type\n  - name: v0\n"
+	if yaml.String() != wantsYAML {
+		t.Errorf("got %q, wants %q", yaml.String(), wantsYAML)
+	}
+
+	var tf bytes.Buffer
+	if err := WriteIndexTerraform(&tf, "casbin", indexes); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(tf.String(), "resource \"google_datastore_index\""); n != len(indexes) {
+		t.Errorf("got %d resources, wants %d", n, len(indexes))
+	}
+	if !strings.Contains(tf.String(), `ancestor = "ALL_ANCESTORS"`) {
+		t.Errorf("got %s, wants ancestor indexes", tf.String())
+	}
+	if strings.Contains(yaml.String()+tf.String(), "WARNING") {
+		t.Errorf("got a warning, wants none within the quota")
+	}
+
+	// Case folding adds the indexes of the folded values, unless codecs
+	// disable it.
+	folded := RequiredIndexes(m, Config{Kind: "casbin_test", CaseFolding: true})
+	if n := len(folded) - len(RequiredIndexes(m, Config{Kind: "casbin_test"})); n != 3 {
+		t.Errorf("got %d folded indexes, wants 3", n)
+	}
+	wantsFolded := Index{Kind: "casbin_test", Ancestor: true, Properties: []string{"p_type", "folded", "folded"}}
+	found := false
+	for _, index := range folded {
+		found = found || reflect.DeepEqual(index, wantsFolded)
+	}
+	if !found {
+		t.Errorf("got %v, wants %v among them", folded, wantsFolded)
+	}
+	transformed := RequiredIndexes(m, Config{Kind: "casbin_test", CaseFolding: true, ValueTransformer: HMACTransformer([]byte("secret"), nil)})
+	if len(transformed) != len(folded)-3 {
+		t.Errorf("got %d indexes, wants none of the folded values along with a codec", len(transformed))
+	}
+
+	// Sharding multiplies the indexes past the quota.
+	indexes = RequiredIndexes(m, Config{Kind: "casbin_test", Shards: 32})
+	yaml.Reset()
+	if err := WriteIndexYAML(&yaml, indexes); err != nil {
+		t.Fatal(err)
+	}
+	if len(indexes) <= MaxCompositeIndexes || !strings.HasPrefix(yaml.String(), "# WARNING") {
+		t.Errorf("got %d indexes and %q, wants a warning", len(indexes), yaml.String()[:40])
+	}
+
+	// The indexes of the folded values count towards the quota.
+	indexes = RequiredIndexes(m, Config{Kind: "casbin_test", Shards: 16})
+	if len(indexes) > MaxCompositeIndexes {
+		t.Errorf("got %d indexes, wants them within the quota", len(indexes))
+	}
+	indexes = RequiredIndexes(m, Config{Kind: "casbin_test", Shards: 16, CaseFolding: true})
+	yaml.Reset()
+	if err := WriteIndexYAML(&yaml, indexes); err != nil {
+		t.Fatal(err)
+	}
+	if len(indexes) <= MaxCompositeIndexes || !strings.HasPrefix(yaml.String(), "# WARNING") {
+		t.Errorf("got %d indexes and %q, wants a warning", len(indexes), yaml.String()[:40])
+	}
+}
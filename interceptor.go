@@ -0,0 +1,51 @@
+package datastoreadapter
+
+import "context"
+
+// Interceptor wraps an adapter operation. It is called with the name of the
+// operation, e.g. "SavePolicy", and must call next to run it, unless it
+// rejects the operation by returning an error instead. Interceptors can
+// audit, rate limit or feature flag operations:
+//
+//	func readOnlyOutsideBusinessHours(ctx context.Context, op string, next func(context.Context) error) error {
+//		if op == "SavePolicy" && !businessHours(time.Now()) {
+//			return errors.New("policy changes are frozen")
+//		}
+//		return next(ctx)
+//	}
+type Interceptor func(ctx context.Context, op string, next func(ctx context.Context) error) error
+
+// do runs fn as the operation named op: it is tracked by begin and wrapped by
+// the configured interceptors, the first of which is the outermost. It fails
+// with ErrCircuitOpen, without running fn, while the circuit breaker is open.
+func (a *Adapter) do(ctx context.Context, op string, fn func(ctx context.Context) error) (err error) {
+	if _, ok := ctx.Deadline(); !ok && a.defaultTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.defaultTimeout)
+		defer cancel()
+	}
+	// Operations run by other ones are accounted for by the outer one.
+	nested := operationFromContext(ctx) != nil
+	ctx, o := a.begin(ctx, op)
+	defer func() { o.end(err) }()
+	if !nested {
+		done, rejected := a.breaker.allow()
+		if rejected != nil {
+			return wrapError(op, rejected)
+		}
+		defer func() { done(err) }()
+	}
+
+	next := fn
+	for i := len(a.interceptors) - 1; i >= 0; i-- {
+		interceptor, inner := a.interceptors[i], next
+		next = func(ctx context.Context) error {
+			return interceptor(ctx, op, inner)
+		}
+	}
+	if err = wrapError(op, next(ctx)); err == nil {
+		o.notify()
+		o.alert()
+	}
+	return err
+}
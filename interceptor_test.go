@@ -0,0 +1,56 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+)
+
+func TestInterceptors(t *testing.T) {
+	config := Config{Kind: "casbin_test", Namespace: "unittest"}
+	initPolicy(t, config)
+
+	var calls []string
+	record := func(name string) Interceptor {
+		return func(ctx context.Context, op string, next func(context.Context) error) error {
+			calls = append(calls, name+":"+op)
+			return next(ctx)
+		}
+	}
+	errFrozen := errors.New("frozen")
+	freeze := func(ctx context.Context, op string, next func(context.Context) error) error {
+		if op == "AddPolicy" {
+			return errFrozen
+		}
+		return next(ctx)
+	}
+
+	config.Interceptors = []Interceptor{record("outer"), record("inner"), freeze}
+	a := NewAdapterWithConfig(getDatastore(), config)
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	if n := len(e.GetPolicy()); n != 4 {
+		t.Errorf("got %d rules, wants 4", n)
+	}
+
+	// A rejected operation is not run.
+	err := a.AddPolicy("p", "p", []string{"carol", "data3", "read"})
+	if !errors.Is(err, errFrozen) {
+		t.Errorf("got %v, wants errFrozen", err)
+	}
+	var opErr *OpError
+	if !errors.As(err, &opErr) || opErr.Op != "AddPolicy" {
+		t.Errorf("got %v, wants an OpError for AddPolicy", err)
+	}
+	e.LoadPolicy()
+	if n := len(e.GetPolicy()); n != 4 {
+		t.Errorf("got %d rules, wants 4", n)
+	}
+
+	wants := []string{"outer:LoadPolicy", "inner:LoadPolicy", "outer:AddPolicy", "inner:AddPolicy", "outer:LoadPolicy", "inner:LoadPolicy"}
+	if !reflect.DeepEqual(calls, wants) {
+		t.Errorf("got calls %v, wants %v", calls, wants)
+	}
+}
@@ -0,0 +1,138 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+)
+
+// ruleKind returns the kind the rules of ptype are stored in, or the first of
+// its shards; see Config.Kinds and Config.Shards.
+func (a *Adapter) ruleKind(ptype string) string {
+	if kind, ok := a.kinds[ptype]; ok {
+		return kind
+	}
+	if ptype != "" {
+		if kind, ok := a.kinds[ptype[:1]]; ok {
+			return kind
+		}
+	}
+	return a.kind
+}
+
+// ruleKinds returns the kinds rules are stored in, the configured kind first,
+// followed by their shards.
+func (a *Adapter) ruleKinds() []string {
+	kinds := []string{a.kind}
+	seen := map[string]bool{a.kind: true}
+	for _, kind := range a.kinds {
+		if !seen[kind] {
+			seen[kind] = true
+			kinds = append(kinds, kind)
+		}
+	}
+	sort.Strings(kinds[1:])
+
+	var shards []string
+	for _, kind := range kinds {
+		shards = append(shards, a.shardKinds(kind)...)
+	}
+	return shards
+}
+
+// shardKinds returns the kinds the rules of kind are spread over by
+// Config.Shards, kind itself first.
+func (a *Adapter) shardKinds(kind string) []string {
+	kinds := []string{kind}
+	for i := 1; i < a.shards; i++ {
+		kinds = append(kinds, kind+shardKindSuffix+strconv.Itoa(i))
+	}
+	return kinds
+}
+
+// ptypeKinds returns the kinds the rules of ptype are stored in.
+func (a *Adapter) ptypeKinds(ptype string) []string {
+	return a.shardKinds(a.ruleKind(ptype))
+}
+
+// ruleShard returns the kind line, which is encoded, is stored in: the shard
+// of its kind selected by the hash of its values.
+func (a *Adapter) ruleShard(line CasbinRule) string {
+	kind := a.ruleKind(line.PType)
+	if a.shards <= 1 {
+		return kind
+	}
+	h := fnv.New32a()
+	for _, v := range ruleFields(line) {
+		h.Write([]byte(v))
+		h.Write([]byte{0})
+	}
+	return a.shardKinds(kind)[h.Sum32()%uint32(a.shards)]
+}
+
+// shardKindSuffix is appended to a kind, along with the position of the shard,
+// to name the shards of Config.Shards but the first one.
+const shardKindSuffix = "_shard"
+
+// rootKeyOf returns the key of the pseudo root entity the rules stored in
+// kind descend from.
+func (a *Adapter) rootKeyOf(kind string) *datastore.Key {
+	return a.slotRootKey(kind, a.activeSlot())
+}
+
+// kindQuery returns a query for the rules stored in kind.
+func (a *Adapter) kindQuery(kind string) *datastore.Query {
+	return a.slotQuery(kind, a.activeSlot())
+}
+
+// slotQuery returns a query for the rules stored in kind in slot.
+func (a *Adapter) slotQuery(kind string, slot int64) *datastore.Query {
+	return datastore.NewQuery(kind).Namespace(a.namespace).Filter(a.property("p_type")+" >", "").Ancestor(a.slotRootKey(kind, slot))
+}
+
+// paginateRules runs paginate for the rules of every kind in turn. Its
+// tokens are prefixed with the position of the kind they belong to, unless
+// it is the first one, so that they stay valid if Config.Kinds is not set.
+func (a *Adapter) paginateRules(ctx context.Context, keysOnly bool, token ResumeToken, fn pageFunc) (ResumeToken, error) {
+	kinds := a.ruleKinds()
+	start, token, err := splitToken(token, len(kinds))
+	if err != nil {
+		return token, err
+	}
+
+	for i := start; i < len(kinds); i++ {
+		next, err := a.paginate(ctx, a.kindQuery(kinds[i]), keysOnly, token, fn)
+		if err != nil {
+			return joinToken(i, next), err
+		}
+		token = ""
+	}
+	return "", nil
+}
+
+// splitToken returns the position of the query of n which token belongs to,
+// and its token for that query.
+func splitToken(token ResumeToken, n int) (int, ResumeToken, error) {
+	i := strings.IndexByte(string(token), ':')
+	if i < 0 {
+		return 0, token, nil
+	}
+	pos, err := strconv.Atoi(string(token[:i]))
+	if err != nil || pos <= 0 || pos >= n {
+		return 0, token, errors.New("invalid resume token")
+	}
+	return pos, token[i+1:], nil
+}
+
+// joinToken returns the token of the position token in the query at pos.
+func joinToken(pos int, token ResumeToken) ResumeToken {
+	if pos == 0 {
+		return token
+	}
+	return ResumeToken(strconv.Itoa(pos)+":") + token
+}
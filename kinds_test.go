@@ -0,0 +1,56 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2/model"
+)
+
+func TestKinds(t *testing.T) {
+	config := Config{Kind: "casbin_test_kinds", Namespace: "unittest", Kinds: map[string]string{"g": "casbin_test_kinds_g"}}
+	initPolicy(t, config)
+	ctx := context.Background()
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	// The g rules are stored in their own kind.
+	query := datastore.NewQuery("casbin_test_kinds_g").Namespace("unittest")
+	var rules []CasbinRule
+	if _, err := getDatastore().GetAll(ctx, query, &rules); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(rules) != 1 || rules[0].PType != "g" {
+		t.Errorf("got %v, wants the g rule", rules)
+	}
+
+	n, err := a.CountPolicies(ctx)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if n != 5 {
+		t.Errorf("got %d rules, wants 5", n)
+	}
+
+	if err := a.RemoveFilteredPolicyCtx(ctx, "g", "g", 0, "alice"); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.RemovePolicyCtx(ctx, "p", "p", []string{"bob", "data2", "write"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	m, err := model.NewModelFromFile("examples/rbac_model.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.LoadPolicyCtx(ctx, m); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	wants := [][]string{{"alice", "data1", "read"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}
+	if actual := m["p"]["p"].Policy; !SamePolicy(actual, wants) {
+		t.Errorf("got %v, wants %v", actual, wants)
+	}
+	if actual := m["g"]["g"].Policy; len(actual) != 0 {
+		t.Errorf("got %v, wants no g rules", actual)
+	}
+}
@@ -0,0 +1,81 @@
+package datastoreadapter
+
+import (
+	"context"
+
+	"cloud.google.com/go/datastore"
+)
+
+// ListPolicies returns a page of at most pageSize live rules, starting at the
+// position marked by pageToken, along with the token of the next page, which
+// is empty once there is no more rule. Unlike LoadPolicy, it reads only as
+// many rules as it returns, give or take the soft deleted and expired ones
+// it skips, so that admin UIs can browse large policies.
+//
+// filter is either nil, to list every rule, or a Filter or a *Filter as with
+// LoadFilteredPolicy. A pageSize of zero, or above Config.PageSize, is
+// Config.PageSize.
+func (a *Adapter) ListPolicies(ctx context.Context, filter interface{}, pageSize int, pageToken ResumeToken) ([]CasbinRule, ResumeToken, error) {
+	var rules []CasbinRule
+	next := pageToken
+	err := a.do(ctx, "ListPolicies", func(ctx context.Context) error {
+		if pageSize <= 0 || pageSize > a.pageSize {
+			pageSize = a.pageSize
+		}
+
+		var queries []*datastore.Query
+		match := func(CasbinRule) bool { return true }
+		if filter == nil {
+			for _, kind := range a.ruleKinds() {
+				queries = append(queries, a.kindQuery(kind))
+			}
+		} else {
+			f, err := toFilter(filter)
+			if err != nil {
+				return wrapError("ListPolicies", err)
+			}
+			plans, err := a.filteredPlans(ctx, f)
+			if err != nil {
+				return wrapError("ListPolicies", err)
+			}
+			for _, plan := range plans {
+				queries = append(queries, plan.query)
+				if plan.partial {
+					match = plan.match
+				}
+			}
+		}
+
+		start, token, err := splitToken(pageToken, len(queries))
+		if err != nil {
+			return wrapError("ListPolicies", err)
+		}
+		now := a.now()
+		for i := start; i < len(queries); i++ {
+			for {
+				limit := pageSize - len(rules)
+				p, err := a.fetchPage(ctx, queries[i], false, limit, token)
+				if err != nil {
+					return wrapError("ListPolicies", err)
+				}
+				for _, line := range p.rules {
+					if !line.deleted() && !line.expired(now) && match(line) {
+						rules = append(rules, line)
+					}
+				}
+				if p.read < limit {
+					break
+				}
+				token = p.next
+				if len(rules) >= pageSize {
+					next = joinToken(i, token)
+					return nil
+				}
+			}
+			token = ""
+		}
+		next = ""
+		return nil
+	})
+	return rules, next, err
+}
@@ -0,0 +1,61 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+)
+
+func TestListPolicies(t *testing.T) {
+	config := Config{Kind: "casbin_test_listing", Namespace: "unittest", Kinds: map[string]string{"g": "casbin_test_listing_g"}}
+	initPolicy(t, config)
+	ctx := context.Background()
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	list := func(filter interface{}, pageSize int) ([][]string, int) {
+		var policy [][]string
+		pages := 0
+		var token ResumeToken
+		for {
+			rules, next, err := a.ListPolicies(ctx, filter, pageSize, token)
+			if err != nil {
+				t.Fatalf("got %v, wants no error", err)
+			}
+			if len(rules) > pageSize {
+				t.Fatalf("got %d rules, wants at most %d", len(rules), pageSize)
+			}
+			pages++
+			for _, line := range rules {
+				policy = append(policy, append([]string{line.PType}, line.Rule()...))
+			}
+			if next == "" {
+				return policy, pages
+			}
+			token = next
+		}
+	}
+
+	policy, pages := list(nil, 2)
+	wants := [][]string{
+		{"p", "alice", "data1", "read"},
+		{"p", "bob", "data2", "write"},
+		{"p", "data2_admin", "data2", "read"},
+		{"p", "data2_admin", "data2", "write"},
+		{"g", "alice", "data2_admin"},
+	}
+	if !SamePolicy(policy, wants) || len(policy) != len(wants) {
+		t.Errorf("got %v, wants %v", policy, wants)
+	}
+	if pages < 3 {
+		t.Errorf("got %d pages, wants at least 3", pages)
+	}
+
+	policy, _ = list(Filter{PType: "p", FieldIndex: 0, FieldValues: []string{"data2_admin"}}, 1)
+	wants = [][]string{{"p", "data2_admin", "data2", "read"}, {"p", "data2_admin", "data2", "write"}}
+	if !SamePolicy(policy, wants) || len(policy) != len(wants) {
+		t.Errorf("got %v, wants %v", policy, wants)
+	}
+
+	if _, _, err := a.ListPolicies(ctx, nil, 2, "9:x"); err == nil {
+		t.Error("got no error, wants an invalid token error")
+	}
+}
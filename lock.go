@@ -0,0 +1,111 @@
+package datastoreadapter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// policyLockName is the key name of the entity holding the policy lock.
+const policyLockName = "policy_lock"
+
+// policyLock is the entity holding the lease of the policy lock.
+// It is a root entity, so acquiring the lock doesn't contend with the writes
+// to the entity group of the rules.
+type policyLock struct {
+	Owner   string    `datastore:"owner,noindex"`
+	Expires time.Time `datastore:"expires,noindex"`
+}
+
+// Lock is an advisory lock on the policy, held as a lease which expires
+// after its TTL unless extended. It only excludes other Lock holders;
+// writers which don't acquire it are not blocked.
+type Lock struct {
+	adapter *Adapter
+	owner   string
+	ttl     time.Duration
+}
+
+func (a *Adapter) policyLockKey() *datastore.Key {
+	key := datastore.NameKey(a.kind, policyLockName, nil)
+	key.Namespace = a.namespace
+	return key
+}
+
+// AcquireLock acquires the policy lock for ttl. It fails with ErrLocked if
+// another holder has an unexpired lease. Long-running jobs such as migrations
+// should call Extend before the lease expires.
+func (a *Adapter) AcquireLock(ctx context.Context, ttl time.Duration) (*Lock, error) {
+	var l *Lock
+	err := a.do(ctx, "AcquireLock", func(ctx context.Context) error {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+
+		l = &Lock{adapter: a, owner: hex.EncodeToString(b), ttl: ttl}
+		return l.lease(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Extend renews the lease for another TTL. It fails with ErrLocked if the
+// lease has expired and another holder has acquired the lock meanwhile.
+func (l *Lock) Extend(ctx context.Context) error {
+	return l.adapter.do(ctx, "ExtendLock", l.lease)
+}
+
+// extend is the same as Extend but is a no-op on a nil lock.
+func (l *Lock) extend(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	return l.Extend(ctx)
+}
+
+// Release releases the lock. It is a no-op if the lock is no longer held.
+func (l *Lock) Release(ctx context.Context) error {
+	a := l.adapter
+	return a.do(ctx, "ReleaseLock", func(ctx context.Context) error {
+		_, err := a.db.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+			var v policyLock
+			err := tx.Get(a.policyLockKey(), &v)
+			if err == datastore.ErrNoSuchEntity || err == nil && v.Owner != l.owner {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			return tx.Delete(a.policyLockKey())
+		})
+		return err
+	})
+}
+
+// lease stores the lease of l unless another holder has an unexpired one.
+func (l *Lock) lease(ctx context.Context) error {
+	a := l.adapter
+	_, err := a.db.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		var v policyLock
+		err := tx.Get(a.policyLockKey(), &v)
+		if err != nil && err != datastore.ErrNoSuchEntity {
+			return err
+		}
+
+		now := a.now()
+		if err == nil && v.Owner != l.owner && now.Before(v.Expires) {
+			return ErrLocked
+		}
+
+		v = policyLock{Owner: l.owner, Expires: now.Add(l.ttl)}
+		_, err = tx.Put(a.policyLockKey(), &v)
+		return err
+	})
+	return err
+}
@@ -0,0 +1,92 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+)
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	config := Config{Kind: "casbin_test_lock", Namespace: "unittest", LockTTL: time.Minute}
+	a := NewAdapterWithConfig(getDatastore(), config)
+	b := NewAdapterWithConfig(getDatastore(), config)
+
+	lock, err := a.AcquireLock(ctx, time.Minute)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if _, err := b.AcquireLock(ctx, time.Minute); !errors.Is(err, ErrLocked) {
+		t.Errorf("got %v, wants ErrLocked", err)
+	}
+	if err := lock.Extend(ctx); err != nil {
+		t.Errorf("got %v, wants no error", err)
+	}
+
+	// SavePolicy fails while another writer holds the lock.
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	if err := b.SavePolicy(e.GetModel()); !errors.Is(err, ErrLocked) {
+		t.Errorf("got %v, wants ErrLocked", err)
+	}
+
+	if err := lock.Release(ctx); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := b.SavePolicy(e.GetModel()); err != nil {
+		t.Errorf("got %v, wants no error", err)
+	}
+
+	// An expired lease can be taken over.
+	lock, err = a.AcquireLock(ctx, -time.Second)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	other, err := b.AcquireLock(ctx, time.Minute)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := lock.Extend(ctx); !errors.Is(err, ErrLocked) {
+		t.Errorf("got %v, wants ErrLocked", err)
+	}
+	// Releasing a lost lock doesn't release the new holder's.
+	if err := lock.Release(ctx); err != nil {
+		t.Errorf("got %v, wants no error", err)
+	}
+	if _, err := a.AcquireLock(ctx, time.Minute); !errors.Is(err, ErrLocked) {
+		t.Errorf("got %v, wants ErrLocked", err)
+	}
+	other.Release(ctx)
+}
+
+func TestSavePolicyInPagesLockLost(t *testing.T) {
+	ctx := context.Background()
+	config := Config{Kind: "casbin_test_lock", Namespace: "unittest"}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+	b := NewAdapterWithConfig(getDatastore(), config)
+
+	// The lease of a expires and b takes the lock over.
+	lock, err := a.AcquireLock(ctx, -time.Second)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	other, err := b.AcquireLock(ctx, time.Minute)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	defer other.Release(ctx)
+
+	line := savePolicyLine("p", []string{"carol", "data3", "read"})
+	if err := a.savePolicyInPages(ctx, []interface{}{&line}, make(ruleMetadata), lock); !errors.Is(err, ErrLocked) {
+		t.Fatalf("got %v, wants ErrLocked", err)
+	}
+
+	// Nothing has been deleted.
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+}
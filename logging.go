@@ -0,0 +1,34 @@
+package datastoreadapter
+
+import "context"
+
+// Logger receives a structured record of every adapter operation, and of the
+// failures the adapter recovers from. It is meant to be implemented on top of
+// a logging library, e.g.
+//
+//	type zapLogger struct{ l *zap.Logger }
+//
+//	func (z zapLogger) LogOperation(ctx context.Context, s datastoreadapter.OperationStats) {
+//		z.l.Info("casbin operation", zap.String("op", s.Op), zap.Duration("duration", s.Duration),
+//			zap.Int("read", s.EntitiesRead), zap.Int("written", s.EntitiesWritten), zap.Error(s.Err))
+//	}
+//
+//	func (z zapLogger) LogWarning(ctx context.Context, op string, err error) {
+//		z.l.Warn("casbin warning", zap.String("op", op), zap.Error(err))
+//	}
+//
+// Its methods are called synchronously and must not block.
+type Logger interface {
+	// LogOperation is called once an operation completes.
+	LogOperation(ctx context.Context, stats OperationStats)
+	// LogWarning is called when op recovers from err, e.g. by falling back
+	// to datastore when the shared cache fails.
+	LogWarning(ctx context.Context, op string, err error)
+}
+
+// warn reports err to the configured Logger, if any.
+func (o *operation) warn(err error) {
+	if o != nil && o.adapter.logger != nil {
+		o.adapter.logger.LogWarning(o.ctx, o.stats.Op, err)
+	}
+}
@@ -0,0 +1,66 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+)
+
+type recordingLogger struct {
+	ops      []OperationStats
+	warnings []error
+}
+
+func (l *recordingLogger) LogOperation(ctx context.Context, stats OperationStats) {
+	l.ops = append(l.ops, stats)
+}
+
+func (l *recordingLogger) LogWarning(ctx context.Context, op string, err error) {
+	l.warnings = append(l.warnings, err)
+}
+
+var errCacheDown = errors.New("cache down")
+
+type brokenCache struct{}
+
+func (brokenCache) Get(ctx context.Context, key string) ([]byte, error) { return nil, errCacheDown }
+func (brokenCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return errCacheDown
+}
+
+func TestLogger(t *testing.T) {
+	config := Config{Kind: "casbin_test", Namespace: "unittest"}
+	initPolicy(t, config)
+
+	logger := &recordingLogger{}
+	config.Logger = logger
+	a := NewAdapterWithConfig(getDatastore(), config)
+	cached := NewCachedAdapterWithConfig(a, CacheConfig{Shared: brokenCache{}})
+
+	// The load falls back to datastore and reports the cache failures.
+	e, err := casbin.NewEnforcer("examples/rbac_model.conf", cached)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if n := len(e.GetPolicy()); n != 4 {
+		t.Errorf("got %d rules, wants 4", n)
+	}
+	if len(logger.warnings) != 2 || !errors.Is(logger.warnings[0], errCacheDown) || !errors.Is(logger.warnings[1], errCacheDown) {
+		t.Errorf("got warnings %v, wants 2 cache failures", logger.warnings)
+	}
+
+	config.ReadOnly = true
+	NewAdapterWithConfig(getDatastore(), config).SavePolicy(e.GetModel())
+	if len(logger.ops) != 2 {
+		t.Fatalf("got %d operations, wants 2", len(logger.ops))
+	}
+	if s := logger.ops[0]; s.Op != "LoadPolicy" || s.EntitiesRead != 5 || s.Err != nil {
+		t.Errorf("got %+v, wants LoadPolicy reading 5 rules", s)
+	}
+	if s := logger.ops[1]; s.Op != "SavePolicy" || !errors.Is(s.Err, ErrReadOnly) {
+		t.Errorf("got %+v, wants SavePolicy failing with ErrReadOnly", s)
+	}
+}
@@ -0,0 +1,131 @@
+package datastoreadapter
+
+import (
+	"cloud.google.com/go/datastore"
+)
+
+// EntityMapper maps the rules to the properties of the entities storing them,
+// so that the adapter can work on the entities of an existing schema without
+// migrating them; see RenamingMapper.
+//
+// Save must store the properties the queries of the adapter filter and order
+// by, indexed, under the names Property returns for them: "p_type", "v0" to
+// "v5", "expires_at", "deleted_at" and, with Config.CaseFolding, "folded".
+// Since it writes the whole entity, the properties Load ignores are dropped
+// when the adapter rewrites a rule, such as when soft deleting it. The
+// entities must still descend from the pseudo root entity of their kind,
+// whose key has the ID 1, or 2 once Config.BlueGreen has switched slots.
+type EntityMapper interface {
+	// Property returns the name of the property storing the CasbinRule field
+	// stored as name by default.
+	Property(name string) string
+	Save(rule *CasbinRule) ([]datastore.Property, error)
+	Load(props []datastore.Property, rule *CasbinRule) error
+}
+
+// RenamingMapper is an EntityMapper storing the rules as CasbinRule does,
+// under the property names it maps the default ones to, e.g.
+// {"p_type": "type", "v0": "subject"}. The properties the rules don't have,
+// such as the other fields of the schema, are ignored when loading them.
+type RenamingMapper map[string]string
+
+func (m RenamingMapper) Property(name string) string {
+	if renamed, ok := m[name]; ok {
+		return renamed
+	}
+	return name
+}
+
+func (m RenamingMapper) Save(rule *CasbinRule) ([]datastore.Property, error) {
+	props, err := datastore.SaveStruct(rule)
+	if err != nil {
+		return nil, err
+	}
+	for i := range props {
+		props[i].Name = m.Property(props[i].Name)
+	}
+	return props, nil
+}
+
+func (m RenamingMapper) Load(props []datastore.Property, rule *CasbinRule) error {
+	names := make(map[string]string, len(m))
+	for name, renamed := range m {
+		names[renamed] = name
+	}
+
+	loaded := make([]datastore.Property, 0, len(props))
+	for _, p := range props {
+		if name, ok := names[p.Name]; ok {
+			p.Name = name
+		} else if _, ok := m[p.Name]; ok {
+			// A default name which is renamed is another field of the schema.
+			continue
+		}
+		loaded = append(loaded, p)
+	}
+	err := datastore.LoadStruct(rule, loaded)
+	if _, ok := err.(*datastore.ErrFieldMismatch); ok {
+		return nil
+	}
+	return err
+}
+
+// ruleEntity loads and saves a rule with an EntityMapper.
+type ruleEntity struct {
+	rule   *CasbinRule
+	mapper EntityMapper
+}
+
+func (e ruleEntity) Load(props []datastore.Property) error {
+	return e.mapper.Load(props, e.rule)
+}
+
+func (e ruleEntity) Save() ([]datastore.Property, error) {
+	return e.mapper.Save(e.rule)
+}
+
+// property returns the name of the property storing the rule field stored as
+// name by default.
+func (a *Adapter) property(name string) string {
+	if a.mapper == nil {
+		return name
+	}
+	return a.mapper.Property(name)
+}
+
+// entity returns the value to load rule from or save it to datastore with.
+func (a *Adapter) entity(rule *CasbinRule) interface{} {
+	a.foldRule(rule)
+	if a.mapper == nil {
+		return rule
+	}
+	return ruleEntity{rule: rule, mapper: a.mapper}
+}
+
+// entities returns the values to save lines, holding *CasbinRule, with.
+func (a *Adapter) entities(lines []interface{}) []interface{} {
+	for _, line := range lines {
+		a.foldRule(line.(*CasbinRule))
+	}
+	if a.mapper == nil {
+		return lines
+	}
+	mapped := make([]interface{}, len(lines))
+	for i, line := range lines {
+		mapped[i] = a.entity(line.(*CasbinRule))
+	}
+	return mapped
+}
+
+// getRules gets the rules of keys with get, e.g. tx.GetMulti.
+func (a *Adapter) getRules(get func([]*datastore.Key, interface{}) error, keys []*datastore.Key) ([]CasbinRule, error) {
+	rules := make([]CasbinRule, len(keys))
+	if a.mapper == nil {
+		return rules, get(keys, rules)
+	}
+	dst := make([]ruleEntity, len(keys))
+	for i := range dst {
+		dst[i] = ruleEntity{rule: &rules[i], mapper: a.mapper}
+	}
+	return rules, get(keys, dst)
+}
@@ -0,0 +1,83 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2/model"
+)
+
+// grant is an entity of an existing schema.
+type grant struct {
+	Type    string `datastore:"type"`
+	Subject string `datastore:"subject"`
+	Object  string `datastore:"object"`
+	Action  string `datastore:"action"`
+	Team    string `datastore:"team"`
+}
+
+func TestEntityMapper(t *testing.T) {
+	mapper := RenamingMapper{"p_type": "type", "v0": "subject", "v1": "object", "v2": "action"}
+	config := Config{Kind: "casbin_test_mapper", Namespace: "unittest", EntityMapper: mapper}
+	ctx := context.Background()
+	db := getDatastore()
+	a := NewAdapterWithConfig(db, config)
+
+	// Start from the entities of the existing schema only.
+	var keys []*datastore.Key
+	_, err := a.paginateRules(ctx, true, "", func(page []*datastore.Key, _ []CasbinRule) error {
+		keys = append(keys, page...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := db.DeleteMulti(ctx, keys); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	key := datastore.IncompleteKey(config.Kind, a.pseudoRootKey())
+	key.Namespace = config.Namespace
+	if _, err := db.Put(ctx, key, &grant{Type: "p", Subject: "alice", Object: "data1", Action: "read", Team: "core"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	if err := a.AddPolicyCtx(ctx, "p", "p", []string{"bob", "data2", "write"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	m, err := model.NewModelFromFile("examples/rbac_model.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.LoadPolicyCtx(ctx, m); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	wants := [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}}
+	if actual := m["p"]["p"].Policy; !SamePolicy(actual, wants) {
+		t.Errorf("got %v, wants %v", actual, wants)
+	}
+
+	// The rules are stored under the property names of the schema.
+	var grants []grant
+	query := datastore.NewQuery(config.Kind).Namespace(config.Namespace).Filter("subject =", "bob")
+	if _, err := db.GetAll(ctx, query, &grants); err != nil {
+		if _, ok := err.(*datastore.ErrFieldMismatch); !ok {
+			t.Fatalf("got %v, wants no error", err)
+		}
+	}
+	if len(grants) != 1 || grants[0].Object != "data2" {
+		t.Errorf("got %v, wants the rule of bob", grants)
+	}
+
+	if err := a.RemoveFilteredPolicyCtx(ctx, "p", "p", 0, "alice"); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	m.ClearPolicy()
+	if err := a.LoadPolicyCtx(ctx, m); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	wants = [][]string{{"bob", "data2", "write"}}
+	if actual := m["p"]["p"].Policy; !SamePolicy(actual, wants) {
+		t.Errorf("got %v, wants %v", actual, wants)
+	}
+}
@@ -0,0 +1,60 @@
+package datastoreadapter
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ruleID identifies a rule by its ptype, its values v0 to v5 and its extra
+// values, quoted and joined.
+type ruleID [8]string
+
+// ruleFields returns the fields which identify the rule line stores, leaving
+// out its metadata.
+func ruleFields(line CasbinRule) ruleID {
+	extra := make([]string, len(line.Extra))
+	for i, v := range line.Extra {
+		extra[i] = strconv.Quote(v)
+	}
+	return ruleID{line.PType, line.V0, line.V1, line.V2, line.V3, line.V4, line.V5, strings.Join(extra, ",")}
+}
+
+// stampRule sets the metadata of line, which is stored for the first time
+// at now.
+func stampRule(ctx context.Context, line *CasbinRule, now time.Time) {
+	line.CreatedAt = now
+	line.UpdatedAt = now
+	line.CreatedBy = ActorFromContext(ctx)
+}
+
+// ruleMetadata holds the metadata of the stored rules, so that SavePolicy can
+// preserve it when it rewrites them.
+type ruleMetadata map[ruleID]CasbinRule
+
+// collect records the metadata of rules. The first live copy of a rule wins.
+func (m ruleMetadata) collect(rules []CasbinRule) {
+	for _, rule := range rules {
+		if _, ok := m[ruleFields(rule)]; !ok && !rule.deleted() {
+			m[ruleFields(rule)] = rule
+		}
+	}
+}
+
+// stamp sets the metadata of lines, which are *CasbinRule written at now,
+// to the one recorded for the same rule, if any.
+func (m ruleMetadata) stamp(ctx context.Context, lines []interface{}, now time.Time) {
+	for _, l := range lines {
+		line := l.(*CasbinRule)
+		stored, ok := m[ruleFields(*line)]
+		if !ok {
+			stampRule(ctx, line, now)
+			continue
+		}
+		line.CreatedAt = stored.CreatedAt
+		line.UpdatedAt = stored.UpdatedAt
+		line.CreatedBy = stored.CreatedBy
+		line.ExpiresAt = stored.ExpiresAt
+	}
+}
@@ -0,0 +1,58 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2"
+)
+
+func TestRuleMetadata(t *testing.T) {
+	ctx := context.Background()
+	config := Config{Kind: "casbin_test_metadata", Namespace: "unittest"}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	if err := a.AddPolicyCtx(WithActor(ctx, "bob"), "p", "p", []string{"bob", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	before := storedRules(t, a)
+	added := before[ruleFields(savePolicyLine("p", []string{"bob", "data3", "read"}))]
+	if added.CreatedBy != "bob" || added.CreatedAt.IsZero() || !added.UpdatedAt.Equal(added.CreatedAt) {
+		t.Fatalf("got %+v, wants the metadata of the new rule", added)
+	}
+
+	// SavePolicy preserves the metadata of the rules which were already stored.
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	if err := a.LoadPolicy(e.GetModel()); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	e.GetModel().AddPolicy("p", "p", []string{"carol", "data3", "write"})
+	if err := a.SavePolicyCtx(WithActor(ctx, "carol"), e.GetModel()); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	after := storedRules(t, a)
+	for fields, rule := range before {
+		if got := after[fields]; !got.CreatedAt.Equal(rule.CreatedAt) || !got.UpdatedAt.Equal(rule.UpdatedAt) || got.CreatedBy != rule.CreatedBy {
+			t.Errorf("got %+v, wants %+v", got, rule)
+		}
+	}
+	if got := after[ruleFields(savePolicyLine("p", []string{"carol", "data3", "write"}))]; got.CreatedBy != "carol" || got.CreatedAt.IsZero() {
+		t.Errorf("got %+v, wants the metadata of the new rule", got)
+	}
+}
+
+// storedRules returns the rules stored by a.
+func storedRules(t *testing.T, a *Adapter) ruleMetadata {
+	rules := make(ruleMetadata)
+	_, err := a.paginateRules(context.Background(), false, "", func(_ []*datastore.Key, page []CasbinRule) error {
+		rules.collect(page)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	return rules
+}
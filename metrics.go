@@ -0,0 +1,77 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MetricsCollector receives the statistics of every adapter operation. It is
+// meant to be implemented on top of a metrics library such as Prometheus, e.g.
+//
+//	type promCollector struct {
+//		ops      *prometheus.CounterVec   // labels: op, code
+//		latency  *prometheus.HistogramVec // labels: op
+//		entities *prometheus.CounterVec   // labels: op, direction
+//		retries  *prometheus.CounterVec   // labels: op
+//	}
+//
+//	func (p promCollector) ObserveOperation(s datastoreadapter.OperationStats) {
+//		p.ops.WithLabelValues(s.Op, datastoreadapter.ErrorCode(s.Err).String()).Inc()
+//		p.latency.WithLabelValues(s.Op).Observe(s.Duration.Seconds())
+//		p.entities.WithLabelValues(s.Op, "read").Add(float64(s.EntitiesRead))
+//		p.entities.WithLabelValues(s.Op, "written").Add(float64(s.EntitiesWritten))
+//		p.retries.WithLabelValues(s.Op).Add(float64(s.Retries))
+//	}
+//
+// ObserveOperation is called synchronously and must not block.
+type MetricsCollector interface {
+	ObserveOperation(stats OperationStats)
+}
+
+// OperationStats describes a completed adapter operation.
+type OperationStats struct {
+	// Op is the name of the operation, e.g. "SavePolicy".
+	Op string
+	// Duration is the time the operation took.
+	Duration time.Duration
+	// EntitiesRead is the number of rules read.
+	EntitiesRead int
+	// EntitiesWritten is the number of rules written or deleted.
+	EntitiesWritten int
+	// Retries is the number of transactions retried due to contention.
+	Retries int
+	// RequestID is the request ID set with WithRequestID or derived by
+	// Config.ContextExtractor, if any.
+	RequestID string
+	// Err is the error the operation failed with, if any.
+	Err error
+}
+
+// ErrorCode classifies err as a gRPC code, which is suitable as a metric
+// label. It returns codes.OK for nil.
+func ErrorCode(err error) codes.Code {
+	var s interface{ GRPCStatus() *status.Status }
+	switch {
+	case err == nil:
+		return codes.OK
+	case errors.As(err, &s):
+		return s.GRPCStatus().Code()
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded
+	case errors.Is(err, ErrPolicyNotFound), errors.Is(err, ErrModelNotFound):
+		return codes.NotFound
+	case errors.Is(err, ErrConflict), errors.Is(err, ErrLocked):
+		return codes.Aborted
+	case errors.Is(err, ErrReadOnly):
+		return codes.FailedPrecondition
+	case errors.Is(err, ErrInvalidFilter), errors.Is(err, ErrTooManyRules), errors.Is(err, ErrTxnTooLarge):
+		return codes.InvalidArgument
+	}
+	return codes.Unknown
+}
@@ -0,0 +1,73 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type statsRecorder []OperationStats
+
+func (r *statsRecorder) ObserveOperation(stats OperationStats) {
+	*r = append(*r, stats)
+}
+
+func TestMetrics(t *testing.T) {
+	config := Config{Kind: "casbin_test", Namespace: "unittest"}
+	initPolicy(t, config)
+
+	var stats statsRecorder
+	config.Metrics = &stats
+	a := NewAdapterWithConfig(getDatastore(), config)
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	if err := e.SavePolicy(); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if _, err := e.RemovePolicy("alice", "data1", "read"); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	config.ReadOnly = true
+	NewAdapterWithConfig(getDatastore(), config).AddPolicy("p", "p", []string{"carol", "data3", "read"})
+
+	wants := []OperationStats{
+		{Op: "LoadPolicy", EntitiesRead: 5},
+		// The keys of the 5 stored rules are read, then they are deleted and
+		// 5 new rules are written.
+		{Op: "SavePolicy", EntitiesRead: 5, EntitiesWritten: 10},
+		{Op: "RemovePolicy", EntitiesRead: 1, EntitiesWritten: 1},
+		{Op: "AddPolicy", Err: ErrReadOnly},
+	}
+	if len(stats) != len(wants) {
+		t.Fatalf("got %d operations, wants %d", len(stats), len(wants))
+	}
+	for i, w := range wants {
+		s := stats[i]
+		if s.Op != w.Op || s.EntitiesRead != w.EntitiesRead || s.EntitiesWritten != w.EntitiesWritten || !errors.Is(s.Err, w.Err) {
+			t.Errorf("got %+v, wants %+v", s, w)
+		}
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		code codes.Code
+	}{
+		{nil, codes.OK},
+		{wrapError("LoadPolicy", status.Error(codes.Unavailable, "unavailable")), codes.Unavailable},
+		{fmt.Errorf("wrapped: %w", status.Error(codes.PermissionDenied, "denied")), codes.PermissionDenied},
+		{wrapError("SavePolicy", ErrConflict), codes.Aborted},
+		{wrapError("SavePolicy", ErrReadOnly), codes.FailedPrecondition},
+		{wrapError("LoadPolicy", context.Canceled), codes.Canceled},
+		{errors.New("unknown"), codes.Unknown},
+	} {
+		if code := ErrorCode(tt.err); code != tt.code {
+			t.Errorf("got %v for %v, wants %v", code, tt.err, tt.code)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package datastoreadapter
+
+import (
+	"context"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+)
+
+// MigrateOptions configures MigrateFrom.
+type MigrateOptions struct {
+	// Model defining the ptypes to load from the source adapter.
+	// Optional. (Default: the model stored with the adapter's config)
+	Model model.Model
+	// Mode selects how the rules already stored are treated.
+	// Optional. (Default: ImportMerge)
+	Mode ImportMode
+	// Progress is called with the number of rules written so far after each
+	// batch.
+	// Optional. (Default: nil)
+	Progress func(written int)
+}
+
+// MigrateFrom loads every rule from src, which may be any Casbin adapter such
+// as the gorm, mongo or file ones, and stores them in batches, as
+// ImportPolicyCSV does.
+func (a *Adapter) MigrateFrom(ctx context.Context, src persist.Adapter, opts MigrateOptions) error {
+	return a.do(ctx, "MigrateFrom", func(ctx context.Context) error {
+		m := opts.Model
+		if m == nil {
+			var err error
+			if m, err = a.loadModel(ctx); err != nil {
+				return err
+			}
+		}
+		if err := src.LoadPolicy(m); err != nil {
+			return err
+		}
+
+		return a.importRules(ctx, opts.Mode, func(add func(CasbinRule) error) error {
+			for _, sec := range []string{"p", "g"} {
+				for ptype, ast := range m[sec] {
+					for _, rule := range ast.Policy {
+						if err := add(savePolicyLine(ptype, rule)); err != nil {
+							return err
+						}
+					}
+				}
+			}
+			return nil
+		}, opts.Progress)
+	})
+}
@@ -0,0 +1,38 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+)
+
+func TestMigrateFrom(t *testing.T) {
+	ctx := context.Background()
+	config := Config{Kind: "casbin_test_migrate", Namespace: "unittest", PageSize: 2}
+	a := NewAdapterWithConfig(getDatastore(), config)
+	if err := a.RemoveFilteredPolicy("p", "p", 0); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.RemoveFilteredPolicy("g", "g", 0); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	// Migrate from the file adapter the enforcer was created with.
+	src, _ := casbin.NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	m, _ := model.NewModelFromFile("examples/rbac_model.conf")
+	var progress []int
+	err := a.MigrateFrom(ctx, src.GetAdapter(), MigrateOptions{Model: m, Progress: func(n int) { progress = append(progress, n) }})
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(progress) == 0 || progress[len(progress)-1] != 5 {
+		t.Errorf("got progress %v, wants 5 rules written", progress)
+	}
+
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+}
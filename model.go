@@ -2,6 +2,7 @@ package datastoreadapter
 
 import (
 	"context"
+	"io"
 	"io/ioutil"
 
 	"cloud.google.com/go/datastore"
@@ -10,6 +11,9 @@ import (
 
 type CasbinModelConf struct {
 	Text string `datastore:"text,noindex"`
+	// Version is the version of the latest ModelRevision, or zero if the
+	// model was stored before revisions were recorded.
+	Version int64 `datastore:"version,noindex"`
 }
 
 // SaveModel loads a casbin model definition from the specified file and store it to a datastore entity.
@@ -19,33 +23,52 @@ func SaveModel(db *datastore.Client, path string) error {
 
 // SaveModel loads a casbin model definition from the specified file and store it to a datastore entity.
 func SaveModelWithConfig(db *datastore.Client, path string, config Config) error {
-	b, err := ioutil.ReadFile(path)
-	if err != nil {
-		return err
-	}
-	text := string(b)
+	return SaveModelCtx(context.Background(), db, path, config)
+}
 
-	// Validate the specified config.
-	if _, err = model.NewModelFromString(text); err != nil {
-		return err
-	}
+// SaveModelCtx is the same as SaveModelWithConfig but honors ctx.
+func SaveModelCtx(ctx context.Context, db *datastore.Client, path string, config Config) error {
+	a := newAdapter(db, config)
+	return a.do(ctx, "SaveModel", func(ctx context.Context) error {
+		if config.ReadOnly {
+			return ErrReadOnly
+		}
 
-	kind := casbinKind
-	if config.Kind != "" {
-		kind = config.Kind
-	}
-	namespace := config.Namespace
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return a.saveModel(ctx, string(b), nil)
+	})
+}
 
-	ctx := context.Background()
-	_, err = db.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
-		key := datastore.NameKey(kind, "conf", nil)
-		key.Namespace = namespace
+// SaveModelFromString validates a casbin model definition and stores it to a
+// datastore entity.
+func SaveModelFromString(ctx context.Context, db *datastore.Client, text string, config Config) error {
+	a := newAdapter(db, config)
+	return a.do(ctx, "SaveModel", func(ctx context.Context) error {
+		if config.ReadOnly {
+			return ErrReadOnly
+		}
+		return a.saveModel(ctx, text, nil)
+	})
+}
 
-		m := CasbinModelConf{text}
-		_, err := tx.Put(key, &m)
-		return err
+// SaveModelFromReader reads a casbin model definition from r, validates it and
+// stores it to a datastore entity.
+func SaveModelFromReader(ctx context.Context, db *datastore.Client, r io.Reader, config Config) error {
+	a := newAdapter(db, config)
+	return a.do(ctx, "SaveModel", func(ctx context.Context) error {
+		if config.ReadOnly {
+			return ErrReadOnly
+		}
+
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return a.saveModel(ctx, string(b), nil)
 	})
-	return err
 }
 
 // LoadModel loads a casbin model definition from a datastore entity.
@@ -55,20 +78,68 @@ func LoadModel(db *datastore.Client) (model.Model, error) {
 
 // LoadModel loads a casbin model definition from a datastore entity.
 func LoadModelWithConfig(db *datastore.Client, config Config) (model.Model, error) {
-	kind := casbinKind
-	if config.Kind != "" {
-		kind = config.Kind
+	return LoadModelCtx(context.Background(), db, config)
+}
+
+// LoadModelCtx is the same as LoadModelWithConfig but honors ctx.
+func LoadModelCtx(ctx context.Context, db *datastore.Client, config Config) (model.Model, error) {
+	a := newAdapter(db, config)
+	var m model.Model
+	err := a.do(ctx, "LoadModel", func(ctx context.Context) error {
+		var err error
+		m, err = a.loadModel(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	namespace := config.Namespace
+	return m, nil
+}
 
-	key := datastore.NameKey(kind, "conf", nil)
-	key.Namespace = namespace
+// LoadModelText returns the text of the model definition stored with config,
+// e.g. to edit it.
+func LoadModelText(ctx context.Context, db *datastore.Client, config Config) (string, error) {
+	a := newAdapter(db, config)
+	var text string
+	err := a.do(ctx, "LoadModel", func(ctx context.Context) error {
+		var err error
+		text, err = a.loadModelText(ctx)
+		return err
+	})
+	return text, err
+}
 
-	ctx := context.Background()
-	var conf CasbinModelConf
-	if err := db.Get(ctx, key, &conf); err != nil {
+// loadModel loads the model definition stored for the adapter.
+func (a *Adapter) loadModel(ctx context.Context) (model.Model, error) {
+	text, err := a.loadModelText(ctx)
+	if err != nil {
 		return nil, err
 	}
+	return model.NewModelFromString(text)
+}
+
+func (a *Adapter) loadModelText(ctx context.Context) (string, error) {
+	var conf CasbinModelConf
+	if err := a.db.Get(ctx, a.modelKey(), &conf); err != nil {
+		if err == datastore.ErrNoSuchEntity {
+			return "", &OpError{Op: "LoadModel", Err: err, kind: ErrModelNotFound}
+		}
+		return "", err
+	}
+	return conf.Text, nil
+}
 
-	return model.NewModelFromString(conf.Text)
+// modelConfName is the key name of the entity holding the unnamed model
+// definition. Named ones are suffixed with "/" and their names.
+const modelConfName = "conf"
+
+// modelKey returns the key of the entity holding the model definition.
+func (a *Adapter) modelKey() *datastore.Key {
+	name := modelConfName
+	if a.modelName != "" {
+		name += "/" + a.modelName
+	}
+	key := datastore.NameKey(a.kind, name, nil)
+	key.Namespace = a.namespace
+	return key
 }
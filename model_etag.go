@@ -0,0 +1,51 @@
+package datastoreadapter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"cloud.google.com/go/datastore"
+)
+
+// storedModelETag returns the ETag of conf, which was read with err, or an
+// empty string if no model is stored.
+func storedModelETag(conf CasbinModelConf, err error) string {
+	if err == datastore.ErrNoSuchEntity {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(conf.Text))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetModelETag returns the ETag of the model stored with config, a hash of its
+// text, or an empty string if no model is stored. Pass it to SaveModelIfMatch
+// to make sure the model hasn't been modified meanwhile.
+func GetModelETag(ctx context.Context, db *datastore.Client, config Config) (string, error) {
+	a := newAdapter(db, config)
+	var etag string
+	err := a.do(ctx, "GetModelETag", func(ctx context.Context) error {
+		var conf CasbinModelConf
+		err := a.db.Get(ctx, a.modelKey(), &conf)
+		if err != nil && err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		etag = storedModelETag(conf, err)
+		return nil
+	})
+	return etag, err
+}
+
+// SaveModelIfMatch is the same as SaveModelFromString but fails with
+// ErrConflict unless the ETag of the stored model is etag, that is, unless the
+// model is the one the caller has read. An empty etag expects no model to be
+// stored.
+func SaveModelIfMatch(ctx context.Context, db *datastore.Client, text string, etag string, config Config) error {
+	a := newAdapter(db, config)
+	return a.do(ctx, "SaveModel", func(ctx context.Context) error {
+		if config.ReadOnly {
+			return ErrReadOnly
+		}
+		return a.saveModel(ctx, text, &etag)
+	})
+}
@@ -0,0 +1,39 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSaveModelIfMatch(t *testing.T) {
+	ctx := context.Background()
+	db := getDatastore()
+	config := Config{Namespace: "unittest", ModelName: "etag"}
+	a := newAdapter(db, config)
+	db.Delete(ctx, a.modelKey())
+
+	etag, err := GetModelETag(ctx, db, config)
+	if err != nil || etag != "" {
+		t.Fatalf("got %q and %v, wants an empty ETag", etag, err)
+	}
+	if err := SaveModelIfMatch(ctx, db, mustReadFile(t, "examples/rbac_model.conf"), etag, config); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	// Another admin's edit based on the same ETag conflicts.
+	if err := SaveModelIfMatch(ctx, db, mustReadFile(t, "examples/rbac_tenant_service.conf"), etag, config); !errors.Is(err, ErrConflict) {
+		t.Errorf("got %v, wants ErrConflict", err)
+	}
+
+	etag, err = GetModelETag(ctx, db, config)
+	if err != nil || etag == "" {
+		t.Fatalf("got %q and %v, wants an ETag", etag, err)
+	}
+	if err := SaveModelIfMatch(ctx, db, mustReadFile(t, "examples/rbac_tenant_service.conf"), etag, config); err != nil {
+		t.Errorf("got %v, wants no error", err)
+	}
+	if next, _ := GetModelETag(ctx, db, config); next == etag {
+		t.Error("got the same ETag, wants another one")
+	}
+}
@@ -0,0 +1,147 @@
+package datastoreadapter
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2/model"
+)
+
+// modelRevisionKindSuffix is appended to the configured kind to name the kind
+// of the model revisions.
+const modelRevisionKindSuffix = "_model"
+
+// ModelRevision is a model definition stored by SaveModel. Revisions are
+// child entities of the model entity and are never modified, so that a bad
+// model push can be reverted with RollbackModel.
+type ModelRevision struct {
+	Version int64  `datastore:"version" json:"version"`
+	Text    string `datastore:"text,noindex" json:"text"`
+	// Author is the actor, set with WithActor, which stored the revision.
+	Author    string    `datastore:"author" json:"author,omitempty"`
+	Timestamp time.Time `datastore:"timestamp" json:"timestamp"`
+}
+
+func (a *Adapter) modelRevisionKey(version int64) *datastore.Key {
+	key := datastore.IDKey(a.kind+modelRevisionKindSuffix, version, a.modelKey())
+	key.Namespace = a.namespace
+	return key
+}
+
+// saveModel validates text and stores it as a new revision of the model.
+// If etag is not nil, it fails with ErrConflict unless the ETag of the stored
+// model is *etag.
+func (a *Adapter) saveModel(ctx context.Context, text string, etag *string) error {
+	// Validate the specified config.
+	if _, err := model.NewModelFromString(text); err != nil {
+		return err
+	}
+
+	_, err := a.db.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		var conf CasbinModelConf
+		err := tx.Get(a.modelKey(), &conf)
+		if err != nil && err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		if etag != nil && *etag != storedModelETag(conf, err) {
+			return ErrConflict
+		}
+
+		// Keep the model stored before revisions were recorded as the first
+		// one, so that it can be rolled back to.
+		if err == nil && conf.Version == 0 {
+			conf.Version = 1
+			first := ModelRevision{Version: conf.Version, Text: conf.Text}
+			if _, err := tx.Put(a.modelRevisionKey(conf.Version), &first); err != nil {
+				return err
+			}
+		}
+
+		conf.Version++
+		conf.Text = text
+		revision := ModelRevision{
+			Version:   conf.Version,
+			Text:      text,
+			Author:    ActorFromContext(ctx),
+			Timestamp: a.now(),
+		}
+		if _, err := tx.Put(a.modelRevisionKey(conf.Version), &revision); err != nil {
+			return err
+		}
+		_, err = tx.Put(a.modelKey(), &conf)
+		return err
+	})
+	return err
+}
+
+// ListModelVersions returns the revisions of the model stored with config, in
+// order of their versions.
+func ListModelVersions(ctx context.Context, db *datastore.Client, config Config) ([]ModelRevision, error) {
+	a := newAdapter(db, config)
+	var revisions []ModelRevision
+	err := a.do(ctx, "ListModelVersions", func(ctx context.Context) error {
+		query := datastore.NewQuery(a.kind + modelRevisionKindSuffix).
+			Namespace(a.namespace).
+			Ancestor(a.modelKey())
+		if _, err := a.db.GetAll(ctx, query, &revisions); err != nil {
+			return err
+		}
+		operationFromContext(ctx).read(len(revisions))
+		sort.Slice(revisions, func(i, j int) bool { return revisions[i].Version < revisions[j].Version })
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// LoadModelVersion loads the given revision of the model stored with config.
+// It fails with ErrModelNotFound if there is no such revision.
+func LoadModelVersion(ctx context.Context, db *datastore.Client, version int64, config Config) (model.Model, error) {
+	a := newAdapter(db, config)
+	var m model.Model
+	err := a.do(ctx, "LoadModelVersion", func(ctx context.Context) error {
+		revision, err := a.loadModelRevision(ctx, version)
+		if err != nil {
+			return err
+		}
+		m, err = model.NewModelFromString(revision.Text)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// RollbackModel stores the given revision of the model stored with config as
+// a new revision, so that the rollback itself is recorded in the history.
+// It fails with ErrModelNotFound if there is no such revision.
+func RollbackModel(ctx context.Context, db *datastore.Client, version int64, config Config) error {
+	a := newAdapter(db, config)
+	return a.do(ctx, "RollbackModel", func(ctx context.Context) error {
+		if config.ReadOnly {
+			return ErrReadOnly
+		}
+
+		revision, err := a.loadModelRevision(ctx, version)
+		if err != nil {
+			return err
+		}
+		return a.saveModel(ctx, revision.Text, nil)
+	})
+}
+
+func (a *Adapter) loadModelRevision(ctx context.Context, version int64) (*ModelRevision, error) {
+	var revision ModelRevision
+	if err := a.db.Get(ctx, a.modelRevisionKey(version), &revision); err != nil {
+		if err == datastore.ErrNoSuchEntity {
+			return nil, &OpError{Op: "LoadModelVersion", Err: err, kind: ErrModelNotFound}
+		}
+		return nil, err
+	}
+	return &revision, nil
+}
@@ -0,0 +1,79 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2/model"
+)
+
+func TestModelHistory(t *testing.T) {
+	ctx := WithActor(context.Background(), "alice")
+	db := getDatastore()
+	config := Config{Namespace: "unittest_model_history"}
+
+	// Start from an empty history.
+	a := newAdapter(db, config)
+	keys, _ := db.GetAll(ctx, datastore.NewQuery(a.kind+modelRevisionKindSuffix).Namespace(a.namespace).KeysOnly(), nil)
+	db.DeleteMulti(ctx, append(keys, a.modelKey()))
+
+	if err := a.saveModel(ctx, mustReadFile(t, "examples/rbac_model.conf"), nil); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.saveModel(ctx, mustReadFile(t, "examples/rbac_tenant_service.conf"), nil); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	revisions, err := ListModelVersions(ctx, db, config)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(revisions) != 2 || revisions[0].Version != 1 || revisions[1].Version != 2 || revisions[1].Author != "alice" {
+		t.Fatalf("got %+v, wants versions 1 and 2 by alice", revisions)
+	}
+
+	// Rolling back stores the first revision as the third one.
+	if err := RollbackModel(ctx, db, 1, config); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	loaded, err := LoadModelWithConfig(db, config)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if modelToText(loaded) != mustModelText(t, "examples/rbac_model.conf") {
+		t.Error("got another model, wants the first revision")
+	}
+	second, err := LoadModelVersion(ctx, db, 2, config)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if modelToText(second) != mustModelText(t, "examples/rbac_tenant_service.conf") {
+		t.Error("got another model, wants the second revision")
+	}
+	if revisions, _ := ListModelVersions(ctx, db, config); len(revisions) != 3 {
+		t.Errorf("got %d revisions, wants 3", len(revisions))
+	}
+
+	if _, err := LoadModelVersion(ctx, db, 4, config); !errors.Is(err, ErrModelNotFound) {
+		t.Errorf("got %v, wants ErrModelNotFound", err)
+	}
+}
+
+func mustReadFile(t *testing.T, path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func mustModelText(t *testing.T, path string) string {
+	m, err := model.NewModelFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return modelToText(m)
+}
@@ -1,6 +1,8 @@
 package datastoreadapter
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sort"
 	"strings"
@@ -58,8 +60,8 @@ func TestLoadModelFail(t *testing.T) {
 	}
 
 	_, err := LoadModelWithConfig(db, config)
-	if err == nil {
-		t.Errorf("got no error, wants an error")
+	if !errors.Is(err, ErrModelNotFound) {
+		t.Errorf("got %v, wants ErrModelNotFound", err)
 		return
 	}
 }
@@ -74,3 +76,81 @@ func modelToText(model model.Model) string {
 	sort.Strings(lines)
 	return strings.Join(lines, "\n")
 }
+
+func TestSaveModelFromStringAndReader(t *testing.T) {
+	db := getDatastore()
+	config := Config{
+		Namespace: "unittest",
+	}
+	text := mustReadFile(t, "examples/rbac_tenant_service.conf")
+
+	if err := SaveModelFromString(context.Background(), db, text, config); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	actual, err := LoadModelWithConfig(db, config)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if modelToText(actual) != mustModelText(t, "examples/rbac_tenant_service.conf") {
+		t.Errorf("Loaded model is different")
+	}
+
+	if err := SaveModelFromReader(context.Background(), db, strings.NewReader(mustReadFile(t, "examples/rbac_model.conf")), config); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	actual, err = LoadModelWithConfig(db, config)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if modelToText(actual) != mustModelText(t, "examples/rbac_model.conf") {
+		t.Errorf("Loaded model is different")
+	}
+
+	// The same validation applies.
+	if err := SaveModelFromString(context.Background(), db, "invalid", config); err == nil {
+		t.Errorf("got no error, wants an error")
+	}
+}
+
+func TestModelCtxCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	db := getDatastore()
+	config := Config{
+		Namespace: "unittest",
+	}
+
+	if err := SaveModelCtx(ctx, db, "examples/rbac_model.conf", config); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, wants context.Canceled", err)
+	}
+	if _, err := LoadModelCtx(ctx, db, config); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, wants context.Canceled", err)
+	}
+}
+
+func TestNamedModels(t *testing.T) {
+	db := getDatastore()
+	rbac := Config{Namespace: "unittest", ModelName: "rbac"}
+	tenant := Config{Namespace: "unittest", ModelName: "tenant"}
+
+	if err := SaveModelWithConfig(db, "examples/rbac_model.conf", rbac); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := SaveModelWithConfig(db, "examples/rbac_tenant_service.conf", tenant); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	for path, config := range map[string]Config{"examples/rbac_model.conf": rbac, "examples/rbac_tenant_service.conf": tenant} {
+		actual, err := LoadModelWithConfig(db, config)
+		if err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+		if modelToText(actual) != mustModelText(t, path) {
+			t.Errorf("got another model, wants %s", path)
+		}
+	}
+
+	if _, err := LoadModelWithConfig(db, Config{Namespace: "unittest", ModelName: "unknown"}); !errors.Is(err, ErrModelNotFound) {
+		t.Errorf("got %v, wants ErrModelNotFound", err)
+	}
+}
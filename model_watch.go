@@ -0,0 +1,54 @@
+package datastoreadapter
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2/model"
+)
+
+// WatchModel polls the model stored with config every interval and calls fn
+// with it whenever its text changes, so that running services can rebuild
+// their enforcers without redeploying:
+//
+//	go datastoreadapter.WatchModel(ctx, db, config, time.Minute, func(m model.Model) {
+//		e.SetModel(m)
+//		e.LoadPolicy()
+//	})
+//
+// The model stored when WatchModel starts is not reported. A failed poll is
+// reported to Config.Logger and Config.Metrics like any other operation and
+// retried at the next tick. WatchModel returns ctx.Err() once ctx is done.
+func WatchModel(ctx context.Context, db *datastore.Client, config Config, interval time.Duration, fn func(model.Model)) error {
+	a := newAdapter(db, config)
+
+	var last string
+	known := false
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var conf CasbinModelConf
+		err := a.do(ctx, "PollModel", func(ctx context.Context) error {
+			err := a.db.Get(ctx, a.modelKey(), &conf)
+			if err == datastore.ErrNoSuchEntity {
+				return nil
+			}
+			return err
+		})
+		if err == nil {
+			if known && conf.Text != last {
+				if m, err := model.NewModelFromString(conf.Text); err == nil {
+					fn(m)
+				}
+			}
+			last, known = conf.Text, true
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+)
+
+func TestWatchModel(t *testing.T) {
+	db := getDatastore()
+	config := Config{Namespace: "unittest", ModelName: "watched"}
+	if err := SaveModelWithConfig(db, "examples/rbac_model.conf", config); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changed := make(chan model.Model, 1)
+	done := make(chan error)
+	go func() {
+		done <- WatchModel(ctx, db, config, 10*time.Millisecond, func(m model.Model) { changed <- m })
+	}()
+
+	// Let the watcher observe the current model first.
+	time.Sleep(50 * time.Millisecond)
+	if err := SaveModelWithConfig(db, "examples/rbac_tenant_service.conf", config); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	select {
+	case m := <-changed:
+		if modelToText(m) != mustModelText(t, "examples/rbac_tenant_service.conf") {
+			t.Error("got another model, wants the saved one")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("got no notification, wants one")
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, wants context.Canceled", err)
+	}
+}
@@ -0,0 +1,112 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2"
+)
+
+func TestMultiError(t *testing.T) {
+	config := Config{Kind: "casbin_test_multierror", Namespace: "unittest"}
+	initPolicy(t, config)
+
+	a := NewAdapterWithConfig(getDatastore(), config)
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf")
+	n := 2 * maxRuleMutations
+	for i := 0; i < n; i++ {
+		e.GetModel().AddPolicy("p", "p", []string{fmt.Sprintf("user%d", i), "data1", "read"})
+	}
+
+	// Fail the save in pages after its first batch of writes.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = WithProgress(ctx, func(p Progress) {
+		if p.Phase == PhaseWriting {
+			cancel()
+		}
+	})
+	err := a.SavePolicyCtx(ctx, e.GetModel())
+	var multi *MultiError
+	if !errors.As(err, &multi) {
+		t.Fatalf("got %v, wants a *MultiError", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, wants %v", err, context.Canceled)
+	}
+	if len(multi.Deleted) != 5 || len(multi.Undeleted) != 0 {
+		t.Errorf("got %d deleted and %d undeleted rules, wants 5 and 0", len(multi.Deleted), len(multi.Undeleted))
+	}
+	if len(multi.Written) != maxRuleMutations || len(multi.Unwritten) != n-maxRuleMutations {
+		t.Errorf("got %d written and %d unwritten rules, wants %d and %d", len(multi.Written), len(multi.Unwritten), maxRuleMutations, n-maxRuleMutations)
+	}
+
+	// Retrying the unwritten rules completes the policy.
+	for _, rule := range multi.Unwritten {
+		if err := a.AddPolicy("p", rule.PType, rule.Rule()); err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+	}
+	if count, err := a.CountPolicies(context.Background()); err != nil || count != n {
+		t.Errorf("got %d, %v, wants %d rules", count, err, n)
+	}
+}
+
+func TestDeleteRulesAggregatesErrors(t *testing.T) {
+	config := Config{Kind: "casbin_test_multierror", Namespace: "unittest"}
+	initPolicy(t, config)
+	ctx := context.Background()
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	var keys []*datastore.Key
+	_, err := a.paginateRules(ctx, true, "", func(page []*datastore.Key, _ []CasbinRule) error {
+		keys = append(keys, page...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	var lines []interface{}
+	for i := 0; i < maxRuleMutations; i++ {
+		line := savePolicyLine("p", []string{fmt.Sprintf("user%d", i), "data1", "read"})
+		lines = append(lines, &line)
+	}
+	if err := a.putRules(ctx, false, lines, nil); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	// The first transaction fails on an invalid key, the second one still
+	// deletes the initial rules.
+	var invalid []*datastore.Key
+	for i := 0; i < maxRuleMutations; i++ {
+		invalid = append(invalid, a.newRuleKey(&CasbinRule{PType: "p"}))
+	}
+	err = a.deleteRules(ctx, false, append(invalid, keys...))
+	var multi *MultiError
+	if !errors.As(err, &multi) {
+		t.Fatalf("got %v, wants a *MultiError", err)
+	}
+	if !errors.Is(err, datastore.ErrInvalidKey) {
+		t.Errorf("got %v, wants %v", err, datastore.ErrInvalidKey)
+	}
+	if len(multi.Errors) != 1 || len(multi.Undeleted) != maxRuleMutations || len(multi.Deleted) != len(keys) {
+		t.Errorf("got %d errors, %d undeleted and %d deleted rules, wants 1, %d and %d", len(multi.Errors), len(multi.Undeleted), len(multi.Deleted), maxRuleMutations, len(keys))
+	}
+	if n, err := a.CountPolicies(ctx); err != nil || n != maxRuleMutations {
+		t.Errorf("got %d, %v, wants %d rules", n, err, maxRuleMutations)
+	}
+
+	// A failed purge lists the rules the save was yet to write as unwritten.
+	var commits batchCommits
+	commits.skip(multi)
+	err = commits.fail(nil, lines)
+	if !errors.As(err, &multi) {
+		t.Fatalf("got %v, wants a *MultiError", err)
+	}
+	if len(multi.Unwritten) != len(lines) || len(multi.Written) != 0 {
+		t.Errorf("got %d unwritten and %d written rules, wants %d and 0", len(multi.Unwritten), len(multi.Written), len(lines))
+	}
+}
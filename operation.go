@@ -0,0 +1,104 @@
+package datastoreadapter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// operation tracks an adapter operation for the configured Tracer,
+// MetricsCollector and Logger. Its methods are no-ops on a nil operation.
+type operation struct {
+	adapter *Adapter
+	ctx     context.Context
+	span    Span
+	// mu guards the counters of stats, which the concurrent reads of the
+	// operation update.
+	mu    sync.Mutex
+	stats OperationStats
+	start time.Time
+	// startedAt is the time the operation started by Config.Clock, which
+	// its records are stamped with, while start measures its duration.
+	startedAt time.Time
+
+	// pendingAudit is the audit entry the next mutation writes.
+	pendingAudit *AuditEntry
+	// event is the event the Notifiers are notified of, and committed
+	// whether any mutation of the operation has been committed.
+	event     *PolicyEvent
+	committed bool
+	// added are the rules the operation has added, if
+	// Config.SensitiveRules is set.
+	added []CasbinRule
+	// progress is the progress of each phase of the operation.
+	progress map[ProgressPhase]*Progress
+}
+
+type operationKey struct{}
+
+// begin starts tracking op. The returned context carries the operation, so
+// that helpers can record the entities they write and the retries they make.
+func (a *Adapter) begin(ctx context.Context, op string) (context.Context, *operation) {
+	ctx = a.extract(ctx)
+	o := &operation{adapter: a, span: noopSpan{}, stats: OperationStats{Op: op, RequestID: RequestIDFromContext(ctx)}, start: time.Now(), startedAt: a.now()}
+	if a.tracer != nil {
+		ctx, o.span = a.tracer.Start(ctx, op)
+		o.span.SetAttribute(attrKind, a.kind)
+		o.span.SetAttribute(attrNamespace, a.namespace)
+		if o.stats.RequestID != "" {
+			o.span.SetAttribute(attrRequestID, o.stats.RequestID)
+		}
+	}
+	o.ctx = context.WithValue(ctx, operationKey{}, o)
+	return o.ctx, o
+}
+
+func operationFromContext(ctx context.Context) *operation {
+	o, _ := ctx.Value(operationKey{}).(*operation)
+	return o
+}
+
+func (o *operation) read(n int) {
+	if o != nil {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		o.stats.EntitiesRead += n
+	}
+}
+
+func (o *operation) wrote(n int) {
+	if o != nil {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		o.stats.EntitiesWritten += n
+	}
+}
+
+func (o *operation) retry() {
+	if o != nil {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		o.stats.Retries++
+	}
+}
+
+// end reports the operation, which failed with err if not nil.
+func (o *operation) end(err error) {
+	o.mu.Lock()
+	o.stats.Duration = time.Since(o.start)
+	o.stats.Err = err
+	stats := o.stats
+	o.mu.Unlock()
+
+	o.span.SetAttribute(attrEntitiesRead, stats.EntitiesRead)
+	o.span.SetAttribute(attrEntitiesWritten, stats.EntitiesWritten)
+	o.span.SetAttribute(attrRetries, stats.Retries)
+	o.span.End(err)
+
+	if o.adapter.metrics != nil {
+		o.adapter.metrics.ObserveOperation(stats)
+	}
+	if o.adapter.logger != nil {
+		o.adapter.logger.LogOperation(o.ctx, stats)
+	}
+}
@@ -0,0 +1,156 @@
+package datastoreadapter
+
+import (
+	"context"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/api/iterator"
+)
+
+// defaultPageSize is the number of entities fetched per page by paginated
+// operations. It also matches the datastore limit on batch operations, so a
+// page of keys can always be deleted with a single call.
+const defaultPageSize = 500
+
+// ResumeToken marks the position of a paginated operation.
+// An empty token denotes the beginning of the result set.
+type ResumeToken string
+
+// pageFunc processes a page of entities. rules is nil for keys-only queries.
+type pageFunc func(keys []*datastore.Key, rules []CasbinRule) error
+
+// paginate runs q in pages of at most a.pageSize entities, starting at token,
+// and calls fn for each page. It returns an empty token once all pages have
+// been processed. On failure, it returns the token of the failed page, so a
+// later call can resume from there.
+func (a *Adapter) paginate(ctx context.Context, q *datastore.Query, keysOnly bool, token ResumeToken, fn pageFunc) (ResumeToken, error) {
+	if keysOnly {
+		q = q.KeysOnly()
+	}
+
+	for {
+		p, err := a.fetchPage(ctx, q, keysOnly, a.pageSize, token)
+		if err != nil {
+			return token, err
+		}
+		if p.read == 0 {
+			return "", nil
+		}
+		// The malformed rules dropped from the page may leave it empty.
+		if len(p.keys) > 0 {
+			if err := fn(p.keys, p.rules); err != nil {
+				return token, err
+			}
+		}
+		if p.read < a.pageSize {
+			return "", nil
+		}
+		token = p.next
+	}
+}
+
+// fetchPage runs q for a page of at most limit entities starting at token,
+// and returns them along with the token of the position after them. The
+// rules of the page are nil if keysOnly is set. The read is hedged within
+// the operations marked by withHedging.
+func (a *Adapter) fetchPage(ctx context.Context, q *datastore.Query, keysOnly bool, limit int, token ResumeToken) (page, error) {
+	var p page
+	if a.hedgeDelay > 0 && hedging(ctx) {
+		p = a.fetchHedgedPage(ctx, q, keysOnly, limit, token)
+	} else {
+		p = a.fetchPageOnce(ctx, q, keysOnly, limit, token)
+	}
+	if p.err != nil {
+		return page{}, p.err
+	}
+	operationFromContext(ctx).read(p.read)
+	return p, nil
+}
+
+// fetchPageOnce is the same as fetchPage, but reads the page once and
+// doesn't record the entities read.
+func (a *Adapter) fetchPageOnce(ctx context.Context, q *datastore.Query, keysOnly bool, limit int, token ResumeToken) page {
+	fail := func(err error) page {
+		return page{err: err}
+	}
+
+	q = q.Limit(limit)
+	if tx := readTransaction(ctx); tx != nil {
+		q = q.Transaction(tx)
+	}
+	if token != "" {
+		cursor, err := datastore.DecodeCursor(string(token))
+		if err != nil {
+			return fail(err)
+		}
+		q = q.Start(cursor)
+	}
+
+	release, err := a.limiter.acquire(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	defer release()
+
+	var p page
+	it := a.db.Run(ctx, q)
+	for {
+		if err := ctx.Err(); err != nil {
+			return fail(err)
+		}
+
+		var rule CasbinRule
+		var dst interface{}
+		if !keysOnly {
+			dst = a.entity(&rule)
+		}
+		key, err := it.Next(dst)
+		if err == iterator.Done {
+			break
+		}
+		if m := malformed(ctx); m != nil && key != nil && fieldMismatch(err) {
+			m.add(key, rule, err)
+			p.read++
+			continue
+		}
+		if err != nil {
+			return fail(err)
+		}
+		p.read++
+		p.keys = append(p.keys, key)
+		if !keysOnly {
+			p.rules = append(p.rules, rule)
+		}
+	}
+	if p.read == 0 {
+		return page{}
+	}
+
+	if !keysOnly && len(p.keys) > 0 {
+		if p.keys, p.rules, err = a.decodePage(ctx, p.keys, p.rules); err != nil {
+			return fail(err)
+		}
+	}
+	cursor, err := it.Cursor()
+	if err != nil {
+		return fail(err)
+	}
+	p.next = ResumeToken(cursor.String())
+	return p
+}
+
+// ScanPolicy calls fn with every page of stored rules, starting at the
+// position marked by token. It is meant for long-running jobs such as
+// migrations: if fn or datastore fails, ScanPolicy returns the error along
+// with the token of the failed page, from which a later call can resume.
+func (a *Adapter) ScanPolicy(ctx context.Context, token ResumeToken, fn func(rules []CasbinRule) error) (ResumeToken, error) {
+	next := token
+	err := a.do(ctx, "ScanPolicy", func(ctx context.Context) error {
+		var err error
+		next, err = a.paginateRules(ctx, false, token, func(_ []*datastore.Key, rules []CasbinRule) error {
+			return fn(rules)
+		})
+		return err
+	})
+	return next, err
+}
@@ -0,0 +1,77 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+)
+
+func TestScanPolicyResume(t *testing.T) {
+	config := Config{Kind: "casbin_test", Namespace: "unittest", PageSize: 2}
+	initPolicy(t, config)
+
+	a := NewAdapterWithConfig(getDatastore(), config)
+	ctx := context.Background()
+
+	// Fail on the second page.
+	errStop := errors.New("stop")
+	var seen int
+	var pages int
+	token, err := a.ScanPolicy(ctx, "", func(rules []CasbinRule) error {
+		pages++
+		if pages == 2 {
+			return errStop
+		}
+		seen += len(rules)
+		return nil
+	})
+	if !errors.Is(err, errStop) {
+		t.Fatalf("got %v, wants %v", err, errStop)
+	}
+	if token == "" {
+		t.Fatal("got an empty token, wants a token to resume from")
+	}
+
+	// Resume from the failed page.
+	token, err = a.ScanPolicy(ctx, token, func(rules []CasbinRule) error {
+		seen += len(rules)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if token != "" {
+		t.Errorf("got %q, wants an empty token", token)
+	}
+	if seen != 5 {
+		t.Errorf("got %d rules, wants 5", seen)
+	}
+}
+
+func TestSavePolicyInPages(t *testing.T) {
+	config := Config{Kind: "casbin_test_large", Namespace: "unittest"}
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf")
+	for i := 0; i < 2*maxTxnMutations; i++ {
+		e.GetModel().AddPolicy("p", "p", []string{fmt.Sprintf("user%d", i), "data1", "read"})
+	}
+
+	a := NewAdapterWithConfig(getDatastore(), config)
+	// Save twice so that the second save has to purge more entities
+	// than a single transaction can hold.
+	for i := 0; i < 2; i++ {
+		if err := a.SavePolicy(e.GetModel()); err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+	}
+
+	e.ClearPolicy()
+	if err := a.LoadPolicy(e.GetModel()); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if n := len(e.GetPolicy()); n != 2*maxTxnMutations {
+		t.Errorf("got %d rules, wants %d", n, 2*maxTxnMutations)
+	}
+}
@@ -0,0 +1,86 @@
+package datastoreadapter
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2/model"
+)
+
+// loadPolicyInParallel loads the rules of each ptype defined in the model with
+// a query of its own, running up to a.loadWorkers queries at a time.
+// Rules whose ptype is not defined in the model are not queried at all.
+func (a *Adapter) loadPolicyInParallel(ctx context.Context, model model.Model) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var firstErr error
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+
+	ptypes := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < a.loadWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ptype := range ptypes {
+				for _, kind := range a.ptypeKinds(ptype) {
+					query := a.kindQuery(kind).Filter(a.property("p_type")+" =", ptype)
+					_, err := a.paginate(ctx, query, false, "", func(keys []*datastore.Key, rules []CasbinRule) error {
+						mu.Lock()
+						defer mu.Unlock()
+						for i, line := range rules {
+							if err := a.loadRule(ctx, model, keys[i], line); err != nil {
+								return err
+							}
+						}
+						return nil
+					})
+					if err != nil {
+						fail(err)
+						break
+					}
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, ptype := range modelPTypes(model) {
+		select {
+		case ptypes <- ptype:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(ptypes)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// modelPTypes returns the ptypes of the policy and role definitions in the
+// model, in a stable order.
+func modelPTypes(model model.Model) []string {
+	var ptypes []string
+	for _, sec := range []string{"p", "g"} {
+		for ptype := range model[sec] {
+			ptypes = append(ptypes, ptype)
+		}
+	}
+	sort.Strings(ptypes)
+	return ptypes
+}
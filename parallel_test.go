@@ -0,0 +1,50 @@
+package datastoreadapter
+
+import (
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+)
+
+func TestLoadPolicyInParallel(t *testing.T) {
+	config := Config{Kind: "casbin_test", Namespace: "unittest", PageSize: 1}
+	initPolicy(t, config)
+
+	// The workers count the entities they read concurrently, which
+	// go test -race checks.
+	var stats statsRecorder
+	config.LoadWorkers = 4
+	config.Metrics = &stats
+	a := NewAdapterWithConfig(getDatastore(), config)
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+	if n := len(e.GetGroupingPolicy()); n != 1 {
+		t.Errorf("got %d grouping rules, wants 1", n)
+	}
+	if len(stats) != 1 || stats[0].EntitiesRead != 5 {
+		t.Errorf("got %+v, wants a LoadPolicy reading 5 rules", stats)
+	}
+}
+
+func TestLoadPolicyUnknownPType(t *testing.T) {
+	config := Config{Kind: "casbin_test", Namespace: "unittest"}
+	initPolicy(t, config)
+
+	if err := NewAdapterWithConfig(getDatastore(), config).AddPolicy("p", "p9", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	// Both load paths skip the rule the model doesn't define.
+	for _, workers := range []int{1, 4} {
+		config.LoadWorkers = workers
+		e, err := casbin.NewEnforcer("examples/rbac_model.conf", NewAdapterWithConfig(getDatastore(), config))
+		if err != nil {
+			t.Fatalf("got %v with %d workers, wants no error", err, workers)
+		}
+		if n := len(e.GetPolicy()); n != 4 {
+			t.Errorf("got %d rules with %d workers, wants 4", n, workers)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package datastoreadapter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"cloud.google.com/go/datastore"
+)
+
+// queryPlan is a query for rules along with the composite index it needs, and
+// queries which the built-in indexes serve to fall back to without that index.
+// The fallbacks may return more rules than query, which match filters out.
+type queryPlan struct {
+	query     *datastore.Query
+	index     Index
+	fallbacks []*datastore.Query
+	match     func(CasbinRule) bool
+	// partial is set if query matches a superset of the rules too, which
+	// match filters out.
+	partial bool
+}
+
+// scanPlans returns the plans of the queries for the rules of each kind,
+// which fall back to a query per ptype in ptypes stored in that kind. The
+// ancestor query alone can't serve as a fallback since it also matches the
+// other entities of the group, such as the policy version.
+func (a *Adapter) scanPlans(ptypes []string) []queryPlan {
+	var plans []queryPlan
+	for _, kind := range a.ruleKinds() {
+		plan := queryPlan{
+			query: a.kindQuery(kind),
+			index: Index{Kind: kind, Ancestor: true, Properties: []string{a.property("p_type")}},
+			match: func(CasbinRule) bool { return true },
+		}
+		for _, ptype := range ptypes {
+			for _, k := range a.ptypeKinds(ptype) {
+				if k == kind {
+					plan.fallbacks = append(plan.fallbacks, a.ptypeQuery(kind, ptype))
+				}
+			}
+		}
+		plans = append(plans, plan)
+	}
+	return plans
+}
+
+// ptypeQuery returns a query for the rules of ptype stored in kind which the
+// built-in indexes serve: datastore serves ancestor queries with only
+// equality filters by merging them.
+func (a *Adapter) ptypeQuery(kind, ptype string) *datastore.Query {
+	return datastore.NewQuery(kind).Namespace(a.namespace).Ancestor(a.rootKeyOf(kind)).Filter(a.property("p_type")+" =", ptype)
+}
+
+// filteredPlans returns the plans of the queries for the rules of f.PType
+// whose values match f.FieldValues starting at f.FieldIndex, one per kind
+// they are stored in. Empty field values match any value. They fall back to
+// matching p_type alone. The extra values,
+// after v5, are always matched in memory, as are the others if f.IgnoreCase
+// is set without Config.CaseFolding, which codecs disable, and the prefix of f.Prefix if it is
+// set along with f.IgnoreCase or codecs, which don't keep prefixes.
+func (a *Adapter) filteredPlans(ctx context.Context, f Filter) ([]queryPlan, error) {
+	ptype := f.PType
+	var plan queryPlan
+	properties := []string{a.property("p_type")}
+
+	prefixField := -1
+	if n := len(f.FieldValues); f.Prefix && n > 0 && f.FieldValues[n-1] != "" && f.FieldValues[n-1] != MatchEmpty {
+		prefixField = f.FieldIndex + n - 1
+	}
+
+	// values holds the decoded values to match, which codecs such as
+	// ValueTransformer may have changed.
+	values := make(map[int]string)
+	var filters []func(*datastore.Query) *datastore.Query
+	ranged := false
+	for i, value := range f.FieldValues {
+		field := f.FieldIndex + i
+		if field < 0 || value == "" {
+			continue
+		}
+		if field == prefixField {
+			values[field] = value
+			if field >= maxRuleFields || f.IgnoreCase || len(a.codecs) > 0 {
+				plan.partial = true
+				continue
+			}
+			// Datastore has no prefix filter, but the values starting with
+			// value are those between it and it followed by the last rune.
+			name := a.property(fmt.Sprintf("v%d", field))
+			filters = append(filters, func(q *datastore.Query) *datastore.Query {
+				return q.Filter(name+" >=", value).Filter(name+" <", value+string(utf8.MaxRune))
+			})
+			properties = append(properties, name)
+			ranged = true
+			continue
+		}
+		if value == MatchEmpty {
+			value = ""
+		}
+		stored, err := a.encodeValue(ctx, ptype, field, value)
+		if err != nil {
+			return nil, err
+		}
+		if values[field], err = a.decodeValue(ctx, ptype, field, stored); err != nil {
+			return nil, err
+		}
+		var name, filtered string
+		switch {
+		case field >= maxRuleFields || f.IgnoreCase && !a.caseFolding:
+			plan.partial = true
+			continue
+		case f.IgnoreCase:
+			name, filtered = a.property("folded"), foldedValue(field, stored)
+		default:
+			name, filtered = a.property(fmt.Sprintf("v%d", field)), stored
+		}
+		filters = append(filters, func(q *datastore.Query) *datastore.Query {
+			return q.Filter(name+" =", filtered)
+		})
+		properties = append(properties, name)
+	}
+
+	equal := func(stored, value string) bool {
+		return stored == value || f.IgnoreCase && strings.ToLower(stored) == strings.ToLower(value)
+	}
+	plan.match = func(line CasbinRule) bool {
+		fields := line.values()
+		for field, value := range values {
+			if field >= len(fields) {
+				if value != "" {
+					return false
+				}
+				continue
+			}
+			stored := *fields[field]
+			if field == prefixField && len(stored) >= len(value) {
+				stored = stored[:len(value)]
+			}
+			if !equal(stored, value) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var plans []queryPlan
+	for _, kind := range a.ptypeKinds(ptype) {
+		plan := plan
+		plan.index = Index{Kind: kind, Ancestor: true, Properties: properties}
+		plan.fallbacks = []*datastore.Query{a.ptypeQuery(kind, ptype)}
+		// A query can't have inequality filters on more than one property,
+		// so the one of a prefix replaces the one of kindQuery, which
+		// excludes the other entities of the group.
+		if ranged {
+			plan.query = a.ptypeQuery(kind, ptype)
+		} else {
+			plan.query = a.kindQuery(kind).Filter(a.property("p_type")+" =", ptype)
+		}
+		for _, filter := range filters {
+			plan.query = filter(plan.query)
+		}
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
+
+// paginatePlan runs plan.query as paginate does. If it fails for lack of its
+// index and Config.IndexFallback is set, it reports the index to create to the
+// Logger and runs plan.fallbacks instead, passing fn the matching rules only.
+func (a *Adapter) paginatePlan(ctx context.Context, plan queryPlan, keysOnly bool, fn pageFunc) error {
+	called := false
+	run := func(keys []*datastore.Key, rules []CasbinRule) error {
+		called = true
+		return fn(keys, rules)
+	}
+	var err error
+	if plan.partial {
+		err = a.paginateMatching(ctx, plan.query, plan.match, keysOnly, run)
+	} else {
+		_, err = a.paginate(ctx, plan.query, keysOnly, "", run)
+	}
+	if err == nil || called || !a.indexFallback || classifyError(err) != ErrMissingIndex {
+		return err
+	}
+
+	operationFromContext(ctx).warn(fmt.Errorf("%w: falling back to filtering in memory; create the index on %s of %s",
+		err, strings.Join(plan.index.Properties, ", "), plan.index.Kind))
+	return a.paginateFallback(ctx, plan, keysOnly, fn)
+}
+
+// paginatePlans runs paginatePlan for each of plans in turn.
+func (a *Adapter) paginatePlans(ctx context.Context, plans []queryPlan, keysOnly bool, fn pageFunc) error {
+	for _, plan := range plans {
+		if err := a.paginatePlan(ctx, plan, keysOnly, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// paginateFallback runs plan.fallbacks, passing fn the rules matching plan.
+func (a *Adapter) paginateFallback(ctx context.Context, plan queryPlan, keysOnly bool, fn pageFunc) error {
+	for _, query := range plan.fallbacks {
+		if err := a.paginateMatching(ctx, query, plan.match, keysOnly, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// paginateMatching runs query as paginate does, passing fn the rules which
+// match only.
+func (a *Adapter) paginateMatching(ctx context.Context, query *datastore.Query, match func(CasbinRule) bool, keysOnly bool, fn pageFunc) error {
+	_, err := a.paginate(ctx, query, false, "", func(page []*datastore.Key, rules []CasbinRule) error {
+		var keys []*datastore.Key
+		var matched []CasbinRule
+		for i := range rules {
+			if match(rules[i]) {
+				keys = append(keys, page[i])
+				matched = append(matched, rules[i])
+			}
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+		if keysOnly {
+			matched = nil
+		}
+		return fn(keys, matched)
+	})
+	return err
+}
@@ -0,0 +1,69 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMissingIndexError(t *testing.T) {
+	err := wrapError("LoadFilteredPolicy", status.Error(codes.FailedPrecondition, "no matching index found. recommended index is: ..."))
+	if !errors.Is(err, ErrMissingIndex) {
+		t.Errorf("got %v, wants ErrMissingIndex", err)
+	}
+}
+
+func TestQueryPlanFallback(t *testing.T) {
+	config := Config{Kind: "casbin_test_planner", Namespace: "unittest", IndexFallback: true}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+	ctx := context.Background()
+
+	collect := func(plan queryPlan, fallback bool) [][]string {
+		var lines [][]string
+		fn := func(_ []*datastore.Key, rules []CasbinRule) error {
+			for _, line := range rules {
+				lines = append(lines, []string{line.PType, line.V0, line.V1, line.V2})
+			}
+			return nil
+		}
+		var err error
+		if fallback {
+			err = a.paginateFallback(ctx, plan, false, fn)
+		} else {
+			err = a.paginatePlan(ctx, plan, false, fn)
+		}
+		if err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+		sortPolicy(lines)
+		return lines
+	}
+
+	filtered := func(ptype string, fieldIndex int, fieldValues ...string) queryPlan {
+		plans, err := a.filteredPlans(ctx, Filter{PType: ptype, FieldIndex: fieldIndex, FieldValues: fieldValues})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return plans[0]
+	}
+	for _, plan := range []queryPlan{
+		a.scanPlans([]string{"p", "g"})[0],
+		filtered("p", 0, "data2_admin"),
+		filtered("p", 1, "data2", "write"),
+		filtered("p", 0, "", "data2"),
+		filtered("g", 1, "data2_admin"),
+	} {
+		wants := collect(plan, false)
+		if len(wants) == 0 {
+			t.Errorf("got no rules for %v", plan.index.Properties)
+		}
+		if actual := collect(plan, true); !SamePolicy(actual, wants) {
+			t.Errorf("got %v with the fallback of %v, wants %v", actual, plan.index.Properties, wants)
+		}
+	}
+}
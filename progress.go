@@ -0,0 +1,75 @@
+package datastoreadapter
+
+import "context"
+
+// ProgressPhase is a phase of a long-running operation reported to a
+// ProgressFunc.
+type ProgressPhase string
+
+const (
+	// PhaseDeleting is the phase deleting the stored rules, or soft deleting
+	// them if Config.SoftDelete is set.
+	PhaseDeleting ProgressPhase = "deleting"
+	// PhaseWriting is the phase writing the rules.
+	PhaseWriting ProgressPhase = "writing"
+)
+
+// Progress is the progress of a phase of an operation.
+type Progress struct {
+	// Op is the name of the operation, as in OperationStats.
+	Op    string
+	Phase ProgressPhase
+	// Processed is the number of rules processed so far in the phase.
+	Processed int
+	// Total is the number of rules known to be processed in the phase. It
+	// grows along with Processed when the operation reads the rules page by
+	// page, such as the imports.
+	Total int
+}
+
+// ProgressFunc is called by the operations run with a context returned by
+// WithProgress after every batch of rules they delete or write.
+type ProgressFunc func(Progress)
+
+type progressKey struct{}
+
+// WithProgress returns a context which makes the operations run with it,
+// such as SavePolicyCtx, RestoreFromGCS, ImportPolicyCSV and MigrateFrom,
+// report their progress to fn, e.g. for a CLI to show it. fn is called from
+// the goroutine running the operation.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// expect records that n more rules are to be processed in phase.
+func (o *operation) expect(phase ProgressPhase, n int) {
+	if o == nil || n == 0 {
+		return
+	}
+	if o.progress == nil {
+		o.progress = make(map[ProgressPhase]*Progress)
+	}
+	p, ok := o.progress[phase]
+	if !ok {
+		p = &Progress{Op: o.stats.Op, Phase: phase}
+		o.progress[phase] = p
+	}
+	p.Total += n
+}
+
+// advance records that n more rules have been processed in phase, and
+// reports it to the ProgressFunc set on the context of the operation.
+func (o *operation) advance(phase ProgressPhase, n int) {
+	if o == nil || n == 0 {
+		return
+	}
+	fn, _ := o.ctx.Value(progressKey{}).(ProgressFunc)
+	p, ok := o.progress[phase]
+	if !ok {
+		return
+	}
+	p.Processed += n
+	if fn != nil {
+		fn(*p)
+	}
+}
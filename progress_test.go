@@ -0,0 +1,71 @@
+package datastoreadapter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+)
+
+func TestProgress(t *testing.T) {
+	config := Config{Kind: "casbin_test_progress", Namespace: "unittest"}
+	initPolicy(t, config)
+
+	var reports []Progress
+	ctx := WithProgress(context.Background(), func(p Progress) {
+		reports = append(reports, p)
+	})
+	last := func(phase ProgressPhase) Progress {
+		var last Progress
+		for _, p := range reports {
+			if p.Phase == phase {
+				last = p
+			}
+		}
+		return last
+	}
+
+	a := NewAdapterWithConfig(getDatastore(), config)
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	for i := 0; i < maxTxnMutations; i++ {
+		e.GetModel().AddPolicy("p", "p", []string{fmt.Sprintf("user%d", i), "data1", "read"})
+	}
+
+	// The policy is saved in pages, reporting every batch.
+	if err := a.SavePolicyCtx(ctx, e.GetModel()); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if got, wants := last(PhaseDeleting), (Progress{Op: "SavePolicy", Phase: PhaseDeleting, Processed: 5, Total: 5}); got != wants {
+		t.Errorf("got %+v, wants %+v", got, wants)
+	}
+	n := maxTxnMutations + 5
+	if got, wants := last(PhaseWriting), (Progress{Op: "SavePolicy", Phase: PhaseWriting, Processed: n, Total: n}); got != wants {
+		t.Errorf("got %+v, wants %+v", got, wants)
+	}
+	if writes := len(reports) - 1; writes < 2 {
+		t.Errorf("got %d reports of the writes, wants one per batch", writes)
+	}
+
+	reports = nil
+	csv := "p, alice, data1, read\np, carol, data3, read\n"
+	if err := a.ImportPolicyCSV(ctx, strings.NewReader(csv), ImportReplace); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if got, wants := last(PhaseDeleting), (Progress{Op: "ImportPolicyCSV", Phase: PhaseDeleting, Processed: n, Total: n}); got != wants {
+		t.Errorf("got %+v, wants %+v", got, wants)
+	}
+	if got, wants := last(PhaseWriting), (Progress{Op: "ImportPolicyCSV", Phase: PhaseWriting, Processed: 2, Total: 2}); got != wants {
+		t.Errorf("got %+v, wants %+v", got, wants)
+	}
+
+	// Nothing is reported without WithProgress.
+	reports = nil
+	if err := a.SavePolicy(e.GetModel()); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(reports) != 0 {
+		t.Errorf("got %d reports, wants none", len(reports))
+	}
+}
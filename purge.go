@@ -0,0 +1,112 @@
+package datastoreadapter
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/datastore"
+)
+
+// PurgeReport is the report of PurgeNamespace.
+type PurgeReport struct {
+	// Deleted is the number of entities deleted of each kind, or which would
+	// be under WithDryRun.
+	Deleted map[string]int
+	// Total is the number of entities deleted of all kinds.
+	Total int
+}
+
+// entityKinds returns the kinds the adapter stores entities in: those of the
+// rules, which also hold the policy version, the model and the other
+// singletons, followed by the kinds named after Config.Kind.
+func (a *Adapter) entityKinds() []string {
+	kinds := a.ruleKinds()
+	for _, suffix := range []string{
+		auditKindSuffix,
+		idempotencyKindSuffix,
+		modelRevisionKindSuffix,
+		quarantineKindSuffix,
+		reverseIndexKindSuffix,
+		snapshotKindSuffix,
+		snapshotRuleKindSuffix,
+	} {
+		kinds = append(kinds, a.kind+suffix)
+	}
+	return kinds
+}
+
+// PurgeNamespace deletes every entity the adapter stores in namespace, e.g.
+// to erase the data of a tenant leaving: the rules of every slot and shard,
+// the models and their revisions, the snapshots, the audit entries and the
+// other entities of the kinds named after Config.Kind, including the data key
+// of Config.KeyEncrypter. The entities of the other kinds of namespace are
+// left alone, and the default namespace can't be purged.
+//
+// The entities are deleted kind by kind, in pages of Config.PageSize and
+// batches of up to maxRuleMutations, outside of any transaction, so that a
+// failed purge leaves some of them, and can be run again. Under WithDryRun,
+// the entities are counted and recorded as deleted, but nothing is deleted.
+// The purge is neither audited nor versioned, since both would be purged
+// along, but the Notifiers are notified of it.
+func (a *Adapter) PurgeNamespace(ctx context.Context, namespace string) (*PurgeReport, error) {
+	b := a.ForNamespace(namespace)
+	report := &PurgeReport{Deleted: make(map[string]int)}
+	err := b.do(ctx, "PurgeNamespace", func(ctx context.Context) error {
+		if b.readOnly {
+			return ErrReadOnly
+		}
+		if namespace == "" {
+			return fmt.Errorf("%w: empty namespace", ErrInvalidFilter)
+		}
+		b.audit(ctx, AuditEntry{})
+		record := dryRun(ctx)
+
+		for _, kind := range b.entityKinds() {
+			query := datastore.NewQuery(kind).Namespace(namespace)
+			_, err := b.paginate(ctx, query, true, "", func(keys []*datastore.Key, _ []CasbinRule) error {
+				if record != nil {
+					recordDeletes(record, MutationDelete, keys)
+				} else if err := b.purge(ctx, keys); err != nil {
+					return err
+				}
+				report.Deleted[kind] += len(keys)
+				report.Total += len(keys)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if record == nil {
+			// The policy version is gone along with the rules.
+			b.mu.Lock()
+			b.versionKnown = false
+			b.mu.Unlock()
+		}
+		return nil
+	})
+	return report, err
+}
+
+// PurgeNamespace is the same as Adapter.PurgeNamespace.
+func (m *MultiTenantAdapter) PurgeNamespace(ctx context.Context, namespace string) (*PurgeReport, error) {
+	return m.adapter.PurgeNamespace(ctx, namespace)
+}
+
+// purge deletes keys in batches of up to maxRuleMutations keys.
+func (a *Adapter) purge(ctx context.Context, keys []*datastore.Key) error {
+	for start := 0; start < len(keys); start += maxRuleMutations {
+		end := start + maxRuleMutations
+		if end > len(keys) {
+			end = len(keys)
+		}
+		err := a.limited(ctx, func() error {
+			return a.db.DeleteMulti(ctx, keys[start:end])
+		})
+		if err != nil {
+			return err
+		}
+		operationFromContext(ctx).wrote(end - start)
+	}
+	return nil
+}
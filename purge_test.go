@@ -0,0 +1,76 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+)
+
+func TestPurgeNamespace(t *testing.T) {
+	config := Config{Kind: "casbin_test_purge", Namespace: "unittest_purge", Audit: true}
+	initPolicy(t, config)
+	db := getDatastore()
+	a := NewAdapterWithConfig(db, config)
+	ctx := context.Background()
+
+	if err := SaveModelWithConfig(db, "examples/rbac_model.conf", config); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.AddPolicyCtx(ctx, "p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if _, err := a.CreateSnapshot(ctx, "before"); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	// An entity of another kind of the namespace.
+	other := datastore.NameKey("other", "kept", nil)
+	other.Namespace = config.Namespace
+	if _, err := db.Put(ctx, other, &policyVersion{Version: 1}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	var recorded int
+	dry, err := a.PurgeNamespace(WithDryRun(ctx, func(Mutation) { recorded++ }), config.Namespace)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if dry.Total == 0 || dry.Total != recorded {
+		t.Errorf("got %d entities, %d recorded, wants them counted", dry.Total, recorded)
+	}
+	if dry.Deleted[config.Kind] < 6 || dry.Deleted[config.Kind+auditKindSuffix] == 0 || dry.Deleted[config.Kind+snapshotRuleKindSuffix] != 6 {
+		t.Errorf("got %v, wants the rules, the audit entries and the snapshot", dry.Deleted)
+	}
+	if rules := storedRules(t, a); len(rules) != 6 {
+		t.Errorf("got %d rules, wants nothing deleted by the dry run", len(rules))
+	}
+
+	report, err := a.PurgeNamespace(ctx, config.Namespace)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if report.Total != dry.Total {
+		t.Errorf("got %d entities deleted, wants %d", report.Total, dry.Total)
+	}
+	for _, kind := range a.entityKinds() {
+		keys, err := db.GetAll(ctx, datastore.NewQuery(kind).Namespace(config.Namespace).KeysOnly(), nil)
+		if err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+		if len(keys) != 0 {
+			t.Errorf("got %d entities of %s, wants none", len(keys), kind)
+		}
+	}
+	if err := db.Get(ctx, other, &policyVersion{}); err != nil {
+		t.Errorf("got %v, wants the other kinds left alone", err)
+	}
+
+	// The adapter can write the namespace again.
+	if err := a.AddPolicyCtx(ctx, "p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Errorf("got %v, wants no error", err)
+	}
+	if _, err := a.PurgeNamespace(ctx, ""); !errors.Is(err, ErrInvalidFilter) {
+		t.Errorf("got %v, wants %v", err, ErrInvalidFilter)
+	}
+}
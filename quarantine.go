@@ -0,0 +1,283 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/api/iterator"
+)
+
+// quarantineKindSuffix is appended to the configured kind to name the kind
+// of the quarantined rules, e.g. "casbin_quarantine".
+const quarantineKindSuffix = "_quarantine"
+
+// QuarantinedRule is a rule moved out of the policy because it is invalid or
+// malformed, so that operators can inspect and repair it; see
+// ListQuarantinedRules and RestoreQuarantinedRule.
+//
+// Quarantined rules are root entities, like the audit entries. Each of them
+// is written in the same transaction as the deletion of the rule.
+type QuarantinedRule struct {
+	// Key is the key the rule was stored under.
+	Key *datastore.Key `datastore:"key,noindex"`
+	// PType and Rule are those of the rule, with its values encoded by
+	// Config.Codec, if any, as they were stored.
+	PType string   `datastore:"p_type"`
+	Rule  []string `datastore:"rule,noindex"`
+	// Reason is the error the rule was quarantined for.
+	Reason string `datastore:"reason,noindex"`
+	// Actor is the actor of the operation which quarantined the rule; see
+	// WithActor.
+	Actor string `datastore:"actor,noindex"`
+	// Timestamp is the time the rule was quarantined.
+	Timestamp time.Time `datastore:"timestamp"`
+}
+
+type quarantineKey struct{}
+
+// WithQuarantine returns a context which makes ValidatePolicies move the
+// rules it finds invalid to the quarantine kind; see QuarantinedRule.
+func WithQuarantine(ctx context.Context) context.Context {
+	return context.WithValue(ctx, quarantineKey{}, true)
+}
+
+// quarantining reports whether ctx has been returned by WithQuarantine.
+func quarantining(ctx context.Context) bool {
+	q, _ := ctx.Value(quarantineKey{}).(bool)
+	return q
+}
+
+func (a *Adapter) quarantineKind() string {
+	return a.kind + quarantineKindSuffix
+}
+
+// malformedRule is a stored rule which can't be loaded.
+type malformedRule struct {
+	key *datastore.Key
+	// stored is the rule with its values as they were stored.
+	stored CasbinRule
+	err    error
+}
+
+// malformedRules collects the malformed rules the reads of an operation
+// come across, once each, since a page may be read again.
+type malformedRules struct {
+	mu    sync.Mutex
+	seen  map[string]bool
+	rules []malformedRule
+}
+
+type malformedKey struct{}
+
+// withMalformed returns a context which makes the reads run with it skip the
+// malformed rules, collecting them into m, instead of failing.
+func withMalformed(ctx context.Context, m *malformedRules) context.Context {
+	return context.WithValue(ctx, malformedKey{}, m)
+}
+
+// malformed returns the malformedRules of ctx, or nil.
+func malformed(ctx context.Context) *malformedRules {
+	m, _ := ctx.Value(malformedKey{}).(*malformedRules)
+	return m
+}
+
+func (m *malformedRules) add(key *datastore.Key, stored CasbinRule, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.seen == nil {
+		m.seen = make(map[string]bool)
+	}
+	if !m.seen[key.String()] {
+		m.seen[key.String()] = true
+		m.rules = append(m.rules, malformedRule{key: key, stored: stored, err: err})
+	}
+}
+
+// merge adds the rules of other to m.
+func (m *malformedRules) merge(other *malformedRules) {
+	for _, r := range other.rules {
+		m.add(r.key, r.stored, r.err)
+	}
+}
+
+// fieldMismatch reports whether err, returned by a read of an entity, tells
+// that the entity doesn't fit CasbinRule.
+func fieldMismatch(err error) bool {
+	var mismatch *datastore.ErrFieldMismatch
+	return errors.As(err, &mismatch)
+}
+
+// decodePage decodes the values of rules, stored under keys, in place. If ctx
+// collects the malformed rules, those which fail to decode are collected and
+// dropped, instead of failing the page.
+func (a *Adapter) decodePage(ctx context.Context, keys []*datastore.Key, rules []CasbinRule) ([]*datastore.Key, []CasbinRule, error) {
+	m := malformed(ctx)
+	if m == nil || len(a.codecs) == 0 {
+		return keys, rules, a.decodeRules(ctx, rules)
+	}
+	var decodedKeys []*datastore.Key
+	var decoded []CasbinRule
+	for i, rule := range rules {
+		stored := rule
+		stored.Extra = append([]string(nil), rule.Extra...)
+		if err := a.decodeRule(ctx, &rule); err != nil {
+			m.add(keys[i], stored, err)
+			continue
+		}
+		decodedKeys = append(decodedKeys, keys[i])
+		decoded = append(decoded, rule)
+	}
+	return decodedKeys, decoded, nil
+}
+
+// collectMalformed returns a context which makes the reads run with it
+// collect the malformed rules into the returned malformedRules, if
+// Config.QuarantineMalformed is set, or ctx and nil.
+func (a *Adapter) collectMalformed(ctx context.Context) (context.Context, *malformedRules) {
+	if !a.quarantineMalformed {
+		return ctx, nil
+	}
+	m := &malformedRules{}
+	return withMalformed(ctx, m), m
+}
+
+// flushMalformed moves the rules of m, if not nil, to the quarantine kind,
+// unless the adapter is read-only.
+func (a *Adapter) flushMalformed(ctx context.Context, m *malformedRules) error {
+	if m == nil || a.readOnly || len(m.rules) == 0 {
+		return nil
+	}
+	entries := make([]*QuarantinedRule, len(m.rules))
+	for i, r := range m.rules {
+		entries[i] = a.newQuarantinedRule(ctx, r.key, r.stored, r.err)
+	}
+	return a.quarantine(ctx, entries)
+}
+
+// newQuarantinedRule returns the QuarantinedRule of stored, whose values are
+// as they were stored under key, for reason.
+func (a *Adapter) newQuarantinedRule(ctx context.Context, key *datastore.Key, stored CasbinRule, reason error) *QuarantinedRule {
+	return &QuarantinedRule{
+		Key:       key,
+		PType:     stored.PType,
+		Rule:      ruleValues(stored),
+		Reason:    reason.Error(),
+		Actor:     ActorFromContext(ctx),
+		Timestamp: a.now(),
+	}
+}
+
+// quarantine deletes the rules of entries and writes entries, in
+// transactions of up to half maxRuleMutations rules.
+func (a *Adapter) quarantine(ctx context.Context, entries []*QuarantinedRule) error {
+	keys := make([]*datastore.Key, len(entries))
+	for i, q := range entries {
+		keys[i] = q.Key
+	}
+	if record := dryRun(ctx); record != nil {
+		recordDeletes(record, MutationDelete, keys)
+		return nil
+	}
+
+	a.audit(ctx, AuditEntry{})
+	const batch = maxRuleMutations / 2
+	for start := 0; start < len(entries); start += batch {
+		end := start + batch
+		if end > len(entries) {
+			end = len(entries)
+		}
+
+		qkeys := make([]*datastore.Key, end-start)
+		for i := range qkeys {
+			qkeys[i] = a.newKey(a.quarantineKind(), nil)
+		}
+		err := a.mutate(ctx, false, end-start, func(tx *datastore.Transaction) error {
+			if err := tx.DeleteMulti(keys[start:end]); err != nil {
+				return err
+			}
+			_, err := tx.PutMulti(qkeys, entries[start:end])
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListQuarantinedRules calls fn with the key and the content of each
+// quarantined rule, in order of the time they were quarantined. It stops at
+// the first error fn returns.
+func (a *Adapter) ListQuarantinedRules(ctx context.Context, fn func(*datastore.Key, QuarantinedRule) error) error {
+	return a.do(ctx, "ListQuarantinedRules", func(ctx context.Context) error {
+		query := datastore.NewQuery(a.quarantineKind()).
+			Namespace(a.namespace).
+			Order("timestamp")
+
+		it := a.db.Run(ctx, query)
+		for {
+			var q QuarantinedRule
+			key, err := it.Next(&q)
+			if err == iterator.Done {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := fn(key, q); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// RestoreQuarantinedRule moves the quarantined rule stored under key back to
+// the key it was quarantined from, e.g. once the model defines its ptype. The
+// rule is written with the values it was quarantined with; to repair them,
+// add the repaired rule and delete the quarantined one with
+// DeleteQuarantinedRule instead.
+func (a *Adapter) RestoreQuarantinedRule(ctx context.Context, key *datastore.Key) error {
+	return a.do(ctx, "RestoreQuarantinedRule", func(ctx context.Context) error {
+		if a.readOnly {
+			return ErrReadOnly
+		}
+		var q QuarantinedRule
+		if err := a.db.Get(ctx, key, &q); err != nil {
+			return err
+		}
+		line := savePolicyLine(q.PType, q.Rule)
+		stampRule(ctx, &line, a.now())
+		a.audit(ctx, AuditEntry{PType: q.PType, Rule: q.Rule, stored: true})
+		if record := dryRun(ctx); record != nil {
+			recordPuts(record, []interface{}{&line})
+			return nil
+		}
+
+		keys, entities, err := a.indexedEntities(ctx, []*datastore.Key{q.Key}, []interface{}{&line})
+		if err != nil {
+			return err
+		}
+		return a.mutate(ctx, false, 1, func(tx *datastore.Transaction) error {
+			if err := tx.Delete(key); err != nil {
+				return err
+			}
+			_, err := tx.PutMulti(keys, entities)
+			return err
+		})
+	})
+}
+
+// DeleteQuarantinedRule deletes the quarantined rule stored under key.
+func (a *Adapter) DeleteQuarantinedRule(ctx context.Context, key *datastore.Key) error {
+	return a.do(ctx, "DeleteQuarantinedRule", func(ctx context.Context) error {
+		if a.readOnly {
+			return ErrReadOnly
+		}
+		return a.limited(ctx, func() error {
+			return a.db.Delete(ctx, key)
+		})
+	})
+}
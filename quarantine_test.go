@@ -0,0 +1,140 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2/model"
+)
+
+func TestQuarantineMalformed(t *testing.T) {
+	config := Config{Kind: "casbin_test_quarantine", Namespace: "unittest"}
+	initPolicy(t, config)
+	db := getDatastore()
+	a := NewAdapterWithConfig(db, config)
+	ctx := context.Background()
+
+	// An entity which doesn't fit CasbinRule, and a rule whose ptype the
+	// model doesn't define.
+	line := NewCasbinRule("p", []string{"mallory", "data1", "read"})
+	malformed := &datastore.PropertyList{
+		{Name: "p_type", Value: "p"},
+		{Name: "v0", Value: "mallory"},
+		{Name: "bogus", Value: int64(1)},
+	}
+	if _, err := db.Put(ctx, a.newRuleKey(&line), malformed); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.AddPolicyCtx(ctx, "p", "p2", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	load := func(a *Adapter, ctx context.Context) (model.Model, error) {
+		m, err := model.NewModelFromFile("examples/rbac_model.conf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m, a.LoadPolicyCtx(ctx, m)
+	}
+	if _, err := load(a, ctx); err == nil {
+		t.Fatalf("got no error, wants the malformed entity to fail the load")
+	}
+
+	config.QuarantineMalformed = true
+	m, err := load(NewAdapterWithConfig(db, config), WithActor(ctx, "alice"))
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(m["p"]["p"].Policy) != 4 {
+		t.Errorf("got %v, wants the seed policy", m["p"]["p"].Policy)
+	}
+	if _, err := load(a, ctx); err != nil {
+		t.Fatalf("got %v, wants no error once quarantined", err)
+	}
+
+	list := func() map[string]*datastore.Key {
+		keys := make(map[string]*datastore.Key)
+		err := a.ListQuarantinedRules(ctx, func(key *datastore.Key, q QuarantinedRule) error {
+			if q.Key == nil || q.Reason == "" || q.Actor != "alice" {
+				t.Errorf("got %+v, wants the key, the reason and the actor", q)
+			}
+			keys[q.PType] = key
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+		return keys
+	}
+	quarantined := list()
+	if len(quarantined) != 2 || quarantined["p"] == nil || quarantined["p2"] == nil {
+		t.Fatalf("got %v, wants both rules quarantined", quarantined)
+	}
+
+	if err := a.RestoreQuarantinedRule(ctx, quarantined["p2"]); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	var skipped []PolicyViolation
+	if _, err := load(a, WithSkippedRules(ctx, func(v PolicyViolation) { skipped = append(skipped, v) })); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(skipped) != 1 || skipped[0].PType != "p2" || len(skipped[0].Rule) != 3 {
+		t.Errorf("got %+v, wants the restored rule", skipped)
+	}
+
+	if err := a.DeleteQuarantinedRule(ctx, quarantined["p"]); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.RestoreQuarantinedRule(ctx, quarantined["p"]); !errors.Is(err, ErrPolicyNotFound) {
+		t.Errorf("got %v, wants ErrPolicyNotFound", err)
+	}
+	if quarantined = list(); len(quarantined) != 0 {
+		t.Errorf("got %v, wants no quarantined rule left", quarantined)
+	}
+}
+
+func TestQuarantineMalformedAcrossPages(t *testing.T) {
+	config := Config{Kind: "casbin_test_quarantine_pages", Namespace: "unittest", PageSize: 2, QuarantineMalformed: true}
+	initPolicy(t, config)
+	db := getDatastore()
+	a := NewAdapterWithConfig(db, config)
+	ctx := context.Background()
+
+	// Auto-allocated IDs are far above 1, so the malformed entity comes
+	// first and leaves the first page with a single rule.
+	key := datastore.IDKey(a.kind, 1, a.rootKeyOf(a.kind))
+	key.Namespace = a.namespace
+	malformed := &datastore.PropertyList{
+		{Name: "p_type", Value: "p"},
+		{Name: "v0", Value: "mallory"},
+		{Name: "bogus", Value: int64(1)},
+	}
+	if _, err := db.Put(ctx, key, malformed); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	m, err := model.NewModelFromFile("examples/rbac_model.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.LoadPolicyCtx(ctx, m); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(m["p"]["p"].Policy) != 4 || len(m["g"]["g"].Policy) != 1 {
+		t.Errorf("got %v and %v, wants the whole seed policy", m["p"]["p"].Policy, m["g"]["g"].Policy)
+	}
+
+	var quarantined int
+	err = a.ListQuarantinedRules(ctx, func(key *datastore.Key, _ QuarantinedRule) error {
+		quarantined++
+		return a.DeleteQuarantinedRule(ctx, key)
+	})
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if quarantined != 1 {
+		t.Errorf("got %d quarantined rules, wants 1", quarantined)
+	}
+}
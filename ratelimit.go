@@ -0,0 +1,97 @@
+package datastoreadapter
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// rateLimiter throttles the datastore calls of the adapters sharing it; see
+// Config.RateLimit and Config.MaxConcurrentRPCs.
+type rateLimiter struct {
+	// rate is the number of calls per second, or 0 if unlimited.
+	rate  float64
+	burst float64
+	// slots holds a value per running call, or is nil if unlimited.
+	slots chan struct{}
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns the limiter configured by config, or nil if config
+// doesn't limit the calls.
+func newRateLimiter(config Config) *rateLimiter {
+	if config.RateLimit <= 0 && config.MaxConcurrentRPCs <= 0 {
+		return nil
+	}
+
+	l := &rateLimiter{}
+	if config.RateLimit > 0 {
+		l.rate = config.RateLimit
+		l.burst = float64(config.RateBurst)
+		if l.burst <= 0 {
+			l.burst = math.Max(1, math.Ceil(config.RateLimit))
+		}
+		l.tokens = l.burst
+		l.last = time.Now()
+	}
+	if config.MaxConcurrentRPCs > 0 {
+		l.slots = make(chan struct{}, config.MaxConcurrentRPCs)
+	}
+	return l
+}
+
+// acquire waits until a call is allowed and returns the function to call
+// once it has returned. It fails if ctx is done before then.
+func (l *rateLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	if l.rate > 0 {
+		if err := l.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if l.slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return func() { <-l.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// wait takes a token from the bucket, waiting for one to be added if it is
+// empty.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	// Taking the token ahead reserves it, so that the waiting calls are
+	// served in order.
+	l.tokens--
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
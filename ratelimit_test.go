@@ -0,0 +1,67 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+)
+
+func TestRateLimiter(t *testing.T) {
+	ctx := context.Background()
+
+	l := newRateLimiter(Config{RateLimit: 50, RateBurst: 1})
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		release, err := l.acquire(ctx)
+		if err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+		release()
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("got 6 calls in %v, wants them throttled to 50 per second", elapsed)
+	}
+
+	l = newRateLimiter(Config{MaxConcurrentRPCs: 1})
+	release, err := l.acquire(ctx)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(timeout); err != context.DeadlineExceeded {
+		t.Errorf("got %v, wants %v while the slot is taken", err, context.DeadlineExceeded)
+	}
+	release()
+	if release, err = l.acquire(ctx); err != nil {
+		t.Errorf("got %v, wants no error once the slot is released", err)
+	} else {
+		release()
+	}
+
+	if l := newRateLimiter(Config{}); l != nil {
+		t.Errorf("got a limiter, wants none by default")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	config := Config{Kind: "casbin_test_ratelimit", Namespace: "unittest", PageSize: 2, RateLimit: 100, RateBurst: 1, MaxConcurrentRPCs: 1}
+	initPolicy(t, config)
+
+	a := NewAdapterWithConfig(getDatastore(), config)
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	if _, err := e.AddPolicy("carol", "data3", "read"); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := e.SavePolicy(); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := e.LoadPolicy(); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"carol", "data3", "read"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+}
@@ -0,0 +1,93 @@
+package datastoreadapter
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+
+	"cloud.google.com/go/datastore"
+)
+
+// Reconcile makes the stored rules of the ptypes of desired match them, e.g.
+// the rules of a policy file managed in a repository and read with
+// ReadPolicyCSV, and returns the rules it added and removed. Only the rules
+// missing from the store are added and only the extra ones removed, so
+// reconciling an unchanged policy writes nothing. The rules of the ptypes
+// desired has no entry for are left as they are; map a ptype to no rule to
+// remove all of its rules.
+//
+// Soft deleted and expired rules are ignored, and the rules kept keep their
+// metadata. As with SyncPolicies, the changes are applied in batches, and
+// WithDryRun reports them without applying them.
+func (a *Adapter) Reconcile(ctx context.Context, desired map[string][][]string) (*PolicyDiff, error) {
+	var diff *PolicyDiff
+	err := a.do(ctx, "Reconcile", func(ctx context.Context) error {
+		if a.readOnly {
+			return ErrReadOnly
+		}
+
+		live, err := a.liveRuleSet(ctx)
+		if err != nil {
+			return err
+		}
+		stored := make(map[ruleID]*storedRule)
+		for id, s := range live {
+			if _, ok := desired[s.rule.PType]; ok {
+				stored[id] = s
+			}
+		}
+		target := make(map[ruleID]*storedRule)
+		now := a.now()
+		for ptype, rules := range desired {
+			for _, rule := range rules {
+				line := savePolicyLine(ptype, rule)
+				if s, ok := stored[ruleFields(line)]; ok {
+					line.ExpiresAt = s.rule.ExpiresAt
+				} else {
+					stampRule(ctx, &line, now)
+				}
+				target[ruleFields(line)] = &storedRule{rule: line}
+			}
+		}
+
+		d := diffRuleSets(stored, target)
+		diff = d.policyDiff()
+		var added []interface{}
+		for _, s := range d.added {
+			added = append(added, &s.rule)
+		}
+		var removed []*datastore.Key
+		for _, s := range d.removed {
+			removed = append(removed, s.keys...)
+		}
+		if len(added) == 0 && len(removed) == 0 {
+			return nil
+		}
+
+		defer a.lockRules()()
+		a.audit(ctx, AuditEntry{})
+		if _, err := a.removeRules(ctx, removed); err != nil {
+			return err
+		}
+		return a.putRules(ctx, false, added, nil)
+	})
+	return diff, err
+}
+
+// ReadPolicyCSV reads the rules of a policy file from r, in the format of
+// ImportPolicyCSV, by ptype, e.g. for Reconcile.
+func ReadPolicyCSV(r io.Reader) (map[string][][]string, error) {
+	rules := make(map[string][][]string)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line, ok, err := parsePolicyCSVLine(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if ok {
+			rules[line.PType] = append(rules[line.PType], ruleValues(line))
+		}
+	}
+	return rules, scanner.Err()
+}
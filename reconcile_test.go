@@ -0,0 +1,58 @@
+package datastoreadapter
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+)
+
+func TestReconcile(t *testing.T) {
+	config := Config{Kind: "casbin_test_reconcile", Namespace: "unittest"}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+	ctx := context.Background()
+
+	desired, err := ReadPolicyCSV(strings.NewReader(`
+# managed in the repository
+p, alice, data1, read
+p, bob, data2, write
+p, carol, data3, read
+`))
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	var mutations []Mutation
+	diff, err := a.Reconcile(WithDryRun(ctx, func(m Mutation) { mutations = append(mutations, m) }), desired)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	// The data2_admin rules are removed and carol's added, leaving the g
+	// rules alone.
+	if len(diff.Added) != 1 || len(diff.Removed) != 2 || len(mutations) != 3 {
+		t.Errorf("got %+v and %d mutations, wants 1 rule added and 2 removed", diff, len(mutations))
+	}
+
+	if _, err := a.Reconcile(ctx, desired); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"carol", "data3", "read"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+	if roles := e.GetGroupingPolicy(); len(roles) != 1 {
+		t.Errorf("got %v, wants the g rules kept", roles)
+	}
+
+	// Reconciling again writes nothing.
+	diff, err = a.Reconcile(ctx, desired)
+	if err != nil || len(diff.Added) != 0 || len(diff.Removed) != 0 {
+		t.Errorf("got %+v, %v, wants no change", diff, err)
+	}
+
+	if _, err := ReadPolicyCSV(strings.NewReader("p")); err == nil {
+		t.Error("got no error, wants the malformed line reported")
+	}
+}
@@ -0,0 +1,151 @@
+package datastoreadapter
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/datastore"
+)
+
+// RemapValues rewrites the column-th value of the stored rules of every
+// ptype, which is in mapping, to the value it maps to, e.g. to rename a
+// domain or to merge two roles; the values after V5 are counted as well. It
+// returns the number of rules rewritten, including those merged.
+//
+// The stored rules are scanned first, then the matching ones are rewritten
+// in transactions of up to half maxRuleMutations rules, or fewer along with
+// their reverse index entries, each of which deletes the old rules and
+// writes the new ones, preserving their metadata.
+// A rewritten rule which is already stored, as when merging roles, is only
+// deleted. The mapping is applied once, so that a mapping such as
+// {"a": "b", "b": "c"} rewrites "a" to "b", not to "c". On failure, the rules
+// of the batches committed so far stay rewritten.
+func (a *Adapter) RemapValues(ctx context.Context, column int, mapping map[string]string) (int, error) {
+	remapped := 0
+	err := a.do(ctx, "RemapValues", func(ctx context.Context) error {
+		if a.readOnly {
+			return ErrReadOnly
+		}
+		if column < 0 {
+			return fmt.Errorf("invalid column %d", column)
+		}
+		if len(mapping) == 0 {
+			return nil
+		}
+		defer a.lockRules()()
+
+		live, err := a.liveRuleSet(ctx)
+		if err != nil {
+			return err
+		}
+		var old []*storedRule
+		for _, s := range live {
+			values := ruleValues(s.rule)
+			if column >= len(values) {
+				continue
+			}
+			if _, ok := mapping[values[column]]; ok {
+				old = append(old, s)
+			}
+		}
+		if len(old) == 0 {
+			return nil
+		}
+
+		// A rewritten rule may already be stored, unless it is itself
+		// rewritten, as when swapping two values.
+		for _, s := range old {
+			delete(live, ruleFields(s.rule))
+		}
+
+		type remap struct {
+			keys []*datastore.Key
+			line *CasbinRule
+		}
+		remaps := make([]remap, len(old))
+		for i, s := range old {
+			values := ruleValues(s.rule)
+			values[column] = mapping[values[column]]
+			line := savePolicyLine(s.rule.PType, values)
+			line.CreatedAt = s.rule.CreatedAt
+			line.CreatedBy = s.rule.CreatedBy
+			line.ExpiresAt = s.rule.ExpiresAt
+			line.UpdatedAt = a.now()
+			id := ruleFields(line)
+			if _, ok := live[id]; ok {
+				remaps[i] = remap{keys: s.keys}
+				continue
+			}
+			live[id] = &storedRule{rule: line}
+			remaps[i] = remap{keys: s.keys, line: &line}
+		}
+
+		a.audit(ctx, AuditEntry{FieldIndex: column})
+		batch := maxRuleMutations / (1 + a.ruleWrites())
+		var keys []*datastore.Key
+		var lines []interface{}
+		pending := 0
+		flush := func() error {
+			if len(keys) == 0 {
+				return nil
+			}
+			if err := a.rewriteRules(ctx, keys, lines); err != nil {
+				return err
+			}
+			for _, line := range lines {
+				a.recordAdded(ctx, line.(*CasbinRule))
+			}
+			remapped += pending
+			keys, lines, pending = nil, nil, 0
+			return nil
+		}
+		for _, r := range remaps {
+			if len(keys)+len(r.keys) > batch || len(lines) >= batch {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+			keys = append(keys, r.keys...)
+			pending++
+			if r.line != nil {
+				lines = append(lines, r.line)
+			}
+		}
+		return flush()
+	})
+	return remapped, err
+}
+
+// rewriteRules deletes the rules stored under keys and writes lines, which
+// are not encoded, in a transaction.
+func (a *Adapter) rewriteRules(ctx context.Context, keys []*datastore.Key, lines []interface{}) error {
+	if record := dryRun(ctx); record != nil {
+		kind := MutationDelete
+		if a.softDelete {
+			kind = MutationSoftDelete
+		}
+		recordDeletes(record, kind, keys)
+		recordPuts(record, lines)
+		return nil
+	}
+
+	encoded, err := a.encodeRules(ctx, lines)
+	if err != nil {
+		return err
+	}
+	newKeys := make([]*datastore.Key, len(encoded))
+	for i := range newKeys {
+		newKeys[i] = a.newRuleKey(encoded[i].(*CasbinRule))
+	}
+	newKeys, entities, err := a.indexedEntities(ctx, newKeys, encoded)
+	if err != nil {
+		return err
+	}
+	return a.mutate(ctx, false, len(keys)+len(encoded), func(tx *datastore.Transaction) error {
+		if err := a.deleteInTransaction(ctx, tx, keys); err != nil {
+			return err
+		}
+		_, err := tx.PutMulti(newKeys, entities)
+		return err
+	})
+}
@@ -0,0 +1,56 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRemapValues(t *testing.T) {
+	config := Config{Kind: "casbin_test_remap", Namespace: "unittest"}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+	ctx := context.Background()
+
+	// Rename the role in the p rules, then in the g rule.
+	n, err := a.RemapValues(ctx, 0, map[string]string{"data2_admin": "admin"})
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if n != 2 {
+		t.Errorf("got %d, wants 2 rules rewritten", n)
+	}
+	if n, err = a.RemapValues(ctx, 1, map[string]string{"data2_admin": "admin"}); err != nil || n != 1 {
+		t.Fatalf("got %d, %v, wants 1 rule rewritten", n, err)
+	}
+
+	// Merge a role into admin, and swap two objects.
+	if err := a.AddPolicyCtx(ctx, "p", "p", []string{"ops", "data2", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if n, err = a.RemapValues(ctx, 0, map[string]string{"ops": "admin"}); err != nil || n != 1 {
+		t.Fatalf("got %d, %v, wants 1 rule merged", n, err)
+	}
+	if n, err = a.RemapValues(ctx, 1, map[string]string{"data1": "data2", "data2": "data1"}); err != nil || n != 4 {
+		t.Fatalf("got %d, %v, wants 4 rules rewritten", n, err)
+	}
+
+	rules := storedRules(t, a)
+	wants := [][]string{
+		{"p", "alice", "data2", "read"},
+		{"p", "bob", "data1", "write"},
+		{"p", "admin", "data1", "read"},
+		{"p", "admin", "data1", "write"},
+		{"g", "alice", "admin"},
+	}
+	if len(rules) != len(wants) {
+		t.Errorf("got %d rules, wants %d", len(rules), len(wants))
+	}
+	for _, w := range wants {
+		rule, ok := rules[ruleFields(savePolicyLine(w[0], w[1:]))]
+		if !ok {
+			t.Errorf("got no %v, wants it stored", w)
+		} else if rule.CreatedAt.IsZero() {
+			t.Errorf("got %+v, wants its metadata preserved", rule)
+		}
+	}
+}
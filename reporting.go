@@ -0,0 +1,72 @@
+package datastoreadapter
+
+import (
+	"context"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+)
+
+// ReportingAdapter wraps an Adapter and returns whether its mutations changed
+// the stored rules along with their errors, as newer casbin adapters do, so
+// that the bookkeeping of the enforcer can tell a rule which was not stored,
+// or already stored, from a failure:
+//
+//	r := datastoreadapter.NewReportingAdapter(a)
+//	removed, err := r.RemovePolicy("p", "p", []string{"alice", "data1", "read"})
+//
+// It doesn't implement persist.Adapter of the casbin version this module
+// depends on, whose methods only return errors; use the Adapter for it.
+type ReportingAdapter struct {
+	adapter *Adapter
+}
+
+// NewReportingAdapter is the constructor for ReportingAdapter.
+func NewReportingAdapter(a *Adapter) *ReportingAdapter {
+	return &ReportingAdapter{adapter: a}
+}
+
+func (r *ReportingAdapter) LoadPolicy(model model.Model) error {
+	return r.adapter.LoadPolicy(model)
+}
+
+func (r *ReportingAdapter) SavePolicy(model model.Model) error {
+	return r.adapter.SavePolicy(model)
+}
+
+func (r *ReportingAdapter) AddPolicy(sec string, ptype string, rule []string) (bool, error) {
+	return r.AddPolicyCtx(context.Background(), sec, ptype, rule)
+}
+
+// AddPolicyCtx is the same as Adapter.AddPolicyCtx but reports whether the
+// rule was stored, which it is not if it was already stored and
+// Config.Deduplicate is set.
+func (r *ReportingAdapter) AddPolicyCtx(ctx context.Context, sec string, ptype string, rule []string) (bool, error) {
+	added := false
+	err := r.adapter.do(ctx, "AddPolicy", func(ctx context.Context) error {
+		var err error
+		added, err = r.adapter.addPolicy(ctx, ptype, rule, time.Time{})
+		return err
+	})
+	return added, err
+}
+
+func (r *ReportingAdapter) RemovePolicy(sec string, ptype string, rule []string) (bool, error) {
+	return r.RemovePolicyCtx(context.Background(), sec, ptype, rule)
+}
+
+// RemovePolicyCtx is the same as Adapter.RemovePolicyExisted.
+func (r *ReportingAdapter) RemovePolicyCtx(ctx context.Context, sec string, ptype string, rule []string) (bool, error) {
+	return r.adapter.RemovePolicyExisted(ctx, sec, ptype, rule)
+}
+
+func (r *ReportingAdapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) (bool, error) {
+	return r.RemoveFilteredPolicyCtx(context.Background(), sec, ptype, fieldIndex, fieldValues...)
+}
+
+// RemoveFilteredPolicyCtx is the same as Adapter.RemoveFilteredPolicyCtx but
+// reports whether any rule was removed.
+func (r *ReportingAdapter) RemoveFilteredPolicyCtx(ctx context.Context, sec string, ptype string, fieldIndex int, fieldValues ...string) (bool, error) {
+	n, err := r.adapter.removeFilteredPolicy(ctx, ptype, fieldIndex, fieldValues...)
+	return n > 0, err
+}
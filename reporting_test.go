@@ -0,0 +1,36 @@
+package datastoreadapter
+
+import (
+	"testing"
+)
+
+func TestReportingAdapter(t *testing.T) {
+	config := Config{Kind: "casbin_test_reporting", Namespace: "unittest", Deduplicate: true, SoftDelete: true}
+	initPolicy(t, config)
+	r := NewReportingAdapter(NewAdapterWithConfig(getDatastore(), config))
+
+	check := func(name string, changed bool, err error, wants bool) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%s: got %v, wants no error", name, err)
+		}
+		if changed != wants {
+			t.Errorf("%s: got %v, wants %v", name, changed, wants)
+		}
+	}
+
+	changed, err := r.AddPolicy("p", "p", []string{"carol", "data3", "read"})
+	check("AddPolicy", changed, err, true)
+	changed, err = r.AddPolicy("p", "p", []string{"carol", "data3", "read"})
+	check("AddPolicy of a stored rule", changed, err, false)
+
+	changed, err = r.RemovePolicy("p", "p", []string{"carol", "data3", "read"})
+	check("RemovePolicy", changed, err, true)
+	changed, err = r.RemovePolicy("p", "p", []string{"carol", "data3", "read"})
+	check("RemovePolicy of a removed rule", changed, err, false)
+
+	changed, err = r.RemoveFilteredPolicy("p", "p", 0, "data2_admin")
+	check("RemoveFilteredPolicy", changed, err, true)
+	changed, err = r.RemoveFilteredPolicy("p", "p", 0, "data2_admin")
+	check("RemoveFilteredPolicy of removed rules", changed, err, false)
+}
@@ -0,0 +1,338 @@
+package datastoreadapter
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+)
+
+// reverseIndexKindSuffix is appended to the configured kind to name the kind
+// of the entries of Config.ReverseIndex, e.g. "casbin_reverse".
+const reverseIndexKindSuffix = "_reverse"
+
+// reverseIndexColumns is the number of values of each rule, from the first
+// one, the reverse index keys it by: its subject and its object.
+const reverseIndexColumns = 2
+
+// reverseIndexEntry is an entry of Config.ReverseIndex. It descends from the
+// same root as the rule it refers to, so that both are written in the same
+// transaction, and is named after the column, the value as stored, and the
+// encoded key of the rule, so that the entries of a value are next to each
+// other. The entries of the removed rules are left behind until a load comes
+// across them or RebuildReverseIndex runs.
+type reverseIndexEntry struct {
+	PType string `datastore:"p_type,noindex"`
+}
+
+func (a *Adapter) reverseIndexKind() string {
+	return a.kind + reverseIndexKindSuffix
+}
+
+// ruleWrites returns the number of entities written for each rule: the rule
+// and, if Config.ReverseIndex is set, its reverse index entries.
+func (a *Adapter) ruleWrites() int {
+	if a.reverseIndex {
+		return 1 + reverseIndexColumns
+	}
+	return 1
+}
+
+// reverseIndexPrefix returns the prefix of the names of the reverse index
+// entries of the rules whose column-th value is stored as value.
+func reverseIndexPrefix(column int, value string) string {
+	return strconv.Itoa(column) + ":" + value + "\x00"
+}
+
+// reverseIndexKey returns the key of the reverse index entry named name,
+// descending from root.
+func (a *Adapter) reverseIndexKey(name string, root *datastore.Key) *datastore.Key {
+	key := datastore.NameKey(a.reverseIndexKind(), name, root)
+	key.Namespace = a.namespace
+	return key
+}
+
+// indexedEntities returns the keys and the entities to write lines, which are
+// encoded *CasbinRule, under keys with: those of the rules, followed by their
+// reverse index entries if Config.ReverseIndex is set, in which case the
+// incomplete keys are completed first.
+func (a *Adapter) indexedEntities(ctx context.Context, keys []*datastore.Key, lines []interface{}) ([]*datastore.Key, []interface{}, error) {
+	entities := a.entities(lines)
+	if !a.reverseIndex {
+		return keys, entities, nil
+	}
+
+	var incomplete []*datastore.Key
+	var positions []int
+	for i, key := range keys {
+		if key.Incomplete() {
+			incomplete = append(incomplete, key)
+			positions = append(positions, i)
+		}
+	}
+	if len(incomplete) > 0 {
+		err := a.limited(ctx, func() error {
+			var err error
+			incomplete, err = a.db.AllocateIDs(ctx, incomplete)
+			return err
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		keys = append([]*datastore.Key(nil), keys...)
+		for i, key := range incomplete {
+			keys[positions[i]] = key
+		}
+	}
+
+	indexKeys, entries := a.reverseIndexEntries(keys, lines)
+	return append(keys, indexKeys...), append(entities, entries...), nil
+}
+
+// reverseIndexEntries returns the keys and the reverse index entries of lines,
+// which are encoded *CasbinRule, stored under keys, which are complete.
+func (a *Adapter) reverseIndexEntries(keys []*datastore.Key, lines []interface{}) ([]*datastore.Key, []interface{}) {
+	var indexKeys []*datastore.Key
+	var entries []interface{}
+	for i, line := range lines {
+		line := line.(*CasbinRule)
+		values := line.values()
+		for column := 0; column < reverseIndexColumns; column++ {
+			if *values[column] == "" {
+				continue
+			}
+			name := reverseIndexPrefix(column, *values[column]) + keys[i].Encode()
+			indexKeys = append(indexKeys, a.reverseIndexKey(name, keys[i].Parent))
+			entries = append(entries, &reverseIndexEntry{PType: line.PType})
+		}
+	}
+	return indexKeys, entries
+}
+
+// reverseIndexColumn returns the column by which the reverse index serves f,
+// the first of the subject and the object f matches exactly, or -1 if
+// Config.ReverseIndex is not set or f matches neither.
+func (a *Adapter) reverseIndexColumn(f Filter) int {
+	if !a.reverseIndex || f.IgnoreCase {
+		return -1
+	}
+	for i, value := range f.FieldValues {
+		column := f.FieldIndex + i
+		if column < 0 || column >= reverseIndexColumns || value == "" || value == MatchEmpty {
+			continue
+		}
+		if f.Prefix && i == len(f.FieldValues)-1 {
+			continue
+		}
+		return column
+	}
+	return -1
+}
+
+// paginateReverseIndex reads the rules of f.PType whose column-th value is the
+// one f matches through the reverse index, and passes fn those matching f
+// along with their keys, in pages of at most a.pageSize rules. It deletes the
+// entries of the rules which are no longer stored, unless the adapter is
+// read-only.
+func (a *Adapter) paginateReverseIndex(ctx context.Context, f Filter, column int, match func(CasbinRule) bool, fn pageFunc) error {
+	value, err := a.encodeValue(ctx, f.PType, column, f.FieldValues[column-f.FieldIndex])
+	if err != nil {
+		return err
+	}
+	prefix := reverseIndexPrefix(column, value)
+	// The names of the entries of value are those starting with prefix,
+	// which ends with "\x00".
+	end := prefix[:len(prefix)-1] + "\x01"
+	tx := readTransaction(ctx)
+
+	var stale []*datastore.Key
+	for _, kind := range a.ptypeKinds(f.PType) {
+		root := a.rootKeyOf(kind)
+		query := datastore.NewQuery(a.reverseIndexKind()).
+			Namespace(a.namespace).
+			Ancestor(root).
+			Filter("__key__ >=", a.reverseIndexKey(prefix, root)).
+			Filter("__key__ <", a.reverseIndexKey(end, root))
+		if tx != nil {
+			query = query.Transaction(tx)
+		}
+		var entries []reverseIndexEntry
+		var indexKeys []*datastore.Key
+		err := a.limited(ctx, func() error {
+			var err error
+			indexKeys, err = a.db.GetAll(ctx, query, &entries)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		operationFromContext(ctx).read(len(indexKeys))
+
+		var keys, ruleIndexKeys []*datastore.Key
+		for i, key := range indexKeys {
+			if entries[i].PType != f.PType {
+				continue
+			}
+			ruleKey, err := datastore.DecodeKey(strings.TrimPrefix(key.Name, prefix))
+			if err != nil {
+				return err
+			}
+			keys = append(keys, ruleKey)
+			ruleIndexKeys = append(ruleIndexKeys, key)
+		}
+
+		for start := 0; start < len(keys); start += a.pageSize {
+			end := start + a.pageSize
+			if end > len(keys) {
+				end = len(keys)
+			}
+			page, rules, missing, err := a.getIndexedRules(ctx, tx, keys[start:end])
+			if err != nil {
+				return err
+			}
+			for _, i := range missing {
+				stale = append(stale, ruleIndexKeys[start+i])
+			}
+			var matched []*datastore.Key
+			var matching []CasbinRule
+			for i, rule := range rules {
+				if rule.PType == f.PType && match(rule) {
+					matched = append(matched, page[i])
+					matching = append(matching, rule)
+				}
+			}
+			if len(matched) == 0 {
+				continue
+			}
+			if err := fn(matched, matching); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(stale) == 0 || a.readOnly || dryRun(ctx) != nil {
+		return nil
+	}
+	err = a.limited(ctx, func() error {
+		return a.db.DeleteMulti(ctx, stale)
+	})
+	if err != nil {
+		operationFromContext(ctx).warn(err)
+	}
+	return nil
+}
+
+// getIndexedRules gets the rules of keys, in tx if not nil, and returns those
+// which are stored, decoded, along with their keys and the positions in keys
+// of those which are not.
+func (a *Adapter) getIndexedRules(ctx context.Context, tx *datastore.Transaction, keys []*datastore.Key) ([]*datastore.Key, []CasbinRule, []int, error) {
+	get := func(keys []*datastore.Key, dst interface{}) error {
+		return a.db.GetMulti(ctx, keys, dst)
+	}
+	if tx != nil {
+		get = tx.GetMulti
+	}
+	var rules []CasbinRule
+	err := a.limited(ctx, func() error {
+		var err error
+		rules, err = a.getRules(get, keys)
+		return err
+	})
+	operationFromContext(ctx).read(len(keys))
+
+	var found []*datastore.Key
+	var stored []CasbinRule
+	var missing []int
+	errs, _ := err.(datastore.MultiError)
+	if err != nil && errs == nil {
+		return nil, nil, nil, err
+	}
+	for i := range keys {
+		if errs != nil && errs[i] != nil {
+			if errs[i] != datastore.ErrNoSuchEntity {
+				return nil, nil, nil, errs[i]
+			}
+			missing = append(missing, i)
+			continue
+		}
+		found = append(found, keys[i])
+		stored = append(stored, rules[i])
+	}
+	found, stored, err = a.decodePage(ctx, found, stored)
+	return found, stored, missing, err
+}
+
+// RebuildReverseIndex deletes the entries of Config.ReverseIndex and, if it
+// is set, writes those of the stored rules again, e.g. once it has been set on
+// a stored policy, and returns the number of entries written. It is not
+// atomic: the rules added meanwhile are indexed, but those removed may be
+// indexed again, until a load comes across them.
+func (a *Adapter) RebuildReverseIndex(ctx context.Context) (int, error) {
+	written := 0
+	err := a.do(ctx, "RebuildReverseIndex", func(ctx context.Context) error {
+		if a.readOnly {
+			return ErrReadOnly
+		}
+
+		for _, kind := range a.ruleKinds() {
+			query := datastore.NewQuery(a.reverseIndexKind()).
+				Namespace(a.namespace).
+				Ancestor(a.rootKeyOf(kind)).
+				KeysOnly()
+			var keys []*datastore.Key
+			err := a.limited(ctx, func() error {
+				var err error
+				keys, err = a.db.GetAll(ctx, query, nil)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			for start := 0; start < len(keys); start += maxRuleMutations {
+				end := start + maxRuleMutations
+				if end > len(keys) {
+					end = len(keys)
+				}
+				err := a.limited(ctx, func() error {
+					return a.db.DeleteMulti(ctx, keys[start:end])
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if !a.reverseIndex {
+			return nil
+		}
+
+		_, err := a.paginateRules(ctx, false, "", func(keys []*datastore.Key, rules []CasbinRule) error {
+			lines := make([]interface{}, len(rules))
+			for i := range rules {
+				lines[i] = &rules[i]
+			}
+			lines, err := a.encodeRules(ctx, lines)
+			if err != nil {
+				return err
+			}
+			indexKeys, entries := a.reverseIndexEntries(keys, lines)
+			for start := 0; start < len(indexKeys); start += maxRuleMutations {
+				end := start + maxRuleMutations
+				if end > len(indexKeys) {
+					end = len(indexKeys)
+				}
+				err := a.limited(ctx, func() error {
+					_, err := a.db.PutMulti(ctx, indexKeys[start:end], entries[start:end])
+					return err
+				})
+				if err != nil {
+					return err
+				}
+				written += end - start
+			}
+			return nil
+		})
+		return err
+	})
+	return written, err
+}
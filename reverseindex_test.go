@@ -0,0 +1,89 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2/model"
+)
+
+func TestReverseIndex(t *testing.T) {
+	config := Config{Kind: "casbin_test_reverse_index", Namespace: "unittest"}
+	initPolicy(t, config)
+	db := getDatastore()
+	config.ReverseIndex = true
+	a := NewAdapterWithConfig(db, config)
+	ctx := context.Background()
+
+	load := func(f Filter) [][]string {
+		m, err := model.NewModelFromFile("examples/rbac_model.conf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := a.LoadFilteredPolicyCtx(ctx, m, f); err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+		return m["p"]["p"].Policy
+	}
+	entries := func() int {
+		keys, err := db.GetAll(ctx, datastore.NewQuery(a.reverseIndexKind()).Namespace(config.Namespace).KeysOnly(), nil)
+		if err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+		return len(keys)
+	}
+
+	// The seed policy was saved without the index.
+	if rules := load(Filter{PType: "p", FieldValues: []string{"alice"}}); len(rules) != 0 {
+		t.Errorf("got %v, wants nothing indexed yet", rules)
+	}
+	n, err := a.RebuildReverseIndex(ctx)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if n != 10 || entries() != 10 {
+		t.Errorf("got %d entries written, %d stored, wants 10", n, entries())
+	}
+	if rules := load(Filter{PType: "p", FieldValues: []string{"alice"}}); len(rules) != 1 || rules[0][1] != "data1" {
+		t.Errorf("got %v, wants the rule of alice", rules)
+	}
+
+	// The rules written from now on are indexed along with them.
+	if err := a.AddPolicyCtx(ctx, "p", "p", []string{"alice", "data2", "write"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if rules := load(Filter{PType: "p", FieldValues: []string{"alice"}}); len(rules) != 2 {
+		t.Errorf("got %v, wants both rules of alice", rules)
+	}
+	if rules := load(Filter{PType: "p", FieldIndex: 1, FieldValues: []string{"data2", "write"}}); len(rules) != 3 {
+		t.Errorf("got %v, wants the rules writing data2", rules)
+	}
+
+	// The entries of a removed rule are dropped by the loads coming across
+	// them.
+	if err := a.RemovePolicyCtx(ctx, "p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if rules := load(Filter{PType: "p", FieldValues: []string{"alice"}}); len(rules) != 1 || rules[0][1] != "data2" {
+		t.Errorf("got %v, wants the remaining rule of alice", rules)
+	}
+	if entries() != 11 {
+		t.Errorf("got %d entries, wants 11", entries())
+	}
+	if rules := load(Filter{PType: "p", FieldIndex: 1, FieldValues: []string{"data1"}}); len(rules) != 0 {
+		t.Errorf("got %v, wants no rule of data1", rules)
+	}
+	if entries() != 10 {
+		t.Errorf("got %d entries, wants 10", entries())
+	}
+
+	// Without the index, rebuilding drops the entries.
+	config.ReverseIndex = false
+	if n, err := NewAdapterWithConfig(db, config).RebuildReverseIndex(ctx); err != nil || n != 0 {
+		t.Fatalf("got %d, %v, wants no entry written", n, err)
+	}
+	if entries() != 0 {
+		t.Errorf("got %d entries, wants none", entries())
+	}
+}
@@ -0,0 +1,218 @@
+package datastoreadapter
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+)
+
+// RoleCycle is a cycle of role inheritance CheckRoleHierarchy finds.
+type RoleCycle struct {
+	// PType is the ptype of the g rules along the cycle, and Domain the
+	// values they have after the role, if any.
+	PType  string
+	Domain []string
+	// Roles are the roles along the cycle, each of which inherits the next
+	// one, while the last one inherits the first one.
+	Roles []string
+	// Closing is the rule by which the last role inherits the first one,
+	// which WithPrune removes to break the cycle.
+	Closing PolicyRule
+}
+
+// RoleHierarchyReport is the report of CheckRoleHierarchy.
+type RoleHierarchyReport struct {
+	// Cycles are the cycles of role inheritance.
+	Cycles []RoleCycle
+	// Dangling are the g rules granting a role which is neither granted
+	// anything by a p rule nor inherits another role, so that the grant
+	// has no effect.
+	Dangling []PolicyRule
+	// Removed is the number of rules WithPrune has removed.
+	Removed int
+}
+
+type pruneKey struct{}
+
+// WithPrune returns a context which makes CheckRoleHierarchy remove the
+// rules closing the cycles and the dangling ones it reports.
+func WithPrune(ctx context.Context) context.Context {
+	return context.WithValue(ctx, pruneKey{}, true)
+}
+
+// pruning reports whether ctx has been returned by WithPrune.
+func pruning(ctx context.Context) bool {
+	p, _ := ctx.Value(pruneKey{}).(bool)
+	return p
+}
+
+// roleEdge is a g rule by which a role, or a user, inherits the role to.
+type roleEdge struct {
+	to   string
+	rule *storedRule
+}
+
+// roleGraph is the inheritance between the roles of the g rules of a ptype
+// sharing the same domain.
+type roleGraph struct {
+	ptype  string
+	domain []string
+	edges  map[string][]roleEdge
+}
+
+// CheckRoleHierarchy analyzes the stored g rules, that is, the rules of the
+// ptypes starting with "g", for cycles of role inheritance and for dangling
+// roles, which are granted but neither granted anything by a p rule nor
+// inherit another role. The g rules with more than two values are analyzed
+// per domain, the values after the role. With WithPrune, it also removes the
+// rules closing the cycles and those granting the dangling roles. This may
+// leave roles dangling which only inherited another one along a cycle, which
+// the next check reports.
+func (a *Adapter) CheckRoleHierarchy(ctx context.Context) (*RoleHierarchyReport, error) {
+	report := &RoleHierarchyReport{}
+	err := a.do(ctx, "CheckRoleHierarchy", func(ctx context.Context) error {
+		if pruning(ctx) && a.readOnly {
+			return ErrReadOnly
+		}
+		live, err := a.liveRuleSet(ctx)
+		if err != nil {
+			return err
+		}
+
+		subjects := make(map[string]bool)
+		inherits := make(map[string]map[string]bool)
+		graphs := make(map[string]*roleGraph)
+		for _, s := range live {
+			values := ruleValues(s.rule)
+			if len(values) == 0 {
+				continue
+			}
+			switch {
+			case strings.HasPrefix(s.rule.PType, "p"):
+				subjects[values[0]] = true
+			case strings.HasPrefix(s.rule.PType, "g") && len(values) >= 2:
+				if inherits[s.rule.PType] == nil {
+					inherits[s.rule.PType] = make(map[string]bool)
+				}
+				inherits[s.rule.PType][values[0]] = true
+
+				id := s.rule.PType + "\x00" + strings.Join(values[2:], "\x00")
+				g, ok := graphs[id]
+				if !ok {
+					g = &roleGraph{ptype: s.rule.PType, domain: values[2:], edges: make(map[string][]roleEdge)}
+					graphs[id] = g
+				}
+				g.edges[values[0]] = append(g.edges[values[0]], roleEdge{to: values[1], rule: s})
+			}
+		}
+
+		var remove []*datastore.Key
+		ids := make([]string, 0, len(graphs))
+		for id := range graphs {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			for _, c := range graphs[id].cycles() {
+				report.Cycles = append(report.Cycles, c.RoleCycle)
+				remove = append(remove, c.keys...)
+			}
+		}
+
+		var dangling []*storedRule
+		for _, s := range live {
+			values := ruleValues(s.rule)
+			if strings.HasPrefix(s.rule.PType, "g") && len(values) >= 2 &&
+				!subjects[values[1]] && !inherits[s.rule.PType][values[1]] {
+				dangling = append(dangling, s)
+			}
+		}
+		sort.Slice(dangling, func(i, j int) bool {
+			return policyCSVLine(dangling[i].rule) < policyCSVLine(dangling[j].rule)
+		})
+		for _, s := range dangling {
+			report.Dangling = append(report.Dangling, newPolicyRule(s.rule))
+			remove = append(remove, s.keys...)
+		}
+
+		if !pruning(ctx) || len(remove) == 0 {
+			return nil
+		}
+		// A rule may both close a cycle and grant a dangling role.
+		seen := make(map[string]bool)
+		unique := remove[:0]
+		for _, key := range remove {
+			if !seen[key.String()] {
+				seen[key.String()] = true
+				unique = append(unique, key)
+			}
+		}
+		defer a.lockRules()()
+		a.audit(ctx, AuditEntry{})
+		report.Removed, err = a.removeRules(ctx, unique)
+		return err
+	})
+	return report, err
+}
+
+// foundCycle is a cycle along with the keys of its closing rule.
+type foundCycle struct {
+	RoleCycle
+	keys []*datastore.Key
+}
+
+// cycles returns the cycles of g, found by a depth-first search visiting the
+// roles in order. Each back edge closes a cycle, so the cycles sharing an
+// edge are reported once.
+func (g *roleGraph) cycles() []foundCycle {
+	roles := make([]string, 0, len(g.edges))
+	for role, edges := range g.edges {
+		roles = append(roles, role)
+		sort.Slice(edges, func(i, j int) bool { return edges[i].to < edges[j].to })
+	}
+	sort.Strings(roles)
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var path []string
+	var found []foundCycle
+	var visit func(role string)
+	visit = func(role string) {
+		state[role] = visiting
+		path = append(path, role)
+		for _, e := range g.edges[role] {
+			switch state[e.to] {
+			case unvisited:
+				visit(e.to)
+			case visiting:
+				start := len(path) - 1
+				for path[start] != e.to {
+					start--
+				}
+				found = append(found, foundCycle{
+					RoleCycle: RoleCycle{
+						PType:   g.ptype,
+						Domain:  g.domain,
+						Roles:   append([]string(nil), path[start:]...),
+						Closing: newPolicyRule(e.rule.rule),
+					},
+					keys: e.rule.keys,
+				})
+			}
+		}
+		path = path[:len(path)-1]
+		state[role] = visited
+	}
+	for _, role := range roles {
+		if state[role] == unvisited {
+			visit(role)
+		}
+	}
+	return found
+}
@@ -0,0 +1,65 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCheckRoleHierarchy(t *testing.T) {
+	config := Config{Kind: "casbin_test_roles", Namespace: "unittest"}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+	ctx := context.Background()
+
+	report, err := a.CheckRoleHierarchy(ctx)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(report.Cycles) != 0 || len(report.Dangling) != 0 {
+		t.Fatalf("got %+v, wants no issue in the seed policy", report)
+	}
+
+	for _, rule := range [][]string{{"data2_admin", "super"}, {"super", "data2_admin"}, {"bob", "ghost"}} {
+		if err := a.AddPolicyCtx(ctx, "g", "g", rule); err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+	}
+	// The same roles in a domain make no cycle with the others.
+	if err := a.AddPolicyCtx(ctx, "g", "g2", []string{"super", "data2_admin", "domain1"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	report, err = a.CheckRoleHierarchy(ctx)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(report.Cycles) != 1 {
+		t.Fatalf("got %+v, wants 1 cycle", report.Cycles)
+	}
+	c := report.Cycles[0]
+	if c.PType != "g" || len(c.Roles) != 2 || c.Roles[0] != "data2_admin" || c.Roles[1] != "super" || c.Closing.Rule[0] != "super" || c.Closing.Rule[1] != "data2_admin" {
+		t.Errorf("got %+v, wants the cycle of data2_admin and super", c)
+	}
+	if len(report.Dangling) != 1 || report.Dangling[0].Rule[1] != "ghost" {
+		t.Errorf("got %+v, wants the grant of ghost", report.Dangling)
+	}
+	if report.Removed != 0 {
+		t.Errorf("got %d, wants nothing removed", report.Removed)
+	}
+
+	report, err = a.CheckRoleHierarchy(WithPrune(ctx))
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if report.Removed != 2 {
+		t.Errorf("got %d, wants 2 rules removed", report.Removed)
+	}
+	// Once the cycle is broken, super inherits nothing any more.
+	report, err = a.CheckRoleHierarchy(ctx)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(report.Cycles) != 0 || len(report.Dangling) != 1 || report.Dangling[0].Rule[1] != "super" {
+		t.Errorf("got %+v, wants the grant of super", report)
+	}
+}
@@ -0,0 +1,73 @@
+package datastoreadapter
+
+import "sync"
+
+// ruleLocks serializes the writes of the same rule by an adapter; see
+// Config.SerializeWrites.
+type ruleLocks struct {
+	// all is held for reading by the writes of a single rule, and for
+	// writing by those of any number of rules, such as SavePolicy.
+	all sync.RWMutex
+
+	mu    sync.Mutex
+	rules map[ruleID]*ruleLock
+}
+
+// ruleLock is the lock of a rule, which is dropped once no write refers to
+// it anymore.
+type ruleLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lockRule locks the rule identified by id and returns the function which
+// unlocks it.
+func (l *ruleLocks) lockRule(id ruleID) func() {
+	l.all.RLock()
+
+	l.mu.Lock()
+	lock, ok := l.rules[id]
+	if !ok {
+		lock = &ruleLock{}
+		l.rules[id] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+
+		l.mu.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(l.rules, id)
+		}
+		l.mu.Unlock()
+
+		l.all.RUnlock()
+	}
+}
+
+// lockAll locks every rule and returns the function which unlocks them.
+func (l *ruleLocks) lockAll() func() {
+	l.all.Lock()
+	return l.all.Unlock
+}
+
+// lockRule locks the rule of ptype if Config.SerializeWrites is set, and
+// returns the function which unlocks it.
+func (a *Adapter) lockRule(ptype string, rule []string) func() {
+	if a.ruleLocks == nil {
+		return func() {}
+	}
+	return a.ruleLocks.lockRule(ruleFields(savePolicyLine(ptype, rule)))
+}
+
+// lockRules locks every rule if Config.SerializeWrites is set, and returns the
+// function which unlocks them.
+func (a *Adapter) lockRules() func() {
+	if a.ruleLocks == nil {
+		return func() {}
+	}
+	return a.ruleLocks.lockAll()
+}
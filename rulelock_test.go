@@ -0,0 +1,98 @@
+package datastoreadapter
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRuleLocks(t *testing.T) {
+	l := &ruleLocks{rules: make(map[ruleID]*ruleLock)}
+	alice := ruleFields(savePolicyLine("p", []string{"alice", "data1", "read"}))
+	bob := ruleFields(savePolicyLine("p", []string{"bob", "data2", "write"}))
+
+	// waits calls lock in a goroutine and reports whether it blocks, along
+	// with the channel receiving the unlock function once it returns.
+	waits := func(lock func() func()) (bool, chan func()) {
+		done := make(chan func(), 1)
+		go func() { done <- lock() }()
+		select {
+		case unlock := <-done:
+			done <- unlock
+			return false, done
+		case <-time.After(50 * time.Millisecond):
+			return true, done
+		}
+	}
+
+	unlockAlice := l.lockRule(alice)
+	blocked, done := waits(func() func() { return l.lockRule(alice) })
+	if !blocked {
+		t.Errorf("got the lock of a locked rule, wants to wait for it")
+	}
+	if blocked, bobDone := waits(func() func() { return l.lockRule(bob) }); blocked {
+		t.Errorf("waited for the lock of another rule, wants to get it")
+	} else {
+		(<-bobDone)()
+	}
+	unlockAlice()
+	(<-done)()
+
+	unlockAlice = l.lockRule(alice)
+	blocked, done = waits(l.lockAll)
+	if !blocked {
+		t.Errorf("got the lock of all rules while a rule is locked, wants to wait for it")
+	}
+	unlockAlice()
+	unlockAll := <-done
+	if blocked, bobDone := waits(func() func() { return l.lockRule(bob) }); !blocked {
+		t.Errorf("got the lock of a rule while all are locked, wants to wait for it")
+		(<-bobDone)()
+		unlockAll()
+	} else {
+		unlockAll()
+		(<-bobDone)()
+	}
+
+	if len(l.rules) != 0 {
+		t.Errorf("got %d rule locks, wants none left", len(l.rules))
+	}
+}
+
+func TestSerializeWrites(t *testing.T) {
+	config := Config{Kind: "casbin_test_serialize", Namespace: "unittest", SerializeWrites: true, Deduplicate: true}
+	initPolicy(t, config)
+	ctx := context.Background()
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	rule := []string{"carol", "data3", "read"}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if i%2 == 0 {
+				err = a.AddPolicyCtx(ctx, "p", "p", rule)
+			} else {
+				err = a.RemovePolicyCtx(ctx, "p", "p", rule)
+			}
+			if err != nil {
+				t.Errorf("got %v, wants no error", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	exists, err := a.ExistsPolicy(ctx, "p", rule)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.RemovePolicyCtx(ctx, "p", "p", rule); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if exists, err = a.ExistsPolicy(ctx, "p", rule); err != nil || exists {
+		t.Errorf("got %v, %v, wants no copy of the rule left", exists, err)
+	}
+}
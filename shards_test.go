@@ -0,0 +1,79 @@
+package datastoreadapter
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2"
+)
+
+func TestShards(t *testing.T) {
+	ctx := context.Background()
+	config := Config{Kind: "casbin_test_shards", Namespace: "unittest", Shards: 4, Deduplicate: true}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	var wants [][]string
+	for i := 0; i < 20; i++ {
+		rule := []string{fmt.Sprintf("user%d", i), "data3", "read"}
+		if err := a.AddPolicyCtx(ctx, "p", "p", rule); err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+		wants = append(wants, rule)
+	}
+
+	// The rules are spread over the shards, each of them in the one of its
+	// hash.
+	for _, kind := range a.shardKinds("casbin_test_shards") {
+		keys, err := a.db.GetAll(ctx, a.kindQuery(kind).KeysOnly(), nil)
+		if err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+		if len(keys) == 0 {
+			t.Errorf("got no rules in %s, wants some", kind)
+		}
+		var rules []CasbinRule
+		if _, err := a.db.GetAll(ctx, a.kindQuery(kind), &rules); err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+		for _, rule := range rules {
+			if shard := a.ruleShard(rule); shard != kind {
+				t.Errorf("got %v in %s, wants it in %s", rule.Rule(), kind, shard)
+			}
+		}
+	}
+
+	// Writes are routed to the shard of the rule.
+	if err := a.AddPolicyCtx(ctx, "p", "p", []string{"user3", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.RemovePolicyCtx(ctx, "p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	testGetPolicy(e, append([][]string{{"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, wants...), func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+
+	// The filtered loads fan out over the shards.
+	if err := e.LoadFilteredPolicy(&Filter{PType: "p", FieldIndex: 1, FieldValues: []string{"data3"}}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	testGetPolicy(e, wants, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+	if err := a.RemoveFilteredPolicyCtx(ctx, "p", "p", 1, "data3"); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	n := 0
+	_, err := a.paginateRules(ctx, true, "", func(keys []*datastore.Key, _ []CasbinRule) error {
+		n += len(keys)
+		return nil
+	})
+	if err != nil || n != 4 {
+		t.Errorf("got %d, %v, wants 4 rules", n, err)
+	}
+}
@@ -0,0 +1,70 @@
+package datastoreadapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SharedCache is a cache shared by the CachedAdapter instances of a fleet,
+// typically backed by Memorystore (Redis). It lets cold-starting instances
+// load the policy without scanning datastore.
+//
+// With Config.KeyEncrypter, the rule values of the snapshots are encrypted as
+// the stored ones are.
+//
+// Get must return a nil slice when key is not cached. A Redis backed
+// implementation could look like:
+//
+//	type redisCache struct{ *redis.Client }
+//
+//	func (c redisCache) Get(ctx context.Context, key string) ([]byte, error) {
+//		b, err := c.Client.Get(ctx, key).Bytes()
+//		if err == redis.Nil {
+//			return nil, nil
+//		}
+//		return b, err
+//	}
+//
+//	func (c redisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+//		return c.Client.Set(ctx, key, value, ttl).Err()
+//	}
+type SharedCache interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// defaultSharedTTL is how long snapshots are kept in the shared cache unless
+// configured otherwise. Snapshots of old policy versions are never read again,
+// so they must expire.
+const defaultSharedTTL = time.Hour
+
+// sharedSnapshotVersion is the version of the serialized snapshot format.
+// Bump it whenever the format changes, so instances running different
+// versions don't read each other's snapshots.
+const sharedSnapshotVersion = 1
+
+// sharedSnapshot is the serialized form of a snapshot in a SharedCache.
+type sharedSnapshot struct {
+	Version int          `json:"version"`
+	Rules   []CasbinRule `json:"rules"`
+}
+
+// sharedCacheKey returns the SharedCache key of the snapshot of the given
+// policy version of a.
+func sharedCacheKey(a *Adapter, version int64) string {
+	return fmt.Sprintf("casbin:%s:%s:v%d:%d", a.namespace, a.kind, sharedSnapshotVersion, version)
+}
+
+func encodeSharedSnapshot(rules []CasbinRule) ([]byte, error) {
+	return json.Marshal(sharedSnapshot{Version: sharedSnapshotVersion, Rules: rules})
+}
+
+func decodeSharedSnapshot(b []byte) ([]CasbinRule, bool) {
+	var s sharedSnapshot
+	if err := json.Unmarshal(b, &s); err != nil || s.Version != sharedSnapshotVersion {
+		return nil, false
+	}
+	return s.Rules, true
+}
@@ -0,0 +1,79 @@
+package datastoreadapter
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+)
+
+type mapCache struct {
+	mu   sync.Mutex
+	m    map[string][]byte
+	ttl  time.Duration
+	hits int
+}
+
+func (c *mapCache) Get(ctx context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.m[key]
+	if ok {
+		c.hits++
+	}
+	return b, nil
+}
+
+func (c *mapCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.m[key] = value
+	c.ttl = ttl
+	return nil
+}
+
+func TestSharedCache(t *testing.T) {
+	config := Config{Kind: "casbin_test", Namespace: "unittest"}
+	initPolicy(t, config)
+
+	shared := &mapCache{m: make(map[string][]byte)}
+	newEnforcer := func() *casbin.Enforcer {
+		cached := NewCachedAdapterWithConfig(NewAdapterWithConfig(getDatastore(), config), CacheConfig{Shared: shared})
+		e, _ := casbin.NewEnforcer("examples/rbac_model.conf", cached)
+		return e
+	}
+
+	// The first instance populates the shared cache.
+	newEnforcer()
+	if len(shared.m) != 1 || shared.hits != 0 {
+		t.Fatalf("got %d shared entries and %d hits, wants 1 and 0", len(shared.m), shared.hits)
+	}
+	// Snapshots expire even though no TTL is configured.
+	if shared.ttl != defaultSharedTTL {
+		t.Errorf("got ttl %v, wants %v", shared.ttl, defaultSharedTTL)
+	}
+
+	// A cold instance reads the snapshot from the shared cache.
+	e := newEnforcer()
+	if shared.hits != 1 {
+		t.Fatalf("got %d hits, wants 1", shared.hits)
+	}
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+
+	// A write bumps the policy version, so the snapshot is taken again.
+	a := NewAdapterWithConfig(getDatastore(), config)
+	if err := a.AddPolicy("p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	e = newEnforcer()
+	if len(shared.m) != 2 || shared.hits != 1 {
+		t.Fatalf("got %d shared entries and %d hits, wants 2 and 1", len(shared.m), shared.hits)
+	}
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"carol", "data3", "read"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+}
@@ -0,0 +1,313 @@
+package datastoreadapter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// policyAliasName is the key name of the entity holding the active slot of
+// Config.BlueGreen.
+const policyAliasName = "policy_alias"
+
+// defaultSlot is the slot the rules are stored in until Config.BlueGreen
+// switches to the other one, so that the stored policies need no migration.
+const defaultSlot = 1
+
+// policyAlias is the entity pointing at the slot the rules are read from and
+// written to. It belongs to the same entity group as the policy version, so
+// that both are updated in the same transaction.
+type policyAlias struct {
+	Slot       int64     `datastore:"slot,noindex"`
+	SwitchedAt time.Time `datastore:"switched_at,noindex"`
+	// Generation identifies the SavePolicy refilling the inactive slot, if
+	// any. Once it is set, the inactive slot no longer holds the policy
+	// RollbackPolicy would restore, until a SavePolicy switches to it.
+	Generation string `datastore:"generation,noindex"`
+}
+
+func (a *Adapter) policyAliasKey() *datastore.Key {
+	key := datastore.NameKey(a.kind, policyAliasName, a.pseudoRootKey())
+	key.Namespace = a.namespace
+	return key
+}
+
+// slotRootKey returns the key of the pseudo root entity the rules stored in
+// kind in slot descend from.
+func (a *Adapter) slotRootKey(kind string, slot int64) *datastore.Key {
+	key := datastore.IDKey(kind, slot, nil)
+	key.Namespace = a.namespace
+	return key
+}
+
+// activeSlot returns the slot the adapter last saw active.
+func (a *Adapter) activeSlot() int64 {
+	return atomic.LoadInt64(&a.slot)
+}
+
+func (a *Adapter) setSlot(slot int64) {
+	atomic.StoreInt64(&a.slot, slot)
+}
+
+// otherSlot returns the slot which is inactive while slot is active.
+func otherSlot(slot int64) int64 {
+	return 3 - slot
+}
+
+// aliasSlot returns the slot alias points at.
+func aliasSlot(alias policyAlias) int64 {
+	if alias.Slot == 0 {
+		return defaultSlot
+	}
+	return alias.Slot
+}
+
+// readSlot reads the active slot, so that the rules are read from and written
+// to it.
+func (a *Adapter) readSlot(ctx context.Context) error {
+	var alias policyAlias
+	var err error
+	if tx := readTransaction(ctx); tx != nil {
+		err = tx.Get(a.policyAliasKey(), &alias)
+	} else {
+		err = a.db.Get(ctx, a.policyAliasKey(), &alias)
+	}
+	if err != nil && err != datastore.ErrNoSuchEntity {
+		return err
+	}
+	a.setSlot(aliasSlot(alias))
+	return nil
+}
+
+// checkSlot fails with ErrConflict if the active slot is no longer the one
+// the adapter writes to, that is, if another writer has switched it since.
+func (a *Adapter) checkSlot(tx *datastore.Transaction) error {
+	var alias policyAlias
+	if err := tx.Get(a.policyAliasKey(), &alias); err != nil && err != datastore.ErrNoSuchEntity {
+		return err
+	}
+	if slot := aliasSlot(alias); slot != a.activeSlot() {
+		a.setSlot(slot)
+		return ErrConflict
+	}
+	return nil
+}
+
+// claimSlot stamps the alias with a new generation, claiming the inactive
+// slot for the SavePolicy refilling it, and returns the generation. It fails
+// with ErrConflict if from is no longer the active slot.
+func (a *Adapter) claimSlot(ctx context.Context, from int64) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	generation := hex.EncodeToString(b)
+
+	err := a.limited(ctx, func() error {
+		_, err := a.db.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+			var alias policyAlias
+			if err := tx.Get(a.policyAliasKey(), &alias); err != nil && err != datastore.ErrNoSuchEntity {
+				return err
+			}
+			if slot := aliasSlot(alias); slot != from {
+				a.setSlot(slot)
+				return ErrConflict
+			}
+			alias.Slot = from
+			alias.Generation = generation
+			_, err := tx.Put(a.policyAliasKey(), &alias)
+			return err
+		})
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return generation, nil
+}
+
+// checkGeneration fails with ErrConflict if the inactive slot is no longer
+// claimed by generation, that is, if another SavePolicy has claimed it since.
+func (a *Adapter) checkGeneration(tx *datastore.Transaction, generation string) error {
+	var alias policyAlias
+	if err := tx.Get(a.policyAliasKey(), &alias); err != nil && err != datastore.ErrNoSuchEntity {
+		return err
+	}
+	if alias.Generation != generation {
+		return ErrConflict
+	}
+	return nil
+}
+
+// slotWrite runs f, which writes to the inactive slot, in a transaction
+// which fails with ErrConflict unless the slot is still claimed by
+// generation, so that concurrent saves can't interleave their writes.
+func (a *Adapter) slotWrite(ctx context.Context, generation string, f func(tx *datastore.Transaction) error) error {
+	return a.limited(ctx, func() error {
+		_, err := a.db.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+			if err := a.checkGeneration(tx, generation); err != nil {
+				return err
+			}
+			return f(tx)
+		})
+		return err
+	})
+}
+
+// savePolicyToSlot replaces the stored rules with lines for Config.BlueGreen:
+// it claims the inactive slot, writes the rules to it, dropping what that
+// slot held, and then switches the active slot to it in a single
+// transaction, which fails with ErrConflict if the policy has been modified
+// since the adapter loaded it. Each write fails with ErrConflict as well once
+// another SavePolicy has claimed the slot. The rules of the slot it switches
+// from are kept for RollbackPolicy.
+//
+// If lock is not nil, its lease is extended before every batch.
+func (a *Adapter) savePolicyToSlot(ctx context.Context, lines []interface{}, lock *Lock) error {
+	from := a.activeSlot()
+	to := otherSlot(from)
+
+	generation, err := a.claimSlot(ctx, from)
+	if err != nil {
+		return err
+	}
+	for _, kind := range a.ruleKinds() {
+		_, err := a.paginate(ctx, a.slotQuery(kind, to), true, "", func(keys []*datastore.Key, _ []CasbinRule) error {
+			if err := lock.extend(ctx); err != nil {
+				return err
+			}
+			return a.slotWrite(ctx, generation, func(tx *datastore.Transaction) error {
+				return tx.DeleteMulti(keys)
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	stored := make(ruleMetadata)
+	_, err = a.paginateRules(ctx, false, "", func(_ []*datastore.Key, rules []CasbinRule) error {
+		stored.collect(rules)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	stored.stamp(ctx, lines, a.now())
+	lines, err = a.encodeRules(ctx, lines)
+	if err != nil {
+		return err
+	}
+
+	op := operationFromContext(ctx)
+	op.expect(PhaseWriting, len(lines))
+	batch := maxRuleMutations / a.ruleWrites()
+	for start := 0; start < len(lines); start += batch {
+		if err := lock.extend(ctx); err != nil {
+			return err
+		}
+
+		end := start + batch
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		keys := make([]*datastore.Key, end-start)
+		for i := range keys {
+			kind := a.ruleShard(*lines[start+i].(*CasbinRule))
+			keys[i] = a.newKey(kind, a.slotRootKey(kind, to))
+		}
+		keys, entities, err := a.indexedEntities(ctx, keys, lines[start:end])
+		if err != nil {
+			return err
+		}
+		err = a.slotWrite(ctx, generation, func(tx *datastore.Transaction) error {
+			_, err := tx.PutMulti(keys, entities)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		op.wrote(end - start)
+		op.advance(PhaseWriting, end-start)
+	}
+
+	// The rules of the slot switched from are no longer those LoadPolicyAt
+	// reads.
+	if err := a.markHardDelete(ctx); err != nil {
+		return err
+	}
+	err = a.mutate(ctx, true, 1, func(tx *datastore.Transaction) error {
+		if err := a.checkGeneration(tx, generation); err != nil {
+			return err
+		}
+		_, err := tx.Put(a.policyAliasKey(), &policyAlias{Slot: to, SwitchedAt: a.now()})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	a.setSlot(to)
+	return nil
+}
+
+// limited runs fn, which makes a datastore call, once the rate limiter
+// allows it.
+func (a *Adapter) limited(ctx context.Context, fn func() error) error {
+	release, err := a.limiter.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return fn()
+}
+
+// RollbackPolicy switches the active slot back to the one SavePolicy last
+// switched from, restoring the policy stored before it in a single write. It
+// requires Config.BlueGreen and fails with ErrNoRollback if SavePolicy has
+// never switched slots, or if a SavePolicy has begun refilling that slot
+// since, even if it has failed. Calling it again switches forward.
+func (a *Adapter) RollbackPolicy(ctx context.Context) error {
+	return a.do(ctx, "RollbackPolicy", func(ctx context.Context) error {
+		if a.readOnly {
+			return ErrReadOnly
+		}
+		if !a.blueGreen {
+			return ErrBlueGreenDisabled
+		}
+		defer a.lockRules()()
+		a.audit(ctx, AuditEntry{})
+
+		if err := a.readSlot(ctx); err != nil {
+			return err
+		}
+		if err := a.markHardDelete(ctx); err != nil {
+			return err
+		}
+		var to int64
+		err := a.mutate(ctx, false, 1, func(tx *datastore.Transaction) error {
+			var alias policyAlias
+			if err := tx.Get(a.policyAliasKey(), &alias); err != nil {
+				if err == datastore.ErrNoSuchEntity {
+					return ErrNoRollback
+				}
+				return err
+			}
+			if alias.Generation != "" {
+				return ErrNoRollback
+			}
+			to = otherSlot(aliasSlot(alias))
+			_, err := tx.Put(a.policyAliasKey(), &policyAlias{Slot: to, SwitchedAt: a.now()})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		a.setSlot(to)
+		return nil
+	})
+}
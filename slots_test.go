@@ -0,0 +1,113 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2"
+)
+
+func TestBlueGreen(t *testing.T) {
+	config := Config{Kind: "casbin_test_bluegreen", Namespace: "unittest", BlueGreen: true}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+	other := NewAdapterWithConfig(getDatastore(), config)
+	if _, err := other.GetPolicyVersion(context.Background()); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	initial := [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	from := a.activeSlot()
+	e.GetModel().RemovePolicy("p", "p", []string{"alice", "data1", "read"})
+	e.GetModel().AddPolicy("p", "p", []string{"carol", "data3", "read"})
+	if err := e.SavePolicy(); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if a.activeSlot() != otherSlot(from) {
+		t.Errorf("got slot %d, wants %d", a.activeSlot(), otherSlot(from))
+	}
+
+	saved := [][]string{{"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"carol", "data3", "read"}}
+	e, _ = casbin.NewEnforcer("examples/rbac_model.conf", NewAdapterWithConfig(getDatastore(), config))
+	testGetPolicy(e, saved, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+
+	// The adapter which loaded the policy before the switch would write to
+	// the inactive slot, so it fails until it loads the policy again.
+	err := other.AddPolicy("p", "p", []string{"dave", "data4", "read"})
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("got %v, wants %v", err, ErrConflict)
+	}
+	if err := other.AddPolicy("p", "p", []string{"dave", "data4", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	saved = append(saved, []string{"dave", "data4", "read"})
+
+	if err := a.RollbackPolicy(context.Background()); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	e, _ = casbin.NewEnforcer("examples/rbac_model.conf", a)
+	testGetPolicy(e, initial, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+
+	// Rolling back again switches forward.
+	if err := a.RollbackPolicy(context.Background()); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := e.LoadPolicy(); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	testGetPolicy(e, saved, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+}
+
+func TestRollbackPolicyErrors(t *testing.T) {
+	a := NewAdapterWithConfig(getDatastore(), Config{Kind: "casbin_test_bluegreen_errors", Namespace: "unittest"})
+	if err := a.RollbackPolicy(context.Background()); !errors.Is(err, ErrBlueGreenDisabled) {
+		t.Errorf("got %v, wants %v", err, ErrBlueGreenDisabled)
+	}
+
+	a = NewAdapterWithConfig(getDatastore(), Config{Kind: "casbin_test_bluegreen_errors", Namespace: "unittest", BlueGreen: true})
+	if err := a.RollbackPolicy(context.Background()); !errors.Is(err, ErrNoRollback) {
+		t.Errorf("got %v, wants %v", err, ErrNoRollback)
+	}
+}
+
+func TestBlueGreenConcurrentSaves(t *testing.T) {
+	config := Config{Kind: "casbin_test_bluegreen_concurrent", Namespace: "unittest", BlueGreen: true}
+	initPolicy(t, config)
+	ctx := context.Background()
+	a := NewAdapterWithConfig(getDatastore(), config)
+	other := NewAdapterWithConfig(getDatastore(), config)
+	if err := a.readSlot(ctx); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := other.readSlot(ctx); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	// A save which has claimed the inactive slot can't write to it once
+	// another save has claimed it.
+	generation, err := a.claimSlot(ctx, a.activeSlot())
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if _, err := other.claimSlot(ctx, other.activeSlot()); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	err = a.slotWrite(ctx, generation, func(*datastore.Transaction) error { return nil })
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("got %v, wants %v", err, ErrConflict)
+	}
+
+	// The slot being refilled can't be rolled back to.
+	if err := a.RollbackPolicy(ctx); !errors.Is(err, ErrNoRollback) {
+		t.Errorf("got %v, wants %v", err, ErrNoRollback)
+	}
+}
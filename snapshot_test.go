@@ -0,0 +1,46 @@
+package datastoreadapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONSnapshot(t *testing.T) {
+	ctx := context.Background()
+	config := Config{Kind: "casbin_test_snapshot", Namespace: "unittest"}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+	if err := SaveModelCtx(ctx, getDatastore(), "examples/rbac_model.conf", config); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	var buf bytes.Buffer
+	if err := a.ExportJSON(ctx, &buf); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	var snapshot PolicySnapshot
+	if err := json.Unmarshal(buf.Bytes(), &snapshot); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(snapshot.Rules) != 5 || snapshot.Model != mustReadFile(t, "examples/rbac_model.conf") {
+		t.Fatalf("got %+v, wants the model and 5 rules", snapshot)
+	}
+	if first := snapshot.Rules[0]; first.PType != "g" || len(first.Rule) != 2 {
+		t.Errorf("got %+v first, wants the rules sorted", first)
+	}
+
+	// Restore the snapshot into another namespace.
+	b := a.ForNamespace("unittest_snapshot")
+	if err := b.ImportJSON(ctx, &buf, ImportReplace); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	e, err := NewEnforcerFromDatastore(ctx, getDatastore(), Config{Kind: config.Kind, Namespace: "unittest_snapshot"}, nil)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+}
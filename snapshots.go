@@ -0,0 +1,178 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// snapshotKindSuffix and snapshotRuleKindSuffix are appended to the
+// configured kind to name the kinds of the stored snapshots and of their
+// rules.
+const (
+	snapshotKindSuffix     = "_snapshot"
+	snapshotRuleKindSuffix = "_snapshot_rule"
+)
+
+// ErrSnapshotNotFound is reported when no snapshot of the given name is
+// stored.
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// SnapshotInfo describes a snapshot stored by CreateSnapshot. The rules of the
+// snapshot are child entities of it, so that it can be restored without
+// leaving datastore.
+type SnapshotInfo struct {
+	Name string `datastore:"-"`
+	// Version is the policy version the snapshot was taken at.
+	Version int64 `datastore:"version,noindex"`
+	// Rules is the number of rules of the snapshot.
+	Rules     int       `datastore:"rules,noindex"`
+	CreatedAt time.Time `datastore:"created_at"`
+	// CreatedBy is the actor, set with WithActor, which took the snapshot.
+	CreatedBy string `datastore:"created_by,noindex"`
+}
+
+func (a *Adapter) snapshotKey(name string) *datastore.Key {
+	key := datastore.NameKey(a.kind+snapshotKindSuffix, name, nil)
+	key.Namespace = a.namespace
+	return key
+}
+
+// snapshotRulesQuery returns the query of the rules of the snapshot of key.
+func (a *Adapter) snapshotRulesQuery(key *datastore.Key) *datastore.Query {
+	return datastore.NewQuery(a.kind + snapshotRuleKindSuffix).Namespace(a.namespace).Ancestor(key)
+}
+
+// CreateSnapshot copies the live rules under a snapshot named name, replacing
+// the snapshot of the same name if any, so that RestoreSnapshot can bring
+// them back, e.g. to roll back a policy rollout. The rules are copied page by
+// page, so the rules mutated meanwhile may or may not be part of it.
+func (a *Adapter) CreateSnapshot(ctx context.Context, name string) (*SnapshotInfo, error) {
+	var info *SnapshotInfo
+	err := a.do(ctx, "CreateSnapshot", func(ctx context.Context) error {
+		if a.readOnly {
+			return ErrReadOnly
+		}
+		key := a.snapshotKey(name)
+		if err := a.deleteSnapshot(ctx, key); err != nil {
+			return err
+		}
+
+		version, err := a.readVersion(ctx)
+		if err != nil {
+			return err
+		}
+		info = &SnapshotInfo{Name: name, Version: version, CreatedAt: a.now(), CreatedBy: ActorFromContext(ctx)}
+
+		now := a.now()
+		_, err = a.paginateRules(ctx, false, "", func(_ []*datastore.Key, rules []CasbinRule) error {
+			var lines []interface{}
+			for i := range rules {
+				if !rules[i].deleted() && !rules[i].expired(now) {
+					lines = append(lines, &rules[i])
+				}
+			}
+			lines, err := a.encodeRules(ctx, lines)
+			if err != nil {
+				return err
+			}
+
+			keys := make([]*datastore.Key, len(lines))
+			for i := range keys {
+				keys[i] = a.newKey(a.kind+snapshotRuleKindSuffix, key)
+			}
+			if _, err := a.db.PutMulti(ctx, keys, a.entities(lines)); err != nil {
+				return err
+			}
+			operationFromContext(ctx).wrote(len(lines))
+			info.Rules += len(lines)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// The snapshot is only listed once all of its rules are stored.
+		_, err = a.db.Put(ctx, key, info)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// RestoreSnapshot replaces the stored rules with those of the snapshot named
+// name, as ImportPolicyCSV does with ImportReplace: the rules of the snapshot
+// which are still stored keep their metadata. It fails with
+// ErrSnapshotNotFound if there is no such snapshot.
+func (a *Adapter) RestoreSnapshot(ctx context.Context, name string) error {
+	return a.do(ctx, "RestoreSnapshot", func(ctx context.Context) error {
+		if a.readOnly {
+			return ErrReadOnly
+		}
+		key := a.snapshotKey(name)
+		var info SnapshotInfo
+		if err := a.db.Get(ctx, key, &info); err != nil {
+			if err == datastore.ErrNoSuchEntity {
+				return ErrSnapshotNotFound
+			}
+			return err
+		}
+
+		return a.importRules(ctx, ImportReplace, func(add func(CasbinRule) error) error {
+			_, err := a.paginate(ctx, a.snapshotRulesQuery(key), false, "", func(_ []*datastore.Key, rules []CasbinRule) error {
+				for _, rule := range rules {
+					if err := add(rule); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			return err
+		}, nil)
+	})
+}
+
+// ListSnapshots returns the stored snapshots, the most recent first.
+func (a *Adapter) ListSnapshots(ctx context.Context) ([]SnapshotInfo, error) {
+	var infos []SnapshotInfo
+	err := a.do(ctx, "ListSnapshots", func(ctx context.Context) error {
+		query := datastore.NewQuery(a.kind + snapshotKindSuffix).Namespace(a.namespace).Order("-created_at")
+		keys, err := a.db.GetAll(ctx, query, &infos)
+		if err != nil {
+			return err
+		}
+		for i, key := range keys {
+			infos[i].Name = key.Name
+		}
+		operationFromContext(ctx).read(len(keys))
+		return nil
+	})
+	return infos, err
+}
+
+// DeleteSnapshot deletes the snapshot named name along with its rules.
+func (a *Adapter) DeleteSnapshot(ctx context.Context, name string) error {
+	return a.do(ctx, "DeleteSnapshot", func(ctx context.Context) error {
+		if a.readOnly {
+			return ErrReadOnly
+		}
+		return a.deleteSnapshot(ctx, a.snapshotKey(name))
+	})
+}
+
+// deleteSnapshot deletes the snapshot of key along with its rules, if any.
+func (a *Adapter) deleteSnapshot(ctx context.Context, key *datastore.Key) error {
+	// Unlist the snapshot before deleting its rules, so that it is never
+	// restored partially.
+	if err := a.db.Delete(ctx, key); err != nil {
+		return err
+	}
+	_, err := a.paginate(ctx, a.snapshotRulesQuery(key), true, "", func(keys []*datastore.Key, _ []CasbinRule) error {
+		return a.db.DeleteMulti(ctx, keys)
+	})
+	return err
+}
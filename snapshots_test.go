@@ -0,0 +1,70 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2"
+)
+
+func TestSnapshots(t *testing.T) {
+	ctx := WithActor(context.Background(), "alice")
+	config := Config{Kind: "casbin_test_snapshots", Namespace: "unittest"}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	info, err := a.CreateSnapshot(ctx, "before-rollout")
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if info.Rules != 5 || info.CreatedBy != "alice" {
+		t.Errorf("got %+v, wants 5 rules created by alice", info)
+	}
+
+	// Roll out a new policy, and then roll it back.
+	if err := a.RemoveFilteredPolicyCtx(ctx, "p", "p", 0, "alice"); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.AddPolicyCtx(ctx, "p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.RestoreSnapshot(ctx, "before-rollout"); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+
+	// Taking a snapshot of the same name replaces it.
+	if err := a.AddPolicyCtx(ctx, "p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if info, err = a.CreateSnapshot(ctx, "before-rollout"); err != nil || info.Rules != 6 {
+		t.Fatalf("got %+v, %v, wants 6 rules", info, err)
+	}
+	infos, err := a.ListSnapshots(ctx)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(infos) != 1 || infos[0].Name != "before-rollout" || infos[0].Rules != 6 {
+		t.Errorf("got %+v, wants the replaced snapshot", infos)
+	}
+
+	if err := a.DeleteSnapshot(ctx, "before-rollout"); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.RestoreSnapshot(ctx, "before-rollout"); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("got %v, wants %v", err, ErrSnapshotNotFound)
+	}
+	n := 0
+	_, err = a.paginate(ctx, a.snapshotRulesQuery(a.snapshotKey("before-rollout")), true, "", func(keys []*datastore.Key, _ []CasbinRule) error {
+		n += len(keys)
+		return nil
+	})
+	if err != nil || n != 0 {
+		t.Errorf("got %d, %v, wants the rules of the snapshot deleted", n, err)
+	}
+}
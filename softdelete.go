@@ -0,0 +1,139 @@
+package datastoreadapter
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// deleted reports whether line is a tombstone left by a soft delete.
+func (line CasbinRule) deleted() bool {
+	return !line.DeletedAt.IsZero()
+}
+
+// removeRules removes the rules of keys, soft deleting them if
+// Config.SoftDelete is set, and returns the number of rules it removed, which
+// leaves out the tombstones among keys.
+func (a *Adapter) removeRules(ctx context.Context, keys []*datastore.Key) (int, error) {
+	if !a.softDelete {
+		if err := a.deleteRules(ctx, false, keys); err != nil {
+			return 0, err
+		}
+		return len(keys), nil
+	}
+	if record := dryRun(ctx); record != nil {
+		recordDeletes(record, MutationSoftDelete, keys)
+		return len(keys), nil
+	}
+
+	now := a.now()
+	removed := 0
+	op := operationFromContext(ctx)
+	op.expect(PhaseDeleting, len(keys))
+	for start := 0; start < len(keys); start += maxRuleMutations {
+		end := start + maxRuleMutations
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		var written int
+		err := a.mutate(ctx, false, 0, func(tx *datastore.Transaction) error {
+			rules, err := a.getRules(tx.GetMulti, keys[start:end])
+			if err != nil {
+				return err
+			}
+
+			var live []*datastore.Key
+			var tombstones []interface{}
+			for i := range rules {
+				if rules[i].deleted() {
+					continue
+				}
+				rules[i].DeletedAt = now
+				rules[i].DeletedBy = ActorFromContext(ctx)
+				live = append(live, keys[start+i])
+				tombstones = append(tombstones, &rules[i])
+			}
+			if len(live) == 0 {
+				return errUnchanged
+			}
+			written = len(live)
+			_, err = tx.PutMulti(live, a.entities(tombstones))
+			return err
+		})
+		if err != nil {
+			return removed, deleteError(keys, start, err)
+		}
+		removed += written
+		op.wrote(written)
+		op.advance(PhaseDeleting, end-start)
+	}
+	return removed, nil
+}
+
+// liveKeys returns the keys of the rules which are not soft deleted.
+// SavePolicy keeps the tombstones, so that they can still be inspected.
+func liveKeys(keys []*datastore.Key, rules []CasbinRule) []*datastore.Key {
+	var live []*datastore.Key
+	for i := range rules {
+		if !rules[i].deleted() {
+			live = append(live, keys[i])
+		}
+	}
+	return live
+}
+
+// liveRules reports whether any of keys is a rule which is not soft deleted.
+func (a *Adapter) liveRules(tx *datastore.Transaction, keys []*datastore.Key) (bool, error) {
+	if !a.softDelete {
+		return len(keys) > 0, nil
+	}
+
+	rules, err := a.getRules(tx.GetMulti, keys)
+	if err != nil {
+		return false, err
+	}
+	for _, rule := range rules {
+		if !rule.deleted() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// PurgeDeletedPolicies deletes the tombstones of the rules soft deleted
+// before the given time, page by page, and returns how many of them it
+// deleted. Until then, soft deleted rules can be inspected with ScanPolicy.
+func (a *Adapter) PurgeDeletedPolicies(ctx context.Context, before time.Time) (int, error) {
+	n := 0
+	err := a.do(ctx, "PurgeDeletedPolicies", func(ctx context.Context) error {
+		if a.readOnly {
+			return ErrReadOnly
+		}
+		a.audit(ctx, AuditEntry{})
+
+		// Live rules store the zero time, which the first filter leaves out.
+		// It also leaves out the entities which aren't rules.
+		for _, kind := range a.ruleKinds() {
+			query := datastore.NewQuery(kind).
+				Namespace(a.namespace).
+				Ancestor(a.rootKeyOf(kind)).
+				Filter(a.property("deleted_at")+" >", time.Time{}).
+				Filter(a.property("deleted_at")+" <", before)
+
+			_, err := a.paginate(ctx, query, true, "", func(keys []*datastore.Key, _ []CasbinRule) error {
+				if err := a.deleteRules(ctx, false, keys); err != nil {
+					return err
+				}
+				n += len(keys)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return n, err
+}
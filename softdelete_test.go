@@ -0,0 +1,77 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2"
+)
+
+func TestSoftDelete(t *testing.T) {
+	ctx := WithActor(context.Background(), "alice")
+	config := Config{Kind: "casbin_test_softdelete", Namespace: "unittest", SoftDelete: true, Deduplicate: true}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	if err := a.RemovePolicyCtx(ctx, "p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.RemoveFilteredPolicyCtx(ctx, "p", "p", 0, "bob"); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	// Tombstones are not loaded, but are still stored.
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	testGetPolicy(e, [][]string{{"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+	tombstone := storedTombstones(t, a)[ruleFields(savePolicyLine("p", []string{"alice", "data1", "read"}))]
+	if tombstone.DeletedAt.IsZero() || tombstone.DeletedBy != "alice" {
+		t.Errorf("got %+v, wants a tombstone", tombstone)
+	}
+
+	// A soft deleted rule can be added again despite Config.Deduplicate, and
+	// SavePolicy keeps the tombstones.
+	if err := a.AddPolicyCtx(ctx, "p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := e.LoadPolicy(); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.SavePolicy(e.GetModel()); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+	if got := len(storedTombstones(t, a)); got != 2 {
+		t.Errorf("got %d tombstones, wants 2", got)
+	}
+
+	n, err := a.PurgeDeletedPolicies(ctx, time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if n != 2 || len(storedTombstones(t, a)) != 0 {
+		t.Errorf("got %d purged rules, wants 2", n)
+	}
+}
+
+// storedTombstones returns the soft deleted rules stored by a.
+func storedTombstones(t *testing.T, a *Adapter) map[ruleID]CasbinRule {
+	tombstones := make(map[ruleID]CasbinRule)
+	_, err := a.paginateRules(context.Background(), false, "", func(_ []*datastore.Key, page []CasbinRule) error {
+		for _, rule := range page {
+			if rule.deleted() {
+				tombstones[ruleFields(rule)] = rule
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	return tombstones
+}
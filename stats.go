@@ -0,0 +1,120 @@
+package datastoreadapter
+
+import (
+	"context"
+
+	"cloud.google.com/go/datastore"
+)
+
+// entityOverhead is the number of bytes datastore adds to the size of every
+// entity, and keyOverhead the number it adds to the size of every key.
+const (
+	entityOverhead = 32
+	keyOverhead    = 16
+)
+
+// Stats holds statistics of the stored rules.
+type Stats struct {
+	// Rules is the number of stored rules, including soft deleted and
+	// expired ones.
+	Rules int
+	// PTypes is the number of stored rules of each ptype.
+	PTypes map[string]int
+	// Deleted is the number of soft deleted rules.
+	Deleted int
+	// Expired is the number of expired rules.
+	Expired int
+	// Bytes is an estimate of the storage size of the rules, computed as
+	// datastore does from their keys and properties, leaving out the project
+	// ID and the indexes.
+	Bytes int64
+}
+
+// Stats returns statistics of the stored rules, e.g. for capacity
+// dashboards. Since datastore doesn't serve aggregation queries to this
+// client, it computes them with a scan of the rules, which is billed as one
+// read per rule.
+func (a *Adapter) Stats(ctx context.Context) (*Stats, error) {
+	stats := &Stats{PTypes: make(map[string]int)}
+	err := a.do(ctx, "Stats", func(ctx context.Context) error {
+		now := a.now()
+		_, err := a.paginateRules(ctx, false, "", func(keys []*datastore.Key, rules []CasbinRule) error {
+			for i := range rules {
+				stats.Rules++
+				stats.PTypes[rules[i].PType]++
+				if rules[i].deleted() {
+					stats.Deleted++
+				} else if rules[i].expired(now) {
+					stats.Expired++
+				}
+
+				props, err := a.ruleProperties(&rules[i])
+				if err != nil {
+					return err
+				}
+				stats.Bytes += entitySize(keys[i], props)
+			}
+			return nil
+		})
+		return err
+	})
+	return stats, err
+}
+
+// ruleProperties returns the properties rule is stored with.
+func (a *Adapter) ruleProperties(rule *CasbinRule) ([]datastore.Property, error) {
+	if pls, ok := a.entity(rule).(datastore.PropertyLoadSaver); ok {
+		return pls.Save()
+	}
+	return datastore.SaveStruct(rule)
+}
+
+// entitySize returns the storage size of the entity of key and props,
+// without the project ID.
+func entitySize(key *datastore.Key, props []datastore.Property) int64 {
+	size := int64(entityOverhead + keyOverhead + len(key.Namespace) + 1)
+	for k := key; k != nil; k = k.Parent {
+		size += int64(len(k.Kind) + 1)
+		if k.Name != "" {
+			size += int64(len(k.Name) + 1)
+		} else {
+			size += 8
+		}
+	}
+	for _, p := range props {
+		size += int64(len(p.Name)+1) + valueSize(p.Value)
+	}
+	return size
+}
+
+// valueSize returns the storage size of a property value.
+func valueSize(v interface{}) int64 {
+	switch v := v.(type) {
+	case string:
+		return int64(len(v) + 1)
+	case []byte:
+		return int64(len(v) + 1)
+	case []interface{}:
+		var size int64
+		for _, e := range v {
+			size += valueSize(e)
+		}
+		return size
+	case bool, nil:
+		return 1
+	}
+	// Integers, floats and times.
+	return 8
+}
+
+// Stats returns the statistics of the rules in each of namespaces, or in
+// each namespace Namespaces returns if none is given.
+func (m *MultiTenantAdapter) Stats(ctx context.Context, namespaces ...string) (map[string]*Stats, error) {
+	stats := make(map[string]*Stats)
+	err := m.ForEachNamespace(ctx, namespaces, func(ctx context.Context, a *Adapter) error {
+		s, err := a.Stats(ctx)
+		stats[a.namespace] = s
+		return err
+	})
+	return stats, err
+}
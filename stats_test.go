@@ -0,0 +1,37 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	config := Config{Kind: "casbin_test_stats", Namespace: "unittest"}
+	initPolicy(t, config)
+	ctx := context.Background()
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	if err := a.AddPolicyWithExpiry(ctx, "p", "p", []string{"carol", "data3", "read"}, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	stats, err := a.Stats(ctx)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if stats.Rules != 6 || stats.PTypes["p"] != 5 || stats.PTypes["g"] != 1 || stats.Expired != 1 || stats.Deleted != 0 {
+		t.Errorf("got %+v, wants 5 p rules, one of which expired, and 1 g rule", stats)
+	}
+	if stats.Bytes <= 0 {
+		t.Errorf("got %d bytes, wants an estimate", stats.Bytes)
+	}
+
+	m := NewMultiTenantAdapter(getDatastore(), config)
+	all, err := m.Stats(ctx, "unittest")
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if s := all["unittest"]; s == nil || s.Rules != stats.Rules {
+		t.Errorf("got %+v, wants the stats of unittest", all)
+	}
+}
@@ -0,0 +1,153 @@
+package datastoreadapter
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// storedRule is a rule stored by an adapter along with the keys of its
+// copies.
+type storedRule struct {
+	rule CasbinRule
+	keys []*datastore.Key
+}
+
+// liveRuleSet returns the stored rules which are neither soft deleted nor
+// expired, by their fields.
+func (a *Adapter) liveRuleSet(ctx context.Context) (map[ruleID]*storedRule, error) {
+	rules := make(map[ruleID]*storedRule)
+	now := a.now()
+	_, err := a.paginateRules(ctx, false, "", func(keys []*datastore.Key, page []CasbinRule) error {
+		for i, rule := range page {
+			if rule.deleted() || rule.expired(now) {
+				continue
+			}
+			s, ok := rules[ruleFields(rule)]
+			if !ok {
+				s = &storedRule{rule: rule}
+				rules[ruleFields(rule)] = s
+			}
+			s.keys = append(s.keys, keys[i])
+		}
+		return nil
+	})
+	return rules, err
+}
+
+// SyncOptions configures SyncPolicies.
+type SyncOptions struct {
+	// DryRun makes SyncPolicies report the delta without applying it.
+	// Optional. (Default: false)
+	DryRun bool
+}
+
+// SyncReport describes the delta SyncPolicies applied.
+type SyncReport struct {
+	// Added is the number of rules added to the destination.
+	Added int
+	// Removed is the number of rules removed from the destination.
+	Removed int
+	// Changed is the number of rules of the destination whose expiry has
+	// been set to that of the source.
+	Changed int
+}
+
+// SyncPolicies makes the rules stored by dst match those stored by src, e.g.
+// to promote policies from a staging project or namespace to a production
+// one. It computes the difference and only adds the missing rules, along with
+// their metadata, and removes the extra ones, honoring Config.SoftDelete of
+// dst. The rules of both whose expiry differs get the expiry of src. Soft
+// deleted and expired rules are ignored on both sides.
+//
+// The delta is applied in batches, so other instances may observe a
+// partially synced policy meanwhile.
+func SyncPolicies(ctx context.Context, src, dst *Adapter, opts SyncOptions) (*SyncReport, error) {
+	report := &SyncReport{}
+	err := dst.do(ctx, "SyncPolicies", func(ctx context.Context) error {
+		if dst.readOnly && !opts.DryRun {
+			return ErrReadOnly
+		}
+
+		from, err := src.liveRuleSet(ctx)
+		if err != nil {
+			return err
+		}
+		to, err := dst.liveRuleSet(ctx)
+		if err != nil {
+			return err
+		}
+
+		diff := diffRuleSets(to, from)
+		var added []interface{}
+		for _, s := range diff.added {
+			rule := s.rule
+			added = append(added, &rule)
+		}
+		var removed []*datastore.Key
+		for _, s := range diff.removed {
+			removed = append(removed, s.keys...)
+		}
+		var changed []*datastore.Key
+		var expiries []time.Time
+		for _, s := range diff.changed {
+			for _, key := range to[ruleFields(s.rule)].keys {
+				changed = append(changed, key)
+				expiries = append(expiries, s.rule.ExpiresAt)
+			}
+		}
+		report.Removed = len(diff.removed)
+		report.Added = len(added)
+		report.Changed = len(diff.changed)
+		if opts.DryRun {
+			return nil
+		}
+
+		dst.audit(ctx, AuditEntry{})
+		if _, err := dst.removeRules(ctx, removed); err != nil {
+			return err
+		}
+		if err := dst.setExpiries(ctx, changed, expiries); err != nil {
+			return err
+		}
+		return dst.putRules(ctx, false, added, nil)
+	})
+	return report, err
+}
+
+// setExpiries sets the expiry of the rules of keys to the matching one of
+// expiries, in transactions of up to maxRuleMutations rules.
+func (a *Adapter) setExpiries(ctx context.Context, keys []*datastore.Key, expiries []time.Time) error {
+	if record := dryRun(ctx); record != nil {
+		recordDeletes(record, MutationUpdate, keys)
+		return nil
+	}
+
+	now := a.now()
+	for start := 0; start < len(keys); start += maxRuleMutations {
+		end := start + maxRuleMutations
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		err := a.mutate(ctx, false, end-start, func(tx *datastore.Transaction) error {
+			rules, err := a.getRules(tx.GetMulti, keys[start:end])
+			if err != nil {
+				return err
+			}
+			lines := make([]interface{}, len(rules))
+			for i := range rules {
+				rules[i].ExpiresAt = expiries[start+i]
+				rules[i].UpdatedAt = now
+				lines[i] = &rules[i]
+			}
+			_, err = tx.PutMulti(keys[start:end], a.entities(lines))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+)
+
+func TestSyncPolicies(t *testing.T) {
+	ctx := context.Background()
+	config := Config{Kind: "casbin_test_sync", Namespace: "unittest"}
+	initPolicy(t, config)
+	initPolicy(t, Config{Kind: config.Kind, Namespace: "unittest_sync"})
+	src := NewAdapterWithConfig(getDatastore(), config)
+	dst := src.ForNamespace("unittest_sync")
+
+	if err := src.AddPolicyCtx(WithActor(ctx, "alice"), "p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := src.RemovePolicy("p", "p", []string{"bob", "data2", "write"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	report, err := SyncPolicies(ctx, src, dst, SyncOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if report.Added != 1 || report.Removed != 1 {
+		t.Errorf("got %+v, wants 1 rule added and 1 removed", report)
+	}
+	if n, _ := dst.CountPolicies(ctx); n != 5 {
+		t.Errorf("got %d rules, wants 5 after a dry run", n)
+	}
+
+	if _, err := SyncPolicies(ctx, src, dst, SyncOptions{}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", dst)
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"carol", "data3", "read"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+	// The metadata of the added rules is copied.
+	if got := storedRules(t, dst)[ruleFields(savePolicyLine("p", []string{"carol", "data3", "read"}))]; got.CreatedBy != "alice" {
+		t.Errorf("got %+v, wants the metadata copied", got)
+	}
+}
+
+func TestSyncPoliciesExpiry(t *testing.T) {
+	ctx := context.Background()
+	config := Config{Kind: "casbin_test_sync_expiry", Namespace: "unittest"}
+	initPolicy(t, config)
+	initPolicy(t, Config{Kind: config.Kind, Namespace: "unittest_sync"})
+	src := NewAdapterWithConfig(getDatastore(), config)
+	dst := src.ForNamespace("unittest_sync")
+
+	rule := []string{"alice", "data1", "read"}
+	if err := src.RemovePolicy("p", "p", rule); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+	if err := src.AddPolicyWithExpiry(ctx, "p", "p", rule, expiresAt); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	report, err := SyncPolicies(ctx, src, dst, SyncOptions{})
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if report.Added != 0 || report.Removed != 0 || report.Changed != 1 {
+		t.Errorf("got %+v, wants 1 rule changed", report)
+	}
+	if got := storedRules(t, dst)[ruleFields(savePolicyLine("p", rule))]; !got.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("got %v, wants the expiry %v", got.ExpiresAt, expiresAt)
+	}
+
+	diff, err := dst.DiffPolicies(ctx, src)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(diff.Added) != 0 || len(diff.Removed) != 0 || len(diff.Changed) != 0 {
+		t.Errorf("got %+v, wants no difference left", diff)
+	}
+}
@@ -0,0 +1,123 @@
+package datastoreadapter
+
+import (
+	"context"
+	"sync"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2/model"
+)
+
+// namespaceAdapters holds the adapter of each namespace an adapter has been
+// switched to.
+type namespaceAdapters struct {
+	config Config
+
+	mu       sync.Mutex
+	adapters map[string]*Adapter
+}
+
+// ForNamespace returns an adapter which shares the datastore client and the
+// configuration of a but targets namespace, so that a request-scoped tenant
+// can be targeted without constructing an adapter per call. The adapter of
+// each namespace is created once and keeps tracking the policy version of
+// its namespace.
+func (a *Adapter) ForNamespace(namespace string) *Adapter {
+	n := a.namespaces
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	b, ok := n.adapters[namespace]
+	if !ok {
+		config := n.config
+		config.Namespace = namespace
+		b = newAdapter(a.db, config)
+		b.namespaces = n
+		b.limiter = a.limiter
+		b.breaker = a.breaker
+		b.owner = a.owner
+		n.adapters[namespace] = b
+	}
+	return b
+}
+
+// MultiTenantAdapter hands out an Adapter per namespace, for deployments
+// which store the policy of each tenant in its own namespace. The adapters
+// are those Adapter.ForNamespace returns.
+//
+// Unlike NewAdapterWithConfig, it doesn't close db when released; the caller
+// owns db and closes it once done.
+type MultiTenantAdapter struct {
+	adapter *Adapter
+	config  Config
+}
+
+// NewMultiTenantAdapter is the constructor for MultiTenantAdapter.
+// config.Namespace is the namespace ForContext falls back to.
+func NewMultiTenantAdapter(db *datastore.Client, config Config) *MultiTenantAdapter {
+	return &MultiTenantAdapter{adapter: newAdapter(db, config), config: config}
+}
+
+// ForNamespace returns the adapter of namespace.
+func (m *MultiTenantAdapter) ForNamespace(namespace string) *Adapter {
+	return m.adapter.ForNamespace(namespace)
+}
+
+// ForContext returns the adapter of the namespace Config.ContextExtractor
+// derives from ctx or set on it with WithNamespace, or of Config.Namespace if
+// none is set.
+func (m *MultiTenantAdapter) ForContext(ctx context.Context) *Adapter {
+	namespace, ok := m.adapter.contextNamespace(ctx)
+	if !ok {
+		namespace = m.config.Namespace
+	}
+	return m.ForNamespace(namespace)
+}
+
+// LoadPolicyCtx loads the policy of the namespace of ctx; see ForContext.
+func (m *MultiTenantAdapter) LoadPolicyCtx(ctx context.Context, model model.Model) error {
+	return m.ForContext(ctx).LoadPolicyCtx(ctx, model)
+}
+
+// LoadFilteredPolicyCtx loads the rules matching filter of the namespace of
+// ctx; see ForContext.
+func (m *MultiTenantAdapter) LoadFilteredPolicyCtx(ctx context.Context, model model.Model, filter interface{}) error {
+	return m.ForContext(ctx).LoadFilteredPolicyCtx(ctx, model, filter)
+}
+
+// SavePolicyCtx saves the policy of the namespace of ctx; see ForContext.
+func (m *MultiTenantAdapter) SavePolicyCtx(ctx context.Context, model model.Model) error {
+	return m.ForContext(ctx).SavePolicyCtx(ctx, model)
+}
+
+// AddPolicyCtx adds a rule to the policy of the namespace of ctx; see
+// ForContext.
+func (m *MultiTenantAdapter) AddPolicyCtx(ctx context.Context, sec string, ptype string, rule []string) error {
+	return m.ForContext(ctx).AddPolicyCtx(ctx, sec, ptype, rule)
+}
+
+// RemovePolicyCtx removes a rule from the policy of the namespace of ctx;
+// see ForContext.
+func (m *MultiTenantAdapter) RemovePolicyCtx(ctx context.Context, sec string, ptype string, rule []string) error {
+	return m.ForContext(ctx).RemovePolicyCtx(ctx, sec, ptype, rule)
+}
+
+// RemoveFilteredPolicyCtx removes the rules matching the filter from the
+// policy of the namespace of ctx; see ForContext.
+func (m *MultiTenantAdapter) RemoveFilteredPolicyCtx(ctx context.Context, sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	return m.ForContext(ctx).RemoveFilteredPolicyCtx(ctx, sec, ptype, fieldIndex, fieldValues...)
+}
+
+type namespaceKey struct{}
+
+// WithNamespace returns a context which makes MultiTenantAdapter.ForContext
+// return the adapter of namespace.
+func WithNamespace(ctx context.Context, namespace string) context.Context {
+	return context.WithValue(ctx, namespaceKey{}, namespace)
+}
+
+// NamespaceFromContext returns the namespace set with WithNamespace.
+func NamespaceFromContext(ctx context.Context) (string, bool) {
+	namespace, ok := ctx.Value(namespaceKey{}).(string)
+	return namespace, ok
+}
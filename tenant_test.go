@@ -0,0 +1,61 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+)
+
+func TestMultiTenantAdapter(t *testing.T) {
+	config := Config{Kind: "casbin_test_tenant", Namespace: "unittest"}
+	initPolicy(t, config)
+	initPolicy(t, Config{Kind: config.Kind, Namespace: "unittest_tenant"})
+	m := NewMultiTenantAdapter(getDatastore(), config)
+
+	if m.ForNamespace("unittest_tenant") != m.ForNamespace("unittest_tenant") {
+		t.Error("got distinct adapters, wants the same one per namespace")
+	}
+
+	ctx := WithNamespace(context.Background(), "unittest_tenant")
+	if err := m.ForContext(ctx).RemoveFilteredPolicyCtx(ctx, "p", "p", 0, "alice"); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	// Only the policy of the tenant is modified.
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", m.ForContext(ctx))
+	testGetPolicy(e, [][]string{{"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+	e, _ = casbin.NewEnforcer("examples/rbac_model.conf", m.ForContext(context.Background()))
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+}
+
+func TestForNamespace(t *testing.T) {
+	config := Config{Kind: "casbin_test_tenant", Namespace: "unittest"}
+	initPolicy(t, config)
+	initPolicy(t, Config{Kind: config.Kind, Namespace: "unittest_tenant"})
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	if a.ForNamespace("unittest") != a {
+		t.Error("got another adapter, wants the adapter of its own namespace")
+	}
+	b := a.ForNamespace("unittest_tenant")
+	if b.ForNamespace("unittest_tenant") != b || b.ForNamespace("unittest") != a {
+		t.Error("got distinct adapters, wants the same one per namespace")
+	}
+
+	if err := b.RemovePolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+	e, _ = casbin.NewEnforcer("examples/rbac_model.conf", b)
+	testGetPolicy(e, [][]string{{"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+}
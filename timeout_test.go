@@ -0,0 +1,51 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+)
+
+func TestDefaultTimeout(t *testing.T) {
+	config := Config{Kind: "casbin_test_timeout", Namespace: "unittest"}
+	initPolicy(t, config)
+
+	var deadlines []bool
+	config.DefaultTimeout = time.Minute
+	config.Interceptors = []Interceptor{
+		func(ctx context.Context, op string, next func(ctx context.Context) error) error {
+			_, ok := ctx.Deadline()
+			deadlines = append(deadlines, ok)
+			return next(ctx)
+		},
+	}
+	a := NewAdapterWithConfig(getDatastore(), config)
+	if _, err := a.CountPolicies(context.Background()); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(deadlines) != 1 || !deadlines[0] {
+		t.Errorf("got deadlines %v, wants [true]", deadlines)
+	}
+
+	// An expired default timeout fails the operations without a deadline.
+	config.DefaultTimeout = time.Nanosecond
+	config.Interceptors = nil
+	a = NewAdapterWithConfig(getDatastore(), config)
+	m, err := model.NewModelFromFile("examples/rbac_model.conf")
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.LoadPolicy(m); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, wants %v", err, context.DeadlineExceeded)
+	}
+
+	// But it doesn't override the deadline of the context.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if _, err := a.CountPolicies(ctx); err != nil {
+		t.Errorf("got %v, wants no error", err)
+	}
+}
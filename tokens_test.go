@@ -0,0 +1,50 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/casbin/casbin/v2/model"
+)
+
+func TestEmptyValues(t *testing.T) {
+	config := Config{Kind: "casbin_test_tokens", Namespace: "unittest"}
+	initPolicy(t, config)
+	ctx := context.Background()
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	rule := []string{"alice", "", "read"}
+	if err := a.AddPolicyCtx(ctx, "p", "p", rule); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	// Rules stored without a token count still end at their first empty value.
+	legacy := savePolicyLine("p", []string{"bob", "", "write"})
+	legacy.Tokens = 0
+	if err := a.putRules(ctx, false, []interface{}{&legacy}, nil); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	m, err := model.NewModelFromFile("examples/rbac_model.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.LoadPolicyCtx(ctx, m); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	wants := [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, rule, {"bob"}}
+	if actual := m["p"]["p"].Policy; len(actual) != len(wants) || !SamePolicy(actual, wants) {
+		t.Errorf("got %v, wants %v", actual, wants)
+	}
+
+	if err := a.RemovePolicyCtx(ctx, "p", "p", rule); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	m.ClearPolicy()
+	if err := a.LoadPolicyCtx(ctx, m); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if actual := m["p"]["p"].Policy; len(actual) != len(wants)-1 {
+		t.Errorf("got %v, wants %v removed", actual, rule)
+	}
+}
@@ -0,0 +1,56 @@
+package datastoreadapter
+
+import "context"
+
+// Tracer starts a span for each adapter operation. It is meant to be
+// implemented on top of a tracing library such as OpenTelemetry, e.g.
+//
+//	type otelTracer struct{ t trace.Tracer }
+//
+//	func (o otelTracer) Start(ctx context.Context, op string) (context.Context, datastoreadapter.Span) {
+//		ctx, span := o.t.Start(ctx, "casbin."+op)
+//		return ctx, otelSpan{span}
+//	}
+//
+//	type otelSpan struct{ s trace.Span }
+//
+//	func (o otelSpan) SetAttribute(key string, value interface{}) {
+//		o.s.SetAttributes(attribute.String(key, fmt.Sprint(value)))
+//	}
+//
+//	func (o otelSpan) End(err error) {
+//		if err != nil {
+//			o.s.RecordError(err)
+//			o.s.SetStatus(codes.Error, err.Error())
+//		}
+//		o.s.End()
+//	}
+type Tracer interface {
+	// Start starts a span for op, e.g. "LoadPolicy", as a child of the span
+	// in ctx, if any.
+	Start(ctx context.Context, op string) (context.Context, Span)
+}
+
+// Span is a span started by Tracer.
+type Span interface {
+	// SetAttribute records an attribute of the operation, such as the
+	// number of rules it processed.
+	SetAttribute(key string, value interface{})
+	// End ends the span. err is the error the operation failed with, if any.
+	End(err error)
+}
+
+// Attributes recorded on spans.
+const (
+	attrKind            = "casbin.kind"
+	attrNamespace       = "casbin.namespace"
+	attrEntitiesRead    = "casbin.entities_read"
+	attrEntitiesWritten = "casbin.entities_written"
+	attrRetries         = "casbin.retries"
+	attrRequestID       = "casbin.request_id"
+)
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, interface{}) {}
+func (noopSpan) End(error)                        {}
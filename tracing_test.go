@@ -0,0 +1,91 @@
+package datastoreadapter
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+)
+
+type recordedSpan struct {
+	op    string
+	attrs map[string]interface{}
+	ended bool
+	err   error
+}
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (r *recordingTracer) Start(ctx context.Context, op string) (context.Context, Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := &recordedSpan{op: op, attrs: make(map[string]interface{})}
+	r.spans = append(r.spans, s)
+	return ctx, s
+}
+
+func (s *recordedSpan) SetAttribute(key string, value interface{}) { s.attrs[key] = value }
+func (s *recordedSpan) End(err error)                              { s.ended, s.err = true, err }
+
+func TestTracer(t *testing.T) {
+	config := Config{Kind: "casbin_test", Namespace: "unittest"}
+	initPolicy(t, config)
+
+	tracer := &recordingTracer{}
+	config.Tracer = tracer
+	a := NewAdapterWithConfig(getDatastore(), config)
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	e.AddPolicy("carol", "data3", "read")
+
+	if len(tracer.spans) != 2 {
+		t.Fatalf("got %d spans, wants 2", len(tracer.spans))
+	}
+	load, add := tracer.spans[0], tracer.spans[1]
+	if load.op != "LoadPolicy" || load.attrs[attrEntitiesRead] != 5 || load.attrs[attrNamespace] != "unittest" {
+		t.Errorf("got %+v, wants a LoadPolicy span with 5 rules in unittest", load)
+	}
+	if add.op != "AddPolicy" || !add.ended || add.err != nil || add.attrs[attrEntitiesWritten] != 1 {
+		t.Errorf("got %+v, wants an ended AddPolicy span", add)
+	}
+}
+
+func TestTracerCoverage(t *testing.T) {
+	ctx := context.Background()
+	config := Config{Kind: "casbin_test", Namespace: "unittest"}
+	initPolicy(t, config)
+
+	tracer := &recordingTracer{}
+	config.Tracer = tracer
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	// A cache miss scans datastore, a hit doesn't.
+	cached := NewCachedAdapter(a, 0)
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", cached)
+	e.LoadPolicy()
+
+	a.ScanPolicy(ctx, "", func([]CasbinRule) error { return nil })
+	a.GetPolicyVersion(ctx)
+	lock, _ := a.AcquireLock(ctx, time.Minute)
+	lock.Extend(ctx)
+	lock.Release(ctx)
+	a.CleanupPolicies(ctx)
+	LoadModelWithConfig(getDatastore(), config)
+
+	var ops []string
+	for _, s := range tracer.spans {
+		if !s.ended {
+			t.Errorf("span %s has not ended", s.op)
+		}
+		ops = append(ops, s.op)
+	}
+	wants := []string{"LoadPolicy", "ScanPolicy", "GetPolicyVersion", "AcquireLock", "ExtendLock", "ReleaseLock", "CleanupPolicies", "LoadModel"}
+	if !reflect.DeepEqual(ops, wants) {
+		t.Errorf("got spans %v, wants %v", ops, wants)
+	}
+}
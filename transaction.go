@@ -0,0 +1,345 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+)
+
+// TxAdapter is the adapter WithTransaction passes to its function. Its
+// AddPolicy, RemovePolicy and RemoveFilteredPolicy stage the mutations, which
+// are written once the function returns. LoadPolicy and SavePolicy fail with
+// ErrUnsupportedInTransaction.
+type TxAdapter struct {
+	adapter *Adapter
+	ctx     context.Context
+	changes []stagedChange
+}
+
+// stagedChange is a mutation staged by TxAdapter.
+type stagedChange struct {
+	// line is the rule added or removed, which is not encoded.
+	line   CasbinRule
+	remove bool
+	// filter is the filter of the rules removed by RemoveFilteredPolicy, if
+	// not nil.
+	filter *Filter
+}
+
+var _ persist.Adapter = (*TxAdapter)(nil)
+
+// maxTxAttempts is the number of times WithTransaction reads the stored
+// rules its mutations apply to, as long as the policy is modified meanwhile.
+const maxTxAttempts = 3
+
+// WithTransaction runs fn with an adapter staging the rules added and removed
+// through it, and then writes all of them in a single transaction, so that
+// e.g. a role can be revoked and its replacement granted atomically:
+//
+//	err := a.WithTransaction(ctx, func(tx persist.Adapter) error {
+//		if err := tx.RemovePolicy("g", "g", []string{"alice", "admin"}); err != nil {
+//			return err
+//		}
+//		return tx.AddPolicy("g", "g", []string{"alice", "operator"})
+//	})
+//
+// Nothing is written if fn fails. The mutations apply in the order they are
+// staged, e.g. removing a rule added earlier in fn cancels its addition.
+// The rules they remove are read before the transaction, which fails and is
+// retried if the policy is modified meanwhile, ultimately with ErrConflict.
+// Since datastore limits the mutations of a transaction, it fails with
+// ErrTooManyRules if they would write more than 498 rules.
+func (a *Adapter) WithTransaction(ctx context.Context, fn func(tx persist.Adapter) error) error {
+	return a.do(ctx, "WithTransaction", func(ctx context.Context) error {
+		if a.readOnly {
+			return wrapError("WithTransaction", ErrReadOnly)
+		}
+		t := &TxAdapter{adapter: a, ctx: ctx}
+		if err := fn(t); err != nil {
+			return err
+		}
+		return wrapError("WithTransaction", a.applyChanges(ctx, t.changes, nil))
+	})
+}
+
+func (t *TxAdapter) LoadPolicy(model model.Model) error {
+	return wrapError("LoadPolicy", ErrUnsupportedInTransaction)
+}
+
+func (t *TxAdapter) SavePolicy(model model.Model) error {
+	return wrapError("SavePolicy", ErrUnsupportedInTransaction)
+}
+
+// AddPolicy stages the addition of the rule.
+func (t *TxAdapter) AddPolicy(sec string, ptype string, rule []string) error {
+	line := savePolicyLine(ptype, rule)
+	stampRule(t.ctx, &line, t.adapter.now())
+	t.changes = append(t.changes, stagedChange{line: line})
+	return nil
+}
+
+// RemovePolicy stages the removal of the rule.
+func (t *TxAdapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	t.changes = append(t.changes, stagedChange{line: savePolicyLine(ptype, rule), remove: true})
+	return nil
+}
+
+// RemoveFilteredPolicy stages the removal of the rules matching the filter.
+func (t *TxAdapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	f := Filter{PType: ptype, FieldIndex: fieldIndex, FieldValues: fieldValues, IgnoreCase: ignoresCase(t.ctx)}
+	t.changes = append(t.changes, stagedChange{line: CasbinRule{PType: ptype}, remove: true, filter: &f})
+	return nil
+}
+
+// errStaleChanges is returned by the transaction of applyChanges when the
+// policy has been modified since the stored rules were read.
+var errStaleChanges = errors.New("policy modified since the staged changes were resolved")
+
+// resolvedChanges holds the mutations staged changes make to the stored rules.
+type resolvedChanges struct {
+	// version is the policy version the stored rules were read at.
+	version int64
+	// added holds the rules to add, which are not encoded.
+	added []*CasbinRule
+	// deleted holds the keys of the stored rules to remove, and removed the
+	// rules themselves.
+	deleted []*datastore.Key
+	removed []CasbinRule
+}
+
+// applyChanges writes changes in a single transaction, once validate, if not
+// nil, accepts them. It reads the rules they remove again if the policy is
+// modified meanwhile.
+func (a *Adapter) applyChanges(ctx context.Context, changes []stagedChange, validate func(*resolvedChanges) error) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	defer a.lockRules()()
+	a.audit(ctx, AuditEntry{})
+
+	for attempt := 1; ; attempt++ {
+		r, err := a.resolveChanges(ctx, changes)
+		if err != nil {
+			return err
+		}
+		if validate != nil {
+			if err := validate(r); err != nil {
+				return err
+			}
+		}
+		err = a.commitChanges(ctx, r)
+		if err != errStaleChanges {
+			return err
+		}
+		if attempt == maxTxAttempts {
+			return ErrConflict
+		}
+		operationFromContext(ctx).retry()
+	}
+}
+
+// resolveChanges resolves changes against the stored rules.
+func (a *Adapter) resolveChanges(ctx context.Context, changes []stagedChange) (*resolvedChanges, error) {
+	version, err := a.readVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &resolvedChanges{version: version}
+	seen := make(map[string]bool)
+	del := func(keys []*datastore.Key, rules []CasbinRule) {
+		for i, key := range keys {
+			if !seen[key.String()] {
+				seen[key.String()] = true
+				r.deleted = append(r.deleted, key)
+				r.removed = append(r.removed, rules[i])
+			}
+		}
+	}
+	for _, c := range changes {
+		switch {
+		case c.filter != nil:
+			plans, err := a.filteredPlans(ctx, *c.filter)
+			if err != nil {
+				return nil, err
+			}
+			r.added = unstage(r.added, func(line CasbinRule) bool {
+				return line.PType == c.filter.PType && plans[0].match(line)
+			})
+			err = a.paginatePlans(ctx, plans, false, func(keys []*datastore.Key, rules []CasbinRule) error {
+				var live []*datastore.Key
+				var liveRules []CasbinRule
+				for i, line := range rules {
+					if !line.deleted() {
+						live = append(live, keys[i])
+						liveRules = append(liveRules, line)
+					}
+				}
+				del(live, liveRules)
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+
+		case c.remove:
+			id := ruleFields(c.line)
+			r.added = unstage(r.added, func(line CasbinRule) bool { return ruleFields(line) == id })
+			keys, err := a.storedRuleKeys(ctx, c.line)
+			if err != nil {
+				return nil, err
+			}
+			rules := make([]CasbinRule, len(keys))
+			for i := range rules {
+				rules[i] = c.line
+			}
+			del(keys, rules)
+
+		default:
+			if a.deduplicate {
+				id := ruleFields(c.line)
+				if len(unstage(r.added, func(line CasbinRule) bool { return ruleFields(line) == id })) < len(r.added) {
+					continue
+				}
+				keys, err := a.storedRuleKeys(ctx, c.line)
+				if err != nil {
+					return nil, err
+				}
+				kept := false
+				for _, key := range keys {
+					kept = kept || !seen[key.String()]
+				}
+				if kept {
+					continue
+				}
+			}
+			line := c.line
+			r.added = append(r.added, &line)
+		}
+	}
+	return r, nil
+}
+
+// commitChanges writes r in a transaction, which fails with errStaleChanges
+// if the policy has been modified since r was resolved.
+func (a *Adapter) commitChanges(ctx context.Context, r *resolvedChanges) error {
+	n := len(r.added) + len(r.deleted)
+	if n == 0 {
+		return nil
+	}
+	if len(r.added)*a.ruleWrites()+len(r.deleted) > maxRuleMutations {
+		return ErrTooManyRules
+	}
+	lines := make([]interface{}, len(r.added))
+	for i, line := range r.added {
+		lines[i] = line
+	}
+	if err := a.checkArity(lines); err != nil {
+		return err
+	}
+	if record := dryRun(ctx); record != nil {
+		kind := MutationDelete
+		if a.softDelete {
+			kind = MutationSoftDelete
+		}
+		recordDeletes(record, kind, r.deleted)
+		recordPuts(record, lines)
+		return nil
+	}
+
+	lines, err := a.encodeRules(ctx, lines)
+	if err != nil {
+		return err
+	}
+	keys := make([]*datastore.Key, len(lines))
+	for i := range keys {
+		keys[i] = a.newRuleKey(lines[i].(*CasbinRule))
+	}
+	keys, entities, err := a.indexedEntities(ctx, keys, lines)
+	if err != nil {
+		return err
+	}
+	err = a.mutate(ctx, false, n, func(tx *datastore.Transaction) error {
+		var v policyVersion
+		if err := tx.Get(a.policyVersionKey(), &v); err != nil && err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		if v.Version != r.version {
+			return errStaleChanges
+		}
+
+		if err := a.deleteInTransaction(ctx, tx, r.deleted); err != nil {
+			return err
+		}
+		_, err := tx.PutMulti(keys, entities)
+		return err
+	})
+	if err == nil {
+		a.recordAdded(ctx, r.added...)
+	}
+	return err
+}
+
+// unstage returns the rules of added which don't match.
+func unstage(added []*CasbinRule, match func(CasbinRule) bool) []*CasbinRule {
+	var kept []*CasbinRule
+	for _, line := range added {
+		if !match(*line) {
+			kept = append(kept, line)
+		}
+	}
+	return kept
+}
+
+// storedRuleKeys returns the keys of the live stored copies of line, which is
+// not encoded.
+func (a *Adapter) storedRuleKeys(ctx context.Context, line CasbinRule) ([]*datastore.Key, error) {
+	line, err := a.encodeRule(ctx, line)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := a.ruleKeys(ctx, line)
+	if err != nil || !a.softDelete || len(keys) == 0 {
+		return keys, err
+	}
+	rules, err := a.getRules(func(keys []*datastore.Key, dst interface{}) error {
+		return a.db.GetMulti(ctx, keys, dst)
+	}, keys)
+	if err != nil {
+		return nil, err
+	}
+	return liveKeys(keys, rules), nil
+}
+
+// deleteInTransaction deletes the rules of keys in tx, or marks them as
+// deleted if Config.SoftDelete is set.
+func (a *Adapter) deleteInTransaction(ctx context.Context, tx *datastore.Transaction, keys []*datastore.Key) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if !a.softDelete {
+		return tx.DeleteMulti(keys)
+	}
+
+	rules, err := a.getRules(tx.GetMulti, keys)
+	if err != nil {
+		return err
+	}
+	now := a.now()
+	var live []*datastore.Key
+	var tombstones []interface{}
+	for i := range rules {
+		if rules[i].deleted() {
+			continue
+		}
+		rules[i].DeletedAt = now
+		rules[i].DeletedBy = ActorFromContext(ctx)
+		live = append(live, keys[i])
+		tombstones = append(tombstones, &rules[i])
+	}
+	_, err = tx.PutMulti(live, a.entities(tombstones))
+	return err
+}
@@ -0,0 +1,83 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/persist"
+)
+
+func TestWithTransaction(t *testing.T) {
+	for _, config := range []Config{
+		{Kind: "casbin_test_tx", Namespace: "unittest"},
+		{Kind: "casbin_test_tx_soft", Namespace: "unittest", SoftDelete: true, Deduplicate: true},
+	} {
+		initPolicy(t, config)
+		a := NewAdapterWithConfig(getDatastore(), config)
+		ctx := context.Background()
+
+		failed := errors.New("failed")
+		err := a.WithTransaction(ctx, func(tx persist.Adapter) error {
+			if err := tx.RemovePolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+				return err
+			}
+			return failed
+		})
+		if !errors.Is(err, failed) {
+			t.Errorf("got %v, wants %v", err, failed)
+		}
+
+		err = a.WithTransaction(ctx, func(tx persist.Adapter) error {
+			if err := tx.LoadPolicy(nil); !errors.Is(err, ErrUnsupportedInTransaction) {
+				t.Errorf("got %v, wants ErrUnsupportedInTransaction", err)
+			}
+			// Revoke a role and grant another one.
+			if err := tx.RemovePolicy("g", "g", []string{"alice", "data2_admin"}); err != nil {
+				return err
+			}
+			if err := tx.AddPolicy("g", "g", []string{"alice", "data1_admin"}); err != nil {
+				return err
+			}
+			// Staged additions are cancelled by later removals.
+			if err := tx.AddPolicy("p", "p", []string{"carol", "data3", "read"}); err != nil {
+				return err
+			}
+			if err := tx.AddPolicy("p", "p", []string{"carol", "data3", "write"}); err != nil {
+				return err
+			}
+			if err := tx.RemovePolicy("p", "p", []string{"carol", "data3", "read"}); err != nil {
+				return err
+			}
+			if err := tx.RemoveFilteredPolicy("p", "p", 0, "bob"); err != nil {
+				return err
+			}
+			return tx.RemoveFilteredPolicy("p", "p", 0, "carol", "", "write")
+		})
+		if err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+
+		e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+		testGetPolicy(e, [][]string{{"alice", "data1", "read"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, func(actual, wants [][]string) {
+			t.Error("got: ", actual, ", wants ", wants)
+		})
+		if roles := e.GetGroupingPolicy(); !SamePolicy(roles, [][]string{{"alice", "data1_admin"}}) {
+			t.Errorf("got %v, wants alice granted data1_admin only", roles)
+		}
+
+		// Nothing is written once the mutations exceed a transaction.
+		err = a.WithTransaction(ctx, func(tx persist.Adapter) error {
+			for i := 0; i <= maxRuleMutations; i++ {
+				if err := tx.AddPolicy("p", "p", []string{"dave", "data", string(rune('a' + i%26)), string(rune('a' + i/26))}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if !errors.Is(err, ErrTooManyRules) {
+			t.Errorf("got %v, wants ErrTooManyRules", err)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package datastoreadapter
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// ValueTransformer returns the value to store for value, the field-th value
+// of a rule of ptype. The same transformation applies to the values
+// RemovePolicy, RemoveFilteredPolicy and LoadFilteredPolicy match, so exact
+// matches keep working, but the transformed values are the ones loaded.
+//
+// Since the loaded values are saved again by SavePolicy, a ValueTransformer
+// must leave the values it has already transformed as they are.
+type ValueTransformer func(ptype string, field int, value string) string
+
+// hmacPrefix marks the values HMACTransformer has transformed.
+const hmacPrefix = "hmac:"
+
+// HMACTransformer returns a ValueTransformer which replaces the values of the
+// fields selected by fields with their HMAC-SHA256 under key, as returned by
+// HMACValue. Enforcement then needs the values of requests pseudonymized the
+// same way, e.g. for RBAC:
+//
+//	subjects := func(ptype string, field int) bool {
+//		return field == 0 || ptype == "g" && field == 1
+//	}
+//	config := datastoreadapter.Config{ValueTransformer: datastoreadapter.HMACTransformer(key, subjects)}
+//	...
+//	e.Enforce(datastoreadapter.HMACValue(key, user), obj, act)
+func HMACTransformer(key []byte, fields func(ptype string, field int) bool) ValueTransformer {
+	return func(ptype string, field int, value string) string {
+		if value == "" || strings.HasPrefix(value, hmacPrefix) || !fields(ptype, field) {
+			return value
+		}
+		return HMACValue(key, value)
+	}
+}
+
+// HMACValue returns the pseudonym HMACTransformer stores for value.
+func HMACValue(key []byte, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return hmacPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// transformerCodec is the Codec of a ValueTransformer, whose values are
+// decoded as they are.
+type transformerCodec ValueTransformer
+
+func (c transformerCodec) Encode(_ context.Context, ptype string, field int, value string) (string, error) {
+	return c(ptype, field, value), nil
+}
+
+func (c transformerCodec) Decode(_ context.Context, _ string, _ int, stored string) (string, error) {
+	return stored, nil
+}
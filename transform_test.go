@@ -0,0 +1,46 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+)
+
+func TestHMACTransformer(t *testing.T) {
+	key := []byte("secret")
+	subjects := func(ptype string, field int) bool {
+		return field == 0 || ptype == "g" && field == 1
+	}
+	config := Config{Kind: "casbin_test_transform", Namespace: "unittest", ValueTransformer: HMACTransformer(key, subjects)}
+	ctx := context.Background()
+	a := NewAdapterWithConfig(getDatastore(), config)
+	f, _ := casbin.NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	if err := a.SavePolicyCtx(ctx, f.GetModel()); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	alice, bob, admin := HMACValue(key, "alice"), HMACValue(key, "bob"), HMACValue(key, "data2_admin")
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	testGetPolicy(e, [][]string{{alice, "data1", "read"}, {bob, "data2", "write"}, {admin, "data2", "read"}, {admin, "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+	if g := e.GetGroupingPolicy(); !SamePolicy(g, [][]string{{alice, admin}}) {
+		t.Errorf("got %v, wants %v", g, [][]string{{alice, admin}})
+	}
+
+	// Saving the loaded values doesn't transform them again.
+	if err := a.SavePolicyCtx(ctx, e.GetModel()); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.RemovePolicyCtx(ctx, "p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.RemoveFilteredPolicyCtx(ctx, "p", "p", 0, "data2_admin"); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	e.LoadPolicy()
+	testGetPolicy(e, [][]string{{bob, "data2", "write"}}, func(actual, wants [][]string) {
+		t.Error("got: ", actual, ", wants ", wants)
+	})
+}
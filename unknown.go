@@ -0,0 +1,101 @@
+package datastoreadapter
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2/model"
+)
+
+// UnknownPTypeMode selects how the loads treat the stored rules whose ptype
+// the model doesn't define; see Config.UnknownPType.
+type UnknownPTypeMode int
+
+const (
+	// UnknownPTypeSkip skips the rules silently.
+	UnknownPTypeSkip UnknownPTypeMode = iota
+	// UnknownPTypeWarn skips the rules, reporting each of them to
+	// Config.Logger as a warning.
+	UnknownPTypeWarn
+	// UnknownPTypeFail fails the load with an UnknownPTypeError at the first
+	// of them.
+	UnknownPTypeFail
+)
+
+// UnknownPTypeError reports a stored rule whose ptype the model doesn't
+// define. It wraps ErrUnknownPType.
+type UnknownPTypeError struct {
+	// Key is the key of the rule, or nil if it has been loaded from a
+	// snapshot of CachedAdapter.
+	Key *datastore.Key
+	PolicyRule
+}
+
+func (e *UnknownPTypeError) Error() string {
+	if e.Key == nil {
+		return fmt.Sprintf("%s: %q of rule %v", ErrUnknownPType, e.PType, e.Rule)
+	}
+	return fmt.Sprintf("%s: %q of rule %v stored under %s", ErrUnknownPType, e.PType, e.Rule, e.Key)
+}
+
+func (e *UnknownPTypeError) Unwrap() error {
+	return ErrUnknownPType
+}
+
+type skippedRulesKey struct{}
+
+// WithSkippedRules returns a context which makes the loads run with it call
+// fn with each rule they skip because the model doesn't define its ptype,
+// unless Config.UnknownPType is UnknownPTypeFail. fn is called from one
+// goroutine at a time.
+//
+// The loads of Config.LoadWorkers only query the ptypes the model defines,
+// so they never skip any rule.
+func WithSkippedRules(ctx context.Context, fn func(PolicyViolation)) context.Context {
+	return context.WithValue(ctx, skippedRulesKey{}, fn)
+}
+
+// skippedRules returns the function set with WithSkippedRules, or nil.
+func skippedRules(ctx context.Context) func(PolicyViolation) {
+	fn, _ := ctx.Value(skippedRulesKey{}).(func(PolicyViolation))
+	return fn
+}
+
+// loadRule adds line, stored under key, to the model as loadPolicyLine does,
+// and handles it as Config.UnknownPType says if the model doesn't define its
+// ptype.
+func (a *Adapter) loadRule(ctx context.Context, model model.Model, key *datastore.Key, line CasbinRule) error {
+	if loadPolicyLine(line, model, a.now()) {
+		return nil
+	}
+	return a.unknownRule(ctx, key, line)
+}
+
+// unknownRule handles line, stored under key, whose ptype the model doesn't
+// define, as Config.UnknownPType says.
+func (a *Adapter) unknownRule(ctx context.Context, key *datastore.Key, line CasbinRule) error {
+	err := &UnknownPTypeError{Key: key, PolicyRule: newPolicyRule(line)}
+	switch a.unknownPType {
+	case UnknownPTypeFail:
+		return err
+	case UnknownPTypeWarn:
+		// The loads of CachedAdapter run outside of any operation.
+		if o := operationFromContext(ctx); o != nil {
+			o.warn(err)
+		} else if a.logger != nil {
+			a.logger.LogWarning(ctx, "LoadPolicy", err)
+		}
+	}
+	if fn := skippedRules(ctx); fn != nil {
+		fn(PolicyViolation{Key: key, PolicyRule: err.PolicyRule, Err: err})
+	}
+	if m := malformed(ctx); m != nil && key != nil {
+		stored, eerr := a.encodeRule(ctx, line)
+		if eerr != nil {
+			return eerr
+		}
+		m.add(key, stored, err)
+	}
+	return nil
+}
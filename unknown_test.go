@@ -0,0 +1,80 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/casbin/casbin/v2/model"
+)
+
+func TestUnknownPType(t *testing.T) {
+	logger := &recordingLogger{}
+	config := Config{Kind: "casbin_test_unknown_ptype", Namespace: "unittest", Logger: logger}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+	ctx := context.Background()
+
+	for _, ptype := range []string{"p2", "g2"} {
+		if err := a.AddPolicyCtx(ctx, ptype[:1], ptype, []string{"carol", "data3", "read"}); err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+	}
+	load := func(a *Adapter, ctx context.Context) (model.Model, error) {
+		m, err := model.NewModelFromFile("examples/rbac_model.conf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m, a.LoadPolicyCtx(ctx, m)
+	}
+
+	var skipped []PolicyViolation
+	m, err := load(a, WithSkippedRules(ctx, func(v PolicyViolation) { skipped = append(skipped, v) }))
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(m["p"]["p"].Policy) != 4 {
+		t.Errorf("got %v, wants the seed policy", m["p"]["p"].Policy)
+	}
+	if len(skipped) != 2 {
+		t.Fatalf("got %+v, wants 2 skipped rules", skipped)
+	}
+	for _, v := range skipped {
+		if v.Key == nil || !errors.Is(v.Err, ErrUnknownPType) || len(v.Rule) != 3 {
+			t.Errorf("got %+v, wants the key and the rule", v)
+		}
+	}
+	if len(logger.warnings) != 0 {
+		t.Errorf("got %v, wants no warning", logger.warnings)
+	}
+
+	config.UnknownPType = UnknownPTypeWarn
+	if _, err := load(NewAdapterWithConfig(getDatastore(), config), ctx); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(logger.warnings) != 2 {
+		t.Errorf("got %v, wants 2 warnings", logger.warnings)
+	}
+
+	config.UnknownPType = UnknownPTypeFail
+	_, err = load(NewAdapterWithConfig(getDatastore(), config), ctx)
+	var unknown *UnknownPTypeError
+	if !errors.As(err, &unknown) || !errors.Is(err, ErrUnknownPType) {
+		t.Fatalf("got %v, wants an UnknownPTypeError", err)
+	}
+	if unknown.Key == nil || unknown.PType != "p2" && unknown.PType != "g2" {
+		t.Errorf("got %+v, wants the key of the rule", unknown)
+	}
+}
+
+func TestLoadPolicyLineEmptyPType(t *testing.T) {
+	m, err := model.NewModelFromFile("examples/rbac_model.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// It used to panic.
+	LoadPolicyLine(NewCasbinRule("", []string{"alice", "data1", "read"}), m)
+	if len(m["p"]["p"].Policy) != 0 {
+		t.Errorf("got %v, wants no rule loaded", m["p"]["p"].Policy)
+	}
+}
@@ -0,0 +1,224 @@
+package datastoreadapter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+)
+
+// ListSubjects returns the subjects of the live rules, that is, their first
+// value, in order: the subjects of the p rules along with the users and the
+// roles granted a role by the g rules. See projectColumn for how they are
+// read.
+func (a *Adapter) ListSubjects(ctx context.Context) ([]string, error) {
+	var subjects []string
+	err := a.do(ctx, "ListSubjects", func(ctx context.Context) error {
+		var err error
+		subjects, err = a.projectColumn(ctx, 0, func(string) bool { return true })
+		return err
+	})
+	return subjects, err
+}
+
+// ListObjects returns the objects of the live p rules, that is, their second
+// value, in order. See projectColumn for how they are read.
+func (a *Adapter) ListObjects(ctx context.Context) ([]string, error) {
+	var objects []string
+	err := a.do(ctx, "ListObjects", func(ctx context.Context) error {
+		var err error
+		objects, err = a.projectColumn(ctx, 1, func(ptype string) bool {
+			return strings.HasPrefix(ptype, "p")
+		})
+		return err
+	})
+	return objects, err
+}
+
+// RulesForSubject returns the live rules of every ptype whose subject, their
+// first value, is sub, by ptype, e.g. to show what alice can do and which
+// roles alice is granted. It queries the rules of each ptype stored, which a
+// projection query lists, as LoadFilteredPolicy does.
+func (a *Adapter) RulesForSubject(ctx context.Context, sub string) ([]CasbinRule, error) {
+	var rules []CasbinRule
+	err := a.do(ctx, "RulesForSubject", func(ctx context.Context) error {
+		ptypes, err := a.storedPTypes(ctx)
+		if err != nil {
+			return err
+		}
+		value := sub
+		if value == "" {
+			value = MatchEmpty
+		}
+		now := a.now()
+		for _, ptype := range ptypes {
+			plans, err := a.filteredPlans(ctx, Filter{PType: ptype, FieldValues: []string{value}})
+			if err != nil {
+				return err
+			}
+			err = a.paginatePlans(ctx, plans, false, func(_ []*datastore.Key, page []CasbinRule) error {
+				for _, line := range page {
+					if !line.deleted() && !line.expired(now) {
+						rules = append(rules, line)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return rules, err
+}
+
+// DistinctValues returns the distinct values, in order, of the column-th
+// value of the live rules matching filter, e.g. the roles or the domains a
+// policy management UI offers to pick from. filter is either nil, for the
+// rules of every ptype, or a Filter or a *Filter as with LoadFilteredPolicy.
+// Only the indexed values, V0 to V5, can be listed, and empty values are
+// left out.
+//
+// The values are read with distinct projection queries, as with
+// projectColumn, unless filter is matched in memory, Config.Codecs is set or
+// column is filtered, in which case the matching rules are read whole.
+func (a *Adapter) DistinctValues(ctx context.Context, column int, filter interface{}) ([]string, error) {
+	var values []string
+	err := a.do(ctx, "DistinctValues", func(ctx context.Context) error {
+		if filter == nil {
+			var err error
+			values, err = a.projectColumn(ctx, column, func(string) bool { return true })
+			return err
+		}
+		f, err := toFilter(filter)
+		if err != nil {
+			return wrapError("DistinctValues", err)
+		}
+		values, err = a.filteredColumn(ctx, column, f)
+		return wrapError("DistinctValues", err)
+	})
+	return values, err
+}
+
+// filteredColumn returns the distinct values, in order, of the column-th
+// value of the live rules matching f, leaving out the empty ones.
+func (a *Adapter) filteredColumn(ctx context.Context, column int, f Filter) ([]string, error) {
+	if err := indexedColumn(column); err != nil {
+		return nil, err
+	}
+	plans, err := a.filteredPlans(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	// The properties filtered by equality can't be projected, and the values
+	// need the ptype, which the filter sets, to be decoded.
+	filtered := column >= f.FieldIndex && column < f.FieldIndex+len(f.FieldValues) &&
+		f.FieldValues[column-f.FieldIndex] != ""
+	project := len(a.codecs) == 0 && !filtered && !f.IgnoreCase
+
+	now := a.now()
+	seen := make(map[string]bool)
+	for _, plan := range plans {
+		if project && !plan.partial {
+			plan.query = plan.query.Project(a.projectedColumn(column)[1:]...).Distinct()
+		}
+		err := a.paginatePlan(ctx, plan, false, func(_ []*datastore.Key, page []CasbinRule) error {
+			for _, line := range page {
+				if value := *line.values()[column]; value != "" && !line.deleted() && !line.expired(now) {
+					seen[value] = true
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sortedKeys(seen), nil
+}
+
+// storedPTypes returns the ptypes of the stored rules, in order, with a
+// projection query on the ptype of every kind.
+func (a *Adapter) storedPTypes(ctx context.Context) ([]string, error) {
+	seen := make(map[string]bool)
+	for _, kind := range a.ruleKinds() {
+		query := a.kindQuery(kind).Project(a.property("p_type")).Distinct()
+		_, err := a.paginate(ctx, query, false, "", func(_ []*datastore.Key, page []CasbinRule) error {
+			for _, line := range page {
+				seen[line.PType] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sortedKeys(seen), nil
+}
+
+// projectColumn returns the distinct values, in order, of the column-th
+// value of the live rules of the ptypes keep selects, leaving out the empty
+// ones, which the rules with fewer values have. It runs a distinct
+// projection query on the ptype, the value and the times the rules expire
+// and were soft deleted, so that only one entity per combination of them is
+// read. Such a query needs the composite index of these properties, and
+// leaves out the rules stored without the times, by versions which didn't
+// store them, until they are rewritten.
+func (a *Adapter) projectColumn(ctx context.Context, column int, keep func(ptype string) bool) ([]string, error) {
+	if err := indexedColumn(column); err != nil {
+		return nil, err
+	}
+	now := a.now()
+	seen := make(map[string]bool)
+	for _, kind := range a.ruleKinds() {
+		query := a.kindQuery(kind).Project(a.projectedColumn(column)...).Distinct()
+		_, err := a.paginate(ctx, query, false, "", func(_ []*datastore.Key, page []CasbinRule) error {
+			for _, line := range page {
+				value := *line.values()[column]
+				if value == "" || line.deleted() || line.expired(now) || !keep(line.PType) {
+					continue
+				}
+				// Codecs may store a value in more than one way.
+				seen[value] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sortedKeys(seen), nil
+}
+
+// projectedColumn returns the properties projectColumn projects: the ptype,
+// the column-th value and the times the rules expire and were soft deleted.
+func (a *Adapter) projectedColumn(column int) []string {
+	return []string{
+		a.property("p_type"),
+		a.property(fmt.Sprintf("v%d", column)),
+		a.property("expires_at"),
+		a.property("deleted_at"),
+	}
+}
+
+// indexedColumn returns an error unless column is one of the indexed
+// values, V0 to V5.
+func indexedColumn(column int) error {
+	if column < 0 || column >= maxRuleFields {
+		return fmt.Errorf("%w: column %d is not indexed", ErrInvalidFilter, column)
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of set in order.
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
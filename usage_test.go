@@ -0,0 +1,94 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUsageQueries(t *testing.T) {
+	config := Config{Kind: "casbin_test_usage", Namespace: "unittest", SoftDelete: true}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+	ctx := context.Background()
+
+	// Neither removed nor expired rules count.
+	if err := a.AddPolicyCtx(ctx, "p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.RemovePolicyCtx(ctx, "p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.AddPolicyWithExpiry(ctx, "p", "p", []string{"dave", "data4", "read"}, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	subjects, err := a.ListSubjects(ctx)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if wants := []string{"alice", "bob", "data2_admin"}; !reflect.DeepEqual(subjects, wants) {
+		t.Errorf("got %v, wants %v", subjects, wants)
+	}
+	objects, err := a.ListObjects(ctx)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if wants := []string{"data1", "data2"}; !reflect.DeepEqual(objects, wants) {
+		t.Errorf("got %v, wants %v", objects, wants)
+	}
+
+	rules, err := a.RulesForSubject(ctx, "alice")
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	var got []string
+	for _, rule := range rules {
+		got = append(got, policyCSVLine(rule))
+	}
+	if wants := []string{"g, alice, data2_admin", "p, alice, data1, read"}; !reflect.DeepEqual(got, wants) {
+		t.Errorf("got %v, wants %v", got, wants)
+	}
+	if rules, err = a.RulesForSubject(ctx, "carol"); err != nil || len(rules) != 0 {
+		t.Errorf("got %v, %v, wants no rule", rules, err)
+	}
+}
+
+func TestDistinctValues(t *testing.T) {
+	config := Config{Kind: "casbin_test_distinct", Namespace: "unittest"}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+	ctx := context.Background()
+
+	tests := []struct {
+		column int
+		filter interface{}
+		wants  []string
+	}{
+		{0, nil, []string{"alice", "bob", "data2_admin"}},
+		{2, nil, []string{"read", "write"}},
+		{1, Filter{PType: "g"}, []string{"data2_admin"}},
+		{2, &Filter{PType: "p", FieldValues: []string{"data2_admin"}}, []string{"read", "write"}},
+		{1, Filter{PType: "p", FieldIndex: 1, FieldValues: []string{"data2"}}, []string{"data2"}},
+		{0, Filter{PType: "p", FieldIndex: 1, FieldValues: []string{"data"}, Prefix: true}, []string{"alice", "bob", "data2_admin"}},
+		{0, Filter{PType: "p", FieldValues: []string{"ALICE"}, IgnoreCase: true}, []string{"alice"}},
+	}
+	for _, tt := range tests {
+		values, err := a.DistinctValues(ctx, tt.column, tt.filter)
+		if err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+		if !reflect.DeepEqual(values, tt.wants) {
+			t.Errorf("column %d of %+v: got %v, wants %v", tt.column, tt.filter, values, tt.wants)
+		}
+	}
+
+	if _, err := a.DistinctValues(ctx, maxRuleFields, nil); !errors.Is(err, ErrInvalidFilter) {
+		t.Errorf("got %v, wants %v", err, ErrInvalidFilter)
+	}
+	if _, err := a.DistinctValues(ctx, 0, "p"); !errors.Is(err, ErrInvalidFilter) {
+		t.Errorf("got %v, wants %v", err, ErrInvalidFilter)
+	}
+}
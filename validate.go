@@ -0,0 +1,134 @@
+package datastoreadapter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2/model"
+)
+
+// PolicyViolation is a stored rule ValidatePolicies finds invalid.
+type PolicyViolation struct {
+	// Key is the key of the rule.
+	Key *datastore.Key
+	PolicyRule
+	// Err tells why the rule is invalid; it wraps ErrUnknownPType or
+	// ErrRuleArity, or is the error reading or decoding a malformed rule,
+	// whose values are then those stored.
+	Err error
+}
+
+// ValidatePolicies checks every stored rule against the stored model, see
+// SaveModel: its ptype must be defined in the model, and it must have as many
+// values as that definition has tokens. It returns the rules which fail
+// either check, which LoadPolicy would otherwise load into a model they don't
+// fit, along with the malformed ones: the entities which don't fit
+// CasbinRule, and those whose values Config.Codecs fail to decode. With
+// WithQuarantine, it also moves them to the quarantine kind.
+func (a *Adapter) ValidatePolicies(ctx context.Context) ([]PolicyViolation, error) {
+	var violations []PolicyViolation
+	err := a.do(ctx, "ValidatePolicies", func(ctx context.Context) error {
+		m, err := a.loadModel(ctx)
+		if err != nil {
+			return err
+		}
+		arity := modelArity(m)
+
+		invalid := &malformedRules{}
+		unreadable := &malformedRules{}
+		_, err = a.paginateRules(withMalformed(ctx, unreadable), false, "", func(keys []*datastore.Key, rules []CasbinRule) error {
+			for i, line := range rules {
+				if line.deleted() {
+					continue
+				}
+				if err := checkRule(arity, line.PType, ruleValues(line)); err != nil {
+					violations = append(violations, PolicyViolation{Key: keys[i], PolicyRule: newPolicyRule(line), Err: err})
+					stored, eerr := a.encodeRule(ctx, line)
+					if eerr != nil {
+						return eerr
+					}
+					invalid.add(keys[i], stored, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, r := range unreadable.rules {
+			violations = append(violations, PolicyViolation{Key: r.key, PolicyRule: newPolicyRule(r.stored), Err: r.err})
+			invalid.add(r.key, r.stored, r.err)
+		}
+		if !quarantining(ctx) {
+			return nil
+		}
+		return a.flushMalformed(ctx, invalid)
+	})
+	return violations, err
+}
+
+// checkRule returns an error if arity, as modelArity returns it, lacks ptype,
+// or if rule doesn't have as many values as its definition.
+func checkRule(arity map[string]int, ptype string, rule []string) error {
+	n, ok := arity[ptype]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownPType, ptype)
+	}
+	if len(rule) != n {
+		return fmt.Errorf("%w: %s has %d values, wants %d", ErrRuleArity, ptype, len(rule), n)
+	}
+	return nil
+}
+
+// modelArity returns the number of values of the rules of each ptype the
+// policy and role definitions of the model define: the number of tokens of a
+// policy definition, or of "_" of a role definition.
+func modelArity(m model.Model) map[string]int {
+	arity := make(map[string]int)
+	for _, sec := range []string{"p", "g"} {
+		for ptype, ast := range m[sec] {
+			if len(ast.Tokens) > 0 {
+				arity[ptype] = len(ast.Tokens)
+			} else {
+				arity[ptype] = len(strings.Split(ast.Value, ","))
+			}
+		}
+	}
+	return arity
+}
+
+// observeModel records the definitions of the model the adapter has loaded
+// or saved the policy of, for Config.StrictArity.
+func (a *Adapter) observeModel(m model.Model) {
+	if !a.strictArity {
+		return
+	}
+	arity := modelArity(m)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.arity = arity
+}
+
+// checkArity returns an error if Config.StrictArity is set and the rules of
+// lines, which are *CasbinRule, don't fit the model the adapter has last
+// loaded or saved the policy of.
+func (a *Adapter) checkArity(lines []interface{}) error {
+	if !a.strictArity {
+		return nil
+	}
+	a.mu.Lock()
+	arity := a.arity
+	a.mu.Unlock()
+	if arity == nil {
+		return nil
+	}
+	for _, line := range lines {
+		line := line.(*CasbinRule)
+		if err := checkRule(arity, line.PType, ruleValues(*line)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/casbin/casbin/v2/model"
+)
+
+func TestValidatePolicies(t *testing.T) {
+	config := Config{Kind: "casbin_test_validate", Namespace: "unittest"}
+	initPolicy(t, config)
+	db := getDatastore()
+	if err := SaveModelWithConfig(db, "examples/rbac_model.conf", config); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	a := NewAdapterWithConfig(db, config)
+	ctx := context.Background()
+
+	violations, err := a.ValidatePolicies(ctx)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(violations) != 0 {
+		t.Fatalf("got %+v, wants no violation", violations)
+	}
+
+	invalid := []struct {
+		ptype string
+		rule  []string
+		err   error
+	}{
+		{"p2", []string{"alice", "data1", "read"}, ErrUnknownPType},
+		{"p", []string{"alice", "data1"}, ErrRuleArity},
+		{"g", []string{"alice", "admin", "domain1"}, ErrRuleArity},
+	}
+	for _, r := range invalid {
+		if err := a.AddPolicyCtx(ctx, r.ptype[:1], r.ptype, r.rule); err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+	}
+
+	violations, err = a.ValidatePolicies(ctx)
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(violations) != len(invalid) {
+		t.Fatalf("got %+v, wants %d violations", violations, len(invalid))
+	}
+	for _, r := range invalid {
+		found := false
+		for _, v := range violations {
+			if v.PType == r.ptype && len(v.Rule) == len(r.rule) && v.Key != nil {
+				found = true
+				if !errors.Is(v.Err, r.err) {
+					t.Errorf("got %v, wants %v", v.Err, r.err)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("got %+v, wants a violation of %s %v", violations, r.ptype, r.rule)
+		}
+	}
+
+	violations, err = a.ValidatePolicies(WithQuarantine(WithActor(ctx, "alice")))
+	if err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(violations) != len(invalid) {
+		t.Fatalf("got %+v, wants %d violations", violations, len(invalid))
+	}
+	if violations, _ = a.ValidatePolicies(ctx); len(violations) != 0 {
+		t.Errorf("got %+v, wants the invalid rules quarantined", violations)
+	}
+	m, err := model.NewModelFromFile("examples/rbac_model.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.LoadPolicyCtx(ctx, m); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(m["p"]["p"].Policy) != 4 || len(m["g"]["g"].Policy) != 1 {
+		t.Errorf("got %v and %v, wants the seed policy", m["p"]["p"].Policy, m["g"]["g"].Policy)
+	}
+
+	var quarantined []QuarantinedRule
+	query := datastore.NewQuery(config.Kind + "_quarantine").Namespace(config.Namespace)
+	if _, err := db.GetAll(ctx, query, &quarantined); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if len(quarantined) != len(invalid) {
+		t.Fatalf("got %+v, wants %d quarantined rules", quarantined, len(invalid))
+	}
+	for _, q := range quarantined {
+		if q.Key == nil || q.Reason == "" || q.Actor != "alice" || q.PType == "" || len(q.Rule) == 0 {
+			t.Errorf("got %+v, wants the key, the rule and the reason", q)
+		}
+	}
+}
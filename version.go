@@ -0,0 +1,256 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// policyVersionName is the key name of the entity holding the policy version.
+const policyVersionName = "policy_version"
+
+// maxRuleMutations is the number of rule mutations a transaction can hold
+// besides the policy version update and the audit entry.
+const maxRuleMutations = maxTxnMutations - 2
+
+// policyVersion is the entity holding the generation counter of the policy.
+// It belongs to the same entity group as the rules and is incremented in the
+// same transaction as every mutation of them.
+type policyVersion struct {
+	Version int64 `datastore:"version,noindex"`
+	// HardDeletedAt is the last time rules were about to be deleted for good
+	// rather than soft deleted, before which LoadPolicyAt can't reconstruct
+	// the policy.
+	HardDeletedAt time.Time `datastore:"hard_deleted_at,noindex"`
+}
+
+func (a *Adapter) policyVersionKey() *datastore.Key {
+	key := datastore.NameKey(a.kind, policyVersionName, a.pseudoRootKey())
+	key.Namespace = a.namespace
+	return key
+}
+
+// GetPolicyVersion returns the policy version, which is incremented on every
+// mutation of the stored rules. It is a cheap way to detect policy changes
+// without scanning the rules. It returns 0 if the policy has never been
+// mutated.
+func (a *Adapter) GetPolicyVersion(ctx context.Context) (int64, error) {
+	var version int64
+	err := a.do(ctx, "GetPolicyVersion", func(ctx context.Context) error {
+		var err error
+		version, err = a.readVersion(ctx)
+		return err
+	})
+	return version, err
+}
+
+// readVersion is the same as GetPolicyVersion but doesn't wrap errors.
+func (a *Adapter) readVersion(ctx context.Context) (int64, error) {
+	var v policyVersion
+	var err error
+	if tx := readTransaction(ctx); tx != nil {
+		err = tx.Get(a.policyVersionKey(), &v)
+	} else {
+		err = a.db.Get(ctx, a.policyVersionKey(), &v)
+	}
+	if err != nil && err != datastore.ErrNoSuchEntity {
+		return 0, err
+	}
+	if a.blueGreen {
+		if err := a.readSlot(ctx); err != nil {
+			return 0, err
+		}
+	}
+	return v.Version, nil
+}
+
+// observeVersion records the policy version the model loaded by the adapter
+// reflects.
+func (a *Adapter) observeVersion(version int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.version = version
+	a.versionKnown = true
+}
+
+// observedVersion returns the policy version recorded by observeVersion.
+func (a *Adapter) observedVersion() (int64, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.version, a.versionKnown
+}
+
+// errUnchanged is returned by a mutate callback which has nothing to write.
+// The transaction is rolled back and mutate reports success.
+var errUnchanged = errors.New("unchanged")
+
+// mutate runs f, which writes n entities, in a transaction which also
+// increments the policy version and writes the pending audit entry of the
+// operation, if any.
+//
+// If cas is true and the adapter knows the policy version its model reflects,
+// the transaction fails with ErrConflict when the stored version differs, that
+// is, when another writer has modified the policy since.
+func (a *Adapter) mutate(ctx context.Context, cas bool, n int, f func(tx *datastore.Transaction) error) error {
+	expected, known := a.observedVersion()
+	op := operationFromContext(ctx)
+
+	release, err := a.limiter.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	var from int64
+	attempts := 0
+	_, err = a.db.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		if attempts++; attempts > 1 {
+			op.retry()
+		}
+
+		var v policyVersion
+		key := a.policyVersionKey()
+		if err := tx.Get(key, &v); err != nil && err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		if cas && known && v.Version != expected {
+			return ErrConflict
+		}
+		if a.blueGreen {
+			if err := a.checkSlot(tx); err != nil {
+				return err
+			}
+		}
+
+		if err := f(tx); err != nil {
+			return err
+		}
+
+		if op != nil && op.pendingAudit != nil {
+			if _, err := tx.Put(a.newAuditKey(), op.pendingAudit); err != nil {
+				return err
+			}
+		}
+
+		from = v.Version
+		v.Version++
+		_, err := tx.Put(key, &v)
+		return err
+	})
+	if err == errUnchanged {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	op.wrote(n)
+	if op != nil {
+		op.pendingAudit = nil
+		op.committed = true
+	}
+
+	// The model still reflects the policy if it did so before this mutation.
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.versionKnown && a.version == from {
+		a.version = from + 1
+	}
+	return nil
+}
+
+// putRules writes lines in transactions of up to maxRuleMutations rules, or
+// fewer along with their reverse index entries, extending the lease of lock,
+// if not nil, before each of them.
+func (a *Adapter) putRules(ctx context.Context, cas bool, lines []interface{}, lock *Lock) error {
+	if err := a.checkArity(lines); err != nil {
+		return err
+	}
+	if record := dryRun(ctx); record != nil {
+		recordPuts(record, lines)
+		return nil
+	}
+
+	plain := lines
+	lines, err := a.encodeRules(ctx, lines)
+	if err != nil {
+		return err
+	}
+	op := operationFromContext(ctx)
+	op.expect(PhaseWriting, len(lines))
+	batch := maxRuleMutations / a.ruleWrites()
+	for start := 0; start < len(lines); start += batch {
+		if err := lock.extend(ctx); err != nil {
+			return writeError(plain, start, err)
+		}
+
+		end := start + batch
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		keys := make([]*datastore.Key, end-start)
+		for i := range keys {
+			keys[i] = a.newRuleKey(lines[start+i].(*CasbinRule))
+		}
+		keys, entities, err := a.indexedEntities(ctx, keys, lines[start:end])
+		if err != nil {
+			return writeError(plain, start, err)
+		}
+		err = a.mutate(ctx, cas, end-start, func(tx *datastore.Transaction) error {
+			_, err := tx.PutMulti(keys, entities)
+			return err
+		})
+		if err != nil {
+			return writeError(plain, start, err)
+		}
+		for _, line := range plain[start:end] {
+			a.recordAdded(ctx, line.(*CasbinRule))
+		}
+		op.advance(PhaseWriting, end-start)
+	}
+	return nil
+}
+
+// deleteRules deletes keys in transactions of up to maxRuleMutations keys.
+// A failed transaction doesn't stop the others, unless abortsBatches says so,
+// and the errors of all of them are reported as a MultiError.
+func (a *Adapter) deleteRules(ctx context.Context, cas bool, keys []*datastore.Key) error {
+	if record := dryRun(ctx); record != nil {
+		recordDeletes(record, MutationDelete, keys)
+		return nil
+	}
+	if err := a.markHardDelete(ctx); err != nil {
+		return err
+	}
+
+	var failed MultiError
+	op := operationFromContext(ctx)
+	op.expect(PhaseDeleting, len(keys))
+	for start := 0; start < len(keys); start += maxRuleMutations {
+		end := start + maxRuleMutations
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		err := a.mutate(ctx, cas, end-start, func(tx *datastore.Transaction) error {
+			return tx.DeleteMulti(keys[start:end])
+		})
+		if err != nil {
+			failed.Errors = append(failed.Errors, err)
+			if abortsBatches(ctx, err) {
+				failed.Undeleted = append(failed.Undeleted, keys[start:]...)
+				break
+			}
+			failed.Undeleted = append(failed.Undeleted, keys[start:end]...)
+			continue
+		}
+		failed.Deleted = append(failed.Deleted, keys[start:end]...)
+		op.advance(PhaseDeleting, end-start)
+	}
+	if len(failed.Errors) > 0 {
+		return &failed
+	}
+	return nil
+}
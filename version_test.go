@@ -0,0 +1,108 @@
+package datastoreadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+)
+
+func TestPolicyVersion(t *testing.T) {
+	ctx := context.Background()
+	config := Config{Kind: "casbin_test_version", Namespace: "unittest"}
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	version := func() int64 {
+		v, err := a.GetPolicyVersion(ctx)
+		if err != nil {
+			t.Fatalf("got %v, wants no error", err)
+		}
+		return v
+	}
+
+	v0 := version()
+
+	e, _ := casbin.NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	if err := a.SavePolicy(e.GetModel()); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if v := version(); v != v0+1 {
+		t.Errorf("got version %d after SavePolicy, wants %d", v, v0+1)
+	}
+
+	if err := a.AddPolicy("p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if v := version(); v != v0+2 {
+		t.Errorf("got version %d after AddPolicy, wants %d", v, v0+2)
+	}
+
+	if err := a.RemovePolicy("p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if v := version(); v != v0+3 {
+		t.Errorf("got version %d after RemovePolicy, wants %d", v, v0+3)
+	}
+
+	// Removing nothing doesn't change the version.
+	if err := a.RemoveFilteredPolicy("p", "p", 0, "nobody"); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if v := version(); v != v0+3 {
+		t.Errorf("got version %d after a no-op RemoveFilteredPolicy, wants %d", v, v0+3)
+	}
+
+	// The version entity is not loaded as a rule.
+	e.ClearPolicy()
+	if err := a.LoadPolicy(e.GetModel()); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if n := len(e.GetPolicy()); n != 4 {
+		t.Errorf("got %d rules, wants 4", n)
+	}
+}
+
+func TestSavePolicyConflict(t *testing.T) {
+	config := Config{Kind: "casbin_test_conflict", Namespace: "unittest"}
+	initPolicy(t, config)
+
+	a := NewAdapterWithConfig(getDatastore(), config)
+	b := NewAdapterWithConfig(getDatastore(), config)
+	ea, _ := casbin.NewEnforcer("examples/rbac_model.conf", a)
+	eb, _ := casbin.NewEnforcer("examples/rbac_model.conf", b)
+
+	// a saves the policy first, so b's copy is stale.
+	ea.EnableAutoSave(false)
+	ea.AddPolicy("carol", "data3", "read")
+	if err := ea.SavePolicy(); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	eb.RemovePolicy("alice", "data1", "read")
+	if err := eb.SavePolicy(); !errors.Is(err, ErrConflict) {
+		t.Fatalf("got %v, wants ErrConflict", err)
+	}
+
+	// Once reloaded, b can save again.
+	if err := eb.LoadPolicy(); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := eb.SavePolicy(); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	// Single rule mutations don't conflict and keep the adapter up to date.
+	if _, err := eb.AddPolicy("dave", "data4", "read"); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := eb.SavePolicy(); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	// An adapter which has not loaded the policy saves unconditionally.
+	c := NewAdapterWithConfig(getDatastore(), config)
+	if err := c.SavePolicy(ea.GetModel()); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+}
@@ -0,0 +1,145 @@
+package datastoreadapter
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/casbin/casbin/v2/persist"
+)
+
+// PollingWatcher notifies enforcers of the changes to the stored rules by
+// polling the policy version, which every mutation increments, so that it
+// needs nothing but datastore. The callback is only called when the version
+// has changed since the previous poll:
+//
+//	w := datastoreadapter.NewPollingWatcher(ctx, a, 10*time.Second)
+//	defer w.Close()
+//	e.SetWatcher(w)
+//
+// A failed poll is reported to Config.Logger and Config.Metrics like any
+// other operation and retried at the next one.
+type PollingWatcher struct {
+	adapter  *Adapter
+	interval time.Duration
+	jitter   time.Duration
+	cancel   context.CancelFunc
+	done     chan struct{}
+
+	mu       sync.Mutex
+	callback func(string)
+}
+
+var _ persist.Watcher = (*PollingWatcher)(nil)
+
+// PollingWatcherConfig is the configuration of PollingWatcher.
+type PollingWatcherConfig struct {
+	// How often the policy version is polled.
+	// Optional. (Default: 10 seconds)
+	Interval time.Duration
+	// Maximum random deviation from Interval of each wait, so that the
+	// instances started together don't poll together.
+	// Optional. (Default: Interval / 10)
+	Jitter time.Duration
+}
+
+// defaultPollInterval is the default PollingWatcherConfig.Interval.
+const defaultPollInterval = 10 * time.Second
+
+// NewPollingWatcher is the constructor for PollingWatcher. It polls until
+// ctx is done or Close is called.
+func NewPollingWatcher(ctx context.Context, a *Adapter, interval time.Duration) *PollingWatcher {
+	return NewPollingWatcherWithConfig(ctx, a, PollingWatcherConfig{Interval: interval})
+}
+
+// NewPollingWatcherWithConfig is the constructor for PollingWatcher.
+func NewPollingWatcherWithConfig(ctx context.Context, a *Adapter, config PollingWatcherConfig) *PollingWatcher {
+	interval := config.Interval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	jitter := config.Jitter
+	if jitter == 0 {
+		jitter = interval / 10
+	}
+	if jitter > interval {
+		jitter = interval
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	w := &PollingWatcher{
+		adapter:  a,
+		interval: interval,
+		jitter:   jitter,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go w.poll(ctx)
+	return w
+}
+
+func (w *PollingWatcher) poll(ctx context.Context) {
+	defer close(w.done)
+	var last int64
+	known := false
+	for {
+		var version int64
+		err := w.adapter.do(ctx, "PollPolicyVersion", func(ctx context.Context) error {
+			var err error
+			version, err = w.adapter.readVersion(ctx)
+			return err
+		})
+		if err == nil {
+			if known && version != last {
+				w.notify()
+			}
+			last, known = version, true
+		}
+
+		timer := time.NewTimer(w.wait())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// wait returns the interval deviated by up to the jitter either way.
+func (w *PollingWatcher) wait() time.Duration {
+	if w.jitter <= 0 {
+		return w.interval
+	}
+	return w.interval - w.jitter + time.Duration(rand.Int63n(int64(2*w.jitter)+1))
+}
+
+func (w *PollingWatcher) notify() {
+	w.mu.Lock()
+	callback := w.callback
+	w.mu.Unlock()
+	if callback != nil {
+		callback("")
+	}
+}
+
+// SetUpdateCallback sets the func called on the changes to the rules.
+func (w *PollingWatcher) SetUpdateCallback(callback func(string)) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.callback = callback
+	return nil
+}
+
+// Update does nothing: every mutation increments the policy version the
+// other instances poll.
+func (w *PollingWatcher) Update() error {
+	return nil
+}
+
+// Close stops polling and waits for the poller to return.
+func (w *PollingWatcher) Close() {
+	w.cancel()
+	<-w.done
+}
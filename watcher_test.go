@@ -0,0 +1,39 @@
+package datastoreadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPollingWatcher(t *testing.T) {
+	config := Config{Kind: "casbin_test_watcher", Namespace: "unittest"}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+
+	w := NewPollingWatcherWithConfig(context.Background(), a, PollingWatcherConfig{Interval: 20 * time.Millisecond})
+	defer w.Close()
+	updated := make(chan struct{}, 10)
+	if err := w.SetUpdateCallback(func(string) { updated <- struct{}{} }); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+
+	// Polls which find the same version don't call the callback.
+	time.Sleep(100 * time.Millisecond)
+	if len(updated) != 0 {
+		t.Fatalf("got %d updates, wants none", len(updated))
+	}
+
+	if err := a.AddPolicy("p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	select {
+	case <-updated:
+	case <-time.After(2 * time.Second):
+		t.Fatal("got no update, wants one")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if len(updated) != 0 {
+		t.Errorf("got %d more updates, wants none", len(updated))
+	}
+}
@@ -0,0 +1,182 @@
+package datastoreadapter
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WebhookSignatureHeader is the header WebhookNotifier signs its requests
+// with, as "sha256=" followed by the hex encoded HMAC-SHA256 of the body
+// keyed with WebhookConfig.Secret.
+const WebhookSignatureHeader = "X-Casbin-Signature"
+
+const (
+	defaultWebhookRetries   = 3
+	defaultWebhookBackoff   = time.Second
+	defaultWebhookQueueSize = 100
+)
+
+// ErrWebhookQueueFull is reported to Config.Logger when an event is dropped
+// because the queue of WebhookNotifier is full.
+var ErrWebhookQueueFull = errors.New("webhook queue full")
+
+// WebhookConfig is the configuration of WebhookNotifier.
+type WebhookConfig struct {
+	// URL the events are posted to.
+	URL string
+	// Secret the requests are signed with; see WebhookSignatureHeader.
+	// Optional. (Default: empty, requests are not signed)
+	Secret []byte
+	// Client the requests are made with.
+	// Optional. (Default: a client with a timeout of 10 seconds)
+	Client *http.Client
+	// Number of times a failed request is retried, waiting Backoff, then
+	// twice as long and so on in between.
+	// Optional. (Default: 3)
+	Retries int
+	// Optional. (Default: 1 second)
+	Backoff time.Duration
+	// Number of events waiting to be posted above which events are dropped.
+	// Optional. (Default: 100)
+	QueueSize int
+	// Function called with the events which could not be posted, along with
+	// the error of the last attempt.
+	// Optional. (Default: nil)
+	OnError func(PolicyEvent, error)
+}
+
+// WebhookNotifier is a Notifier which posts the events as JSON to a URL, e.g.
+// of a SIEM or a chat bot, signing them with HMAC-SHA256. The events are
+// posted one at a time, in order, by a background goroutine, so that a slow
+// endpoint doesn't delay the operations; those which fail after the retries
+// are reported to WebhookConfig.OnError.
+//
+//	w := datastoreadapter.NewWebhookNotifier(datastoreadapter.WebhookConfig{URL: url, Secret: secret})
+//	defer w.Close()
+//	a := datastoreadapter.NewAdapterWithConfig(db, datastoreadapter.Config{Notifiers: []datastoreadapter.Notifier{w}})
+type WebhookNotifier struct {
+	config WebhookConfig
+	events chan PolicyEvent
+	done   chan struct{}
+
+	// mu guards closed, which is set once events is closed.
+	mu     sync.Mutex
+	closed bool
+}
+
+var _ Notifier = (*WebhookNotifier)(nil)
+
+// NewWebhookNotifier is the constructor for WebhookNotifier. It starts the
+// goroutine posting the events, which runs until Close is called.
+func NewWebhookNotifier(config WebhookConfig) *WebhookNotifier {
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if config.Retries <= 0 {
+		config.Retries = defaultWebhookRetries
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = defaultWebhookBackoff
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaultWebhookQueueSize
+	}
+	w := &WebhookNotifier{
+		config: config,
+		events: make(chan PolicyEvent, config.QueueSize),
+		done:   make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Notify queues event to be posted. It fails with ErrWebhookQueueFull if
+// the queue is full.
+func (w *WebhookNotifier) Notify(ctx context.Context, event PolicyEvent) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	select {
+	case w.events <- event:
+		return nil
+	default:
+		return ErrWebhookQueueFull
+	}
+}
+
+// Close posts the queued events and stops the goroutine posting them. The
+// events notified afterwards are dropped.
+func (w *WebhookNotifier) Close() {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.events)
+	}
+	w.mu.Unlock()
+	<-w.done
+}
+
+func (w *WebhookNotifier) run() {
+	defer close(w.done)
+	for event := range w.events {
+		if err := w.post(event); err != nil && w.config.OnError != nil {
+			w.config.OnError(event, err)
+		}
+	}
+}
+
+// post posts event, retrying as configured.
+func (w *WebhookNotifier) post(event PolicyEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	backoff := w.config.Backoff
+	for attempt := 0; ; attempt++ {
+		err = w.postOnce(body)
+		if err == nil || attempt == w.config.Retries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (w *WebhookNotifier) postOnce(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(w.config.Secret) > 0 {
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(w.config.Secret, body))
+	}
+	resp, err := w.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook: %s", resp.Status)
+	}
+	return nil
+}
+
+// SignWebhook returns the value of WebhookSignatureHeader for body signed
+// with secret, for the receivers to check the requests against.
+func SignWebhook(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
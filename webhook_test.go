@@ -0,0 +1,78 @@
+package datastoreadapter
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	secret := []byte("secret")
+	var mu sync.Mutex
+	var events []PolicyEvent
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		// Fail the first attempt, to be retried.
+		if attempts++; attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get(WebhookSignatureHeader) != SignWebhook(secret, body) {
+			t.Errorf("got signature %q, wants %q", r.Header.Get(WebhookSignatureHeader), SignWebhook(secret, body))
+		}
+		var event PolicyEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("got %v, wants no error", err)
+		}
+		events = append(events, event)
+	}))
+	defer server.Close()
+
+	w := NewWebhookNotifier(WebhookConfig{URL: server.URL, Secret: secret, Backoff: time.Millisecond})
+	config := Config{Kind: "casbin_test_webhook", Namespace: "unittest", Notifiers: []Notifier{w}}
+	initPolicy(t, config)
+	a := NewAdapterWithConfig(getDatastore(), config)
+	ctx := WithActor(context.Background(), "alice")
+
+	if err := a.AddPolicyCtx(ctx, "p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	// Removing a rule which isn't stored modifies nothing, and loading
+	// doesn't either.
+	if err := a.RemovePolicyCtx(ctx, "p", "p", []string{"dave", "data3", "read"}); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	if err := a.RemoveFilteredPolicyCtx(ctx, "p", "p", 0, "carol"); err != nil {
+		t.Fatalf("got %v, wants no error", err)
+	}
+	w.Close()
+	mu.Lock()
+	defer mu.Unlock()
+
+	wants := []PolicyEvent{
+		// The SavePolicy of initPolicy.
+		{Op: "SavePolicy"},
+		{Op: "AddPolicy", PType: "p", Rule: []string{"carol", "data3", "read"}, Actor: "alice"},
+		{Op: "RemoveFilteredPolicy", PType: "p", Rule: []string{"carol"}, Actor: "alice"},
+	}
+	if len(events) != len(wants) {
+		t.Fatalf("got %+v, wants %d events", events, len(wants))
+	}
+	for i, e := range events {
+		want := wants[i]
+		if e.Op != want.Op || e.PType != want.PType || len(e.Rule) != len(want.Rule) || e.Actor != want.Actor || e.Kind != config.Kind || e.Namespace != config.Namespace {
+			t.Errorf("got %+v, wants %+v", e, want)
+		}
+	}
+	if err := w.Notify(ctx, PolicyEvent{}); err != nil {
+		t.Errorf("got %v, wants events dropped once closed", err)
+	}
+}